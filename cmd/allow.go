@@ -3,6 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/bernd/vibepit/config"
 	"github.com/bernd/vibepit/proxy"
@@ -14,24 +19,35 @@ func AllowHTTPCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "allow-http",
 		Usage:     "Add entries to the proxy HTTP allowlist",
-		ArgsUsage: "<domain:port-pattern>...",
+		ArgsUsage: "<[scheme://]domain[:port]-pattern>... | -",
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name:  "no-save",
 				Usage: "Skip persisting to project config",
 			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show what would be allowed and saved without changing anything",
+			},
+			&cli.StringFlag{
+				Name:  "from-file",
+				Usage: "Read entries from this file, one per line (- for stdin)",
+			},
 			sessionFlag,
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			entries := cmd.Args().Slice()
-			if len(entries) == 0 {
+			if cmd.String("from-file") != "" || slices.Contains(cmd.Args().Slice(), "-") {
+				return allowHTTPBatchAction(ctx, cmd)
+			}
+			if cmd.Args().Len() == 0 {
 				return cli.ShowSubcommandHelp(cmd)
 			}
-			if err := proxy.ValidateHTTPEntries(entries); err != nil {
+			entries, err := proxy.NormalizeHTTPEntries(cmd.Args().Slice())
+			if err != nil {
 				return err
 			}
 
-			session, err := discoverSession(ctx, cmd.String("session"))
+			session, err := discoverSession(ctx, cmd, cmd.String("session"))
 			if err != nil {
 				return fmt.Errorf("cannot find running proxy: %w", err)
 			}
@@ -41,6 +57,10 @@ func AllowHTTPCommand() *cli.Command {
 				return err
 			}
 
+			if cmd.Bool("dry-run") {
+				return previewAllow(client, "allow-http", entries, session.ProjectDir, !cmd.Bool("no-save"))
+			}
+
 			added, err := client.AllowHTTP(entries)
 			if err != nil {
 				return err
@@ -75,6 +95,10 @@ func AllowDNSCommand() *cli.Command {
 				Name:  "no-save",
 				Usage: "Skip persisting to project config",
 			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show what would be allowed and saved without changing anything",
+			},
 			sessionFlag,
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
@@ -86,7 +110,7 @@ func AllowDNSCommand() *cli.Command {
 				return err
 			}
 
-			session, err := discoverSession(ctx, cmd.String("session"))
+			session, err := discoverSession(ctx, cmd, cmd.String("session"))
 			if err != nil {
 				return fmt.Errorf("cannot find running proxy: %w", err)
 			}
@@ -96,6 +120,10 @@ func AllowDNSCommand() *cli.Command {
 				return err
 			}
 
+			if cmd.Bool("dry-run") {
+				return previewAllow(client, "allow-dns", entries, session.ProjectDir, !cmd.Bool("no-save"))
+			}
+
 			added, err := client.AllowDNS(entries)
 			if err != nil {
 				return err
@@ -119,3 +147,281 @@ func AllowDNSCommand() *cli.Command {
 		},
 	}
 }
+
+// allowPlan is what an allow-http or allow-dns call would change.
+type allowPlan struct {
+	Existing []string // already in the live allowlist or covered by one of its entries
+	Added    []string // would be added to the live allowlist
+	Saved    []string // would be appended to the project config
+	Denied   []string // refused because a deny rule of the session covers them
+}
+
+// planAllow sorts the allow-http or allow-dns entries of section into an
+// allowPlan. live holds the entries the proxy enforces, saved the entries of
+// the project config section and deny the matching deny rules. A plain entry
+// counts as existing when a live entry already allows it; a pattern only when
+// the same entry is live.
+func planAllow(section string, entries, live, saved, deny []string) (allowPlan, error) {
+	var allows, denied func(entry string) bool
+	switch section {
+	case "allow-http":
+		al, err := proxy.NewHTTPAllowlist(live)
+		if err != nil {
+			return allowPlan{}, err
+		}
+		dl, err := proxy.NewHTTPAllowlist(deny)
+		if err != nil {
+			return allowPlan{}, err
+		}
+		allows = func(entry string) bool {
+			host, port, err := net.SplitHostPort(entry)
+			return err == nil && !isDomainPattern(host) && port != "*" && al.Allows(host, port)
+		}
+		denied = func(entry string) bool {
+			_, ok := dl.MatchEntry(entry)
+			return ok
+		}
+	case "allow-dns":
+		al, err := proxy.NewDNSAllowlist(live)
+		if err != nil {
+			return allowPlan{}, err
+		}
+		dl, err := proxy.NewDNSAllowlist(deny)
+		if err != nil {
+			return allowPlan{}, err
+		}
+		allows = func(entry string) bool {
+			return !isDomainPattern(entry) && al.Allows(entry)
+		}
+		denied = dl.Allows
+	default:
+		return allowPlan{}, fmt.Errorf("unknown config section %q", section)
+	}
+
+	var plan allowPlan
+	for _, e := range entries {
+		if denied(e) {
+			plan.Denied = append(plan.Denied, e)
+			continue
+		}
+		if slices.Contains(live, e) || allows(e) {
+			plan.Existing = append(plan.Existing, e)
+		} else {
+			plan.Added = append(plan.Added, e)
+		}
+		if !slices.Contains(saved, e) && !slices.Contains(plan.Saved, e) {
+			plan.Saved = append(plan.Saved, e)
+		}
+	}
+	return plan, nil
+}
+
+// isDomainPattern reports whether domain is a wildcard or leading-dot pattern
+// rather than a single host.
+func isDomainPattern(domain string) bool {
+	return strings.Contains(domain, "*") || strings.HasPrefix(domain, ".")
+}
+
+// sessionAllowPlan plans an allow-http or allow-dns call against the live
+// config of the session and the project config of projectDir. It also returns
+// the live config, for the entry sources.
+func sessionAllowPlan(client *ControlClient, section string, entries []string, projectDir string) (allowPlan, *config.MergedConfig, error) {
+	live, err := client.ConfigWithSources()
+	if err != nil {
+		return allowPlan{}, nil, err
+	}
+	cfg, err := config.Load("", config.DefaultProjectPath(projectDir))
+	if err != nil {
+		return allowPlan{}, nil, fmt.Errorf("config: %w", err)
+	}
+
+	liveEntries, savedEntries, denyEntries := live.AllowHTTP, cfg.Project.AllowHTTP, live.DenyHTTP
+	if section == "allow-dns" {
+		liveEntries, savedEntries, denyEntries = live.AllowDNS, cfg.Project.AllowDNS, live.DenyDNS
+	}
+	plan, err := planAllow(section, entries, liveEntries, savedEntries, denyEntries)
+	if err != nil {
+		return allowPlan{}, nil, err
+	}
+	return plan, live, nil
+}
+
+// printAllowPlanSkipped prints the entries of plan that are denied or
+// already allowed.
+func printAllowPlanSkipped(plan allowPlan, sources map[string]string) {
+	for _, e := range plan.Denied {
+		tui.Status("Denied", "%s is in the deny list", e)
+	}
+	for _, e := range plan.Existing {
+		if source := sources[e]; source != "" {
+			tui.Status("Exists", "%s is already allowed (%s)", e, source)
+			continue
+		}
+		tui.Status("Exists", "%s is already allowed", e)
+	}
+}
+
+// previewAllow prints what allow-http or allow-dns would change in the live
+// allowlist of the session and, when save is set, in the project config,
+// without changing either.
+func previewAllow(client *ControlClient, section string, entries []string, projectDir string, save bool) error {
+	plan, live, err := sessionAllowPlan(client, section, entries, projectDir)
+	if err != nil {
+		return err
+	}
+	projectPath := config.DefaultProjectPath(projectDir)
+
+	printAllowPlanSkipped(plan, live.EntrySources)
+	for _, e := range plan.Added {
+		tui.Status("Would allow", "%s", e)
+	}
+	if save {
+		for _, e := range plan.Saved {
+			tui.Status("Would save", "%s to %s", e, projectPath)
+		}
+	}
+	tui.Status("Dry run", "nothing was changed")
+	return nil
+}
+
+// allowHTTPBatchAction runs allow-http on the entries read from --from-file
+// or from stdin for a "-" argument, plus the other arguments. Unlike a plain
+// allow-http call, invalid entries don't stop the others: they are reported,
+// the valid ones are applied, and the command fails at the end.
+func allowHTTPBatchAction(ctx context.Context, cmd *cli.Command) error {
+	raw, err := batchAllowEntries(cmd.Args().Slice(), cmd.String("from-file"), os.Stdin)
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return fmt.Errorf("no entries to allow")
+	}
+	entries, invalid := normalizeHTTPBatch(raw)
+	for _, err := range invalid {
+		tui.Status("Invalid", "%v", err)
+	}
+
+	if len(entries) > 0 {
+		session, err := discoverSession(ctx, cmd, cmd.String("session"))
+		if err != nil {
+			return fmt.Errorf("cannot find running proxy: %w", err)
+		}
+		client, err := NewControlClient(session)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if cmd.Bool("dry-run") {
+			err = previewAllow(client, "allow-http", entries, session.ProjectDir, !cmd.Bool("no-save"))
+		} else {
+			err = allowHTTPBatch(client, entries, session.ProjectDir, !cmd.Bool("no-save"))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%d of %d entries are invalid", len(invalid), len(raw))
+	}
+	return nil
+}
+
+// batchAllowEntries returns the arguments with each "-" replaced by the
+// entries read from stdin, followed by the entries of fromFile, which is
+// stdin as well for "-". Stdin is read only once.
+func batchAllowEntries(args []string, fromFile string, stdin io.Reader) ([]string, error) {
+	var entries []string
+	stdinRead := false
+	readStdin := func() error {
+		if stdinRead {
+			return nil
+		}
+		stdinRead = true
+		lines, err := readAllowEntries(stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		entries = append(entries, lines...)
+		return nil
+	}
+
+	for _, arg := range args {
+		if arg != "-" {
+			entries = append(entries, arg)
+			continue
+		}
+		if err := readStdin(); err != nil {
+			return nil, err
+		}
+	}
+	switch fromFile {
+	case "":
+	case "-":
+		if err := readStdin(); err != nil {
+			return nil, err
+		}
+	default:
+		f, err := os.Open(fromFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		lines, err := readAllowEntries(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", fromFile, err)
+		}
+		entries = append(entries, lines...)
+	}
+	return entries, nil
+}
+
+// normalizeHTTPBatch normalizes each allow-http entry on its own and returns
+// the valid ones without duplicates, and an error for each invalid one.
+func normalizeHTTPBatch(raw []string) ([]string, []error) {
+	var entries []string
+	var invalid []error
+	for _, e := range raw {
+		n, err := proxy.NormalizeHTTPEntry(e)
+		if err != nil {
+			invalid = append(invalid, err)
+			continue
+		}
+		if !slices.Contains(entries, n) {
+			entries = append(entries, n)
+		}
+	}
+	return entries, invalid
+}
+
+// allowHTTPBatch allows the entries the session doesn't allow yet in a single
+// control API call, reports the ones it already allows or denies, and
+// appends the missing ones to the project config when save is set.
+func allowHTTPBatch(client *ControlClient, entries []string, projectDir string, save bool) error {
+	plan, live, err := sessionAllowPlan(client, "allow-http", entries, projectDir)
+	if err != nil {
+		return err
+	}
+	printAllowPlanSkipped(plan, live.EntrySources)
+
+	if len(plan.Added) > 0 {
+		added, err := client.AllowHTTP(plan.Added)
+		if err != nil {
+			return err
+		}
+		for _, e := range added {
+			tui.Status("Allowed", "%s", e)
+		}
+	}
+
+	if !save || len(plan.Saved) == 0 {
+		return nil
+	}
+	projectPath := config.DefaultProjectPath(projectDir)
+	if err := config.AppendAllowHTTP(projectPath, plan.Saved); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	tui.Status("Saved", "%d entries to %s", len(plan.Saved), projectPath)
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAllow(t *testing.T) {
+	t.Run("allow-http", func(t *testing.T) {
+		plan, err := planAllow("allow-http",
+			[]string{"github.com:443", "api.example.com:443", "*.example.com:443", "new.example.org:443"},
+			[]string{"github.com:443", "**.example.com:443"},
+			[]string{"github.com:443", "api.example.com:443"},
+			nil,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com:443", "api.example.com:443"}, plan.Existing)
+		assert.Equal(t, []string{"*.example.com:443", "new.example.org:443"}, plan.Added)
+		assert.Equal(t, []string{"*.example.com:443", "new.example.org:443"}, plan.Saved)
+	})
+
+	t.Run("allow-dns", func(t *testing.T) {
+		plan, err := planAllow("allow-dns",
+			[]string{"db.corp.example.com", ".corp.example.com", "svc.local"},
+			[]string{"*.corp.example.com"},
+			nil,
+			nil,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db.corp.example.com"}, plan.Existing)
+		assert.Equal(t, []string{".corp.example.com", "svc.local"}, plan.Added)
+		assert.Equal(t, []string{"db.corp.example.com", ".corp.example.com", "svc.local"}, plan.Saved)
+	})
+
+	t.Run("denied entries are neither added nor saved", func(t *testing.T) {
+		plan, err := planAllow("allow-http",
+			[]string{"pastebin.com:443", "github.com:443"},
+			nil,
+			nil,
+			[]string{"pastebin.com:*"},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pastebin.com:443"}, plan.Denied)
+		assert.Equal(t, []string{"github.com:443"}, plan.Added)
+		assert.Equal(t, []string{"github.com:443"}, plan.Saved)
+	})
+}
+
+func TestPreviewAllow(t *testing.T) {
+	httpAL, err := proxy.NewHTTPAllowlist([]string{"github.com:443"})
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	merged := config.MergedConfig{AllowHTTP: []string{"github.com:443"}}
+	client := testControlClient(t, proxy.NewControlAPI(proxy.NewLogBuffer(100), merged, httpAL, dnsAL))
+
+	dir := t.TempDir()
+	projectPath := config.DefaultProjectPath(dir)
+	require.NoError(t, os.MkdirAll(filepath.Dir(projectPath), 0o755))
+	content := []byte("allow-http:\n  - github.com:443\n")
+	require.NoError(t, os.WriteFile(projectPath, content, 0o644))
+
+	require.NoError(t, previewAllow(client, "allow-http", []string{"api.example.com:443"}, dir, true))
+
+	assert.False(t, httpAL.Allows("api.example.com", "443"), "the live allowlist is unchanged")
+	data, err := os.ReadFile(projectPath)
+	require.NoError(t, err)
+	assert.Equal(t, content, data, "the project config is unchanged")
+}
+
+func TestBatchAllowEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# registries\nregistry.npmjs.org:443\n\ncdn.example.com\n"), 0o644))
+
+	t.Run("reads stdin for -", func(t *testing.T) {
+		entries, err := batchAllowEntries([]string{"a.com:443", "-", "-"}, "", strings.NewReader("b.com:443\n  c.com  \n"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.com:443", "b.com:443", "c.com"}, entries)
+	})
+
+	t.Run("reads --from-file", func(t *testing.T) {
+		entries, err := batchAllowEntries([]string{"a.com:443"}, path, strings.NewReader("ignored.com\n"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.com:443", "registry.npmjs.org:443", "cdn.example.com"}, entries)
+	})
+
+	t.Run("reads stdin for --from-file -", func(t *testing.T) {
+		entries, err := batchAllowEntries(nil, "-", strings.NewReader("b.com:443\n"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.com:443"}, entries)
+	})
+
+	t.Run("fails on a missing file", func(t *testing.T) {
+		_, err := batchAllowEntries(nil, filepath.Join(t.TempDir(), "missing.txt"), nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestNormalizeHTTPBatch(t *testing.T) {
+	entries, invalid := normalizeHTTPBatch([]string{"a.com", "https://a.com", "ftp://b.com", "c.com:80", "bad domain:443"})
+	assert.Equal(t, []string{"a.com:443", "c.com:80"}, entries)
+	require.Len(t, invalid, 2)
+	assert.ErrorContains(t, invalid[0], `"ftp://b.com"`)
+	assert.ErrorContains(t, invalid[1], `"bad domain:443"`)
+}
+
+func TestAllowHTTPBatch(t *testing.T) {
+	httpAL, err := proxy.NewHTTPAllowlist([]string{"github.com:443"})
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	merged := config.MergedConfig{
+		AllowHTTP: []string{"github.com:443"},
+		DenyHTTP:  []string{"pastebin.com:*"},
+	}
+	client := testControlClient(t, proxy.NewControlAPI(proxy.NewLogBuffer(100), merged, httpAL, dnsAL))
+
+	dir := t.TempDir()
+	projectPath := config.DefaultProjectPath(dir)
+	require.NoError(t, os.MkdirAll(filepath.Dir(projectPath), 0o755))
+	require.NoError(t, os.WriteFile(projectPath, []byte("allow-http:\n  - github.com:443\n"), 0o644))
+
+	entries := []string{"github.com:443", "api.example.com:443", "pastebin.com:443", "cdn.example.com:443"}
+	require.NoError(t, allowHTTPBatch(client, entries, dir, true))
+
+	assert.Equal(t, []string{"github.com:443", "api.example.com:443", "cdn.example.com:443"}, httpAL.Entries())
+	cfg, err := config.Load("", projectPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"github.com:443", "api.example.com:443", "cdn.example.com:443"}, cfg.Project.AllowHTTP)
+
+	t.Run("without save", func(t *testing.T) {
+		require.NoError(t, allowHTTPBatch(client, []string{"other.example.com:443"}, dir, false))
+		assert.True(t, httpAL.Allows("other.example.com", "443"))
+		cfg, err := config.Load("", projectPath)
+		require.NoError(t, err)
+		assert.NotContains(t, cfg.Project.AllowHTTP, "other.example.com:443")
+	})
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
@@ -10,7 +11,7 @@ import (
 	"runtime"
 	"slices"
 	"strconv"
-	"time"
+	"strings"
 
 	embeddedproxy "github.com/bernd/vibepit/embed/proxy"
 	"github.com/rs/xid"
@@ -35,12 +36,28 @@ const (
 )
 
 const (
-	allowFlag       = "allow"
-	localFlag       = "local"
-	presetFlag      = "preset"
-	reconfigureFlag = "reconfigure"
+	allowFlag         = "allow"
+	allowPrivateFlag  = "allow-private-network"
+	certKeyTypeFlag   = "cert-key-type"
+	certLifetimeFlag  = "cert-lifetime"
+	cpusFlag          = "cpus"
+	envFlag           = "env"
+	envFileFlag       = "env-file"
+	localFlag         = "local"
+	memoryFlag        = "memory"
+	presetFlag        = "preset"
+	profileFlag       = "profile"
+	reconfigureFlag   = "reconfigure"
+	saveConfigFlag    = "save-effective-config"
+	sessionIDFileFlag = "session-id-file"
+	statusFormatFlag  = "status-format"
+	workDirFlag       = "workdir"
 )
 
+// publishedPlatforms lists the platforms the published sandbox image is built
+// for. Keep in sync with the platforms in .github/workflows/docker-publish.yml.
+var publishedPlatforms = []string{"linux/amd64", "linux/arm64"}
+
 func imageName(u *user.User) string {
 	return fmt.Sprintf("%s-uid-%s-gid-%s", defaultImagePrefix, u.Uid, u.Gid)
 }
@@ -54,6 +71,12 @@ type sessionInfra struct {
 	NetworkInfo      ctr.NetworkInfo
 	Merged           config.MergedConfig
 	ProxyContainerID string
+
+	SetupCommands     []string
+	SetupIgnoreErrors bool
+	CACerts           []byte
+	Resources         config.Resources
+	Env               []string
 }
 
 type infraOptions struct {
@@ -78,6 +101,25 @@ func resolveProjectRoot(cmd *cli.Command) (string, error) {
 	return config.FindProjectRoot(projectRoot)
 }
 
+// checkSessionLimit returns an error listing the running sessions when
+// starting another one would exceed the max-sessions limit. A limit of zero
+// means unlimited.
+func checkSessionLimit(running []ctr.ProxySession, maxSessions int) error {
+	if maxSessions < 0 {
+		return fmt.Errorf("config: max-sessions: must not be negative, got %d", maxSessions)
+	}
+	if maxSessions == 0 || len(running) < maxSessions {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "session limit reached: %d of max-sessions %d running", len(running), maxSessions)
+	for _, s := range running {
+		fmt.Fprintf(&b, "\n  %s  %s", s.SessionID, s.ProjectDir)
+	}
+	b.WriteString("\nstop one with 'vibepit down' or raise max-sessions in the global config")
+	return errors.New(b.String())
+}
+
 // containerTerm returns a TERM value suitable for the sandbox container.
 func containerTerm() string {
 	t := os.Getenv("TERM")
@@ -109,14 +151,132 @@ func sandboxFlags() []cli.Flag {
 			Aliases: []string{"p"},
 			Usage:   "Additional presets to activate",
 		},
+		&cli.BoolFlag{
+			Name:  allowPrivateFlag,
+			Usage: "DANGEROUS: do not block private network ranges, for reaching LAN hosts",
+		},
+		&cli.StringSliceFlag{
+			Name:  profileFlag,
+			Usage: "Config profile of allow entries to activate",
+		},
 		&cli.BoolFlag{
 			Name:    reconfigureFlag,
 			Aliases: []string{"r"},
 			Usage:   "Re-run the network preset selector",
 		},
+		&cli.StringFlag{
+			Name:  sessionIDFileFlag,
+			Usage: "Write the session ID to this file for use in scripts",
+		},
+		&cli.StringFlag{
+			Name:  saveConfigFlag,
+			Usage: "Write the merged proxy config of a new session to this file",
+		},
+		&cli.StringFlag{
+			Name:  workDirFlag,
+			Usage: "Start the sandbox shell in this subdirectory of the project",
+		},
+		&cli.StringFlag{
+			Name:  statusFormatFlag,
+			Usage: "Progress output: lines, none, or json (one object per event on stderr)",
+			Value: string(tui.StatusLines),
+		},
+		&cli.DurationFlag{
+			Name:  certLifetimeFlag,
+			Usage: "Validity of the session mTLS certificates (e.g. 24h, default 720h)",
+		},
+		&cli.StringFlag{
+			Name:  certKeyTypeFlag,
+			Usage: "Key type of the session mTLS certificates: ed25519 or ecdsa-p256 (default ed25519)",
+		},
+		&cli.Int64Flag{
+			Name:  memoryFlag,
+			Usage: "Memory limit of the sandbox container in MiB (default unlimited)",
+		},
+		&cli.FloatFlag{
+			Name:  cpusFlag,
+			Usage: "Number of CPUs the sandbox container may use, e.g. 1.5 (default unlimited)",
+		},
+		&cli.StringSliceFlag{
+			Name:    envFlag,
+			Aliases: []string{"e"},
+			Usage:   "Environment variable for the sandbox as KEY=VALUE, or KEY to pass on the host value",
+		},
+		&cli.StringSliceFlag{
+			Name:  envFileFlag,
+			Usage: "File with KEY=VALUE lines to set in the sandbox environment",
+		},
 	}
 }
 
+// writeSessionIDFile writes the session ID to the file given with
+// --session-id-file. It does nothing when the flag is not set.
+func writeSessionIDFile(cmd *cli.Command, sessionID string) error {
+	path := cmd.String(sessionIDFileFlag)
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(sessionID+"\n"), 0o644); err != nil {
+		return fmt.Errorf("session ID file: %w", err)
+	}
+	return nil
+}
+
+// sandboxWorkDir returns the working directory for the sandbox: projectRoot
+// joined with the --workdir subpath, or projectRoot when the flag is not set.
+// The subpath must be an existing directory inside the project mount.
+func sandboxWorkDir(projectRoot, subpath string) (string, error) {
+	if subpath == "" {
+		return projectRoot, nil
+	}
+	if filepath.IsAbs(subpath) {
+		return "", fmt.Errorf("workdir %q: must be relative to the project root", subpath)
+	}
+	workDir := filepath.Join(projectRoot, subpath)
+	// Resolve symlinks so a link can't point the shell outside of the mount.
+	realRoot, err := filepath.EvalSymlinks(projectRoot)
+	if err != nil {
+		return "", fmt.Errorf("workdir %q: %w", subpath, err)
+	}
+	realWorkDir, err := filepath.EvalSymlinks(workDir)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("workdir %q does not exist in %s", subpath, projectRoot)
+	} else if err != nil {
+		return "", fmt.Errorf("workdir %q: %w", subpath, err)
+	}
+	rel, err := filepath.Rel(realRoot, realWorkDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("workdir %q: must be inside the project root %s", subpath, projectRoot)
+	}
+	fi, err := os.Stat(realWorkDir)
+	if err != nil {
+		return "", fmt.Errorf("workdir %q: %w", subpath, err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("workdir %q: not a directory", subpath)
+	}
+	return workDir, nil
+}
+
+// writeEffectiveConfig writes the merged config handed to the proxy, with
+// presets expanded and CLI overrides applied, to the file given with
+// --save-effective-config. It does nothing when the flag is not set.
+func writeEffectiveConfig(cmd *cli.Command, merged config.MergedConfig) error {
+	path := cmd.String(saveConfigFlag)
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return fmt.Errorf("effective config: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("effective config: %w", err)
+	}
+	tui.Status("Saved", "effective config to %s", path)
+	return nil
+}
+
 // resolveProjectAndUser resolves the project root from the CLI arguments,
 // validates it, and returns the current user and container image name.
 func resolveProjectAndUser(cmd *cli.Command) (string, *userInfo, error) {
@@ -207,10 +367,65 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		}
 	}
 
-	merged, err := cfg.Merge(cmd.StringSlice(allowFlag), cmd.StringSlice(presetFlag))
+	merged, err := cfg.Merge(cmd.StringSlice(allowFlag), cmd.StringSlice(presetFlag), cmd.StringSlice(profileFlag))
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("config: %w", err)
 	}
+	for _, e := range merged.Denied {
+		tui.Status("Note", "%s is in the deny list, ignoring the allow entry", e)
+	}
+	if cmd.Bool(allowPrivateFlag) {
+		merged.AllowPrivateNetwork = true
+	}
+	if merged.AllowPrivateNetwork {
+		tui.Warn("private network ranges are NOT blocked, the sandbox can reach hosts on your LAN")
+	}
+	if len(cfg.Project.AllowCIDR) > 0 {
+		tui.Warn("the project config allows blocked ranges: %s", strings.Join(cfg.Project.AllowCIDR, ", "))
+	}
+	certLifetime, err := cfg.CertLifetime(cmd.Duration(certLifetimeFlag))
+	if err != nil {
+		return nil, cleanups, fmt.Errorf("config: %w", err)
+	}
+	certKeyType, err := cfg.CertKeyType(cmd.String(certKeyTypeFlag))
+	if err != nil {
+		return nil, cleanups, fmt.Errorf("config: %w", err)
+	}
+	setupCommands, err := cfg.SetupCommands()
+	if err != nil {
+		return nil, cleanups, fmt.Errorf("config: %w", err)
+	}
+	resources, err := cfg.SandboxResources(cmd.Int64(memoryFlag), cmd.Float(cpusFlag))
+	if err != nil {
+		return nil, cleanups, fmt.Errorf("config: %w", err)
+	}
+	env, ignoredEnv, err := sandboxEnv(cfg.Project.Env, cmd.StringSlice(envFileFlag), cmd.StringSlice(envFlag), os.LookupEnv)
+	if err != nil {
+		return nil, cleanups, err
+	}
+	for _, name := range ignoredEnv {
+		tui.Warn("ignoring environment variable %s, it would override the proxy settings", name)
+	}
+	caCerts, err := cfg.CACerts()
+	if err != nil {
+		return nil, cleanups, fmt.Errorf("config: %w", err)
+	}
+	for _, note := range cfg.PresetPortNotes(cmd.StringSlice(presetFlag)) {
+		tui.Status("Note", "%s", note)
+	}
+	for _, path := range cfg.LegacyAllowFiles {
+		tui.Status("Note", "%s uses the old allow section, rename it to allow-http", path)
+	}
+
+	if cfg.Global.MaxSessions != 0 {
+		running, err := client.ListProxySessions(ctx)
+		if err != nil {
+			return nil, cleanups, fmt.Errorf("list sessions: %w", err)
+		}
+		if err := checkSessionLimit(running, cfg.Global.MaxSessions); err != nil {
+			return nil, cleanups, err
+		}
+	}
 
 	if err := client.EnsureVolume(ctx, homeVolumeName, u.UID, u.Username); err != nil {
 		return nil, cleanups, fmt.Errorf("home volume: %w", err)
@@ -233,36 +448,46 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		selfBinary = proxyBinary
 	}
 
-	if _, err := client.EnsureImage(ctx, u.Image, false); err != nil {
-		return nil, cleanups, fmt.Errorf("image: %w", err)
+	if !cmd.Bool(localFlag) {
+		if err := client.CheckPlatform(ctx, u.Image, publishedPlatforms); err != nil {
+			return nil, cleanups, fmt.Errorf("image: %w", imageError(err))
+		}
+	}
+	if err := ensureImage(ctx, client, u.Image); err != nil {
+		return nil, cleanups, fmt.Errorf("image: %w", imageError(err))
 	}
 	if !cmd.Bool(localFlag) {
 		digestRef, err := client.ImageRepoDigest(ctx, u.Image)
 		if err != nil {
 			return nil, cleanups, fmt.Errorf("resolve image digest: %w", err)
 		}
-		tui.Status("Verifying", "image signature: %s", u.Image)
-		if err := cosign.VerifyImage(ctx, digestRef); err != nil {
+		spin := tui.StartSpinner("Verifying", "image signature: %s", u.Image)
+		err = cosign.VerifyImage(ctx, digestRef)
+		spin.Stop()
+		if err != nil {
 			return nil, cleanups, fmt.Errorf("sandbox image verification: %w", err)
 		}
 	}
-	if _, err := client.EnsureImage(ctx, ctr.ProxyImage, false); err != nil {
+	if err := ensureImage(ctx, client, ctr.ProxyImage); err != nil {
 		return nil, cleanups, fmt.Errorf("proxy image: %w", err)
 	}
 	proxyDigestRef, err := client.ImageRepoDigest(ctx, ctr.ProxyImage)
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("resolve proxy image digest: %w", err)
 	}
-	tui.Status("Verifying", "image signature: %s", ctr.ProxyImage)
-	if err := cosign.VerifyProxyImage(ctx, proxyDigestRef); err != nil {
+	spin := tui.StartSpinner("Verifying", "image signature: %s", ctr.ProxyImage)
+	err = cosign.VerifyProxyImage(ctx, proxyDigestRef)
+	spin.Stop()
+	if err != nil {
 		return nil, cleanups, fmt.Errorf("proxy image verification: %w", err)
 	}
 
 	sessionID := xid.New().String()
 	networkName := networkNamePrefix + sessionID
 
-	tui.Status("Creating", "network %s", networkName)
+	spin = tui.StartSpinner("Creating", "network %s", networkName)
 	netInfo, err := client.CreateNetwork(ctx, networkName)
+	spin.Stop()
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("network: %w", err)
 	}
@@ -276,16 +501,22 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 	merged.ProxyIP = netInfo.ProxyIP
 	merged.HostGateway = "host-gateway"
 
-	proxyPort, err := config.RandomProxyPort(merged.AllowHostPorts)
+	// The proxy port is only used inside the session network, the control
+	// API port gets published on the host loopback.
+	proxyPort, err := config.RandomProxyPort("", merged.AllowHostPorts)
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("proxy port: %w", err)
 	}
-	controlAPIPort, err := config.RandomProxyPort(append(merged.AllowHostPorts, proxyPort))
-	if err != nil {
-		return nil, cleanups, fmt.Errorf("control API port: %w", err)
-	}
 	merged.ProxyPort = proxyPort
-	merged.ControlAPIPort = controlAPIPort
+	if cfg.Global.ControlAPISocket {
+		merged.ControlAPISocket = ctr.ControlSocketPath
+	} else {
+		controlAPIPort, err := config.RandomProxyPort("127.0.0.1", append(merged.AllowHostPorts, proxyPort))
+		if err != nil {
+			return nil, cleanups, fmt.Errorf("control API port: %w", err)
+		}
+		merged.ControlAPIPort = controlAPIPort
+	}
 
 	if opts.Daemon {
 		merged.SSHForwardAddr = fmt.Sprintf("%s:2222", netInfo.SandboxIP)
@@ -295,6 +526,9 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("marshal proxy config: %w", err)
 	}
+	if err := writeEffectiveConfig(cmd, merged); err != nil {
+		return nil, cleanups, err
+	}
 	tmpFile, err := os.CreateTemp("", "vibepit-proxy-*.json")
 	if err != nil {
 		return nil, cleanups, err
@@ -312,7 +546,9 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		os.Remove(tmpFile.Name()) //nolint:errcheck
 	})
 
-	creds, err := proxy.GenerateMTLSCredentials(30 * 24 * time.Hour)
+	spin = tui.StartSpinner("Generating", "mTLS credentials")
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: certLifetime, KeyType: certKeyType})
+	spin.Stop()
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("generating mTLS credentials: %w", err)
 	}
@@ -330,7 +566,7 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		ConfigPath:     tmpFile.Name(),
 		NetworkID:      netInfo.ID,
 		ProxyIP:        netInfo.ProxyIP,
-		ControlAPIPort: controlAPIPort,
+		ControlAPIPort: merged.ControlAPIPort,
 		Name:           "vibepit-proxy-" + sessionID,
 		SessionID:      sessionID,
 		TLSKeyPEM:      string(creds.ServerKeyPEM()),
@@ -338,14 +574,25 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		CACertPEM:      string(creds.CACertPEM()),
 		ProjectDir:     projectRoot,
 		ExtraHosts:     merged.ExtraHosts,
+		Allow:          cmd.StringSlice(allowFlag),
+		Presets:        cmd.StringSlice(presetFlag),
+		Profiles:       cmd.StringSlice(profileFlag),
 	}
 	if opts.Daemon {
 		proxyCfg.NoRestart = true
 		proxyCfg.SSHPort = 2222
 	}
+	if merged.ControlAPISocket != "" {
+		// A directory of its own, the proxy must not see the credentials.
+		proxyCfg.ControlSocketDir = filepath.Join(sessDir, controlSocketDirName)
+		if err := os.MkdirAll(proxyCfg.ControlSocketDir, 0o700); err != nil {
+			return nil, cleanups, fmt.Errorf("control socket dir: %w", err)
+		}
+	}
 
-	tui.Status("Starting", "proxy container")
+	spin = tui.StartSpinner("Starting", "proxy container")
 	proxyContainerID, _, err := client.StartProxyContainer(ctx, proxyCfg)
+	spin.Stop()
 	if err != nil {
 		return nil, cleanups, fmt.Errorf("proxy container: %w", err)
 	}
@@ -362,17 +609,49 @@ func startSessionInfra(ctx context.Context, cmd *cli.Command, client *ctr.Client
 		NetworkInfo:      netInfo,
 		Merged:           merged,
 		ProxyContainerID: proxyContainerID,
+
+		SetupCommands:     setupCommands,
+		SetupIgnoreErrors: cfg.Project.SetupIgnoreErrors,
+		CACerts:           caCerts,
+		Resources:         resources,
+		Env:               env,
 	}, cleanups, nil
 }
 
+// ensureImage pulls ref unless it is present locally. The lookup runs under a
+// spinner like the other startup steps; a pull shows its own progress.
+func ensureImage(ctx context.Context, client *ctr.Client, ref string) error {
+	spin := tui.StartSpinner("Checking", "image %s", ref)
+	present, err := client.HasImage(ctx, ref)
+	spin.Stop()
+	if err != nil || present {
+		return err
+	}
+	return client.PullImage(ctx, ref, tui.Quiet())
+}
+
+// imageError adds a remediation hint to image errors caused by the published
+// image not being available for the daemon's platform or the user's UID/GID.
+func imageError(err error) error {
+	if _, ok := errors.AsType[*ctr.PlatformError](err); ok {
+		return fmt.Errorf("%w; build the image locally with 'vibepit build' and run with --%s", err, localFlag)
+	}
+	if _, ok := errors.AsType[*ctr.ImageNotFoundError](err); ok {
+		return fmt.Errorf("%w; images are only published for UID/GID 1000/1000 and 501/20, "+
+			"build the image locally with 'vibepit build' and run with --%s", err, localFlag)
+	}
+	return err
+}
+
 // baseSandboxConfig returns a SandboxContainerConfig with the fields common
 // to both interactive and daemon modes. Callers set daemon-specific fields
-// on the returned value before passing it to CreateSandboxContainer.
-func (infra *sessionInfra) baseSandboxConfig(projectRoot string, u *userInfo) ctr.SandboxContainerConfig {
+// on the returned value before passing it to CreateSandboxContainer. The
+// whole projectRoot is mounted while the shell starts in workDir.
+func (infra *sessionInfra) baseSandboxConfig(projectRoot, workDir string, u *userInfo) ctr.SandboxContainerConfig {
 	return ctr.SandboxContainerConfig{
 		Image:               u.Image,
 		ProjectDir:          projectRoot,
-		WorkDir:             projectRoot,
+		WorkDir:             workDir,
 		RuntimeDir:          infra.SessionDir,
 		HomeVolumeName:      homeVolumeName,
 		LinuxbrewVolumeName: linuxbrewVolumeName,
@@ -385,6 +664,12 @@ func (infra *sessionInfra) baseSandboxConfig(projectRoot string, u *userInfo) ct
 		UID:                 infra.UID,
 		User:                u.Username,
 		SessionID:           infra.SessionID,
+		SetupCommands:       infra.SetupCommands,
+		SetupIgnoreErrors:   infra.SetupIgnoreErrors,
+		CACerts:             infra.CACerts,
+		Env:                 infra.Env,
+		MemoryLimitMB:       infra.Resources.MemoryMB,
+		CPUs:                infra.Resources.CPUs,
 	}
 }
 
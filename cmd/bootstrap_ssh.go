@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"github.com/bernd/vibepit/config"
 	ctr "github.com/bernd/vibepit/container"
+	"github.com/urfave/cli/v3"
 	"golang.org/x/crypto/ssh"
 	"os"
 	"path/filepath"
 )
 
-func newSSHClient(ctx context.Context, debug bool) (*ssh.Client, *ctr.RunningSession, error) {
-	client, err := ctr.NewClient(ctr.WithDebug(debug))
+func newSSHClient(ctx context.Context, cmd *cli.Command) (*ssh.Client, *ctr.RunningSession, error) {
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestCheckSessionLimit(t *testing.T) {
+	running := []ctr.ProxySession{
+		{SessionID: "sess-a", ProjectDir: "/home/user/a"},
+		{SessionID: "sess-b", ProjectDir: "/home/user/b"},
+	}
+
+	t.Run("zero means unlimited", func(t *testing.T) {
+		assert.NoError(t, checkSessionLimit(running, 0))
+	})
+
+	t.Run("below the limit", func(t *testing.T) {
+		assert.NoError(t, checkSessionLimit(running, 3))
+	})
+
+	t.Run("at the limit lists running sessions", func(t *testing.T) {
+		err := checkSessionLimit(running, 2)
+		assert.ErrorContains(t, err, "2 of max-sessions 2")
+		assert.ErrorContains(t, err, "sess-a  /home/user/a")
+		assert.ErrorContains(t, err, "sess-b  /home/user/b")
+	})
+
+	t.Run("negative limit is rejected", func(t *testing.T) {
+		assert.ErrorContains(t, checkSessionLimit(nil, -1), "must not be negative")
+	})
+}
+
+func TestWriteSessionIDFile(t *testing.T) {
+	run := func(args ...string) error {
+		cmd := &cli.Command{
+			Name:  "run",
+			Flags: sandboxFlags(),
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				return writeSessionIDFile(cmd, "d0abc123")
+			},
+		}
+		return cmd.Run(context.Background(), append([]string{"run"}, args...))
+	}
+
+	t.Run("writes the session ID", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "session-id")
+		require.NoError(t, run("--session-id-file", path))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "d0abc123\n", string(data))
+	})
+
+	t.Run("does nothing without the flag", func(t *testing.T) {
+		assert.NoError(t, run())
+	})
+
+	t.Run("reports write errors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "session-id")
+		assert.ErrorContains(t, run("--session-id-file", path), "session ID file")
+	})
+}
+
+func TestSandboxWorkDir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "packages", "api"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), nil, 0o644))
+	require.NoError(t, os.Symlink(t.TempDir(), filepath.Join(root, "outside")))
+
+	t.Run("defaults to the project root", func(t *testing.T) {
+		dir, err := sandboxWorkDir(root, "")
+		require.NoError(t, err)
+		assert.Equal(t, root, dir)
+	})
+
+	t.Run("joins the subpath", func(t *testing.T) {
+		dir, err := sandboxWorkDir(root, "packages/api")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, "packages", "api"), dir)
+	})
+
+	for name, tc := range map[string]struct {
+		subpath string
+		err     string
+	}{
+		"missing directory": {"packages/web", "does not exist"},
+		"a file":            {"README.md", "not a directory"},
+		"parent directory":  {"../", "inside the project root"},
+		"symlink outside":   {"outside", "inside the project root"},
+		"absolute path":     {"/tmp", "relative to the project root"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := sandboxWorkDir(root, tc.subpath)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestWriteEffectiveConfig(t *testing.T) {
+	merged := config.MergedConfig{
+		AllowHTTP: []string{"github.com:443", "registry.npmjs.org:443"},
+		ProxyPort: 3128,
+	}
+	run := func(args ...string) error {
+		cmd := &cli.Command{
+			Name:  "run",
+			Flags: sandboxFlags(),
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				return writeEffectiveConfig(cmd, merged)
+			},
+		}
+		return cmd.Run(context.Background(), append([]string{"run"}, args...))
+	}
+
+	t.Run("writes the merged config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "effective.json")
+		require.NoError(t, run("--save-effective-config", path))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var got config.MergedConfig
+		require.NoError(t, json.Unmarshal(data, &got))
+		assert.Equal(t, merged.AllowHTTP, got.AllowHTTP)
+		assert.Equal(t, 3128, got.ProxyPort)
+	})
+
+	t.Run("does nothing without the flag", func(t *testing.T) {
+		assert.NoError(t, run())
+	})
+
+	t.Run("reports write errors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "effective.json")
+		assert.ErrorContains(t, run("--save-effective-config", path), "effective config")
+	})
+}
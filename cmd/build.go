@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/bernd/vibepit/tui"
+	"github.com/urfave/cli/v3"
+)
+
+// defaultImageDir is the sandbox image build context inside a vibepit checkout.
+const defaultImageDir = "image"
+
+func BuildCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "build",
+		Usage:     fmt.Sprintf("Build the sandbox image locally as %q", localImage),
+		ArgsUsage: "[image-dir]",
+		Description: "Builds the sandbox image from the Dockerfile in a vibepit checkout's image/ directory,\n" +
+			"using your UID/GID so file ownership matches the host. Use the result with --local.",
+		Category: "Utilities",
+		Action:   BuildAction,
+	}
+}
+
+func BuildAction(ctx context.Context, cmd *cli.Command) error {
+	dir := cmd.Args().First()
+	if dir == "" {
+		dir = defaultImageDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+		return fmt.Errorf("no Dockerfile in %s — run from a vibepit checkout or pass the image directory", dir)
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("cannot determine current user: %w", err)
+	}
+
+	client, err := newContainerClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer client.Close() //nolint:errcheck
+
+	buildArgs := map[string]string{
+		"CODE_UID": u.Uid,
+		"CODE_GID": u.Gid,
+	}
+	if err := client.BuildImage(ctx, dir, localImage, buildArgs, false); err != nil {
+		return err
+	}
+
+	tui.Status("Built", "image %s (run with --%s)", localImage, localFlag)
+	return nil
+}
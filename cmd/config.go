@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/lipgloss/v2"
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/bernd/vibepit/tui"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+const defaultEditor = "vi"
+
+func ConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:     "config",
+		Usage:    "Manage the project network config",
+		Category: "Utilities",
+		Commands: []*cli.Command{
+			{
+				Name:        "edit",
+				Usage:       "Open the project config in $EDITOR and validate it",
+				ArgsUsage:   "[project-dir]",
+				Description: "Creates .vibepit/network.yaml from the template if it is missing.",
+				Action:      ConfigEditAction,
+			},
+			configValidateCommand(),
+			{
+				Name:  "reload",
+				Usage: "Apply the allow and deny lists of the config files to a running proxy",
+				Description: `Merges the config files of the session's project like run does and
+replaces the allow-http, allow-dns, deny-http and deny-dns lists of the
+proxy. Entries allowed at runtime stay unless a deny rule now covers
+them. Open connections are not interrupted.
+
+The --allow, --preset and --profile flags the session was started with
+apply again; flags given to reload add to them. Other settings, like
+block-cidr or upstream-dns, still need a restart.`,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    allowFlag,
+						Aliases: []string{"a"},
+						Usage:   "Additional domain:port to allow (e.g. api.example.com:443)",
+					},
+					&cli.StringSliceFlag{
+						Name:    presetFlag,
+						Aliases: []string{"p"},
+						Usage:   "Additional presets to activate",
+					},
+					&cli.StringSliceFlag{
+						Name:  profileFlag,
+						Usage: "Config profile of allow entries to activate",
+					},
+					sessionFlag,
+				},
+				Action: ConfigReloadAction,
+			},
+		},
+	}
+}
+
+func ConfigReloadAction(ctx context.Context, cmd *cli.Command) error {
+	session, err := discoverSession(ctx, cmd, cmd.String("session"))
+	if err != nil {
+		return fmt.Errorf("cannot find running proxy: %w", err)
+	}
+	cfg, err := config.Load(config.DefaultGlobalPath(), config.DefaultProjectPath(session.ProjectDir))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	merged, err := cfg.Merge(reloadFlags(session, cmd))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	for _, e := range merged.Denied {
+		tui.Status("Note", "%s is in the deny list, ignoring the allow entry", e)
+	}
+
+	client, err := NewControlClient(session)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if _, err := client.Reload(merged); err != nil {
+		return err
+	}
+	tui.Status("Reloaded", "allow and deny lists of %s", session.ProjectDir)
+
+	// Settings other than the lists keep their startup values.
+	if live, err := client.ConfigWithSources(); err == nil && config.ProxyConfigStale(*live, merged) {
+		tui.Warn("other config changes need a restart of the session to take effect")
+	}
+	return nil
+}
+
+// reloadFlags returns the --allow, --preset and --profile flags for the
+// merge of config reload: the ones the session started with, followed by
+// the ones given to reload.
+func reloadFlags(session *SessionInfo, cmd *cli.Command) (allow, presets, profiles []string) {
+	return slices.Concat(session.Allow, cmd.StringSlice(allowFlag)),
+		slices.Concat(session.Presets, cmd.StringSlice(presetFlag)),
+		slices.Concat(session.Profiles, cmd.StringSlice(profileFlag))
+}
+
+const checkDNSFlag = "check-dns"
+
+const (
+	// dnsCheckTimeout bounds a single lookup of config validate --check-dns,
+	// dnsCheckTotalTimeout all of them.
+	dnsCheckTimeout      = 3 * time.Second
+	dnsCheckTotalTimeout = 30 * time.Second
+	// dnsCheckWorkers limits the lookups in flight, so a long allowlist
+	// doesn't flood the resolver.
+	dnsCheckWorkers = 4
+)
+
+func ConfigValidateAction(ctx context.Context, cmd *cli.Command) error {
+	projectRoot, err := resolveProjectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	projectPath := config.DefaultProjectPath(projectRoot)
+
+	if err := validateProjectConfig(projectPath); err != nil {
+		return err
+	}
+	tui.Status("Validated", "%s", projectPath)
+
+	if !cmd.Bool(checkDNSFlag) {
+		return nil
+	}
+	cfg, err := config.Load(config.DefaultGlobalPath(), projectPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	// Only check the entries written in the config files, preset entries
+	// are not for the user to prune.
+	allowHTTP := slices.Concat(cfg.Global.AllowHTTP, cfg.Project.AllowHTTP)
+	allowDNS := slices.Concat(cfg.Global.AllowDNS, cfg.Project.AllowDNS)
+	for _, name := range cfg.ProfileNames() {
+		p, _ := cfg.Profile(name)
+		allowHTTP = append(allowHTTP, p.AllowHTTP...)
+		allowDNS = append(allowDNS, p.AllowDNS...)
+	}
+	allowHTTP, err = proxy.NormalizeHTTPEntries(allowHTTP)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	domains := checkableDomains(allowHTTP, allowDNS)
+	tui.Status("Resolving", "%d domains", len(domains))
+	results := checkDomains(ctx, net.DefaultResolver.LookupHost, domains)
+	unresolved := 0
+	for _, r := range results {
+		switch {
+		case r.err == nil:
+		case isNotFound(r.err):
+			unresolved++
+			tui.Warn("%s does not resolve, consider removing it", r.domain)
+		default:
+			tui.Warn("%s could not be checked: %v", r.domain, r.err)
+		}
+	}
+	if unresolved == 0 {
+		tui.Status("Resolved", "all checked domains")
+	}
+	return nil
+}
+
+// checkableDomains returns the sorted domains of allow-http and allow-dns
+// entries that can be looked up. Wildcard entries, IP addresses and
+// *.vibepit virtual hosts are skipped; a leading-dot entry is checked by its
+// apex domain.
+func checkableDomains(allowHTTP, allowDNS []string) []string {
+	var domains []string
+	add := func(domain string) {
+		domain = strings.TrimPrefix(domain, ".")
+		if strings.Contains(domain, "*") || net.ParseIP(domain) != nil || strings.HasSuffix(domain, ".vibepit") {
+			return
+		}
+		domains = append(domains, strings.ToLower(domain))
+	}
+	for _, e := range allowHTTP {
+		domain, _, _ := strings.Cut(e, ":")
+		add(domain)
+	}
+	for _, e := range allowDNS {
+		add(e)
+	}
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
+
+// domainCheck is the lookup result for a single domain.
+type domainCheck struct {
+	domain string
+	err    error
+}
+
+// checkDomains looks up the domains with at most dnsCheckWorkers lookups in
+// flight. Each lookup is bounded by dnsCheckTimeout and all of them by
+// dnsCheckTotalTimeout; domains not reached in time report the context error.
+// Results are in the order of domains.
+func checkDomains(ctx context.Context, lookup func(ctx context.Context, host string) ([]string, error), domains []string) []domainCheck {
+	ctx, cancel := context.WithTimeout(ctx, dnsCheckTotalTimeout)
+	defer cancel()
+
+	results := make([]domainCheck, len(domains))
+	sem := make(chan struct{}, dnsCheckWorkers)
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		results[i].domain = domain
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].err = ctx.Err()
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			lookupCtx, cancel := context.WithTimeout(ctx, dnsCheckTimeout)
+			defer cancel()
+			_, results[i].err = lookup(lookupCtx, domain)
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// isNotFound reports whether a lookup failed because the domain does not
+// exist, as opposed to a timeout or an unreachable resolver.
+func isNotFound(err error) bool {
+	dnsErr, ok := errors.AsType[*net.DNSError](err)
+	return ok && dnsErr.IsNotFound
+}
+
+// ValidateCommand is the top-level shortcut for "config validate".
+func ValidateCommand() *cli.Command {
+	cmd := configValidateCommand()
+	cmd.Usage = "Validate the project config (same as config validate)"
+	cmd.Category = "Utilities"
+	return cmd
+}
+
+func configValidateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "validate",
+		Usage:     "Validate the project config",
+		ArgsUsage: "[project-dir]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  checkDNSFlag,
+				Usage: "Report allow entries whose domain does not resolve",
+			},
+		},
+		Action: ConfigValidateAction,
+	}
+}
+
+func ConfigEditAction(ctx context.Context, cmd *cli.Command) error {
+	projectRoot, err := resolveProjectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	projectPath := config.DefaultProjectPath(projectRoot)
+
+	if _, err := os.Stat(projectPath); os.IsNotExist(err) {
+		if err := config.CreateProjectConfig(projectPath); err != nil {
+			return fmt.Errorf("create project config: %w", err)
+		}
+		tui.Status("Created", "%s", projectPath)
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	for {
+		if err := runEditor(ctx, projectPath); err != nil {
+			return err
+		}
+
+		err := validateProjectConfig(projectPath)
+		if err == nil {
+			tui.Status("Validated", "%s", projectPath)
+			return nil
+		}
+		tui.Error("%v", err)
+		if !interactive || !confirmReopen() {
+			return fmt.Errorf("%s is invalid", projectPath)
+		}
+	}
+}
+
+// validateProjectConfig loads the project config together with the global
+// config and runs the checks a session start would run.
+func validateProjectConfig(projectPath string) error {
+	cfg, err := config.Load(config.DefaultGlobalPath(), projectPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	for _, note := range cfg.PresetPortNotes(nil) {
+		tui.Status("Note", "%s", note)
+	}
+	for _, path := range cfg.LegacyAllowFiles {
+		tui.Status("Note", "%s uses the old allow section, rename it to allow-http", path)
+	}
+	return nil
+}
+
+// editorCommand returns the editor from $VISUAL or $EDITOR split into its
+// arguments, so values like "code --wait" work.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{defaultEditor}
+}
+
+func runEditor(ctx context.Context, path string) error {
+	args := append(editorCommand(), path)
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", args[0], err)
+	}
+	return nil
+}
+
+func confirmReopen() bool {
+	prompt := lipgloss.NewStyle().Foreground(tui.ColorOrange).Bold(true)
+	fmt.Print(prompt.Render("Re-open the editor?") + " [Y/n] ")
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bernd/vibepit/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestEditorCommand(t *testing.T) {
+	t.Run("prefers VISUAL", func(t *testing.T) {
+		t.Setenv("VISUAL", "code --wait")
+		t.Setenv("EDITOR", "nano")
+		assert.Equal(t, []string{"code", "--wait"}, editorCommand())
+	})
+
+	t.Run("falls back to EDITOR", func(t *testing.T) {
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", "nano")
+		assert.Equal(t, []string{"nano"}, editorCommand())
+	})
+
+	t.Run("defaults to vi", func(t *testing.T) {
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", "")
+		assert.Equal(t, []string{defaultEditor}, editorCommand())
+	})
+}
+
+func TestConfigEdit(t *testing.T) {
+	// writeEditor installs a fake editor that replaces the file with content.
+	writeEditor := func(t *testing.T, content string) {
+		t.Helper()
+		script := filepath.Join(t.TempDir(), "editor")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\ncat > \"$1\" <<'YAML'\n"+content+"YAML\n"), 0o755))
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", script)
+	}
+	run := func(projectDir string) error {
+		return RootCommand().Run(context.Background(), []string{"vibepit", "config", "edit", projectDir})
+	}
+
+	t.Run("creates the config from the template", func(t *testing.T) {
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", "true")
+		projectDir := t.TempDir()
+
+		require.NoError(t, run(projectDir))
+
+		data, err := os.ReadFile(config.DefaultProjectPath(projectDir))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "# allow-http:")
+	})
+
+	t.Run("accepts a valid config", func(t *testing.T) {
+		writeEditor(t, "presets:\n  - default\nallow-http:\n  - github.com:443\n")
+		assert.NoError(t, run(t.TempDir()))
+	})
+
+	t.Run("reports an invalid allow entry", func(t *testing.T) {
+		writeEditor(t, "allow-http:\n  - github.com:44a\n")
+		assert.ErrorContains(t, run(t.TempDir()), "is invalid")
+	})
+
+	t.Run("reports an unknown preset", func(t *testing.T) {
+		writeEditor(t, "presets:\n  - no-such-preset\n")
+		assert.ErrorContains(t, run(t.TempDir()), "is invalid")
+	})
+}
+
+func TestCheckableDomains(t *testing.T) {
+	domains := checkableDomains(
+		[]string{"github.com:443", "*.example.com:443", "**.cdn.example.com:*", ".example.org:443", "10.0.0.5:8080", "db.vibepit:5432", "GitHub.com:80"},
+		[]string{"internal.example.com", "*.corp.example.com", "github.com"},
+	)
+	assert.Equal(t, []string{"example.org", "github.com", "internal.example.com"}, domains)
+}
+
+func TestCheckDomains(t *testing.T) {
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		switch host {
+		case "gone.example.com":
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		case "slow.example.com":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []string{"93.184.216.34"}, nil
+	}
+
+	results := checkDomains(context.Background(), lookup, []string{"github.com", "gone.example.com", "slow.example.com"})
+	require.Len(t, results, 3)
+	assert.Equal(t, domainCheck{domain: "github.com"}, results[0])
+	assert.True(t, isNotFound(results[1].err))
+	require.Error(t, results[2].err)
+	assert.False(t, isNotFound(results[2].err), "a timeout is not reported as missing")
+}
+
+func TestConfigValidate(t *testing.T) {
+	run := func(args ...string) error {
+		return RootCommand().Run(context.Background(), append([]string{"vibepit", "config", "validate"}, args...))
+	}
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		dir := t.TempDir()
+		path := config.DefaultProjectPath(dir)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return dir
+	}
+
+	t.Run("accepts a valid config", func(t *testing.T) {
+		assert.NoError(t, run(writeConfig(t, "allow-http:\n  - github.com:443\n")))
+	})
+
+	t.Run("reports an invalid config", func(t *testing.T) {
+		assert.ErrorContains(t, run(writeConfig(t, "allow-http:\n  - github.com:44a\n")), "allow-http")
+	})
+}
+
+func TestReloadFlags(t *testing.T) {
+	session := &SessionInfo{
+		Allow:    []string{"api.example.com:443"},
+		Presets:  []string{"pkg-go"},
+		Profiles: []string{"ci"},
+	}
+	run := func(args ...string) (allow, presets, profiles []string) {
+		reload := ConfigCommand().Command("reload")
+		reload.Action = func(ctx context.Context, cmd *cli.Command) error {
+			allow, presets, profiles = reloadFlags(session, cmd)
+			return nil
+		}
+		require.NoError(t, reload.Run(context.Background(), append([]string{"reload"}, args...)))
+		return allow, presets, profiles
+	}
+
+	t.Run("keeps the session flags", func(t *testing.T) {
+		allow, presets, profiles := run()
+		assert.Equal(t, []string{"api.example.com:443"}, allow)
+		assert.Equal(t, []string{"pkg-go"}, presets)
+		assert.Equal(t, []string{"ci"}, profiles)
+	})
+
+	t.Run("adds the reload flags", func(t *testing.T) {
+		allow, presets, profiles := run("--allow", "new.example.com:443", "--preset", "pkg-node", "--profile", "dev")
+		assert.Equal(t, []string{"api.example.com:443", "new.example.com:443"}, allow)
+		assert.Equal(t, []string{"pkg-go", "pkg-node"}, presets)
+		assert.Equal(t, []string{"ci", "dev"}, profiles)
+	})
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/tui"
+)
+
+// configLine is a single row in the config view: either a section header
+// or an entry belonging to the preceding section.
+type configLine struct {
+	section string
+	entry   string
+	comment string // config comment for the entry, if any
+	source  string // config layer or preset the entry came from, if known
+}
+
+// configPollResultMsg is returned by async config polling.
+type configPollResultMsg struct {
+	cfg   *config.MergedConfig
+	stale bool
+	err   error
+}
+
+// configScreen implements tui.Screen for viewing the proxy's live config.
+type configScreen struct {
+	tui.Cursor
+	client        *ControlClient
+	back          tui.Screen
+	lines         []configLine
+	pollInFlight  bool
+	firstTickSeen bool
+	loaded        bool
+	stale         bool
+
+	// projectDir and globalPath locate the config files the live config is
+	// compared with. Without a projectDir no comparison is made.
+	projectDir string
+	globalPath string
+}
+
+func newConfigScreen(client *ControlClient, back tui.Screen) *configScreen {
+	return &configScreen{
+		client: client,
+		back:   back,
+	}
+}
+
+// configLines flattens the config sections shown in the view. Empty sections
+// are kept so it is visible that nothing is configured.
+func configLines(cfg *config.MergedConfig) []configLine {
+	ports := make([]string, 0, len(cfg.AllowHostPorts))
+	for _, p := range cfg.AllowHostPorts {
+		ports = append(ports, strconv.Itoa(p))
+	}
+	sections := []struct {
+		name    string
+		entries []string
+	}{
+		{"allow-http", cfg.AllowHTTP},
+		{"allow-dns", cfg.AllowDNS},
+		{"block-cidr", cfg.BlockCIDR},
+		{"allow-cidr", cfg.AllowCIDR},
+		{"allow-host-ports", ports},
+	}
+
+	var lines []configLine
+	for _, s := range sections {
+		lines = append(lines, configLine{section: fmt.Sprintf("%s (%d)", s.name, len(s.entries))})
+		for _, e := range s.entries {
+			lines = append(lines, configLine{entry: e, comment: cfg.EntryComments[e], source: cfg.EntrySources[e]})
+		}
+	}
+	return lines
+}
+
+func (s *configScreen) pollConfigCmd() tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := s.client.ConfigWithSources()
+		if err != nil || s.projectDir == "" {
+			return configPollResultMsg{cfg: cfg, err: err}
+		}
+		// A config file that fails to load is reported when the session
+		// is restarted, so it doesn't hide the live config here.
+		stale, _ := proxyConfigStale(cfg, s.globalPath, s.projectDir)
+		return configPollResultMsg{cfg: cfg, stale: stale}
+	}
+}
+
+// proxyConfigStale merges the config files of projectDir and reports whether
+// the proxy running with the live config doesn't enforce them.
+func proxyConfigStale(live *config.MergedConfig, globalPath, projectDir string) (bool, error) {
+	cfg, err := config.Load(globalPath, config.DefaultProjectPath(projectDir))
+	if err != nil {
+		return false, err
+	}
+	disk, err := cfg.Merge(nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return config.ProxyConfigStale(*live, disk), nil
+}
+
+func (s *configScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch msg.String() {
+		case "esc", "c":
+			return s.back, nil
+		case "q", "ctrl+c":
+			return s, tea.Quit
+		default:
+			s.HandleKey(msg)
+		}
+
+	case tea.WindowSizeMsg:
+		s.VpHeight = w.VpHeight()
+		s.EnsureVisible()
+
+	case configPollResultMsg:
+		s.pollInFlight = false
+		if msg.err != nil {
+			w.SetError(msg.err)
+			break
+		}
+		w.ClearError()
+		s.loaded = true
+		s.stale = msg.stale
+		s.lines = configLines(msg.cfg)
+		s.ItemCount = len(s.lines)
+		if s.Pos >= s.ItemCount {
+			s.Pos = max(s.ItemCount-1, 0)
+		}
+		s.EnsureVisible()
+
+	case tui.TickMsg:
+		if (w.IntervalElapsed(pollInterval) || !s.firstTickSeen) && !s.pollInFlight {
+			s.firstTickSeen = true
+			if s.client == nil {
+				break
+			}
+			s.pollInFlight = true
+			return s, s.pollConfigCmd()
+		}
+		s.firstTickSeen = true
+	}
+
+	return s, nil
+}
+
+func (s *configScreen) View(w *tui.Window) string {
+	var lines []string
+	end := min(s.Offset+s.VpHeight, len(s.lines))
+	for i := s.Offset; i < end; i++ {
+		lines = append(lines, renderConfigLine(s.lines[i], i == s.Pos))
+	}
+	for len(lines) < s.VpHeight {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderConfigLine(l configLine, highlighted bool) string {
+	base, marker := tui.LineStyle(highlighted)
+	if l.section != "" {
+		return marker + base.Foreground(tui.ColorCyan).Bold(true).Render(l.section)
+	}
+	line := marker + base.Render("  "+l.entry)
+	if l.source != "" {
+		line += base.Render("  ") + base.Foreground(tui.ColorField).Render("["+l.source+"]")
+	}
+	if l.comment != "" {
+		line += base.Render("  ") + base.Foreground(tui.ColorField).Render("# "+l.comment)
+	}
+	return line
+}
+
+func (s *configScreen) FooterStatus(w *tui.Window) string {
+	if !s.loaded {
+		return lipgloss.NewStyle().Foreground(tui.ColorField).Render("loading config")
+	}
+	if s.stale {
+		return lipgloss.NewStyle().Foreground(tui.ColorOrange).Render("stale config, restart the session")
+	}
+	return lipgloss.NewStyle().Foreground(tui.ColorField).Render("live config")
+}
+
+func (s *configScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
+	keys := []tui.FooterKey{{Key: "esc", Desc: "logs"}}
+	keys = append(keys, s.Cursor.FooterKeys()...)
+	return keys
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/bernd/vibepit/tui"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLines(t *testing.T) {
+	lines := configLines(&config.MergedConfig{
+		AllowHTTP:      []string{"github.com:443"},
+		AllowDNS:       []string{"internal.example.com"},
+		BlockCIDR:      []string{"10.0.0.0/8"},
+		AllowHostPorts: []int{3000},
+		EntryComments:  map[string]string{"github.com:443": "code hosting"},
+		EntrySources:   map[string]string{"github.com:443": "preset:vcs-github", "internal.example.com": "global"},
+	})
+
+	assert.Equal(t, []configLine{
+		{section: "allow-http (1)"},
+		{entry: "github.com:443", comment: "code hosting", source: "preset:vcs-github"},
+		{section: "allow-dns (1)"},
+		{entry: "internal.example.com", source: "global"},
+		{section: "block-cidr (1)"},
+		{entry: "10.0.0.0/8"},
+		{section: "allow-cidr (0)"},
+		{section: "allow-host-ports (1)"},
+		{entry: "3000"},
+	}, lines)
+}
+
+func TestRenderConfigLine_Comment(t *testing.T) {
+	line := ansi.Strip(renderConfigLine(configLine{entry: "weird-domain.io:443", comment: "needed by tool X"}, false))
+	assert.Contains(t, line, "weird-domain.io:443  # needed by tool X")
+}
+
+func TestRenderConfigLine_Source(t *testing.T) {
+	line := ansi.Strip(renderConfigLine(configLine{entry: "sum.golang.org:443", source: "preset:pkg-go", comment: "go mod"}, false))
+	assert.Contains(t, line, "sum.golang.org:443  [preset:pkg-go]  # go mod")
+}
+
+func TestConfigScreen(t *testing.T) {
+	httpAL, err := proxy.NewHTTPAllowlist([]string{"github.com:443"})
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	merged := config.MergedConfig{AllowHTTP: []string{"github.com:443"}}
+	client := testControlClient(t, proxy.NewControlAPI(proxy.NewLogBuffer(100), merged, httpAL, dnsAL))
+
+	monitor := newMonitorScreen(&SessionInfo{SessionID: "test123456"}, client, nil)
+	w := tui.NewWindow(&tui.HeaderInfo{}, monitor)
+	w.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+
+	t.Run("c opens the config screen", func(t *testing.T) {
+		screen, _ := monitor.Update(tea.KeyPressMsg{Code: 'c', Text: "c"}, w)
+		require.IsType(t, &configScreen{}, screen)
+	})
+
+	t.Run("shows runtime additions", func(t *testing.T) {
+		s := newConfigScreen(client, monitor)
+		s.Update(tea.WindowSizeMsg{}, w)
+		require.NoError(t, httpAL.Add([]string{"api.example.com:443"}))
+
+		_, cmd := s.Update(tui.TickMsg{}, w)
+		require.NotNil(t, cmd)
+		s.Update(cmd(), w)
+
+		view := ansi.Strip(s.View(w))
+		assert.Contains(t, view, "allow-http (2)")
+		assert.Contains(t, view, "github.com:443\n")
+		assert.Contains(t, view, "api.example.com:443  [runtime]")
+	})
+
+	t.Run("warns about a stale config", func(t *testing.T) {
+		s := newConfigScreen(client, monitor)
+		s.Update(configPollResultMsg{cfg: &merged, stale: true}, w)
+		assert.Contains(t, ansi.Strip(s.FooterStatus(w)), "stale config, restart the session")
+
+		s.Update(configPollResultMsg{cfg: &merged}, w)
+		assert.Equal(t, "live config", ansi.Strip(s.FooterStatus(w)))
+	})
+
+	t.Run("esc returns to the monitor", func(t *testing.T) {
+		s := newConfigScreen(client, monitor)
+		screen, _ := s.Update(tea.KeyPressMsg{Code: tea.KeyEscape}, w)
+		assert.Equal(t, monitor, screen)
+	})
+}
+
+func TestProxyConfigStaleFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	globalPath := filepath.Join(t.TempDir(), "config.yaml")
+	projectPath := config.DefaultProjectPath(projectDir)
+	require.NoError(t, os.MkdirAll(filepath.Dir(projectPath), 0o755))
+	require.NoError(t, os.WriteFile(projectPath, []byte("allow-http:\n  - github.com:443\n"), 0o644))
+
+	started := config.MergedConfig{AllowHTTP: []string{"github.com:443"}}
+	started.ConfigHash = started.PolicyHash()
+
+	stale, err := proxyConfigStale(&started, globalPath, projectDir)
+	require.NoError(t, err)
+	assert.False(t, stale)
+
+	require.NoError(t, config.AppendAllowHTTP(projectPath, []string{"example.com:443"}))
+	stale, err = proxyConfigStale(&started, globalPath, projectDir)
+	require.NoError(t, err)
+	assert.True(t, stale)
+}
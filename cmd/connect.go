@@ -39,7 +39,7 @@ func ConnectCommand() *cli.Command {
 }
 
 func ConnectAction(ctx context.Context, cmd *cli.Command) error {
-	conn, sandbox, err := newSSHClient(ctx, cmd.Root().Bool(debugFlag))
+	conn, sandbox, err := newSSHClient(ctx, cmd)
 	if err != nil {
 		return err
 	}
@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -17,20 +21,33 @@ type ControlClient struct {
 	baseURL string
 }
 
+// NewControlClient connects to the control API on the session's unix socket
+// if it has one, and on its loopback port otherwise.
 func NewControlClient(session *SessionInfo) (*ControlClient, error) {
-	if session.ControlPort == "" {
+	if session.ControlPort == "" && session.ControlSocket == "" {
 		return nil, fmt.Errorf("missing control API port for session %q", session.SessionID)
 	}
 	tlsCfg, err := LoadSessionTLSConfig(session.SessionID)
 	if err != nil {
 		return nil, fmt.Errorf("load TLS credentials: %w", err)
 	}
+	transport := &http.Transport{TLSClientConfig: tlsCfg}
+	baseURL := fmt.Sprintf("https://127.0.0.1:%s", session.ControlPort)
+	if session.ControlSocket != "" {
+		// The proxy certificate is issued for 127.0.0.1, keep that as the
+		// host so it still verifies.
+		var dialer net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", session.ControlSocket)
+		}
+		baseURL = "https://127.0.0.1"
+	}
 	return &ControlClient{
 		http: &http.Client{
 			Timeout:   5 * time.Second,
-			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Transport: transport,
 		},
-		baseURL: fmt.Sprintf("https://127.0.0.1:%s", session.ControlPort),
+		baseURL: baseURL,
 	}, nil
 }
 
@@ -55,6 +72,43 @@ func (c *ControlClient) LogsAfter(afterID uint64) ([]proxy.LogEntry, error) {
 	return entries, nil
 }
 
+// StreamLogs calls fn for each log entry after afterID, first the buffered
+// ones and then new entries as the proxy records them. It returns when ctx
+// is canceled or the proxy ends the stream, which it does when the client
+// falls too far behind; resume with the ID of the last entry seen.
+func (c *ControlClient) StreamLogs(ctx context.Context, afterID uint64, fn func(proxy.LogEntry)) error {
+	path := fmt.Sprintf("/logs/stream?after=%d", afterID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	// The stream runs longer than the request timeout of c.http.
+	stream := &http.Client{Transport: c.http.Transport}
+	resp, err := stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var entry proxy.LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+		fn(entry)
+	}
+}
+
 func (c *ControlClient) Stats() (map[string]proxy.DomainStats, error) {
 	var stats map[string]proxy.DomainStats
 	if err := c.get("/stats", &stats); err != nil {
@@ -71,6 +125,16 @@ func (c *ControlClient) Config() (*config.MergedConfig, error) {
 	return &cfg, nil
 }
 
+// ConfigWithSources returns the live config like Config, including the
+// source of each allow entry in EntrySources.
+func (c *ControlClient) ConfigWithSources() (*config.MergedConfig, error) {
+	var cfg config.MergedConfig
+	if err := c.get("/config?sources=true", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
 // AllowHTTP adds domains to the proxy HTTP allowlist and returns the entries that were added.
 func (c *ControlClient) AllowHTTP(entries []string) ([]string, error) {
 	return c.postAllow("/allow-http", entries)
@@ -82,27 +146,53 @@ func (c *ControlClient) AllowDNS(entries []string) ([]string, error) {
 }
 
 func (c *ControlClient) postAllow(path string, entries []string) ([]string, error) {
-	body, err := json.Marshal(map[string]any{"entries": entries})
+	var result struct {
+		Added []string `json:"added"`
+	}
+	if err := c.post(path, map[string]any{"entries": entries}, &result); err != nil {
+		return nil, err
+	}
+	return result.Added, nil
+}
+
+// Reload replaces the allow and deny lists of the proxy with those of cfg,
+// keeping the entries allowed at runtime, and returns the new config hash.
+// The other settings of cfg only take effect with a restart.
+func (c *ControlClient) Reload(cfg config.MergedConfig) (string, error) {
+	var result struct {
+		ConfigHash string `json:"config-hash"`
+	}
+	if err := c.post("/reload", cfg, &result); err != nil {
+		return "", err
+	}
+	return result.ConfigHash, nil
+}
+
+func (c *ControlClient) post(path string, v any, dest any) error {
+	body, err := json.Marshal(v)
 	if err != nil {
-		return nil, fmt.Errorf("marshal allow entries: %w", err)
+		return fmt.Errorf("marshal %s request: %w", path, err)
 	}
 	resp, err := c.http.Post(c.baseURL+path, "application/json", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("POST %s: %w", path, err)
+		return fmt.Errorf("POST %s: %w", path, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("POST %s: %s", path, resp.Status)
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return fmt.Errorf("POST %s: %s: %s", path, resp.Status, body.Error)
+		}
+		return fmt.Errorf("POST %s: %s", path, resp.Status)
 	}
 
-	var result struct {
-		Added []string `json:"added"`
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode %s response: %w", path, err)
-	}
-	return result.Added, nil
+	return nil
 }
 
 func (c *ControlClient) get(path string, dest any) error {
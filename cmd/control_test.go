@@ -1,9 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/adrg/xdg"
 	"github.com/bernd/vibepit/config"
 	"github.com/bernd/vibepit/proxy"
 	"github.com/stretchr/testify/assert"
@@ -109,13 +116,59 @@ func TestControlClient_Stats(t *testing.T) {
 	assert.Equal(t, proxy.DomainStats{Allowed: 0, Blocked: 1}, stats["b.com"])
 }
 
+func TestControlClient_StreamLogs(t *testing.T) {
+	log := proxy.NewLogBuffer(100)
+	log.Add(proxy.LogEntry{Domain: "a.com", Action: proxy.ActionAllow, Source: proxy.SourceProxy})
+	log.Add(proxy.LogEntry{Domain: "b.com", Action: proxy.ActionBlock, Source: proxy.SourceDNS})
+
+	httpAL, err := proxy.NewHTTPAllowlist(nil)
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	client := testControlClient(t, proxy.NewControlAPI(log, nil, httpAL, dnsAL))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	entries := make(chan proxy.LogEntry, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.StreamLogs(ctx, 1, func(e proxy.LogEntry) { entries <- e })
+	}()
+
+	next := func() proxy.LogEntry {
+		t.Helper()
+		select {
+		case e := <-entries:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a streamed entry")
+			return proxy.LogEntry{}
+		}
+	}
+	assert.Equal(t, "b.com", next().Domain, "buffered entries after the cursor come first")
+
+	// The handler subscribes before sending buffered entries, so an entry
+	// added now arrives exactly once.
+	log.Add(proxy.LogEntry{Domain: "c.com", Action: proxy.ActionAllow, Source: proxy.SourceProxy})
+	e := next()
+	assert.Equal(t, "c.com", e.Domain)
+	assert.Equal(t, uint64(3), e.ID)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamLogs did not return after cancel")
+	}
+}
+
 func TestControlClient_Config(t *testing.T) {
 	merged := config.MergedConfig{
-		AllowHTTP:  []string{"a.com:443", "b.com:443"},
-		AllowDNS:   []string{"c.com"},
-		BlockCIDR:  []string{"10.0.0.0/8"},
-		AllowCIDR:  []string{"100.64.0.0/10"},
-		ExtraHosts: []string{"myhost.local:192.168.1.100"},
+		AllowHTTP:   []string{"a.com:443", "b.com:443"},
+		AllowDNS:    []string{"c.com"},
+		BlockCIDR:   []string{"10.0.0.0/8"},
+		AllowCIDR:   []string{"100.64.0.0/10"},
+		UpstreamDNS: []string{"9.9.9.9:53"},
 	}
 
 	httpAL, err := proxy.NewHTTPAllowlist(nil)
@@ -131,7 +184,7 @@ func TestControlClient_Config(t *testing.T) {
 	assert.Equal(t, []string{"c.com"}, cfg.AllowDNS)
 	assert.Equal(t, []string{"10.0.0.0/8"}, cfg.BlockCIDR)
 	assert.Equal(t, []string{"100.64.0.0/10"}, cfg.AllowCIDR)
-	assert.Equal(t, []string{"myhost.local:192.168.1.100"}, cfg.ExtraHosts)
+	assert.Equal(t, []string{"9.9.9.9:53"}, cfg.UpstreamDNS)
 }
 
 func TestControlClient_AllowHTTP(t *testing.T) {
@@ -189,6 +242,33 @@ func TestControlClient_AllowDNS(t *testing.T) {
 	})
 }
 
+func TestControlClient_Reload(t *testing.T) {
+	httpAL, err := proxy.NewHTTPAllowlist([]string{"old.com:443"})
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	api := proxy.NewControlAPI(proxy.NewLogBuffer(100), proxy.ProxyConfig{AllowHTTP: []string{"old.com:443"}}, httpAL, dnsAL)
+	client := testControlClient(t, api)
+
+	t.Run("replaces the lists and returns the new hash", func(t *testing.T) {
+		merged := config.MergedConfig{
+			AllowHTTP: []string{"new.com:443"},
+			AllowDNS:  []string{"internal.example.com"},
+		}
+		hash, err := client.Reload(merged)
+		require.NoError(t, err)
+		assert.Equal(t, merged.PolicyHash(), hash)
+		assert.Equal(t, []string{"new.com:443"}, httpAL.Entries())
+		assert.True(t, dnsAL.Allows("internal.example.com"))
+	})
+
+	t.Run("malformed entries return the error", func(t *testing.T) {
+		_, err := client.Reload(config.MergedConfig{AllowHTTP: []string{"github.com"}})
+		assert.ErrorContains(t, err, "allow-http")
+		assert.Equal(t, []string{"new.com:443"}, httpAL.Entries())
+	})
+}
+
 func TestControlClient_Close(t *testing.T) {
 	log := proxy.NewLogBuffer(100)
 	api := proxy.NewControlAPI(log, nil, nil, nil)
@@ -225,3 +305,34 @@ func TestControlClient_ServerError(t *testing.T) {
 		assert.ErrorContains(t, err, "400")
 	})
 }
+
+func TestNewControlClientUnixSocket(t *testing.T) {
+	origStateHome := xdg.StateHome
+	xdg.StateHome = t.TempDir()
+	t.Cleanup(func() { xdg.StateHome = origStateHome })
+
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: 24 * time.Hour})
+	require.NoError(t, err)
+	_, err = WriteSessionCredentials("unix-session", creds)
+	require.NoError(t, err)
+	serverTLS, err := creds.ServerTLSConfig()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	log := proxy.NewLogBuffer(100)
+	log.Add(proxy.LogEntry{Domain: "a.com", Action: proxy.ActionAllow, Source: proxy.SourceProxy})
+	srv := &http.Server{Handler: proxy.NewControlAPI(log, nil, nil, nil)}
+	go srv.Serve(tls.NewListener(ln, serverTLS))
+	t.Cleanup(func() { srv.Close() })
+
+	client, err := NewControlClient(&SessionInfo{SessionID: "unix-session", ControlSocket: path})
+	require.NoError(t, err)
+	defer client.Close()
+
+	entries, err := client.Logs()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a.com", entries[0].Domain)
+}
@@ -19,7 +19,7 @@ func DownCommand() *cli.Command {
 }
 
 func DownAction(ctx context.Context, cmd *cli.Command) error {
-	client, err := ctr.NewClient(ctr.WithDebug(cmd.Root().Bool(debugFlag)))
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return err
 	}
@@ -49,6 +49,13 @@ func DownAction(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
+	return stopSession(ctx, client, sessionID)
+}
+
+// stopSession stops and removes the containers and the network of a session
+// and cleans up its credentials. The credentials are kept when a container
+// could not be removed, so the user can retry.
+func stopSession(ctx context.Context, client *ctr.Client, sessionID string) error {
 	containers, err := client.SessionContainers(ctx, sessionID)
 	if err != nil {
 		return fmt.Errorf("find session containers: %w", err)
@@ -66,6 +73,7 @@ func DownAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	networkName := networkNamePrefix + sessionID
+	tui.Status("Removing", "network %s", networkName)
 	if err := client.RemoveNetwork(ctx, networkName); err != nil {
 		tui.Error("remove network %s: %v", networkName, err)
 	}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
+)
+
+// sandboxEnv merges the extra environment variables for the sandbox: the
+// project env map first, then the --env-file files in order, then the --env
+// flags, later values winning. A --env entry without "=" takes the value
+// from lookup and is skipped when that is unset. Variables reserved for the
+// proxy settings are left out and returned as ignored.
+func sandboxEnv(project map[string]string, envFiles, envFlags []string, lookup func(string) (string, bool)) (env []string, ignored []string, err error) {
+	values := make(map[string]string)
+	var order []string
+	set := func(name, value string) error {
+		if err := config.CheckEnvName(name); err != nil {
+			return err
+		}
+		if ctr.ReservedEnv(name) {
+			if !slices.Contains(ignored, name) {
+				ignored = append(ignored, name)
+			}
+			return nil
+		}
+		if _, ok := values[name]; !ok {
+			order = append(order, name)
+		}
+		values[name] = value
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(project)) {
+		if err := set(name, project[name]); err != nil {
+			return nil, nil, fmt.Errorf("env: %w", err)
+		}
+	}
+	for _, path := range envFiles {
+		entries, err := readEnvFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			name, value, _ := strings.Cut(e, "=")
+			if err := set(name, value); err != nil {
+				return nil, nil, fmt.Errorf("env file %s: %w", path, err)
+			}
+		}
+	}
+	for _, e := range envFlags {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok {
+			if value, ok = lookup(name); !ok {
+				continue
+			}
+		}
+		if err := set(name, value); err != nil {
+			return nil, nil, fmt.Errorf("--%s %s: %w", envFlag, e, err)
+		}
+	}
+
+	for _, name := range order {
+		env = append(env, name+"="+values[name])
+	}
+	return env, ignored, nil
+}
+
+// readEnvFile reads KEY=VALUE lines from path. Blank lines and lines
+// starting with "#" are skipped. Values are taken literally, without quote
+// removal, like docker's --env-file.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("env file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			return nil, fmt.Errorf("env file %s: line %d: expected KEY=VALUE", path, n)
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("env file %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxEnv(t *testing.T) {
+	host := map[string]string{"GITHUB_TOKEN": "host-token"}
+	lookup := func(name string) (string, bool) {
+		v, ok := host[name]
+		return v, ok
+	}
+
+	t.Run("later sources win", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sandbox.env")
+		require.NoError(t, os.WriteFile(path, []byte("# editor\nEDITOR=vim\n\nPAGER=less -R\n"), 0o600))
+
+		env, ignored, err := sandboxEnv(
+			map[string]string{"EDITOR": "nano", "LANGUAGE": "en"},
+			[]string{path},
+			[]string{"PAGER=more", "GITHUB_TOKEN", "UNSET_ON_HOST"},
+			lookup,
+		)
+		require.NoError(t, err)
+		assert.Empty(t, ignored)
+		assert.Equal(t, []string{"EDITOR=vim", "LANGUAGE=en", "PAGER=more", "GITHUB_TOKEN=host-token"}, env)
+	})
+
+	t.Run("ignores proxy settings", func(t *testing.T) {
+		env, ignored, err := sandboxEnv(
+			map[string]string{"HTTP_PROXY": "http://evil:8080"},
+			nil,
+			[]string{"https_proxy=http://evil:8080", "HTTP_PROXY=x", "EDITOR=vim"},
+			lookup,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"EDITOR=vim"}, env)
+		assert.Equal(t, []string{"HTTP_PROXY", "https_proxy"}, ignored)
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		_, _, err := sandboxEnv(nil, nil, []string{"=value"}, lookup)
+		assert.ErrorContains(t, err, "--env =value")
+
+		_, _, err = sandboxEnv(map[string]string{"MY VAR": "x"}, nil, nil, lookup)
+		assert.ErrorContains(t, err, "env: invalid variable name")
+	})
+
+	t.Run("rejects malformed env files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sandbox.env")
+		require.NoError(t, os.WriteFile(path, []byte("EDITOR=vim\nPAGER\n"), 0o600))
+
+		_, _, err := sandboxEnv(nil, []string{path}, nil, lookup)
+		assert.ErrorContains(t, err, "line 2: expected KEY=VALUE")
+
+		_, _, err = sandboxEnv(nil, []string{filepath.Join(t.TempDir(), "missing.env")}, nil, lookup)
+		assert.ErrorContains(t, err, "env file")
+	})
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"charm.land/lipgloss/v2"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/bernd/vibepit/tui"
+	"github.com/urfave/cli/v3"
+)
+
+const killAllFlag = "all"
+
+func KillCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "kill",
+		Aliases:     []string{"stop"},
+		Usage:       "Stop a running session of any project",
+		ArgsUsage:   "[session-id-or-project-path]",
+		Description: "Selects a running session, or the one matching the argument, and stops it after confirmation.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "yes", Aliases: []string{"y"}, Usage: "Skip confirmation prompt"},
+			&cli.BoolFlag{Name: killAllFlag, Usage: "Stop every running session"},
+		},
+		Action: KillAction,
+	}
+}
+
+func KillAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool(killAllFlag) {
+		return killAll(ctx, cmd)
+	}
+
+	session, err := discoverSession(ctx, cmd, cmd.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Bool("yes") && !confirmKill(os.Stdin, os.Stdout, session) {
+		fmt.Println("Kill cancelled.")
+		return nil
+	}
+
+	client, err := newContainerClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer client.Close() //nolint:errcheck
+
+	return stopSession(ctx, client, session.SessionID)
+}
+
+// killAll stops every session that has a proxy container. A session that
+// fails to stop doesn't keep the others running.
+func killAll(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Present() {
+		return fmt.Errorf("--%s does not take a session argument", killAllFlag)
+	}
+
+	client, err := newContainerClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer client.Close() //nolint:errcheck
+
+	sessions, err := client.ListProxySessions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		tui.Status("Stopped", "no running sessions")
+		return nil
+	}
+
+	if !cmd.Bool("yes") && !confirmKillAll(os.Stdin, os.Stdout, sessions) {
+		fmt.Println("Kill cancelled.")
+		return nil
+	}
+
+	var errs []error
+	for _, s := range sessions {
+		if err := stopSession(ctx, client, s.SessionID); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", s.SessionID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// confirmKill asks whether to stop the session. Anything but an explicit yes,
+// including a closed stdin, counts as no.
+func confirmKill(r io.Reader, w io.Writer, session *SessionInfo) bool {
+	return confirm(r, w, fmt.Sprintf("Stop session %s for %s?", session.SessionID, session.ProjectDir))
+}
+
+// confirmKillAll lists the sessions and asks whether to stop all of them.
+func confirmKillAll(r io.Reader, w io.Writer, sessions []ctr.ProxySession) bool {
+	for _, s := range sessions {
+		fmt.Fprintf(w, "  %s  %s\n", s.SessionID, s.ProjectDir)
+	}
+	return confirm(r, w, fmt.Sprintf("Stop all %d sessions?", len(sessions)))
+}
+
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	prompt := lipgloss.NewStyle().Foreground(tui.ColorOrange).Bold(true)
+	fmt.Fprint(w, prompt.Render(question)+" [y/N] ")
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmKill(t *testing.T) {
+	session := &SessionInfo{SessionID: "sess-a", ProjectDir: "/home/user/a"}
+	for input, want := range map[string]bool{
+		"y\n":   true,
+		"YES\n": true,
+		"yes":   true,
+		"\n":    false,
+		"n\n":   false,
+		"":      false,
+	} {
+		var out bytes.Buffer
+		assert.Equal(t, want, confirmKill(strings.NewReader(input), &out, session), "input %q", input)
+		assert.Contains(t, out.String(), "sess-a")
+		assert.Contains(t, out.String(), "/home/user/a")
+	}
+}
+
+func TestConfirmKillAll(t *testing.T) {
+	sessions := []ctr.ProxySession{
+		{SessionID: "sess-a", ProjectDir: "/home/user/a"},
+		{SessionID: "sess-b", ProjectDir: "/home/user/b"},
+	}
+
+	var out bytes.Buffer
+	assert.True(t, confirmKillAll(strings.NewReader("y\n"), &out, sessions))
+	for _, want := range []string{"sess-a", "/home/user/a", "sess-b", "/home/user/b", "Stop all 2 sessions?"} {
+		assert.Contains(t, out.String(), want)
+	}
+
+	assert.False(t, confirmKillAll(strings.NewReader("\n"), &out, sessions))
+}
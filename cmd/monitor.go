@@ -12,20 +12,35 @@ import (
 
 // SessionInfo contains the information needed to connect to a proxy's control API.
 type SessionInfo struct {
-	ControlPort string
-	SessionID   string
-	ProjectDir  string
+	ControlPort   string
+	ControlSocket string // host path of the control API socket, if used
+	SessionID     string
+	ProjectDir    string
+
+	// Allow, Presets and Profiles are the command line flags the session
+	// started with.
+	Allow    []string
+	Presets  []string
+	Profiles []string
 }
 
+const readOnlyFlag = "read-only"
+
 func MonitorCommand() *cli.Command {
 	return &cli.Command{
 		Name:     "monitor",
 		Aliases:  []string{"m", "tv"},
 		Usage:    "Connect to a running proxy for logs and admin",
 		Category: "Utilities",
-		Flags:    []cli.Flag{sessionFlag},
+		Flags: []cli.Flag{
+			sessionFlag,
+			&cli.BoolFlag{
+				Name:  readOnlyFlag,
+				Usage: "Hide and disable the allow keybindings",
+			},
+		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			client, err := ctr.NewClient()
+			client, err := newContainerClient(cmd)
 			if err != nil {
 				return fmt.Errorf("cannot create container client: %w", err)
 			}
@@ -44,7 +59,10 @@ func MonitorCommand() *cli.Command {
 				if err != nil {
 					return nil, func() tea.Msg { return sessionErrorMsg{err} }
 				}
-				return newMonitorScreen(info, cc, onBack), nil
+				screen := newMonitorScreen(info, cc, onBack)
+				screen.readOnly = cmd.Bool(readOnlyFlag)
+				screen.sampleStats = sandboxStats(client, info)
+				return screen, nil
 			}
 
 			filter := cmd.String("session")
@@ -55,14 +73,9 @@ func MonitorCommand() *cli.Command {
 
 			var session *SessionInfo
 			if filter != "" {
-				for _, ps := range sessions {
-					if matchSession(ps, filter) {
-						session = sessionInfoFromProxy(ps)
-						break
-					}
-				}
-				if session == nil {
-					return fmt.Errorf("no session matching %q found", filter)
+				session, err = findSession(sessions, filter)
+				if err != nil {
+					return err
 				}
 			} else if len(sessions) == 1 {
 				session = sessionInfoFromProxy(sessions[0])
@@ -75,6 +88,8 @@ func MonitorCommand() *cli.Command {
 				}
 				defer cc.Close()
 				screen := newMonitorScreen(session, cc, onBack)
+				screen.readOnly = cmd.Bool(readOnlyFlag)
+				screen.sampleStats = sandboxStats(client, session)
 				header := &tui.HeaderInfo{ProjectDir: session.ProjectDir, SessionID: session.SessionID}
 				return runTUI(header, screen)
 			}
@@ -85,6 +100,22 @@ func MonitorCommand() *cli.Command {
 	}
 }
 
+// sandboxStats returns a function that samples the resource usage of the
+// sandbox container of the session. The container is looked up on every
+// sample, so a restarted sandbox is picked up.
+func sandboxStats(client *ctr.Client, info *SessionInfo) func(ctx context.Context) (ctr.ContainerStats, error) {
+	return func(ctx context.Context) (ctr.ContainerStats, error) {
+		running, err := client.FindRunningSessionByID(ctx, info.ProjectDir, info.SessionID)
+		if err != nil {
+			return ctr.ContainerStats{}, err
+		}
+		if running == nil {
+			return ctr.ContainerStats{}, fmt.Errorf("sandbox container of session %s is not running", info.SessionID)
+		}
+		return client.ContainerStats(ctx, running.ContainerID)
+	}
+}
+
 func selectorHeader() *tui.HeaderInfo {
 	return &tui.HeaderInfo{ProjectDir: "vibepit", SessionID: "session selector"}
 }
@@ -1,16 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"image/color"
 	"strings"
 	"time"
+	"unicode"
 
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
 	"github.com/bernd/vibepit/proxy"
 	"github.com/bernd/vibepit/tui"
+	"github.com/charmbracelet/x/ansi"
 )
 
 // allowStatus tracks whether a log entry has been temporarily or permanently
@@ -23,8 +27,20 @@ const (
 	statusSaved             // saved to persistent allow list
 )
 
+// saveTarget selects the config file an allowed entry is persisted to.
+type saveTarget int
+
+const (
+	saveNone    saveTarget = iota
+	saveProject            // project .vibepit/network.yaml
+	saveGlobal             // global config, applies to every project
+)
+
 const pollInterval = time.Second
 
+// maxPollBackoff caps the delay between log polls after consecutive failures.
+const maxPollBackoff = 10 * time.Second
+
 const disconnectGracePeriod = 3 * time.Second
 
 var disconnectGraceTicks = int(disconnectGracePeriod / tui.TickInterval)
@@ -46,7 +62,15 @@ type monitorScreen struct {
 	items          []logItem
 	newCount       int
 	firstTickSeen  bool
-	disconnectTick int // -1 = connected, 0+ = ticks since disconnect
+	disconnectTick int  // -1 = connected, 0+ = ticks since disconnect
+	readOnly       bool // hides and disables the allow keybindings
+	pollFailures   int  // consecutive failed log polls
+	retryTick      int  // ticks since the last failed poll
+	globalPath     string
+
+	// sampleStats samples the resource usage of the session's sandbox
+	// container. The usage screen is only available when it is set.
+	sampleStats func(ctx context.Context) (ctr.ContainerStats, error)
 }
 
 func newMonitorScreen(session *SessionInfo, client *ControlClient, onBack func() tui.Screen) *monitorScreen {
@@ -55,6 +79,7 @@ func newMonitorScreen(session *SessionInfo, client *ControlClient, onBack func()
 		client:         client,
 		onBack:         onBack,
 		disconnectTick: -1,
+		globalPath:     config.DefaultGlobalPath(),
 	}
 }
 
@@ -62,6 +87,7 @@ func newMonitorScreen(session *SessionInfo, client *ControlClient, onBack func()
 type allowResultMsg struct {
 	index  int
 	status allowStatus
+	path   string // config file the entry was saved to, if any
 	err    error
 }
 
@@ -71,14 +97,21 @@ type logsPollResultMsg struct {
 	err     error
 }
 
+// allowValueForEntry returns the allowlist entry for a log entry. Proxy
+// entries always carry a port, defaulting to 443 for CONNECT requests logged
+// without one, so the saved allow-http entry is a valid domain:port rule.
 func allowValueForEntry(entry proxy.LogEntry) string {
-	if entry.Source == proxy.SourceProxy && entry.Port != "" {
-		return entry.Domain + ":" + entry.Port
+	if entry.Source != proxy.SourceProxy {
+		return entry.Domain
+	}
+	port := entry.Port
+	if port == "" {
+		port = "443"
 	}
-	return entry.Domain
+	return entry.Domain + ":" + port
 }
 
-func (s *monitorScreen) allowCmd(index int, entry proxy.LogEntry, save bool) tea.Cmd {
+func (s *monitorScreen) allowCmd(index int, entry proxy.LogEntry, target saveTarget) tea.Cmd {
 	return func() tea.Msg {
 		value := allowValueForEntry(entry)
 
@@ -93,21 +126,29 @@ func (s *monitorScreen) allowCmd(index int, entry proxy.LogEntry, save bool) tea
 			return allowResultMsg{index: index, err: err}
 		}
 
-		status := statusTemp
-		if save {
-			status = statusSaved
-			projectPath := config.DefaultProjectPath(s.session.ProjectDir)
-			switch entry.Source {
-			case proxy.SourceDNS:
-				err = config.AppendAllowDNS(projectPath, []string{value})
-			default:
-				err = config.AppendAllowHTTP(projectPath, []string{value})
+		var path string
+		switch target {
+		case saveProject:
+			path = config.DefaultProjectPath(s.session.ProjectDir)
+			if entry.Source == proxy.SourceDNS {
+				err = config.AppendAllowDNS(path, []string{value})
+			} else {
+				err = config.AppendAllowHTTP(path, []string{value})
 			}
-			if err != nil {
-				return allowResultMsg{index: index, err: err}
+		case saveGlobal:
+			path = s.globalPath
+			if entry.Source == proxy.SourceDNS {
+				err = config.AppendGlobalAllowDNS(path, []string{value})
+			} else {
+				err = config.AppendGlobalAllowHTTP(path, []string{value})
 			}
+		case saveNone:
+			return allowResultMsg{index: index, status: statusTemp}
+		}
+		if err != nil {
+			return allowResultMsg{index: index, err: err}
 		}
-		return allowResultMsg{index: index, status: status}
+		return allowResultMsg{index: index, status: statusSaved, path: path}
 	}
 }
 
@@ -126,18 +167,85 @@ func (s *monitorScreen) pollLogsCmd(afterID uint64) tea.Cmd {
 	}
 }
 
+// pollBackoff returns the delay before the next log poll after the given
+// number of consecutive failures. The delay doubles per failure starting at
+// pollInterval and is capped at maxPollBackoff.
+func pollBackoff(failures int) time.Duration {
+	d := pollInterval
+	for range failures {
+		d *= 2
+		if d >= maxPollBackoff {
+			return maxPollBackoff
+		}
+	}
+	return d
+}
+
+// nextBlocked returns the index of the closest blocked entry after from when
+// dir is 1, or before it when dir is -1. It returns -1 at the ends instead of
+// wrapping around.
+func (s *monitorScreen) nextBlocked(from, dir int) int {
+	for i := from + dir; i >= 0 && i < len(s.items); i += dir {
+		if s.items[i].entry.Action == proxy.ActionBlock {
+			return i
+		}
+	}
+	return -1
+}
+
 func (s *monitorScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyPressMsg:
 		switch msg.String() {
-		case "a", "A":
+		case "a", "A", "S":
+			if s.readOnly {
+				break
+			}
 			if s.cursor.Pos >= 0 && s.cursor.Pos < len(s.items) {
 				item := s.items[s.cursor.Pos]
 				if item.entry.Action == proxy.ActionBlock && item.status == statusNone {
-					return s, s.allowCmd(s.cursor.Pos, item.entry, msg.String() == "A")
+					target := saveNone
+					switch msg.String() {
+					case "A":
+						target = saveProject
+					case "S":
+						target = saveGlobal
+					}
+					return s, s.allowCmd(s.cursor.Pos, item.entry, target)
 				}
 				w.SetFlash("already allowed")
 			}
+		case "c":
+			if s.client != nil {
+				cs := newConfigScreen(s.client, s)
+				cs.projectDir = s.session.ProjectDir
+				cs.globalPath = s.globalPath
+				return cs, nil
+			}
+		case "i":
+			if s.cursor.Pos >= 0 && s.cursor.Pos < len(s.items) && s.items[s.cursor.Pos].entry.Domain != "" {
+				screen := newResolveScreen(s.client, s, s.items[s.cursor.Pos].entry.Domain)
+				return screen, screen.resolveCmd()
+			}
+		case "u":
+			if s.sampleStats != nil {
+				return newStatsScreen(s, s.sampleStats), nil
+			}
+		case "n", "N":
+			dir := 1
+			if msg.String() == "N" {
+				dir = -1
+			}
+			i := s.nextBlocked(s.cursor.Pos, dir)
+			if i < 0 {
+				w.SetFlash("no more blocked entries")
+				break
+			}
+			s.cursor.Pos = i
+			s.cursor.EnsureVisible()
+			if s.cursor.AtEnd() {
+				s.newCount = 0
+			}
 		case "esc":
 			if s.onBack != nil {
 				return s.transitionBack(w), nil
@@ -171,7 +279,7 @@ func (s *monitorScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd)
 			case statusTemp:
 				w.SetFlash(fmt.Sprintf("allowed %s", domain))
 			case statusSaved:
-				w.SetFlash(fmt.Sprintf("allowed and saved %s", domain))
+				w.SetFlash(fmt.Sprintf("allowed and saved %s to %s", domain, msg.path))
 			case statusNone:
 				// ignored
 			}
@@ -188,9 +296,12 @@ func (s *monitorScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd)
 			} else {
 				w.SetError(msg.err)
 			}
+			s.pollFailures++
+			s.retryTick = 0
 			break
 		}
 		s.disconnectTick = -1
+		s.pollFailures = 0
 		w.ClearError()
 
 		wasAtEnd := len(s.items) == 0 || s.cursor.AtEnd()
@@ -218,6 +329,16 @@ func (s *monitorScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd)
 			return s, nil // Don't poll while disconnected.
 		}
 
+		if s.pollFailures > 0 {
+			s.firstTickSeen = true
+			s.retryTick++
+			if s.pollInFlight || s.client == nil || s.retryTick < int(pollBackoff(s.pollFailures)/tui.TickInterval) {
+				break
+			}
+			s.pollInFlight = true
+			return s, s.pollLogsCmd(s.pollCursor)
+		}
+
 		if (w.IntervalElapsed(pollInterval) || !s.firstTickSeen) && !s.pollInFlight {
 			s.firstTickSeen = true
 			if s.client == nil {
@@ -244,13 +365,13 @@ func (s *monitorScreen) View(w *tui.Window) string {
 	return strings.Join(logLines, "\n")
 }
 
-var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
-
 func (s *monitorScreen) FooterStatus(w *tui.Window) string {
 	isTailing := len(s.items) == 0 || s.cursor.AtEnd()
 	var indicator string
-	if isTailing {
-		glyph := spinnerFrames[w.TickFrame()%len(spinnerFrames)]
+	if s.pollFailures > 0 {
+		indicator = lipgloss.NewStyle().Foreground(tui.ColorOrange).Render("reconnecting…")
+	} else if isTailing {
+		glyph := tui.SpinnerFrames[w.TickFrame()%len(tui.SpinnerFrames)]
 		indicator = lipgloss.NewStyle().Foreground(tui.ColorCyan).Render(glyph)
 	} else {
 		indicator = lipgloss.NewStyle().Foreground(tui.ColorField).Render("⠿")
@@ -267,13 +388,14 @@ func (s *monitorScreen) FooterStatus(w *tui.Window) string {
 func (s *monitorScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
 	var keys []tui.FooterKey
 
-	if s.cursor.Pos >= 0 && s.cursor.Pos < len(s.items) {
+	if !s.readOnly && s.cursor.Pos >= 0 && s.cursor.Pos < len(s.items) {
 		item := s.items[s.cursor.Pos]
 		switch {
 		case item.entry.Action == proxy.ActionBlock && item.status == statusNone:
 			keys = append(keys,
 				tui.FooterKey{Key: "a", Desc: "allow"},
 				tui.FooterKey{Key: "A", Desc: "allow+save"},
+				tui.FooterKey{Key: "S", Desc: "allow+global"},
 			)
 		case item.status == statusTemp:
 			keys = append(keys,
@@ -282,6 +404,18 @@ func (s *monitorScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
 		}
 	}
 
+	if s.cursor.Pos >= 0 && s.cursor.Pos < len(s.items) {
+		keys = append(keys, tui.FooterKey{Key: "i", Desc: "resolve"})
+	}
+	if len(s.items) > 0 {
+		keys = append(keys, tui.FooterKey{Key: "n/N", Desc: "blocks"})
+	}
+	if s.client != nil {
+		keys = append(keys, tui.FooterKey{Key: "c", Desc: "config"})
+	}
+	if s.sampleStats != nil {
+		keys = append(keys, tui.FooterKey{Key: "u", Desc: "usage"})
+	}
 	if s.onBack != nil {
 		keys = append(keys, tui.FooterKey{Key: "esc", Desc: "sessions"})
 	}
@@ -290,6 +424,21 @@ func (s *monitorScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
 	return keys
 }
 
+// maxLogPathWidth caps the request path shown in a log line, so the reason
+// stays visible.
+const maxLogPathWidth = 48
+
+// stripControl removes control characters (C0, C1 and DEL) from client
+// controlled text to prevent terminal escape injection.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
 func renderLogLine(item logItem, highlighted bool) string {
 	e := item.entry
 	base, marker := tui.LineStyle(highlighted)
@@ -317,6 +466,19 @@ func renderLogLine(item logItem, highlighted bool) string {
 	ts := base.Foreground(tui.ColorField).Render(e.Time.Format("15:04:05"))
 	src := base.Foreground(sourceColor).Render(fmt.Sprintf("%-5s", string(e.Source)))
 	hostStr := base.Render(host)
+	if e.QType != "" {
+		hostStr += base.Render(" ") + base.Foreground(tui.ColorField).Render(e.QType)
+	}
+	if e.Method != "" {
+		req := stripControl(e.Method)
+		if e.Path != "" {
+			req += " " + ansi.Truncate(stripControl(e.Path), maxLogPathWidth, "…")
+		}
+		hostStr += base.Render(" ") + base.Foreground(tui.ColorField).Render(req)
+	}
+	if e.Agent != "" {
+		hostStr += base.Render(" ") + base.Foreground(tui.ColorField).Render(e.Agent)
+	}
 	reasonStr := base.Render(e.Reason)
 	sp := base.Render(" ")
 	return marker + base.Render("[") + ts + base.Render("]") + sp + symbol + sp + src + sp + hostStr + sp + reasonStr
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,11 +9,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	tea "charm.land/bubbletea/v2"
 	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
 	"github.com/bernd/vibepit/proxy"
 	"github.com/bernd/vibepit/tui"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -101,6 +105,56 @@ func TestRenderLogLine_Block(t *testing.T) {
 	require.Contains(t, line, "not allowed")
 }
 
+func TestRenderLogLine_DNSQueryType(t *testing.T) {
+	item := logItem{
+		entry: proxy.LogEntry{
+			Domain: "example.com",
+			QType:  "AAAA",
+			Action: proxy.ActionBlock,
+			Source: proxy.SourceDNS,
+			Reason: "domain not in allowlist",
+		},
+	}
+	line := ansi.Strip(renderLogLine(item, false))
+	require.Contains(t, line, "example.com AAAA domain not in allowlist")
+}
+
+func TestRenderLogLine_Agent(t *testing.T) {
+	item := logItem{
+		entry: proxy.LogEntry{
+			Domain: "example.com",
+			Port:   "443",
+			Agent:  "claude-cli",
+			Action: proxy.ActionBlock,
+			Source: proxy.SourceProxy,
+			Reason: "domain not in allowlist",
+		},
+	}
+	line := ansi.Strip(renderLogLine(item, false))
+	require.Contains(t, line, "example.com:443 claude-cli domain not in allowlist")
+}
+
+func TestRenderLogLine_MethodAndPath(t *testing.T) {
+	item := logItem{
+		entry: proxy.LogEntry{
+			Domain: "api.example.com",
+			Port:   "80",
+			Method: "DELETE",
+			Path:   "/v1/users/42\x1b[2J",
+			Action: proxy.ActionAllow,
+			Source: proxy.SourceProxy,
+		},
+	}
+	line := ansi.Strip(renderLogLine(item, false))
+	assert.Contains(t, line, "api.example.com:80 DELETE /v1/users/42[2J")
+	assert.NotContains(t, renderLogLine(item, false), "\x1b[2J")
+
+	item.entry.Path = "/" + strings.Repeat("a", 100)
+	line = ansi.Strip(renderLogLine(item, false))
+	assert.Contains(t, line, "DELETE /"+strings.Repeat("a", maxLogPathWidth-2)+"…")
+	assert.NotContains(t, line, strings.Repeat("a", maxLogPathWidth))
+}
+
 func TestRenderLogLine_AllowStatuses(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -184,6 +238,39 @@ func TestMonitorScreen_FlashOnAlreadyAllowed(t *testing.T) {
 	assert.Equal(t, "already allowed", w.Flash())
 }
 
+func TestMonitorScreen_ReadOnly(t *testing.T) {
+	t.Run("allow keys are ignored", func(t *testing.T) {
+		s, w := makeTestSetup(5)
+		s.readOnly = true
+		s.cursor.Pos = 2
+
+		for _, key := range []string{"a", "A"} {
+			_, cmd := s.Update(tea.KeyPressMsg{Code: rune(key[0]), Text: key}, w)
+			assert.Nil(t, cmd)
+		}
+		assert.Equal(t, statusNone, s.items[2].status)
+		assert.Empty(t, w.Flash())
+	})
+
+	t.Run("hides allow keys on blocked entry", func(t *testing.T) {
+		s, w := makeTestSetup(5)
+		s.readOnly = true
+		s.cursor.Pos = 2
+		descs := footerKeyDescs(s.FooterKeys(w))
+		assert.NotContains(t, descs, "allow")
+		assert.NotContains(t, descs, "allow+save")
+		assert.Contains(t, descs, "navigate")
+	})
+
+	t.Run("hides save key on temp-allowed entry", func(t *testing.T) {
+		s, w := makeTestSetup(5)
+		s.readOnly = true
+		s.items[2].status = statusTemp
+		s.cursor.Pos = 2
+		assert.NotContains(t, footerKeyDescs(s.FooterKeys(w)), "save")
+	})
+}
+
 func TestMonitorScreen_CursorNavigation(t *testing.T) {
 	t.Run("j moves cursor down", func(t *testing.T) {
 		s, w := makeTestSetup(20)
@@ -247,6 +334,7 @@ func TestMonitorScreen_Footer(t *testing.T) {
 		descs := footerKeyDescs(keys)
 		assert.Contains(t, descs, "allow")
 		assert.Contains(t, descs, "allow+save")
+		assert.Contains(t, descs, "allow+global")
 	})
 
 	t.Run("hides allow keys on allowed entry", func(t *testing.T) {
@@ -269,6 +357,15 @@ func TestMonitorScreen_Footer(t *testing.T) {
 		assert.NotContains(t, descs, "allow+save")
 	})
 
+	t.Run("shows block navigation and usage keys", func(t *testing.T) {
+		s, w := makeTestSetup(5)
+		assert.Contains(t, footerKeyDescs(s.FooterKeys(w)), "blocks")
+		assert.NotContains(t, footerKeyDescs(s.FooterKeys(w)), "usage")
+
+		s.sampleStats = func(ctx context.Context) (ctr.ContainerStats, error) { return ctr.ContainerStats{}, nil }
+		assert.Contains(t, footerKeyDescs(s.FooterKeys(w)), "usage")
+	})
+
 	t.Run("shows new message count", func(t *testing.T) {
 		s, w := makeTestSetup(5)
 		s.newCount = 3
@@ -371,6 +468,23 @@ func TestMonitorScreen_TickPollingIsAsync(t *testing.T) {
 	assert.Equal(t, 1, requests)
 }
 
+func TestAllowValueForEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry proxy.LogEntry
+		want  string
+	}{
+		{"proxy with port", proxy.LogEntry{Domain: "example.com", Port: "8080", Source: proxy.SourceProxy}, "example.com:8080"},
+		{"proxy without port defaults to 443", proxy.LogEntry{Domain: "example.com", Source: proxy.SourceProxy}, "example.com:443"},
+		{"dns has no port", proxy.LogEntry{Domain: "example.com", Port: "53", Source: proxy.SourceDNS}, "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, allowValueForEntry(tt.entry))
+		})
+	}
+}
+
 func TestMonitorScreen_AllowCmd_SourceRouting(t *testing.T) {
 	makeScreen := func(t *testing.T) (*monitorScreen, *proxy.HTTPAllowlist, *proxy.DNSAllowlist, string) {
 		t.Helper()
@@ -400,7 +514,7 @@ func TestMonitorScreen_AllowCmd_SourceRouting(t *testing.T) {
 			Domain: "api.openai.com",
 			Port:   "443",
 			Source: proxy.SourceProxy,
-		}, true)()
+		}, saveProject)()
 		result, ok := msg.(allowResultMsg)
 		require.True(t, ok)
 		require.NoError(t, result.err)
@@ -420,7 +534,7 @@ func TestMonitorScreen_AllowCmd_SourceRouting(t *testing.T) {
 		msg := screen.allowCmd(0, proxy.LogEntry{
 			Domain: "internal.example.com",
 			Source: proxy.SourceDNS,
-		}, true)()
+		}, saveProject)()
 		result, ok := msg.(allowResultMsg)
 		require.True(t, ok)
 		require.NoError(t, result.err)
@@ -433,6 +547,60 @@ func TestMonitorScreen_AllowCmd_SourceRouting(t *testing.T) {
 		assert.Contains(t, cfg.Project.AllowDNS, "internal.example.com")
 		assert.NotContains(t, cfg.Project.AllowHTTP, "internal.example.com")
 	})
+
+	t.Run("proxy entry without port is saved with 443", func(t *testing.T) {
+		screen, httpAllowlist, _, projectPath := makeScreen(t)
+
+		msg := screen.allowCmd(0, proxy.LogEntry{
+			Domain: "example.com",
+			Source: proxy.SourceProxy,
+		}, saveProject)()
+		result, ok := msg.(allowResultMsg)
+		require.True(t, ok)
+		require.NoError(t, result.err)
+		assert.True(t, httpAllowlist.Allows("example.com", "443"))
+
+		cfg, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml"), projectPath)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com:443"}, cfg.Project.AllowHTTP)
+	})
+
+	t.Run("global save writes to the global config", func(t *testing.T) {
+		screen, httpAllowlist, _, projectPath := makeScreen(t)
+		screen.globalPath = filepath.Join(t.TempDir(), "vibepit", "config.yaml")
+
+		msg := screen.allowCmd(0, proxy.LogEntry{
+			Domain: "artifacts.corp.example.com",
+			Port:   "443",
+			Source: proxy.SourceProxy,
+		}, saveGlobal)()
+		result, ok := msg.(allowResultMsg)
+		require.True(t, ok)
+		require.NoError(t, result.err)
+		assert.Equal(t, statusSaved, result.status)
+		assert.Equal(t, screen.globalPath, result.path)
+		assert.True(t, httpAllowlist.Allows("artifacts.corp.example.com", "443"))
+
+		cfg, err := config.Load(screen.globalPath, projectPath)
+		require.NoError(t, err)
+		assert.Contains(t, cfg.Global.AllowHTTP, "artifacts.corp.example.com:443")
+		assert.NotContains(t, cfg.Project.AllowHTTP, "artifacts.corp.example.com:443")
+	})
+
+	t.Run("session-only allow does not save", func(t *testing.T) {
+		screen, _, dnsAllowlist, _ := makeScreen(t)
+
+		msg := screen.allowCmd(0, proxy.LogEntry{
+			Domain: "internal.example.com",
+			Source: proxy.SourceDNS,
+		}, saveNone)()
+		result, ok := msg.(allowResultMsg)
+		require.True(t, ok)
+		require.NoError(t, result.err)
+		assert.Equal(t, statusTemp, result.status)
+		assert.Empty(t, result.path)
+		assert.True(t, dnsAllowlist.Allows("internal.example.com"))
+	})
 }
 
 func TestMonitorScreen_EscReturnsSessionScreen(t *testing.T) {
@@ -491,6 +659,74 @@ func TestMonitorScreen_DisconnectTransition(t *testing.T) {
 	})
 }
 
+func TestPollBackoff(t *testing.T) {
+	assert.Equal(t, pollInterval, pollBackoff(0))
+	assert.Equal(t, 2*time.Second, pollBackoff(1))
+	assert.Equal(t, 4*time.Second, pollBackoff(2))
+	assert.Equal(t, 8*time.Second, pollBackoff(3))
+	assert.Equal(t, maxPollBackoff, pollBackoff(4))
+	assert.Equal(t, maxPollBackoff, pollBackoff(100))
+}
+
+func TestMonitorScreen_PollBackoff(t *testing.T) {
+	newFailingScreen := func() (*monitorScreen, *tui.Window) {
+		client := &ControlClient{
+			http: &http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					return nil, fmt.Errorf("connection refused")
+				}),
+			},
+			baseURL: "https://proxy.local",
+		}
+		s, w := makeTestSetup(5)
+		s.client = client
+		return s, w
+	}
+
+	t.Run("waits longer after each failure", func(t *testing.T) {
+		s, w := newFailingScreen()
+
+		s.Update(logsPollResultMsg{err: fmt.Errorf("connection refused")}, w)
+		s.Update(logsPollResultMsg{err: fmt.Errorf("connection refused")}, w)
+		require.Equal(t, 2, s.pollFailures)
+
+		waitTicks := int(pollBackoff(2) / tui.TickInterval)
+		for range waitTicks - 1 {
+			_, cmd := s.Update(tui.TickMsg{}, w)
+			assert.Nil(t, cmd, "should not poll before the backoff elapsed")
+		}
+		_, cmd := s.Update(tui.TickMsg{}, w)
+		require.NotNil(t, cmd, "should poll once the backoff elapsed")
+		assert.True(t, s.pollInFlight)
+
+		msg := cmd()
+		s.Update(msg, w)
+		assert.Equal(t, 3, s.pollFailures)
+		assert.Equal(t, 0, s.retryTick)
+	})
+
+	t.Run("success resets the cadence", func(t *testing.T) {
+		s, w := newFailingScreen()
+		s.Update(logsPollResultMsg{err: fmt.Errorf("connection refused")}, w)
+		require.Equal(t, 1, s.pollFailures)
+
+		s.Update(logsPollResultMsg{}, w)
+		assert.Equal(t, 0, s.pollFailures)
+		assert.NoError(t, w.Err())
+	})
+
+	t.Run("shows reconnecting indicator", func(t *testing.T) {
+		s, w := newFailingScreen()
+		assert.NotContains(t, s.FooterStatus(w), "reconnecting")
+
+		s.Update(logsPollResultMsg{err: fmt.Errorf("connection refused")}, w)
+		assert.Contains(t, s.FooterStatus(w), "reconnecting")
+
+		s.Update(logsPollResultMsg{}, w)
+		assert.NotContains(t, s.FooterStatus(w), "reconnecting")
+	})
+}
+
 func TestMonitorScreen_EscResetsHeader(t *testing.T) {
 	s, w := makeTestSetup(5)
 	stub := &testStubScreen{}
@@ -513,3 +749,32 @@ func TestMonitorScreen_DisconnectFooterMessage(t *testing.T) {
 	assert.Contains(t, w.Err().Error(), "test123456")
 	assert.Contains(t, w.Err().Error(), "disconnected")
 }
+
+func TestMonitorScreen_NextBlock(t *testing.T) {
+	s, w := makeTestSetup(6)
+	for _, i := range []int{0, 2, 3, 5} {
+		s.items[i].entry.Action = proxy.ActionAllow
+	}
+	s.cursor.Pos = 0
+	press := func(key rune) {
+		s.Update(tea.KeyPressMsg{Code: key, Text: string(key)}, w)
+	}
+
+	press('n')
+	assert.Equal(t, 1, s.cursor.Pos)
+	press('n')
+	assert.Equal(t, 4, s.cursor.Pos)
+
+	t.Run("stops at the last blocked entry", func(t *testing.T) {
+		press('n')
+		assert.Equal(t, 4, s.cursor.Pos)
+		assert.Contains(t, ansi.Strip(w.View().Content), "no more blocked entries")
+	})
+
+	t.Run("N moves backwards", func(t *testing.T) {
+		press('N')
+		assert.Equal(t, 1, s.cursor.Pos)
+		press('N')
+		assert.Equal(t, 1, s.cursor.Pos)
+	})
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/urfave/cli/v3"
+)
+
+const psJSONFlag = "json"
+
+func PsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ps",
+		Usage: "List running sessions",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  psJSONFlag,
+				Usage: "Print the sessions as JSON",
+			},
+		},
+		Action: PsAction,
+	}
+}
+
+func PsAction(ctx context.Context, cmd *cli.Command) error {
+	client, err := newContainerClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer client.Close() //nolint:errcheck
+
+	sessions, err := client.ListProxySessions(ctx)
+	if err != nil {
+		return err
+	}
+	if cmd.Bool(psJSONFlag) {
+		if sessions == nil {
+			sessions = []ctr.ProxySession{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sessions)
+	}
+	return printSessionTable(os.Stdout, sessions, time.Now())
+}
+
+// printSessionTable writes one aligned row per session. Sessions are listed
+// by their proxy container, so a session whose sandbox has exited still shows
+// up.
+func printSessionTable(w io.Writer, sessions []ctr.ProxySession, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tPROJECT\tCONTROL API\tUPTIME\tCONTAINER")
+	for _, s := range sessions {
+		control := s.ControlPort
+		if s.ControlSocket != "" {
+			control = "unix:" + s.ControlSocket
+		}
+		uptime := "-"
+		if !s.StartedAt.IsZero() {
+			uptime = formatUptime(s.StartedAt, now)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.SessionID, s.ProjectDir, control, uptime, shortID(s.ContainerID))
+	}
+	return tw.Flush()
+}
+
+// shortID returns the 12 character prefix of a container ID the docker CLI
+// shows.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
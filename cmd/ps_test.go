@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintSessionTable(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("aligned rows", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, printSessionTable(&buf, []ctr.ProxySession{
+			{
+				ContainerID: "0123456789abcdef0123",
+				SessionID:   "cq1abc2def3gh4ij",
+				ControlPort: "41923",
+				ProjectDir:  "/home/user/project",
+				StartedAt:   now.Add(-90 * time.Minute),
+			},
+			{
+				ContainerID:   "fedcba987654",
+				SessionID:     "zz9",
+				ControlSocket: "/run/user/1000/vibepit/control/control.sock",
+				ProjectDir:    "/srv/app",
+			},
+		}, now))
+
+		lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, []string{"SESSION", "PROJECT", "CONTROL", "API", "UPTIME", "CONTAINER"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"cq1abc2def3gh4ij", "/home/user/project", "41923", "1h", "30m", "0123456789ab"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"zz9", "/srv/app", "unix:/run/user/1000/vibepit/control/control.sock", "-", "fedcba987654"}, strings.Fields(lines[2]))
+
+		col := strings.Index(lines[0], "PROJECT")
+		assert.Equal(t, col, strings.Index(lines[1], "/home/user/project"), "columns are aligned")
+		assert.Equal(t, col, strings.Index(lines[2], "/srv/app"), "columns are aligned")
+	})
+
+	t.Run("no sessions prints the header", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, printSessionTable(&buf, nil, now))
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	})
+}
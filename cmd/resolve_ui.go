@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/bernd/vibepit/tui"
+)
+
+const resolveTimeout = 5 * time.Second
+
+// resolvedIP is a single address a domain resolved to and whether the
+// proxy's CIDR rules would block it.
+type resolvedIP struct {
+	ip      net.IP
+	blocked bool
+}
+
+// resolveResultMsg is returned by the async lookup.
+type resolveResultMsg struct {
+	ips []resolvedIP
+	err error
+}
+
+// resolveScreen implements tui.Screen for showing the addresses a domain
+// currently resolves to. The lookup runs on the host, so the result can
+// differ from what the proxy sees through its upstream resolver.
+type resolveScreen struct {
+	tui.Cursor
+	client *ControlClient
+	back   tui.Screen
+	domain string
+	lookup func(ctx context.Context, network, host string) ([]net.IP, error)
+	ips    []resolvedIP
+	loaded bool
+}
+
+func newResolveScreen(client *ControlClient, back tui.Screen, domain string) *resolveScreen {
+	return &resolveScreen{
+		client: client,
+		back:   back,
+		domain: domain,
+		lookup: net.DefaultResolver.LookupIP,
+	}
+}
+
+// checkResolvedIPs marks each address that falls into a blocked CIDR range.
+func checkResolvedIPs(ips []net.IP, cidr *proxy.CIDRBlocker) []resolvedIP {
+	result := make([]resolvedIP, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, resolvedIP{ip: ip, blocked: cidr.IsBlocked(ip)})
+	}
+	return result
+}
+
+func (s *resolveScreen) resolveCmd() tea.Cmd {
+	return func() tea.Msg {
+		// Check against the CIDR rules the proxy is enforcing. Without a
+		// client only the default blocked ranges apply.
+		cidr := proxy.NewCIDRBlocker(nil, nil)
+		if s.client != nil {
+			cfg, err := s.client.Config()
+			if err != nil {
+				return resolveResultMsg{err: err}
+			}
+			cidr = proxy.NewCIDRBlocker(cfg.BlockCIDR, cfg.AllowCIDR)
+			if cfg.AllowPrivateNetwork {
+				cidr = proxy.NewPrivateNetworkCIDRBlocker(cfg.BlockCIDR, cfg.AllowCIDR)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		ips, err := s.lookup(ctx, "ip", s.domain)
+		if err != nil {
+			return resolveResultMsg{err: fmt.Errorf("resolve %s: %w", s.domain, err)}
+		}
+		return resolveResultMsg{ips: checkResolvedIPs(ips, cidr)}
+	}
+}
+
+func (s *resolveScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch msg.String() {
+		case "esc", "i":
+			w.ClearError()
+			return s.back, nil
+		case "q", "ctrl+c":
+			return s, tea.Quit
+		default:
+			s.HandleKey(msg)
+		}
+
+	case tea.WindowSizeMsg:
+		// Reserve the first line for the domain heading.
+		s.VpHeight = max(w.VpHeight()-1, 1)
+		s.EnsureVisible()
+
+	case resolveResultMsg:
+		s.loaded = true
+		if msg.err != nil {
+			w.SetError(msg.err)
+			break
+		}
+		s.ips = msg.ips
+		s.ItemCount = len(s.ips)
+		s.EnsureVisible()
+	}
+
+	return s, nil
+}
+
+func (s *resolveScreen) View(w *tui.Window) string {
+	heading := lipgloss.NewStyle().Foreground(tui.ColorCyan).Bold(true).Render(s.domain) +
+		lipgloss.NewStyle().Foreground(tui.ColorField).Render("  resolved on this host, the proxy may see other addresses")
+	lines := []string{heading}
+	end := min(s.Offset+s.VpHeight, len(s.ips))
+	for i := s.Offset; i < end; i++ {
+		lines = append(lines, renderResolvedIP(s.ips[i], i == s.Pos))
+	}
+	for len(lines) < s.VpHeight+1 {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderResolvedIP(r resolvedIP, highlighted bool) string {
+	base, marker := tui.LineStyle(highlighted)
+	status := base.Foreground(tui.ColorCyan).Render("allowed")
+	if r.blocked {
+		status = base.Foreground(tui.ColorError).Render("blocked by CIDR")
+	}
+	return marker + base.Render(fmt.Sprintf("%-39s", r.ip.String())) + base.Render(" ") + status
+}
+
+func (s *resolveScreen) FooterStatus(w *tui.Window) string {
+	if !s.loaded {
+		return lipgloss.NewStyle().Foreground(tui.ColorField).Render("resolving")
+	}
+	return lipgloss.NewStyle().Foreground(tui.ColorField).Render(fmt.Sprintf("%d addresses", len(s.ips)))
+}
+
+func (s *resolveScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
+	keys := []tui.FooterKey{{Key: "esc", Desc: "logs"}}
+	keys = append(keys, s.Cursor.FooterKeys()...)
+	return keys
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResolvedIPs(t *testing.T) {
+	cidr := proxy.NewCIDRBlocker([]string{"203.0.113.0/24"}, []string{"10.1.0.0/16"})
+	ips := []net.IP{
+		net.ParseIP("93.184.216.34"),
+		net.ParseIP("203.0.113.7"),
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.1.2.3"),
+	}
+
+	assert.Equal(t, []resolvedIP{
+		{ip: ips[0], blocked: false},
+		{ip: ips[1], blocked: true},
+		{ip: ips[2], blocked: true},
+		{ip: ips[3], blocked: false},
+	}, checkResolvedIPs(ips, cidr))
+}
+
+func TestResolveScreen(t *testing.T) {
+	httpAL, err := proxy.NewHTTPAllowlist(nil)
+	require.NoError(t, err)
+	dnsAL, err := proxy.NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	merged := config.MergedConfig{BlockCIDR: []string{"203.0.113.0/24"}}
+	client := testControlClient(t, proxy.NewControlAPI(proxy.NewLogBuffer(100), merged, httpAL, dnsAL))
+
+	monitor, w := makeTestSetup(3)
+	monitor.client = client
+
+	t.Run("i opens the resolve screen for the selected domain", func(t *testing.T) {
+		monitor.cursor.Pos = 1
+		screen, cmd := monitor.Update(tea.KeyPressMsg{Code: 'i', Text: "i"}, w)
+		require.IsType(t, &resolveScreen{}, screen)
+		assert.Equal(t, "domain1.com", screen.(*resolveScreen).domain)
+		assert.NotNil(t, cmd)
+	})
+
+	t.Run("marks addresses in blocked ranges", func(t *testing.T) {
+		s := newResolveScreen(client, monitor, "example.com")
+		s.lookup = func(ctx context.Context, network, host string) ([]net.IP, error) {
+			assert.Equal(t, "example.com", host)
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("203.0.113.7")}, nil
+		}
+		s.Update(tea.WindowSizeMsg{}, w)
+		s.Update(s.resolveCmd()(), w)
+
+		view := ansi.Strip(s.View(w))
+		assert.Contains(t, view, "example.com")
+		assert.Contains(t, view, "93.184.216.34")
+		assert.Contains(t, view, "203.0.113.7")
+		assert.Contains(t, view, "blocked by CIDR")
+		assert.Len(t, s.ips, 2)
+		assert.False(t, s.ips[0].blocked)
+		assert.True(t, s.ips[1].blocked)
+	})
+
+	t.Run("lookup errors are shown", func(t *testing.T) {
+		s := newResolveScreen(client, monitor, "missing.example")
+		s.lookup = func(ctx context.Context, network, host string) ([]net.IP, error) {
+			return nil, fmt.Errorf("no such host")
+		}
+		s.Update(s.resolveCmd()(), w)
+		require.Error(t, w.Err())
+		assert.Contains(t, w.Err().Error(), "missing.example")
+		w.ClearError()
+	})
+
+	t.Run("esc returns to the monitor", func(t *testing.T) {
+		s := newResolveScreen(client, monitor, "example.com")
+		screen, _ := s.Update(tea.KeyPressMsg{Code: tea.KeyEscape}, w)
+		assert.Equal(t, monitor, screen)
+	})
+
+	t.Run("resolve key is shown in the monitor footer", func(t *testing.T) {
+		assert.Contains(t, footerKeyDescs(monitor.FooterKeys(w)), "resolve")
+	})
+}
@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/bernd/vibepit/tui"
 	"github.com/urfave/cli/v3"
 	"os"
 )
@@ -15,6 +18,7 @@ var sessionFlag = &cli.StringFlag{
 
 const debugFlag = "debug"
 const versionFlag = "version"
+const runtimeFlag = "runtime"
 
 func RootCommand() *cli.Command {
 	return &cli.Command{
@@ -28,6 +32,12 @@ func RootCommand() *cli.Command {
 				Name:  debugFlag,
 				Usage: "Enable debug output",
 			},
+			&cli.StringFlag{
+				Name:    runtimeFlag,
+				Usage:   "Container runtime: auto, docker, podman-rootless, podman-root, or custom://<socket-or-host>",
+				Value:   ctr.RuntimeAuto,
+				Sources: cli.EnvVars("VIBEPIT_RUNTIME"),
+			},
 			&cli.BoolFlag{
 				Name:  versionFlag,
 				Usage: "Show version",
@@ -38,6 +48,7 @@ func RootCommand() *cli.Command {
 				fmt.Printf("%s (%s)\n", config.Version, config.CommitID)
 				os.Exit(0)
 			}
+			tui.SetDebug(command.Bool(debugFlag))
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
@@ -47,13 +58,49 @@ func RootCommand() *cli.Command {
 			ConnectCommand(),
 			ExecCommand(),
 			DownCommand(),
+			KillCommand(),
 			StatusCommand(),
+			PsCommand(),
 			AllowHTTPCommand(),
 			AllowDNSCommand(),
 			ProxyCommand(),
 			VibedCommand(),
 			MonitorCommand(),
+			ConfigCommand(),
+			ValidateCommand(),
+			SuggestAllowsCommand(),
+			TestAllowCommand(),
+			BuildCommand(),
 			UpdateCommand(),
 		},
 	}
 }
+
+// newContainerClient creates a container client using the global --debug and
+// --runtime flags.
+func newContainerClient(cmd *cli.Command) (*ctr.Client, error) {
+	root := cmd.Root()
+	client, err := ctr.NewClient(
+		ctr.WithDebug(root.Bool(debugFlag)),
+		ctr.WithRuntime(root.String(runtimeFlag)),
+	)
+	if err != nil {
+		return nil, daemonError(err)
+	}
+	return client, nil
+}
+
+// daemonError adds a remediation hint to errors caused by an unreachable
+// container runtime.
+func daemonError(err error) error {
+	switch {
+	case errors.Is(err, ctr.ErrPermission):
+		return fmt.Errorf("%w; add yourself to the group owning the socket, e.g. "+
+			"'sudo usermod -aG docker $USER', and log in again", err)
+	case errors.Is(err, ctr.ErrNoDaemon):
+		return fmt.Errorf("%w; start Docker Desktop, the Docker service, or the Podman socket", err)
+	case errors.Is(err, ctr.ErrNoSocket):
+		return fmt.Errorf("%w; install Docker or Podman, or select the socket with --%s", err, runtimeFlag)
+	}
+	return err
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"testing"
 
+	ctr "github.com/bernd/vibepit/container"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +20,36 @@ func TestRootCommand_AllowCommands(t *testing.T) {
 	assert.Contains(t, names, "allow-dns")
 	assert.NotContains(t, names, "allow")
 }
+
+func TestDaemonError(t *testing.T) {
+	tests := []struct {
+		kind error
+		want string
+	}{
+		{ctr.ErrPermission, "usermod -aG docker"},
+		{ctr.ErrNoDaemon, "start Docker Desktop"},
+		{ctr.ErrNoSocket, "--runtime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.Error(), func(t *testing.T) {
+			err := daemonError(&ctr.DaemonError{Host: "unix:///var/run/docker.sock", Kind: tt.kind})
+			assert.ErrorIs(t, err, tt.kind)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+
+	t.Run("leaves other errors alone", func(t *testing.T) {
+		err := errors.New("boom")
+		assert.Equal(t, err, daemonError(err))
+	})
+}
+
+func TestRootCommand_Validate(t *testing.T) {
+	root := RootCommand()
+
+	validate := root.Command("validate")
+	if assert.NotNil(t, validate) {
+		assert.Equal(t, "Utilities", validate.Category)
+		assert.Len(t, validate.Flags, len(root.Command("config").Command("validate").Flags))
+	}
+}
@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"fmt"
+
+	"github.com/bernd/vibepit/config"
 	ctr "github.com/bernd/vibepit/container"
 	"github.com/bernd/vibepit/tui"
 	"github.com/urfave/cli/v3"
@@ -10,54 +12,138 @@ import (
 
 func RunCommand() *cli.Command {
 	return &cli.Command{
-		Name:   "run",
-		Usage:  "Start the sandbox",
-		Flags:  sandboxFlags(),
+		Name:  "run",
+		Usage: "Start the sandbox",
+		Flags: append(sandboxFlags(),
+			&cli.StringFlag{
+				Name:  runSessionFlag,
+				Usage: "Attach to the running session with this ID instead of starting one",
+			},
+			&cli.BoolFlag{
+				Name:  runKeepFlag,
+				Usage: "Keep the session containers after exit for debugging",
+			},
+		),
 		Action: RunAction,
 	}
 }
 
+const (
+	runSessionFlag = "session"
+	runKeepFlag    = "keep"
+)
+
 func RunAction(ctx context.Context, cmd *cli.Command) error {
+	if err := tui.SetStatusFormat(tui.StatusFormat(cmd.String(statusFormatFlag))); err != nil {
+		return err
+	}
 	tui.PrintHeader()
 
 	projectRoot, u, err := resolveProjectAndUser(cmd)
 	if err != nil {
 		return err
 	}
-
-	client, err := ctr.NewClient(ctr.WithDebug(cmd.Bool(debugFlag)))
+	workDir, err := sandboxWorkDir(projectRoot, cmd.String(workDirFlag))
 	if err != nil {
 		return err
 	}
-	defer client.Close()
 
-	existing, err := client.FindRunningSession(ctx, projectRoot)
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
+
+	var existing *ctr.RunningSession
+	if sessionID := cmd.String(runSessionFlag); sessionID != "" {
+		existing, err = client.FindRunningSessionByID(ctx, projectRoot, sessionID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return fmt.Errorf("session %s is not running for %s — run 'vibepit status' to list sessions", sessionID, projectRoot)
+		}
+	} else {
+		existing, err = client.FindRunningSession(ctx, projectRoot)
+		if err != nil {
+			return err
+		}
+	}
 	if existing != nil {
+		if err := writeSessionIDFile(cmd, existing.SessionID); err != nil {
+			return err
+		}
+		// The check is best effort and must not keep the user from attaching.
+		if stale, err := runningProxyConfigStale(ctx, client, projectRoot, existing.SessionID); err == nil && stale {
+			tui.Status("Note", "proxy config is stale, restart the session to apply %s", config.DefaultProjectPath(projectRoot))
+		}
 		tui.Status("Attaching", "to running session in %s", projectRoot)
 		return client.ExecSession(ctx, existing.ContainerID)
 	}
 
+	// With --keep the containers, the network and the credentials stay in
+	// place after exit, so a failed session can be inspected. 'vibepit down'
+	// removes them like the leftovers of a crashed session.
+	keep := cmd.Bool(runKeepFlag)
 	infra, cleanups, err := startSessionInfra(ctx, cmd, client, projectRoot, u, infraOptions{})
-	defer runCleanups(cleanups)
+	defer func() { cleanupSession(cleanups, keep, projectRoot) }()
 	if err != nil {
 		return err
 	}
 
 	tui.Status("Creating", "sandbox container in %s", projectRoot)
-	sandboxContainer, err := client.CreateSandboxContainer(ctx, infra.baseSandboxConfig(projectRoot, u))
+	sandboxContainer, err := client.CreateSandboxContainer(ctx, infra.baseSandboxConfig(projectRoot, workDir, u))
 	if err != nil {
 		return fmt.Errorf("sandbox container: %w", err)
 	}
 	defer func() {
+		if keep {
+			tui.Status("Keeping", "sandbox container %s", sandboxContainer[:12])
+			return
+		}
 		tui.Status("Stopping", "sandbox container")
 		client.StopAndRemove(ctx, sandboxContainer)
 	}()
 
+	if err := writeSessionIDFile(cmd, infra.SessionID); err != nil {
+		return err
+	}
+
 	tui.Status("Starting", "sandbox container")
 	tui.Status("Attaching", "shell session")
 	fmt.Println()
 	return client.AttachAndStartSession(ctx, sandboxContainer)
 }
+
+// cleanupSession runs the session cleanups unless keep is set, in which case
+// it only tells the user how to remove the session later.
+func cleanupSession(cleanups []func(), keep bool, projectRoot string) {
+	if !keep {
+		runCleanups(cleanups)
+	} else if len(cleanups) > 0 {
+		tui.Status("Keeping", "session, remove it with 'vibepit down %s'", projectRoot)
+	}
+}
+
+// runningProxyConfigStale reports whether the proxy of the running session
+// doesn't enforce the current config files of projectRoot.
+func runningProxyConfigStale(ctx context.Context, client *ctr.Client, projectRoot, sessionID string) (bool, error) {
+	sessions, err := client.ListProxySessions(ctx)
+	if err != nil {
+		return false, err
+	}
+	info, err := findSession(sessions, sessionID)
+	if err != nil {
+		return false, err
+	}
+	cc, err := NewControlClient(info)
+	if err != nil {
+		return false, err
+	}
+	defer cc.Close()
+	live, err := cc.ConfigWithSources()
+	if err != nil {
+		return false, err
+	}
+	return proxyConfigStale(live, config.DefaultGlobalPath(), projectRoot)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupSession(t *testing.T) {
+	newCleanups := func(order *[]string) []func() {
+		return []func(){
+			func() { *order = append(*order, "network") },
+			func() { *order = append(*order, "proxy") },
+		}
+	}
+
+	t.Run("removes the session in reverse order", func(t *testing.T) {
+		var order []string
+		cleanupSession(newCleanups(&order), false, "/project")
+		assert.Equal(t, []string{"proxy", "network"}, order)
+	})
+
+	t.Run("keeps the session with --keep", func(t *testing.T) {
+		var order []string
+		cleanupSession(newCleanups(&order), true, "/project")
+		assert.Empty(t, order)
+	})
+
+	t.Run("handles a failed start without cleanups", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			cleanupSession(nil, false, "/project")
+			cleanupSession(nil, true, "/project")
+		})
+	})
+}
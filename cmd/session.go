@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/bernd/vibepit/config"
 	ctr "github.com/bernd/vibepit/container"
 	"github.com/bernd/vibepit/proxy"
+	"github.com/urfave/cli/v3"
 )
 
 // SSH credential filenames stored under the per-session directory.
@@ -22,6 +24,10 @@ const (
 	SSHHostPubFile    = "host-key.pub"
 )
 
+// controlSocketDirName is the subdirectory of the session directory that
+// holds the control API socket.
+const controlSocketDirName = "control"
+
 func sessionBaseDir() string {
 	return filepath.Join(xdg.StateHome, config.RuntimeDirName, "sessions")
 }
@@ -51,11 +57,22 @@ func matchSession(ps ctr.ProxySession, filter string) bool {
 	return ps.SessionID == filter || ps.ProjectDir == filter
 }
 
+// findSession returns the first session matching filter by SessionID or
+// ProjectDir.
+func findSession(sessions []ctr.ProxySession, filter string) (*SessionInfo, error) {
+	for _, s := range sessions {
+		if matchSession(s, filter) {
+			return sessionInfoFromProxy(s), nil
+		}
+	}
+	return nil, fmt.Errorf("no session matching %q found", filter)
+}
+
 // discoverSession finds running vibepit proxy containers and returns connection
 // info. If multiple sessions are running, prompts the user to select one.
 // If filter is non-empty, it matches against SessionID or ProjectDir.
-func discoverSession(ctx context.Context, filter string) (*SessionInfo, error) {
-	client, err := ctr.NewClient()
+func discoverSession(ctx context.Context, cmd *cli.Command, filter string) (*SessionInfo, error) {
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -70,12 +87,7 @@ func discoverSession(ctx context.Context, filter string) (*SessionInfo, error) {
 	}
 
 	if filter != "" {
-		for _, s := range sessions {
-			if matchSession(s, filter) {
-				return sessionInfoFromProxy(s), nil
-			}
-		}
-		return nil, fmt.Errorf("no session matching %q found", filter)
+		return findSession(sessions, filter)
 	}
 
 	if len(sessions) == 1 {
@@ -89,9 +101,13 @@ func discoverSession(ctx context.Context, filter string) (*SessionInfo, error) {
 // sessionInfoFromProxy converts a container.ProxySession to a SessionInfo.
 func sessionInfoFromProxy(ps ctr.ProxySession) *SessionInfo {
 	return &SessionInfo{
-		ControlPort: ps.ControlPort,
-		SessionID:   ps.SessionID,
-		ProjectDir:  ps.ProjectDir,
+		ControlPort:   ps.ControlPort,
+		ControlSocket: ps.ControlSocket,
+		SessionID:     ps.SessionID,
+		ProjectDir:    ps.ProjectDir,
+		Allow:         ps.Allow,
+		Presets:       ps.Presets,
+		Profiles:      ps.Profiles,
 	}
 }
 
@@ -150,6 +166,12 @@ func LoadSessionTLSConfig(sessionID string) (*tls.Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("load client keypair: %w", err)
 	}
+	// The proxy cannot issue new certificates because the session CA key is
+	// discarded at startup, so an expired session has to be restarted.
+	if expiry := cert.Leaf.NotAfter; time.Now().After(expiry) {
+		return nil, fmt.Errorf("session credentials expired on %s, restart the session with 'vibepit down' and 'vibepit up'",
+			expiry.Local().Format(time.DateTime))
+	}
 
 	caPool := x509.NewCertPool()
 	if !caPool.AppendCertsFromPEM(caCert) {
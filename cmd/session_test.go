@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/adrg/xdg"
+	ctr "github.com/bernd/vibepit/container"
 	"github.com/bernd/vibepit/proxy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,7 +28,7 @@ func TestWriteSessionCredentials(t *testing.T) {
 	t.Cleanup(func() { xdg.StateHome = origStateHome })
 
 	sessionID := "test-session-abc"
-	creds, err := proxy.GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	dir, err := WriteSessionCredentials(sessionID, creds)
@@ -58,7 +59,7 @@ func TestReadSessionCredentials(t *testing.T) {
 	t.Cleanup(func() { xdg.StateHome = origStateHome })
 
 	sessionID := "test-session-read"
-	creds, err := proxy.GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	_, err = WriteSessionCredentials(sessionID, creds)
@@ -71,6 +72,24 @@ func TestReadSessionCredentials(t *testing.T) {
 	assert.NotNil(t, tlsCfg.RootCAs)
 }
 
+func TestLoadSessionTLSConfigExpired(t *testing.T) {
+	tmpDir := t.TempDir()
+	origStateHome := xdg.StateHome
+	xdg.StateHome = tmpDir
+	t.Cleanup(func() { xdg.StateHome = origStateHome })
+
+	sessionID := "test-session-expired"
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: -time.Hour})
+	require.NoError(t, err)
+
+	_, err = WriteSessionCredentials(sessionID, creds)
+	require.NoError(t, err)
+
+	_, err = LoadSessionTLSConfig(sessionID)
+	assert.ErrorContains(t, err, "session credentials expired")
+	assert.ErrorContains(t, err, "vibepit down")
+}
+
 func TestWriteSSHCredentials(t *testing.T) {
 	tmpDir := t.TempDir()
 	origStateHome := xdg.StateHome
@@ -115,7 +134,7 @@ func TestCleanupSessionCredentials(t *testing.T) {
 	t.Cleanup(func() { xdg.StateHome = origStateHome })
 
 	sessionID := "test-session-cleanup"
-	creds, err := proxy.GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	dir, err := WriteSessionCredentials(sessionID, creds)
@@ -127,3 +146,27 @@ func TestCleanupSessionCredentials(t *testing.T) {
 	_, err = os.Stat(dir)
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestFindSession(t *testing.T) {
+	sessions := []ctr.ProxySession{
+		{SessionID: "aaa111", ProjectDir: "/home/user/one", ControlPort: "1001"},
+		{SessionID: "bbb222", ProjectDir: "/home/user/two", ControlPort: "1002"},
+	}
+
+	t.Run("matches session ID", func(t *testing.T) {
+		info, err := findSession(sessions, "bbb222")
+		require.NoError(t, err)
+		assert.Equal(t, &SessionInfo{ControlPort: "1002", SessionID: "bbb222", ProjectDir: "/home/user/two"}, info)
+	})
+
+	t.Run("matches project dir", func(t *testing.T) {
+		info, err := findSession(sessions, "/home/user/one")
+		require.NoError(t, err)
+		assert.Equal(t, "aaa111", info.SessionID)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		_, err := findSession(sessions, "ccc333")
+		assert.ErrorContains(t, err, `no session matching "ccc333" found`)
+	})
+}
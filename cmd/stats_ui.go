@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/bernd/vibepit/tui"
+)
+
+const (
+	// statsInterval is the time between resource usage samples. Each
+	// sample makes the daemon read the cgroup twice, so keep it modest.
+	statsInterval = 2 * time.Second
+	statsTimeout  = 5 * time.Second
+)
+
+// statsResultMsg is returned by the async stats sample.
+type statsResultMsg struct {
+	stats ctr.ContainerStats
+	err   error
+}
+
+// statsScreen implements tui.Screen for showing the CPU and memory usage of
+// the session's sandbox container.
+type statsScreen struct {
+	back          tui.Screen
+	sample        func(ctx context.Context) (ctr.ContainerStats, error)
+	stats         ctr.ContainerStats
+	inFlight      bool
+	firstTickSeen bool
+	loaded        bool
+}
+
+func newStatsScreen(back tui.Screen, sample func(ctx context.Context) (ctr.ContainerStats, error)) *statsScreen {
+	return &statsScreen{
+		back:   back,
+		sample: sample,
+	}
+}
+
+func (s *statsScreen) sampleCmd() tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+		defer cancel()
+		stats, err := s.sample(ctx)
+		return statsResultMsg{stats: stats, err: err}
+	}
+}
+
+func (s *statsScreen) Update(msg tea.Msg, w *tui.Window) (tui.Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch msg.String() {
+		case "esc", "u":
+			w.ClearError()
+			return s.back, nil
+		case "q", "ctrl+c":
+			return s, tea.Quit
+		}
+
+	case statsResultMsg:
+		s.inFlight = false
+		if msg.err != nil {
+			w.SetError(msg.err)
+			break
+		}
+		w.ClearError()
+		s.loaded = true
+		s.stats = msg.stats
+
+	case tui.TickMsg:
+		if (w.IntervalElapsed(statsInterval) || !s.firstTickSeen) && !s.inFlight {
+			s.firstTickSeen = true
+			s.inFlight = true
+			return s, s.sampleCmd()
+		}
+		s.firstTickSeen = true
+	}
+
+	return s, nil
+}
+
+func (s *statsScreen) View(w *tui.Window) string {
+	var lines []string
+	if s.loaded {
+		label := lipgloss.NewStyle().Foreground(tui.ColorCyan).Bold(true)
+		memory := fmt.Sprintf("%s / %s", ctr.HumanBytes(int64(s.stats.MemoryUsage)), ctr.HumanBytes(int64(s.stats.MemoryLimit)))
+		if s.stats.MemoryLimit > 0 {
+			memory += fmt.Sprintf(" (%.1f%%)", float64(s.stats.MemoryUsage)/float64(s.stats.MemoryLimit)*100)
+		}
+		lines = append(lines,
+			label.Render("CPU    ")+" "+fmt.Sprintf("%.1f%%", s.stats.CPUPercent),
+			label.Render("Memory ")+" "+memory,
+		)
+	}
+	for len(lines) < w.VpHeight() {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *statsScreen) FooterStatus(w *tui.Window) string {
+	if !s.loaded {
+		return lipgloss.NewStyle().Foreground(tui.ColorField).Render("sampling usage")
+	}
+	return lipgloss.NewStyle().Foreground(tui.ColorField).Render("sandbox usage")
+}
+
+func (s *statsScreen) FooterKeys(w *tui.Window) []tui.FooterKey {
+	return []tui.FooterKey{{Key: "esc", Desc: "logs"}}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/bernd/vibepit/tui"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsScreen(t *testing.T) {
+	monitor, w := makeTestSetup(3)
+	sample := func(ctx context.Context) (ctr.ContainerStats, error) {
+		return ctr.ContainerStats{CPUPercent: 12.5, MemoryUsage: 512 << 20, MemoryLimit: 2 << 30}, nil
+	}
+
+	t.Run("u is ignored without a stats source", func(t *testing.T) {
+		screen, _ := monitor.Update(tea.KeyPressMsg{Code: 'u', Text: "u"}, w)
+		assert.Equal(t, monitor, screen)
+	})
+
+	t.Run("u opens the usage screen", func(t *testing.T) {
+		monitor.sampleStats = sample
+		screen, _ := monitor.Update(tea.KeyPressMsg{Code: 'u', Text: "u"}, w)
+		require.IsType(t, &statsScreen{}, screen)
+	})
+
+	t.Run("shows CPU and memory usage", func(t *testing.T) {
+		s := newStatsScreen(monitor, sample)
+		_, cmd := s.Update(tui.TickMsg{}, w)
+		require.NotNil(t, cmd)
+		s.Update(cmd(), w)
+
+		view := ansi.Strip(s.View(w))
+		assert.Contains(t, view, "12.5%")
+		assert.Contains(t, view, "512.0 MB / 2.0 GB (25.0%)")
+	})
+
+	t.Run("sample errors are shown", func(t *testing.T) {
+		s := newStatsScreen(monitor, func(ctx context.Context) (ctr.ContainerStats, error) {
+			return ctr.ContainerStats{}, fmt.Errorf("sandbox container of session test123456 is not running")
+		})
+		_, cmd := s.Update(tui.TickMsg{}, w)
+		s.Update(cmd(), w)
+		require.Error(t, w.Err())
+		assert.Contains(t, w.Err().Error(), "not running")
+		w.ClearError()
+	})
+
+	t.Run("esc returns to the monitor", func(t *testing.T) {
+		s := newStatsScreen(monitor, sample)
+		screen, _ := s.Update(tea.KeyPressMsg{Code: tea.KeyEscape}, w)
+		assert.Equal(t, monitor, screen)
+	})
+}
@@ -30,7 +30,7 @@ func StatusCommand() *cli.Command {
 }
 
 func StatusAction(ctx context.Context, cmd *cli.Command) error {
-	client, err := ctr.NewClient(ctr.WithDebug(cmd.Root().Bool(debugFlag)))
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return err
 	}
@@ -114,7 +114,9 @@ func printSessionStatus(ctx context.Context, client *ctr.Client, sessionID, proj
 	apiAddr := "N/A"
 	proxyID, proxyErr := client.FindProxyContainerID(ctx, sessionID)
 	if proxyErr == nil {
-		if port, err := client.FindControlPort(ctx, proxyID); err == nil {
+		if path, err := client.FindControlSocket(ctx, proxyID); err == nil && path != "" {
+			apiAddr = "unix:" + path
+		} else if port, err := client.FindControlPort(ctx, proxyID); err == nil {
 			apiAddr = fmt.Sprintf("127.0.0.1:%d", port)
 		}
 		if port, err := client.FindPublishedPort(ctx, proxyID, ctr.SSHContainerPort); err == nil {
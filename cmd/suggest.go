@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/bernd/vibepit/config"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/bernd/vibepit/tui"
+	"github.com/urfave/cli/v3"
+)
+
+func SuggestAllowsCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "suggest-allows",
+		Usage:       "Suggest allow-http entries from dependency lock files",
+		Category:    "Utilities",
+		ArgsUsage:   "[project-dir]",
+		Description: "Reads package-lock.json and suggests the registry hosts its packages are downloaded from.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "save",
+				Usage: "Append the suggested entries to the project config",
+			},
+		},
+		Action: SuggestAllowsAction,
+	}
+}
+
+func SuggestAllowsAction(ctx context.Context, cmd *cli.Command) error {
+	projectRoot, err := resolveProjectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	projectPath := config.DefaultProjectPath(projectRoot)
+
+	suggested, err := config.SuggestAllowHTTP(projectRoot)
+	if err != nil {
+		return fmt.Errorf("suggest: %w", err)
+	}
+	if len(suggested) == 0 {
+		tui.Status("Nothing", "to suggest, no supported lock file in %s", projectRoot)
+		return nil
+	}
+
+	cfg, err := config.Load(config.DefaultGlobalPath(), projectPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	merged, err := cfg.Merge(nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	missing, err := notAllowedHTTP(merged.AllowHTTP, suggested)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		tui.Status("Nothing", "to suggest, all %d hosts are already allowed", len(suggested))
+		return nil
+	}
+
+	for _, e := range missing {
+		tui.Status("Suggested", "%s", e)
+	}
+
+	if !cmd.Bool("save") {
+		tui.Status("Hint", "run with --save to append them to %s", projectPath)
+		return nil
+	}
+
+	if _, err := os.Stat(projectPath); os.IsNotExist(err) {
+		if err := config.CreateProjectConfig(projectPath); err != nil {
+			return fmt.Errorf("create project config: %w", err)
+		}
+	}
+	if err := config.AppendAllowHTTP(projectPath, missing); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	tui.Status("Saved", "to %s", projectPath)
+	return nil
+}
+
+// notAllowedHTTP returns the entries of candidates that the allow-http
+// entries in allowed don't already cover, including through wildcards.
+func notAllowedHTTP(allowed, candidates []string) ([]string, error) {
+	al, err := proxy.NewHTTPAllowlist(allowed)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, c := range candidates {
+		host, port, err := net.SplitHostPort(c)
+		if err != nil {
+			return nil, err
+		}
+		if !al.Allows(host, port) {
+			missing = append(missing, c)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bernd/vibepit/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotAllowedHTTP(t *testing.T) {
+	missing, err := notAllowedHTTP(
+		[]string{"registry.npmjs.org:443", "**.example.com:*"},
+		[]string{"npm.corp.example.com:443", "registry.npmjs.org:443", "registry.yarnpkg.com:443"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry.yarnpkg.com:443"}, missing)
+}
+
+func TestSuggestAllows(t *testing.T) {
+	run := func(args ...string) error {
+		return RootCommand().Run(context.Background(), append([]string{"vibepit", "suggest-allows"}, args...))
+	}
+	writeLock := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		lock := `{"lockfileVersion": 3, "packages": {
+			"node_modules/internal": {"resolved": "https://npm.corp.example.com/internal/-/internal-1.0.0.tgz"}
+		}}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package-lock.json"), []byte(lock), 0o644))
+		return dir
+	}
+
+	t.Run("does not write without --save", func(t *testing.T) {
+		dir := writeLock(t)
+		require.NoError(t, run(dir))
+		assert.NoFileExists(t, config.DefaultProjectPath(dir))
+	})
+
+	t.Run("saves suggestions to the project config", func(t *testing.T) {
+		dir := writeLock(t)
+		require.NoError(t, run("--save", dir))
+
+		cfg, err := config.Load("", config.DefaultProjectPath(dir))
+		require.NoError(t, err)
+		assert.Contains(t, cfg.Project.AllowHTTP, "npm.corp.example.com:443")
+	})
+}
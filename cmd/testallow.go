@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/bernd/vibepit/config"
+	ctr "github.com/bernd/vibepit/container"
+	"github.com/bernd/vibepit/proxy"
+	"github.com/urfave/cli/v3"
+)
+
+const testAllowVerboseFlag = "verbose"
+
+func TestAllowCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "test-allow",
+		Usage:     "Check whether the project config allows HTTP entries",
+		Category:  "Utilities",
+		ArgsUsage: "[domain:port...]",
+		Description: `Checks each domain:port against the merged allow-http list of the project
+in the current directory. Exits 0 when every entry is allowed and 1
+otherwise, printing nothing unless --verbose is set.
+
+Without arguments the entries are read from stdin, one per line. Empty
+lines and lines starting with # are skipped.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    testAllowVerboseFlag,
+				Aliases: []string{"v"},
+				Usage:   "Print the result and the matching rule for each entry",
+			},
+			&cli.StringSliceFlag{
+				Name:  profileFlag,
+				Usage: "Config profile of allow entries to activate",
+			},
+		},
+		Action: TestAllowAction,
+	}
+}
+
+func TestAllowAction(ctx context.Context, cmd *cli.Command) error {
+	entries := cmd.Args().Slice()
+	if len(entries) == 0 {
+		var err error
+		if entries, err = readAllowEntries(os.Stdin); err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries to test")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	projectRoot, err := config.FindProjectRoot(wd)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(config.DefaultGlobalPath(), config.DefaultProjectPath(projectRoot))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	merged, err := cfg.Merge(nil, nil, cmd.StringSlice(profileFlag))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	al, err := proxy.NewHTTPAllowlist(merged.AllowHTTP)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	deny, err := proxy.NewHTTPAllowlist(merged.DenyHTTP)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var out io.Writer = io.Discard
+	if cmd.Bool(testAllowVerboseFlag) {
+		out = os.Stdout
+	}
+	allowed, err := testAllowEntries(out, al, deny, merged.EntrySources, entries)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		// Exit without an error message, the exit code is the result.
+		return &ctr.ExitError{Code: 1}
+	}
+	return nil
+}
+
+// readAllowEntries reads one entry per line, skipping empty lines and
+// comments.
+func readAllowEntries(r io.Reader) ([]string, error) {
+	var entries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, scanner.Err()
+}
+
+// testAllowEntries checks every domain:port entry against the deny list and
+// the allowlist and writes one result line per entry to w, naming the
+// matching rule and where it came from. It reports whether all entries are
+// allowed.
+func testAllowEntries(w io.Writer, al, deny *proxy.HTTPAllowlist, sources map[string]string, entries []string) (bool, error) {
+	allowed := true
+	for _, entry := range entries {
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil || host == "" || port == "" {
+			return false, fmt.Errorf("invalid entry %q: must be domain:port", entry)
+		}
+		if rule, ok := deny.Match(host, port); ok {
+			allowed = false
+			fmt.Fprintf(w, "blocked  %s  (deny-http %s)\n", entry, rule)
+			continue
+		}
+		if rule, ok := al.Match(host, port); ok {
+			if source := sources[rule]; source != "" {
+				rule += ", " + source
+			}
+			fmt.Fprintf(w, "allowed  %s  (%s)\n", entry, rule)
+			continue
+		}
+		allowed = false
+		fmt.Fprintf(w, "blocked  %s\n", entry)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bernd/vibepit/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAllowEntries(t *testing.T) {
+	entries, err := readAllowEntries(strings.NewReader("registry.npmjs.org:443\n\n  # comment\n  github.com:443  \n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry.npmjs.org:443", "github.com:443"}, entries)
+}
+
+func TestTestAllowEntries(t *testing.T) {
+	al, err := proxy.NewHTTPAllowlist([]string{"github.com:443", "*.npmjs.org:443"})
+	require.NoError(t, err)
+	deny, err := proxy.NewHTTPAllowlist([]string{"evil.npmjs.org:*"})
+	require.NoError(t, err)
+
+	t.Run("all allowed", func(t *testing.T) {
+		var out strings.Builder
+		sources := map[string]string{"*.npmjs.org:443": "preset:pkg-node"}
+		allowed, err := testAllowEntries(&out, al, deny, sources, []string{"github.com:443", "registry.npmjs.org:443"})
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, "allowed  github.com:443  (github.com:443)\nallowed  registry.npmjs.org:443  (*.npmjs.org:443, preset:pkg-node)\n", out.String())
+	})
+
+	t.Run("one blocked entry fails the batch", func(t *testing.T) {
+		var out strings.Builder
+		allowed, err := testAllowEntries(&out, al, deny, nil, []string{"github.com:80", "github.com:443"})
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Contains(t, out.String(), "blocked  github.com:80\n")
+	})
+
+	t.Run("deny rules win over allow rules", func(t *testing.T) {
+		var out strings.Builder
+		allowed, err := testAllowEntries(&out, al, deny, nil, []string{"evil.npmjs.org:443"})
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Equal(t, "blocked  evil.npmjs.org:443  (deny-http evil.npmjs.org:*)\n", out.String())
+	})
+
+	t.Run("rejects entries without a port", func(t *testing.T) {
+		_, err := testAllowEntries(&strings.Builder{}, al, deny, nil, []string{"github.com"})
+		assert.ErrorContains(t, err, `invalid entry "github.com": must be domain:port`)
+	})
+}
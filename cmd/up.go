@@ -23,14 +23,21 @@ func UpCommand() *cli.Command {
 }
 
 func UpAction(ctx context.Context, cmd *cli.Command) error {
+	if err := tui.SetStatusFormat(tui.StatusFormat(cmd.String(statusFormatFlag))); err != nil {
+		return err
+	}
 	tui.PrintHeader()
 
 	projectRoot, u, err := resolveProjectAndUser(cmd)
 	if err != nil {
 		return err
 	}
+	workDir, err := sandboxWorkDir(projectRoot, cmd.String(workDirFlag))
+	if err != nil {
+		return err
+	}
 
-	client, err := ctr.NewClient(ctr.WithDebug(cmd.Bool(debugFlag)))
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return err
 	}
@@ -43,7 +50,7 @@ func UpAction(ctx context.Context, cmd *cli.Command) error {
 	}
 	if existing != nil {
 		tui.Status("Session", "already running for %s", projectRoot)
-		return nil
+		return writeSessionIDFile(cmd, existing.SessionID)
 	}
 
 	// Check for orphaned containers from a previous failed attempt (e.g.
@@ -84,7 +91,7 @@ func UpAction(ctx context.Context, cmd *cli.Command) error {
 	hostPubPath := filepath.Join(infra.SessionDir, SSHHostPubFile)
 
 	tui.Status("Creating", "sandbox container in %s", projectRoot)
-	sandboxCfg := infra.baseSandboxConfig(projectRoot, u)
+	sandboxCfg := infra.baseSandboxConfig(projectRoot, workDir, u)
 	sandboxCfg.SandboxIP = infra.NetworkInfo.SandboxIP
 	sandboxCfg.Daemon = true
 	sandboxCfg.DaemonBinaryPath = infra.SelfBinary
@@ -159,6 +166,10 @@ func UpAction(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("SSH daemon did not become ready within 30s")
 	}
 
+	if err := writeSessionIDFile(cmd, infra.SessionID); err != nil {
+		return err
+	}
+
 	succeeded = true
 
 	tui.Status("Ready", "session %s", infra.SessionID)
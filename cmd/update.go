@@ -76,7 +76,7 @@ func runUpdate(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	if doImages {
-		imgErr = runImageUpdate(ctx)
+		imgErr = runImageUpdate(ctx, cmd)
 	}
 
 	// Report errors from both paths.
@@ -341,28 +341,33 @@ func runBinaryUpdate(_ context.Context, client *selfupdate.Client, useVersion st
 	return nil
 }
 
-func runImageUpdate(ctx context.Context) error {
+func runImageUpdate(ctx context.Context, cmd *cli.Command) error {
 	u, err := user.Current()
 	if err != nil {
 		return fmt.Errorf("cannot determine current user: %w", err)
 	}
 
-	client, err := ctr.NewClient()
+	client, err := newContainerClient(cmd)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
 	img := imageName(u)
+	if err := client.CheckPlatform(ctx, img, publishedPlatforms); err != nil {
+		return fmt.Errorf("pull image: %w", imageError(err))
+	}
 	if err := client.PullImage(ctx, img, false); err != nil {
-		return fmt.Errorf("pull image: %w", err)
+		return fmt.Errorf("pull image: %w", imageError(err))
 	}
 	digestRef, err := client.ImageRepoDigest(ctx, img)
 	if err != nil {
 		return fmt.Errorf("resolve image digest: %w", err)
 	}
-	tui.Status("Verifying", "image signature")
-	if err := cosign.VerifyImage(ctx, digestRef); err != nil {
+	spin := tui.StartSpinner("Verifying", "image signature")
+	err = cosign.VerifyImage(ctx, digestRef)
+	spin.Stop()
+	if err != nil {
 		return fmt.Errorf("image verification: %w", err)
 	}
 	if err := client.PullImage(ctx, ctr.ProxyImage, false); err != nil {
@@ -372,8 +377,10 @@ func runImageUpdate(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("resolve proxy image digest: %w", err)
 	}
-	tui.Status("Verifying", "image signature")
-	if err := cosign.VerifyProxyImage(ctx, proxyDigestRef); err != nil {
+	spin = tui.StartSpinner("Verifying", "image signature")
+	err = cosign.VerifyProxyImage(ctx, proxyDigestRef)
+	spin.Stop()
+	if err != nil {
 		return fmt.Errorf("image verification: %w", err)
 	}
 	fmt.Println("Container images updated.")
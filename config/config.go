@@ -2,13 +2,21 @@ package config
 
 import (
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/binary"
+	"encoding/pem"
 	"fmt"
+	"maps"
+	"net"
+	"net/netip"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/adrg/xdg"
 	"github.com/bernd/vibepit/proxy"
@@ -30,7 +38,39 @@ type GlobalConfig struct {
 	BlockCIDR   []string `koanf:"block-cidr"`
 	AllowCIDR   []string `koanf:"allow-cidr"`
 	ExtraHosts  []string `koanf:"extra-hosts"`
-	UpstreamDNS string   `koanf:"upstream-dns"`
+	UpstreamDNS []string `koanf:"upstream-dns"` // a single server or a list
+	UpstreamDoH []string `koanf:"upstream-doh"` // DNS-over-HTTPS URLs, replace upstream-dns
+	MaxSessions int      `koanf:"max-sessions"` // 0 means unlimited
+
+	// MaxRequestBytes caps plain HTTP request bodies; 0 means unlimited.
+	MaxRequestBytes int64 `koanf:"max-request-bytes"`
+
+	// CertLifetime is the validity of the per-session mTLS certificates;
+	// 0 means DefaultCertLifetime.
+	CertLifetime time.Duration `koanf:"cert-lifetime"`
+
+	// CertKeyType is the key algorithm of the per-session mTLS
+	// certificates, "ed25519" or "ecdsa-p256"; empty means ed25519.
+	CertKeyType string `koanf:"cert-key-type"`
+
+	// AllowPrivateNetwork turns off the default blocking of the private
+	// network ranges, for reaching LAN hosts. It weakens SSRF protection.
+	AllowPrivateNetwork bool `koanf:"allow-private-network"`
+
+	// CACerts lists PEM files with extra CA certificates the sandbox trusts,
+	// e.g. the root of a TLS-inspecting corporate proxy.
+	CACerts []string `koanf:"ca-certs"`
+
+	// DenyHTTP and DenyDNS block domains for every project. No allow entry,
+	// neither from the config nor added at runtime, overrides them.
+	DenyHTTP []string `koanf:"deny-http"`
+	DenyDNS  []string `koanf:"deny-dns"`
+
+	// ControlAPISocket serves the control API of new sessions on a unix
+	// socket in the session directory instead of a loopback TCP port.
+	ControlAPISocket bool `koanf:"control-api-socket"`
+
+	Profiles map[string]Profile `koanf:"profiles"`
 }
 
 type ProjectConfig struct {
@@ -38,11 +78,92 @@ type ProjectConfig struct {
 	AllowHTTP      []string `koanf:"allow-http"`
 	AllowDNS       []string `koanf:"allow-dns"`
 	AllowHostPorts []int    `koanf:"allow-host-ports"`
+	DNSImpliesHTTP bool     `koanf:"dns-implies-http"`
+
+	// AllowCIDR adds to the global allow-cidr ranges, which are reachable
+	// even inside the blocked ranges. Unlike the global ones they must not
+	// overlap projectCIDRForbidden.
+	AllowCIDR []string `koanf:"allow-cidr"`
+
+	// CustomPresets defines project presets as name to allow-http entries.
+	// They are listed in presets like the built-in ones, whose names they
+	// can't reuse.
+	CustomPresets map[string][]string `koanf:"custom-presets"`
+
+	// DNSCacheSize bounds the number of DNS answers the proxy caches; 0
+	// means the proxy default.
+	DNSCacheSize int `koanf:"dns-cache-size"`
+
+	// DenyHTTP and DenyDNS subtract domains from this project's allowlist,
+	// including entries pulled in by presets. They add to the global deny
+	// lists and cannot lift them.
+	DenyHTTP []string `koanf:"deny-http"`
+	DenyDNS  []string `koanf:"deny-dns"`
+
+	// SetupCommands run inside the sandbox before the shell starts, e.g.
+	// to warm dependency caches. A failing command stops the session unless
+	// SetupIgnoreErrors is set.
+	SetupCommands     []string `koanf:"setup-commands"`
+	SetupIgnoreErrors bool     `koanf:"setup-ignore-errors"`
+
+	// Resources limits the sandbox container of this project.
+	Resources Resources `koanf:"resources"`
+
+	// Env sets extra environment variables in the sandbox, e.g. EDITOR.
+	// The proxy settings can't be overridden.
+	Env map[string]string `koanf:"env"`
+
+	Profiles map[string]Profile `koanf:"profiles"`
+}
+
+// Resources are the CPU and memory limits of the sandbox container. Zero
+// means unlimited.
+type Resources struct {
+	MemoryMB int64   `koanf:"memory-mb"`
+	CPUs     float64 `koanf:"cpus"`
+}
+
+// Profile is a named bundle of allow entries for a task, like publishing a
+// package, that is only applied when selected with --profile.
+type Profile struct {
+	AllowHTTP []string `koanf:"allow-http"`
+	AllowDNS  []string `koanf:"allow-dns"`
+}
+
+const (
+	// DefaultCertLifetime is the validity of the per-session mTLS
+	// certificates when cert-lifetime is not set.
+	DefaultCertLifetime = 30 * 24 * time.Hour
+	// MaxCertLifetime is the longest accepted cert-lifetime.
+	MaxCertLifetime = 365 * 24 * time.Hour
+)
+
+// dnsImpliedHTTPPort is the port allowed for allow-dns entries when the
+// project sets dns-implies-http.
+const dnsImpliedHTTPPort = "443"
+
+// projectCIDRForbidden lists the ranges a project allow-cidr entry must not
+// overlap. A cloned repository should not be able to open loopback or the
+// link-local cloud metadata endpoints; the global config still can.
+var projectCIDRForbidden = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fe80::/10"),
 }
 
 type Config struct {
 	Global  GlobalConfig
 	Project ProjectConfig
+
+	// EntryComments maps allow-http and allow-dns entries to the trailing
+	// YAML comment written next to them, e.g. "needed by tool X".
+	EntryComments map[string]string
+
+	// LegacyAllowFiles lists the loaded files that still use the allow
+	// section, which was renamed to allow-http. Its entries are merged into
+	// AllowHTTP so they keep working.
+	LegacyAllowFiles []string
 }
 
 type MergedConfig struct {
@@ -51,31 +172,144 @@ type MergedConfig struct {
 	BlockCIDR      []string `json:"block-cidr"`
 	AllowCIDR      []string `json:"allow-cidr"`
 	ExtraHosts     []string `json:"extra-hosts,omitempty"`
-	UpstreamDNS    string   `json:"upstream-dns,omitempty"`
+	UpstreamDNS    []string `json:"upstream-dns,omitempty"`
 	AllowHostPorts []int    `json:"allow-host-ports"`
 	ProxyIP        string   `json:"proxy-ip,omitempty"`
 	HostGateway    string   `json:"host-gateway,omitempty"`
 	ProxyPort      int      `json:"proxy-port,omitempty"`
 	ControlAPIPort int      `json:"control-api-port,omitempty"`
 	SSHForwardAddr string   `json:"ssh-forward-addr,omitempty"`
+
+	ControlAPISocket string `json:"control-api-socket,omitempty"`
+
+	DenyHTTP []string `json:"deny-http,omitempty"`
+	DenyDNS  []string `json:"deny-dns,omitempty"`
+
+	UpstreamDoH []string `json:"upstream-doh,omitempty"`
+
+	// Denied lists the allow entries Merge dropped because a deny rule
+	// covers them. It is not passed to the proxy.
+	Denied []string `json:"-"`
+
+	VirtualHosts    map[string]string `json:"virtual-hosts,omitempty"`
+	MaxRequestBytes int64             `json:"max-request-bytes,omitempty"`
+	DNSCacheSize    int               `json:"dns-cache-size,omitempty"`
+	EntryComments   map[string]string `json:"entry-comments,omitempty"`
+
+	// EntrySources maps allow-http and allow-dns entries to where they came
+	// from: "global", "project", "cli", "profile:<name>", "preset:<name>" or
+	// "dns-implies-http". The control API only returns it on request.
+	EntrySources map[string]string `json:"entry-sources,omitempty"`
+
+	AllowPrivateNetwork bool `json:"allow-private-network,omitempty"`
+
+	// ConfigHash is the policy hash the proxy recorded at startup. It is
+	// only set in configs read from the control API.
+	ConfigHash string `json:"config-hash,omitempty"`
+}
+
+// PolicyHash returns the hash the proxy records for this config, see
+// proxy.ProxyConfig.PolicyHash.
+func (m MergedConfig) PolicyHash() string {
+	return proxy.ProxyConfig{
+		AllowHTTP:           m.AllowHTTP,
+		AllowDNS:            m.AllowDNS,
+		BlockCIDR:           m.BlockCIDR,
+		AllowCIDR:           m.AllowCIDR,
+		UpstreamDNS:         m.UpstreamDNS,
+		AllowHostPorts:      m.AllowHostPorts,
+		VirtualHosts:        m.VirtualHosts,
+		MaxRequestBytes:     m.MaxRequestBytes,
+		AllowPrivateNetwork: m.AllowPrivateNetwork,
+		DenyHTTP:            m.DenyHTTP,
+		DenyDNS:             m.DenyDNS,
+		UpstreamDoH:         m.UpstreamDoH,
+	}.PolicyHash()
+}
+
+// ProxyConfigStale reports whether a proxy with the live config read from
+// the control API doesn't enforce the disk config merged from the config
+// files. Allow entries the proxy has on top of the files, from --allow,
+// --preset or runtime allows, don't make it stale, and neither does
+// --allow-private-network. Live entries that came from the files but are
+// gone from disk do; that needs the EntrySources of the live config, see
+// ControlClient.ConfigWithSources. A live config without a
+// hash comes from an older proxy and is never reported as stale.
+func ProxyConfigStale(live, disk MergedConfig) bool {
+	if live.ConfigHash == "" || live.ConfigHash == disk.PolicyHash() {
+		return false
+	}
+	if missingEntry(disk.AllowHTTP, live.AllowHTTP, nil) || missingEntry(disk.AllowDNS, live.AllowDNS, nil) {
+		return true
+	}
+	if missingEntry(live.AllowHTTP, disk.AllowHTTP, live.EntrySources) || missingEntry(live.AllowDNS, disk.AllowDNS, live.EntrySources) {
+		return true
+	}
+	if disk.AllowPrivateNetwork && !live.AllowPrivateNetwork {
+		return true
+	}
+	live.AllowHTTP, live.AllowDNS, live.AllowPrivateNetwork = nil, nil, false
+	disk.AllowHTTP, disk.AllowDNS, disk.AllowPrivateNetwork = nil, nil, false
+	return live.PolicyHash() != disk.PolicyHash()
+}
+
+// fileEntrySources are the entry sources of allow entries that come from the
+// config files alone. Profile and preset entries may come from command line
+// flags, which the disk config doesn't know about.
+var fileEntrySources = []string{"global", "project", "dns-implies-http"}
+
+// missingEntry reports whether an entry of from is not in to. With sources,
+// only entries from fileEntrySources count.
+func missingEntry(from, to []string, sources map[string]string) bool {
+	for _, e := range from {
+		if sources != nil && !slices.Contains(fileEntrySources, sources[e]) {
+			continue
+		}
+		if !slices.Contains(to, e) {
+			return true
+		}
+	}
+	return false
 }
 
+// portAttempts bounds how many random candidates RandomProxyPort tries.
+const portAttempts = 100
+
 // RandomProxyPort returns a random port in the ephemeral range (49152-65535)
-// that is not in the excluded set.
-func RandomProxyPort(excluded []int) (int, error) {
-	const lo, hi = 49152, 65535
+// that is not in the excluded set. With a non-empty bindAddr the port must
+// also be free on that host address, which keeps concurrent sessions from
+// publishing the same port.
+func RandomProxyPort(bindAddr string, excluded []int) (int, error) {
+	return randomPort(49152, 65535, bindAddr, excluded)
+}
+
+func randomPort(lo, hi int, bindAddr string, excluded []int) (int, error) {
 	rangeSize := hi - lo + 1
-	for range 100 {
+	for range portAttempts {
 		var b [2]byte
 		if _, err := rand.Read(b[:]); err != nil {
 			return 0, err
 		}
 		port := lo + int(binary.BigEndian.Uint16(b[:]))%rangeSize
-		if !slices.Contains(excluded, port) {
-			return port, nil
+		if slices.Contains(excluded, port) {
+			continue
+		}
+		if bindAddr != "" && !portFree(bindAddr, port) {
+			continue
 		}
+		return port, nil
 	}
-	return 0, fmt.Errorf("failed to find available port after 100 attempts")
+	return 0, fmt.Errorf("failed to find available port after %d attempts", portAttempts)
+}
+
+// portFree reports whether a TCP listener can bind port on addr right now.
+func portFree(addr string, port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	ln.Close() //nolint:errcheck
+	return true
 }
 
 func Load(globalPath, projectPath string) (*Config, error) {
@@ -88,9 +322,45 @@ func Load(globalPath, projectPath string) (*Config, error) {
 		return nil, err
 	}
 
+	for _, f := range []struct {
+		path      string
+		allowHTTP *[]string
+	}{
+		{globalPath, &cfg.Global.AllowHTTP},
+		{projectPath, &cfg.Project.AllowHTTP},
+	} {
+		legacy, err := loadLegacyAllow(f.path)
+		if err != nil {
+			return nil, err
+		}
+		if len(legacy) > 0 {
+			*f.allowHTTP = dedup(*f.allowHTTP, legacy)
+			cfg.LegacyAllowFiles = append(cfg.LegacyAllowFiles, f.path)
+		}
+	}
+
+	cfg.EntryComments = make(map[string]string)
+	for _, path := range []string{globalPath, projectPath} {
+		if err := loadEntryComments(path, cfg.EntryComments); err != nil {
+			return nil, err
+		}
+	}
+
 	return cfg, nil
 }
 
+// loadLegacyAllow returns the entries of the allow section in path. Older
+// versions wrote allow-http entries under that key.
+func loadLegacyAllow(path string) ([]string, error) {
+	var legacy struct {
+		Allow []string `koanf:"allow"`
+	}
+	if err := loadFile(path, &legacy); err != nil {
+		return nil, err
+	}
+	return legacy.Allow, nil
+}
+
 // loadFile parses a YAML file into target, silently skipping missing files
 // so callers don't need to check existence first.
 func loadFile(path string, target any) error {
@@ -105,36 +375,522 @@ func loadFile(path string, target any) error {
 	return k.Unmarshal("", target)
 }
 
-// Merge combines global config, project config, CLI flags, and expanded presets
-// into a single flat config. Duplicates are removed while preserving order.
-func (c *Config) Merge(cliAllow []string, cliPresets []string) (MergedConfig, error) {
-	allowHTTP := dedup(c.Global.AllowHTTP, c.Project.AllowHTTP, cliAllow)
+// Merge combines global config, project config, CLI flags, expanded presets,
+// and the selected profiles into a single flat config. Duplicates are removed
+// while preserving order.
+func (c *Config) Merge(cliAllow []string, cliPresets []string, profiles []string) (MergedConfig, error) {
+	for _, port := range c.Project.AllowHostPorts {
+		if port < 1 || port > 65535 {
+			return MergedConfig{}, fmt.Errorf("allow-host-ports: port %d out of range 1-65535", port)
+		}
+	}
+
+	for _, server := range c.Global.UpstreamDNS {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return MergedConfig{}, fmt.Errorf("upstream-dns: %q must be host:port", server)
+		}
+	}
+	for _, u := range c.Global.UpstreamDoH {
+		if err := proxy.ValidateDoHURL(u); err != nil {
+			return MergedConfig{}, fmt.Errorf("upstream-doh: %w", err)
+		}
+	}
+	if len(c.Global.UpstreamDNS) > 0 && len(c.Global.UpstreamDoH) > 0 {
+		return MergedConfig{}, fmt.Errorf("upstream-dns and upstream-doh can't be used together")
+	}
+
+	globalHTTP, err := proxy.NormalizeHTTPEntries(c.Global.AllowHTTP)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("allow-http: %w", err)
+	}
+	projectHTTP, err := proxy.NormalizeHTTPEntries(c.Project.AllowHTTP)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("allow-http: %w", err)
+	}
+	cliHTTP, err := proxy.NormalizeHTTPEntries(cliAllow)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("allow-http: %w", err)
+	}
+	allowHTTP := dedup(globalHTTP, projectHTTP, cliHTTP)
+
+	// sources records the first place each entry came from, matching the
+	// order dedup keeps. HTTP entries always carry a port and DNS entries
+	// never do, so both share the map.
+	sources := make(map[string]string)
+	addSources := func(entries []string, source string) {
+		for _, e := range entries {
+			if _, ok := sources[e]; !ok {
+				sources[e] = source
+			}
+		}
+	}
+	addSources(globalHTTP, "global")
+	addSources(projectHTTP, "project")
+	addSources(cliHTTP, "cli")
+	addSources(c.Global.AllowDNS, "global")
+	addSources(c.Project.AllowDNS, "project")
+
+	var profileDNS []string
+	for _, name := range profiles {
+		p, ok := c.Profile(name)
+		if !ok {
+			return MergedConfig{}, fmt.Errorf("profiles: unknown profile %q", name)
+		}
+		profileHTTP, err := proxy.NormalizeHTTPEntries(p.AllowHTTP)
+		if err != nil {
+			return MergedConfig{}, fmt.Errorf("profiles: %s: allow-http: %w", name, err)
+		}
+		allowHTTP = dedup(allowHTTP, profileHTTP)
+		profileDNS = dedup(profileDNS, p.AllowDNS)
+		addSources(profileHTTP, "profile:"+name)
+		addSources(p.AllowDNS, "profile:"+name)
+	}
 
 	// Expand presets from both project config and CLI flags.
-	reg := proxy.NewPresetRegistry()
-	allowHTTP = dedup(allowHTTP, reg.Expand(append(c.Project.Presets, cliPresets...)))
+	reg, err := c.PresetRegistry()
+	if err != nil {
+		return MergedConfig{}, err
+	}
+	presets := slices.Concat(c.Project.Presets, cliPresets)
+	allowHTTP = dedup(allowHTTP, reg.Expand(presets))
+	for domain, preset := range reg.Sources(presets) {
+		addSources([]string{domain}, "preset:"+preset)
+	}
 
 	if err := proxy.ValidateHTTPEntries(allowHTTP); err != nil {
 		return MergedConfig{}, fmt.Errorf("allow-http: %w", err)
 	}
 
-	allowDNS := dedup(c.Global.AllowDNS, c.Project.AllowDNS)
+	allowDNS := dedup(c.Global.AllowDNS, c.Project.AllowDNS, profileDNS)
+
+	if c.Global.MaxRequestBytes < 0 {
+		return MergedConfig{}, fmt.Errorf("max-request-bytes: must not be negative, got %d", c.Global.MaxRequestBytes)
+	}
+	allowCIDR := dedup(c.Global.AllowCIDR, c.Project.AllowCIDR)
+	for _, cidr := range allowCIDR {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return MergedConfig{}, fmt.Errorf("allow-cidr: invalid range %q", cidr)
+		}
+	}
+	for _, cidr := range c.Project.AllowCIDR {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue // reported above
+		}
+		for _, forbidden := range projectCIDRForbidden {
+			if prefix.Overlaps(forbidden) {
+				return MergedConfig{}, fmt.Errorf("allow-cidr: project range %q overlaps %s, only the global config can allow it", cidr, forbidden)
+			}
+		}
+	}
+
+	if c.Project.DNSCacheSize < 0 {
+		return MergedConfig{}, fmt.Errorf("dns-cache-size: must not be negative, got %d", c.Project.DNSCacheSize)
+	}
 
 	if err := proxy.ValidateDNSEntries(allowDNS); err != nil {
 		return MergedConfig{}, fmt.Errorf("allow-dns: %w", err)
 	}
 
+	// With dns-implies-http, every allow-dns entry is also reachable through
+	// the HTTP proxy on the standard HTTPS port.
+	if c.Project.DNSImpliesHTTP {
+		implied := make([]string, 0, len(allowDNS))
+		for _, d := range allowDNS {
+			implied = append(implied, d+":"+dnsImpliedHTTPPort)
+		}
+		allowHTTP = dedup(allowHTTP, implied)
+		addSources(implied, "dns-implies-http")
+	}
+
+	denyHTTP, err := proxy.NormalizeDenyHTTPEntries(dedup(c.Global.DenyHTTP, c.Project.DenyHTTP))
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("deny-http: %w", err)
+	}
+	denyHTTP = dedup(denyHTTP)
+	denyHTTPRules, err := proxy.NewHTTPAllowlist(denyHTTP)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("deny-http: %w", err)
+	}
+	denyDNS := dedup(c.Global.DenyDNS, c.Project.DenyDNS)
+	denyDNSRules, err := proxy.NewDNSAllowlist(denyDNS)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("deny-dns: %w", err)
+	}
+
+	// Deny rules win over allow entries from every layer. Entries they
+	// cover are dropped here; the proxy blocks denied hosts within wildcard
+	// entries at request time.
+	var denied []string
+	allowHTTP = slices.DeleteFunc(allowHTTP, func(e string) bool {
+		_, ok := denyHTTPRules.MatchEntry(e)
+		if ok {
+			denied = append(denied, e)
+			delete(sources, e)
+		}
+		return ok
+	})
+	allowDNS = slices.DeleteFunc(allowDNS, func(e string) bool {
+		_, ok := denyDNSRules.Match(e)
+		if ok {
+			denied = append(denied, e)
+			delete(sources, e)
+		}
+		return ok
+	})
+
+	virtualHosts, err := virtualHosts(c.Global.ExtraHosts)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("extra-hosts: %w", err)
+	}
+
+	var comments map[string]string
+	for _, e := range slices.Concat(allowHTTP, allowDNS) {
+		if comment, ok := c.EntryComments[e]; ok {
+			if comments == nil {
+				comments = make(map[string]string)
+			}
+			comments[e] = comment
+		}
+	}
+
 	return MergedConfig{
-		AllowHTTP:      allowHTTP,
-		AllowDNS:       allowDNS,
-		BlockCIDR:      c.Global.BlockCIDR,
-		AllowCIDR:      c.Global.AllowCIDR,
-		ExtraHosts:     c.Global.ExtraHosts,
-		UpstreamDNS:    c.Global.UpstreamDNS,
-		AllowHostPorts: c.Project.AllowHostPorts,
+		AllowHTTP:       allowHTTP,
+		AllowDNS:        allowDNS,
+		BlockCIDR:       c.Global.BlockCIDR,
+		AllowCIDR:       allowCIDR,
+		ExtraHosts:      c.Global.ExtraHosts,
+		UpstreamDNS:     c.Global.UpstreamDNS,
+		UpstreamDoH:     c.Global.UpstreamDoH,
+		AllowHostPorts:  c.Project.AllowHostPorts,
+		VirtualHosts:    virtualHosts,
+		MaxRequestBytes: c.Global.MaxRequestBytes,
+		DNSCacheSize:    c.Project.DNSCacheSize,
+		EntryComments:   comments,
+		EntrySources:    sources,
+		DenyHTTP:        denyHTTP,
+		DenyDNS:         denyDNS,
+		Denied:          denied,
+
+		AllowPrivateNetwork: c.Global.AllowPrivateNetwork,
 	}, nil
 }
 
+// Validate checks the loaded config for an invalid session limit or cert
+// lifetime, unknown presets, and invalid allow entries, including those of
+// every profile, the same checks a session start runs.
+func (c *Config) Validate() error {
+	if c.Global.MaxSessions < 0 {
+		return fmt.Errorf("max-sessions: must not be negative, got %d", c.Global.MaxSessions)
+	}
+	if _, err := c.CertLifetime(0); err != nil {
+		return err
+	}
+	if _, err := c.CertKeyType(""); err != nil {
+		return err
+	}
+	if _, err := c.SandboxResources(0, 0); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Project.Env)) {
+		if err := CheckEnvName(name); err != nil {
+			return fmt.Errorf("env: %w", err)
+		}
+	}
+	if _, err := c.SetupCommands(); err != nil {
+		return err
+	}
+	if _, err := c.CACerts(); err != nil {
+		return err
+	}
+	reg, err := c.PresetRegistry()
+	if err != nil {
+		return err
+	}
+	for _, name := range c.Project.Presets {
+		if _, ok := reg.Get(name); !ok {
+			return fmt.Errorf("presets: unknown preset %q", name)
+		}
+	}
+	_, err = c.Merge(nil, nil, c.ProfileNames())
+	return err
+}
+
+// SetupCommands returns the project's setup-commands. Blank commands are
+// rejected, and so are commands with NUL bytes, which separate the commands
+// handed to the sandbox.
+func (c *Config) SetupCommands() ([]string, error) {
+	for i, command := range c.Project.SetupCommands {
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("setup-commands: command %d is empty", i+1)
+		}
+		if strings.ContainsRune(command, 0) {
+			return nil, fmt.Errorf("setup-commands: command %d contains a NUL byte", i+1)
+		}
+	}
+	return c.Project.SetupCommands, nil
+}
+
+// CACerts reads the files listed in ca-certs and returns their certificates
+// as one PEM bundle. Paths must be absolute or start with "~/". Every file
+// must hold at least one certificate and no other PEM blocks, so a private
+// key can't end up in the sandbox by mistake.
+func (c *Config) CACerts() ([]byte, error) {
+	var bundle []byte
+	for _, path := range c.Global.CACerts {
+		certs, err := readCACerts(path)
+		if err != nil {
+			return nil, fmt.Errorf("ca-certs: %w", err)
+		}
+		bundle = append(bundle, certs...)
+	}
+	return bundle, nil
+}
+
+func readCACerts(path string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%s: path must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%s: unexpected PEM block %q, only certificates are allowed", path, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		certs = append(certs, pem.EncodeToMemory(block)...)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return certs, nil
+}
+
+// Profile returns the named profile. A profile defined in both the global and
+// the project config combines the entries of both.
+func (c *Config) Profile(name string) (Profile, bool) {
+	global, inGlobal := c.Global.Profiles[name]
+	project, inProject := c.Project.Profiles[name]
+	if !inGlobal && !inProject {
+		return Profile{}, false
+	}
+	return Profile{
+		AllowHTTP: dedup(global.AllowHTTP, project.AllowHTTP),
+		AllowDNS:  dedup(global.AllowDNS, project.AllowDNS),
+	}, true
+}
+
+// ProfileNames returns the sorted names of the profiles defined in the global
+// and project config.
+func (c *Config) ProfileNames() []string {
+	names := slices.Concat(slices.Collect(maps.Keys(c.Global.Profiles)), slices.Collect(maps.Keys(c.Project.Profiles)))
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// PresetRegistry returns the built-in presets together with the project's
+// custom-presets.
+func (c *Config) PresetRegistry() (*proxy.PresetRegistry, error) {
+	return newPresetRegistry(c.Project.CustomPresets)
+}
+
+// newPresetRegistry returns the built-in presets with the custom presets
+// added in name order. Custom preset entries take the allow-http shorthands.
+func newPresetRegistry(custom map[string][]string) (*proxy.PresetRegistry, error) {
+	reg := proxy.NewPresetRegistry()
+	for _, name := range slices.Sorted(maps.Keys(custom)) {
+		if _, ok := reg.Get(name); ok {
+			return nil, fmt.Errorf("custom-presets: %q is the name of a built-in preset", name)
+		}
+		domains, err := proxy.NormalizeHTTPEntries(custom[name])
+		if err != nil {
+			return nil, fmt.Errorf("custom-presets: %s: %w", name, err)
+		}
+		if err := reg.Register(proxy.Preset{
+			Name:        name,
+			Group:       proxy.CustomPresetGroup,
+			Description: "Project preset",
+			Domains:     domains,
+		}); err != nil {
+			return nil, fmt.Errorf("custom-presets: %w", err)
+		}
+	}
+	return reg, nil
+}
+
+// PresetPortNotes reports domains that the selected presets allow on more
+// than one port. The merged allowlist keeps every entry; the notes only make
+// the combined surface visible. cliPresets are the presets passed on the
+// command line in addition to the project presets.
+func (c *Config) PresetPortNotes(cliPresets []string) []string {
+	reg, err := c.PresetRegistry()
+	if err != nil {
+		// Merge reports the invalid custom preset.
+		return nil
+	}
+	var sources []presetEntries
+	for _, name := range dedup(c.Project.Presets, cliPresets) {
+		sources = append(sources, presetEntries{name: name, entries: reg.Expand([]string{name})})
+	}
+	return portConflictNotes(sources)
+}
+
+// presetEntries holds the expanded allow-http entries of a single preset.
+type presetEntries struct {
+	name    string
+	entries []string
+}
+
+// portConflictNotes returns one note per domain that appears with different
+// ports across the given presets, e.g.
+// "proxy.golang.org is allowed on port 443 (pkg-go) and port 80 (custom)".
+func portConflictNotes(sources []presetEntries) []string {
+	var domains []string
+	portsByDomain := make(map[string][]string)
+	presetsByEntry := make(map[string][]string)
+	for _, src := range sources {
+		for _, entry := range src.entries {
+			i := strings.LastIndex(entry, ":")
+			if i < 0 {
+				continue
+			}
+			domain, port := entry[:i], entry[i+1:]
+			if _, ok := portsByDomain[domain]; !ok {
+				domains = append(domains, domain)
+			}
+			if !slices.Contains(portsByDomain[domain], port) {
+				portsByDomain[domain] = append(portsByDomain[domain], port)
+			}
+			if !slices.Contains(presetsByEntry[entry], src.name) {
+				presetsByEntry[entry] = append(presetsByEntry[entry], src.name)
+			}
+		}
+	}
+
+	var notes []string
+	for _, domain := range domains {
+		ports := portsByDomain[domain]
+		if len(ports) < 2 {
+			continue
+		}
+		parts := make([]string, 0, len(ports))
+		for _, port := range ports {
+			parts = append(parts, fmt.Sprintf("port %s (%s)", port, strings.Join(presetsByEntry[domain+":"+port], ", ")))
+		}
+		notes = append(notes, fmt.Sprintf("%s is allowed on %s and %s",
+			domain, strings.Join(parts[:len(parts)-1], ", "), parts[len(parts)-1]))
+	}
+	return notes
+}
+
+// CertLifetime returns the validity for the per-session mTLS certificates.
+// A non-zero override, e.g. from a CLI flag, wins over the global config;
+// when neither is set DefaultCertLifetime is used.
+func (c *Config) CertLifetime(override time.Duration) (time.Duration, error) {
+	lifetime := c.Global.CertLifetime
+	if override != 0 {
+		lifetime = override
+	}
+	if lifetime == 0 {
+		return DefaultCertLifetime, nil
+	}
+	if lifetime < 0 {
+		return 0, fmt.Errorf("cert-lifetime: must be positive, got %s", lifetime)
+	}
+	if lifetime > MaxCertLifetime {
+		return 0, fmt.Errorf("cert-lifetime: must not exceed %s, got %s", MaxCertLifetime, lifetime)
+	}
+	return lifetime, nil
+}
+
+// CertKeyType returns the key algorithm for the per-session mTLS
+// certificates. A non-empty override, e.g. from a CLI flag, wins over the
+// global config; when neither is set proxy.KeyTypeEd25519 is used.
+func (c *Config) CertKeyType(override string) (proxy.KeyType, error) {
+	keyType := c.Global.CertKeyType
+	if override != "" {
+		keyType = override
+	}
+	kt, err := proxy.ParseKeyType(keyType)
+	if err != nil {
+		return "", fmt.Errorf("cert-key-type: %w", err)
+	}
+	return kt, nil
+}
+
+// SandboxResources returns the resource limits for the sandbox container.
+// Non-zero overrides, e.g. from CLI flags, win over the project config.
+func (c *Config) SandboxResources(memoryMB int64, cpus float64) (Resources, error) {
+	r := c.Project.Resources
+	if memoryMB != 0 {
+		r.MemoryMB = memoryMB
+	}
+	if cpus != 0 {
+		r.CPUs = cpus
+	}
+	if r.MemoryMB < 0 {
+		return Resources{}, fmt.Errorf("resources: memory-mb must not be negative, got %d", r.MemoryMB)
+	}
+	if r.CPUs < 0 {
+		return Resources{}, fmt.Errorf("resources: cpus must not be negative, got %g", r.CPUs)
+	}
+	return r, nil
+}
+
+// CheckEnvName reports whether name can be used as an environment variable
+// name: it must be non-empty and must not contain '=', whitespace or NUL.
+func CheckEnvName(name string) error {
+	if name == "" {
+		return fmt.Errorf("variable name must not be empty")
+	}
+	if strings.ContainsAny(name, "=\x00") || strings.ContainsFunc(name, unicode.IsSpace) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	return nil
+}
+
+// virtualHosts returns the extra-hosts entries whose name ends in .vibepit,
+// mapped to their address. The proxy serves these like host.vibepit.
+func virtualHosts(extraHosts []string) (map[string]string, error) {
+	var hosts map[string]string
+	for _, entry := range extraHosts {
+		name, addr, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || addr == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected name:address", entry)
+		}
+		name = strings.ToLower(name)
+		if !strings.HasSuffix(name, proxy.VirtualHostSuffix) {
+			continue
+		}
+		if name == proxy.HostVibepit {
+			return nil, fmt.Errorf("%s is reserved for the host machine", proxy.HostVibepit)
+		}
+		if hosts == nil {
+			hosts = make(map[string]string)
+		}
+		hosts[name] = addr
+	}
+	return hosts, nil
+}
+
 // dedup merges multiple string slices, removing duplicates while preserving order.
 func dedup(slices ...[]string) []string {
 	seen := make(map[string]bool)
@@ -151,7 +907,8 @@ func dedup(slices ...[]string) []string {
 }
 
 // FindProjectRoot returns the Git repository root for the given path, or the
-// path itself if it is not inside a Git repository.
+// path itself if it is not inside a Git repository. For linked worktrees the
+// worktree's own root is returned, not the main checkout.
 func FindProjectRoot(path string) (string, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
@@ -162,9 +919,35 @@ func FindProjectRoot(path string) (string, error) {
 			return root, nil
 		}
 	}
+	if root, ok := findGitMarker(abs); ok {
+		return root, nil
+	}
 	return abs, nil
 }
 
+// findGitMarker walks up from dir looking for a ".git" entry. It is the
+// fallback when the git binary is unavailable. A ".git" directory marks a
+// regular checkout; a ".git" file containing a "gitdir:" pointer marks a
+// linked worktree (or submodule), whose root is the directory holding it.
+func findGitMarker(dir string) (string, bool) {
+	for {
+		marker := filepath.Join(dir, ".git")
+		if info, err := os.Stat(marker); err == nil {
+			if info.IsDir() {
+				return dir, true
+			}
+			if data, err := os.ReadFile(marker); err == nil && strings.HasPrefix(string(data), "gitdir:") {
+				return dir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
 func DefaultGlobalPath() string {
 	configHome := xdg.ConfigHome
 	if configHome == "" {
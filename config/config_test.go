@@ -2,14 +2,21 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bernd/vibepit/proxy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadAndMerge(t *testing.T) {
@@ -45,7 +52,7 @@ allow-http:
 		cfg, err := Load(globalFile, projectFile)
 		require.NoError(t, err)
 
-		merged, err := cfg.Merge(nil, nil)
+		merged, err := cfg.Merge(nil, nil, nil)
 		require.NoError(t, err)
 
 		for _, want := range []string{"github.com:443", "api.anthropic.com:443", "proxy.golang.org:443", "sum.golang.org:443"} {
@@ -59,7 +66,7 @@ allow-http:
 
 	t.Run("CLI overrides add to merged config", func(t *testing.T) {
 		cfg := &Config{}
-		merged, err := cfg.Merge([]string{"extra.com:443"}, []string{"pkg-node"})
+		merged, err := cfg.Merge([]string{"extra.com:443"}, []string{"pkg-node"}, nil)
 		require.NoError(t, err)
 
 		assert.Contains(t, merged.AllowHTTP, "extra.com:443")
@@ -81,7 +88,7 @@ allow-host-ports:
 		cfg, err := Load("/nonexistent/global.yaml", projectFile)
 		require.NoError(t, err)
 
-		merged, err := cfg.Merge(nil, nil)
+		merged, err := cfg.Merge(nil, nil, nil)
 		require.NoError(t, err)
 		assert.Equal(t, []int{9200, 5432}, merged.AllowHostPorts)
 	})
@@ -89,7 +96,7 @@ allow-host-ports:
 	t.Run("generates random port in ephemeral range avoiding excluded", func(t *testing.T) {
 		excluded := []int{55000, 55001}
 		for range 100 {
-			port, err := RandomProxyPort(excluded)
+			port, err := RandomProxyPort("", excluded)
 			require.NoError(t, err)
 			assert.GreaterOrEqual(t, port, 49152)
 			assert.LessOrEqual(t, port, 65535)
@@ -97,10 +104,32 @@ allow-host-ports:
 		}
 	})
 
+	t.Run("skips excluded ports", func(t *testing.T) {
+		for range 20 {
+			port, err := randomPort(55000, 55001, "", []int{55000})
+			require.NoError(t, err)
+			assert.Equal(t, 55001, port)
+		}
+	})
+
+	t.Run("skips ports in use on the bind address", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		inUse := ln.Addr().(*net.TCPAddr).Port
+
+		_, err = randomPort(inUse, inUse, "127.0.0.1", nil)
+		assert.ErrorContains(t, err, "failed to find available port")
+
+		require.NoError(t, ln.Close())
+		port, err := randomPort(inUse, inUse, "127.0.0.1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, inUse, port)
+	})
+
 	t.Run("missing files are not errors", func(t *testing.T) {
 		cfg, err := Load("/nonexistent/global.yaml", "/nonexistent/project.yaml")
 		require.NoError(t, err)
-		merged, err := cfg.Merge(nil, nil)
+		merged, err := cfg.Merge(nil, nil, nil)
 		require.NoError(t, err)
 		assert.Empty(t, merged.AllowHTTP)
 	})
@@ -279,6 +308,91 @@ func TestAppendAllowHTTP(t *testing.T) {
 		assert.Equal(t, want, string(data))
 	})
 
+	t.Run("preserves CRLF line endings when replacing the commented template", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "presets:\r\n  - node\r\n\r\n# allow-http:\r\n#   - api.openai.com:443\r\n"
+		want := "presets:\r\n  - node\r\n\r\nallow-http:\r\n  - bun.sh:443\r\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	})
+
+	t.Run("preserves CRLF line endings when adding a new section", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "presets:\r\n  - node\r\n"
+		want := "presets:\r\n  - node\r\n\r\nallow-http:\r\n  - bun.sh:443\r\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	})
+
+	t.Run("appends to a list with deeper item indentation", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "allow-http:\n    - github.com:443 # code\nallow-host-ports: [3000]\n"
+		want := "allow-http:\n    - github.com:443 # code\n    - bun.sh:443\nallow-host-ports: [3000]\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	})
+
+	t.Run("ignores a commented template indented under another key", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "x-notes:\n  # allow-http:\n  #   - foo:443\n  owner: me\n"
+		want := before + "\nallow-http:\n  - bun.sh:443\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	})
+
+	t.Run("rejects tab indentation without touching the file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "presets:\n\t- node\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.Error(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, before, string(data))
+	})
+
+	t.Run("leaves an allow-http key nested under another key alone", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		os.WriteFile(path, []byte("x-old:\n  allow-http:\n    - old.example.com:443\n"), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		cfg := &ProjectConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.Equal(t, []string{"bun.sh:443"}, cfg.AllowHTTP)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "x-old:\n  allow-http:\n    - old.example.com:443\n")
+	})
+
 	t.Run("deduplicates existing entries", func(t *testing.T) {
 		dir := t.TempDir()
 		path := filepath.Join(dir, "network.yaml")
@@ -300,6 +414,69 @@ func TestAppendAllowHTTP(t *testing.T) {
 	})
 }
 
+func TestAppendAllowHTTPWithAnchors(t *testing.T) {
+	load := func(t *testing.T, path string) map[string]any {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var m map[string]any
+		require.NoError(t, yaml.Unmarshal(data, &m), "rewritten config must stay valid YAML:\n%s", data)
+		return m
+	}
+
+	t.Run("replaces an alias with its own list", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		os.WriteFile(path, []byte("x-common: &common\n  - github.com:443\n\n# HTTP allowlist\nallow-http: *common\n"), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		cfg := &ProjectConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.Equal(t, []string{"github.com:443", "bun.sh:443"}, cfg.AllowHTTP)
+		assert.Equal(t, []any{"github.com:443"}, load(t, path)["x-common"], "alias target must not change")
+	})
+
+	t.Run("keeps entries inherited through a merge key", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		os.WriteFile(path, []byte("base: &base\n  allow-http:\n    - github.com:443\n<<: *base\npresets:\n  - default\n"), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		cfg := &ProjectConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.Equal(t, []string{"github.com:443", "bun.sh:443"}, cfg.AllowHTTP)
+		assert.Equal(t, []string{"default"}, cfg.Presets)
+	})
+
+	t.Run("extends an anchored list and its aliases", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		os.WriteFile(path, []byte("allow-http: &http\n  - github.com:443\nx-copy: *http\n"), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"bun.sh:443"}))
+
+		cfg := &ProjectConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.Equal(t, []string{"github.com:443", "bun.sh:443"}, cfg.AllowHTTP)
+		assert.Equal(t, []any{"github.com:443", "bun.sh:443"}, load(t, path)["x-copy"])
+	})
+
+	t.Run("deduplicates against entries from an alias", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		before := "x-common: &common\n  - github.com:443\nallow-http: *common\n"
+		os.WriteFile(path, []byte(before), 0o644)
+
+		require.NoError(t, AppendAllowHTTP(path, []string{"github.com:443"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, before, string(data))
+	})
+}
+
 func TestAppendAllowDNS(t *testing.T) {
 	t.Run("adds to existing allow-dns section", func(t *testing.T) {
 		dir := t.TempDir()
@@ -349,6 +526,28 @@ func TestAppendAllowDNS(t *testing.T) {
 	})
 }
 
+func TestAppendAllowConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "network.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("allow-http:\n  - github.com:443\n"), 0o644))
+
+	var want []string
+	var wg sync.WaitGroup
+	for i := range 20 {
+		entry := fmt.Sprintf("host%d.example.com:443", i)
+		want = append(want, entry)
+		wg.Go(func() {
+			assert.NoError(t, AppendAllowHTTP(path, []string{entry}))
+		})
+	}
+	wg.Wait()
+
+	cfg := &ProjectConfig{}
+	require.NoError(t, loadFile(path, cfg))
+	assert.Subset(t, cfg.AllowHTTP, want, "no append may be lost")
+	assert.Len(t, cfg.AllowHTTP, len(want)+1)
+	assert.NoFileExists(t, path+".lock")
+}
+
 func TestMergeValidation(t *testing.T) {
 	t.Run("invalid allow-http entry fails merge", func(t *testing.T) {
 		cfg := &Config{
@@ -356,7 +555,7 @@ func TestMergeValidation(t *testing.T) {
 				AllowHTTP: []string{"github.com:443", "bad:entry:here"},
 			},
 		}
-		_, err := cfg.Merge(nil, nil)
+		_, err := cfg.Merge(nil, nil, nil)
 		assert.Error(t, err)
 	})
 	t.Run("invalid allow-dns entry fails merge", func(t *testing.T) {
@@ -365,12 +564,12 @@ func TestMergeValidation(t *testing.T) {
 				AllowDNS: []string{"github.com:443"},
 			},
 		}
-		_, err := cfg.Merge(nil, nil)
+		_, err := cfg.Merge(nil, nil, nil)
 		assert.Error(t, err)
 	})
 	t.Run("invalid CLI allow entry fails merge", func(t *testing.T) {
 		cfg := &Config{}
-		_, err := cfg.Merge([]string{"a*.example.com:443"}, nil)
+		_, err := cfg.Merge([]string{"a*.example.com:443"}, nil, nil)
 		assert.Error(t, err)
 	})
 	t.Run("valid entries succeed", func(t *testing.T) {
@@ -380,11 +579,455 @@ func TestMergeValidation(t *testing.T) {
 				AllowDNS:  []string{"example.com"},
 			},
 		}
-		_, err := cfg.Merge(nil, nil)
+		_, err := cfg.Merge(nil, nil, nil)
 		assert.NoError(t, err)
 	})
 }
 
+func TestEntryComments(t *testing.T) {
+	dir := t.TempDir()
+	globalFile := filepath.Join(dir, "config.yaml")
+	projectFile := filepath.Join(dir, "network.yaml")
+	require.NoError(t, os.WriteFile(globalFile, []byte(
+		"allow-dns:\n  - internal.example.com # corp resolver\n"+
+			"allow-http:\n  - github.com:443 # global reason\n"), 0o644))
+	require.NoError(t, os.WriteFile(projectFile, []byte(
+		"# header comment\nallow-http:\n  - weird-domain.io:443  # needed by tool X\n  - github.com:443 #project reason\n  - plain.example.com:443\n"+
+			"custom-presets:\n  corp:\n    - git.corp.example # source mirror\n"), 0o644))
+
+	cfg, err := Load(globalFile, projectFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"internal.example.com": "corp resolver",
+		"weird-domain.io:443":  "needed by tool X",
+		"github.com:443":       "project reason",
+		"git.corp.example:443": "source mirror",
+	}, cfg.EntryComments)
+
+	merged, err := cfg.Merge(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, merged.AllowHTTP, "weird-domain.io:443", "comment must not be part of the entry")
+	assert.Equal(t, "needed by tool X", merged.EntryComments["weird-domain.io:443"])
+	assert.NotContains(t, merged.EntryComments, "plain.example.com:443")
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{Presets: []string{"default"}, AllowHTTP: []string{"github.com:443"}}}
+		assert.NoError(t, cfg.Validate())
+	})
+	t.Run("unknown preset", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{Presets: []string{"no-such-preset"}}}
+		assert.ErrorContains(t, cfg.Validate(), "no-such-preset")
+	})
+	t.Run("invalid allow entry", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{AllowHTTP: []string{"github.com:44a"}}}
+		assert.Error(t, cfg.Validate())
+	})
+	t.Run("allow-host-ports out of range", func(t *testing.T) {
+		for _, port := range []int{0, -1, 65536} {
+			cfg := &Config{Project: ProjectConfig{AllowHostPorts: []int{5432, port}}}
+			assert.ErrorContains(t, cfg.Validate(), "allow-host-ports", "port %d", port)
+		}
+	})
+	t.Run("negative max-request-bytes", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{MaxRequestBytes: -1}}
+		assert.ErrorContains(t, cfg.Validate(), "max-request-bytes")
+	})
+	t.Run("negative dns-cache-size", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{DNSCacheSize: -1}}
+		assert.ErrorContains(t, cfg.Validate(), "dns-cache-size")
+	})
+	t.Run("invalid env name", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{Env: map[string]string{"EDITOR": "vim", "MY=VAR": "x"}}}
+		assert.ErrorContains(t, cfg.Validate(), `env: invalid variable name "MY=VAR"`)
+	})
+	t.Run("negative max-sessions", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{MaxSessions: -1}}
+		assert.ErrorContains(t, cfg.Validate(), "max-sessions")
+	})
+}
+
+func TestMergeNormalizesHTTPShorthands(t *testing.T) {
+	cfg := &Config{
+		Global:  GlobalConfig{AllowHTTP: []string{"https://api.example.com"}},
+		Project: ProjectConfig{AllowHTTP: []string{"github.com", "http://mirror.example.com", "github.com:443"}},
+	}
+	merged, err := cfg.Merge([]string{"http://localhost.example.com:8080"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"api.example.com:443",
+		"github.com:443",
+		"mirror.example.com:80",
+		"localhost.example.com:8080",
+	}, merged.AllowHTTP)
+
+	_, err = cfg.Merge([]string{"ftp://example.com"}, nil, nil)
+	assert.ErrorContains(t, err, "unsupported scheme")
+}
+
+func TestMergeAllowCIDR(t *testing.T) {
+	t.Run("merges global and project ranges", func(t *testing.T) {
+		cfg := &Config{
+			Global:  GlobalConfig{AllowCIDR: []string{"10.1.0.0/16"}},
+			Project: ProjectConfig{AllowCIDR: []string{"192.168.50.0/24", "10.1.0.0/16"}},
+		}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.1.0.0/16", "192.168.50.0/24"}, merged.AllowCIDR)
+	})
+
+	t.Run("rejects invalid ranges", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{AllowCIDR: []string{"10.1.0.0"}}}
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, `allow-cidr: invalid range "10.1.0.0"`)
+	})
+
+	t.Run("rejects project ranges overlapping loopback or link-local", func(t *testing.T) {
+		for _, cidr := range []string{"127.0.0.1/32", "0.0.0.0/0", "169.254.169.254/32", "::/0", "fe80::1/128", "::1/128"} {
+			cfg := &Config{Project: ProjectConfig{AllowCIDR: []string{cidr}}}
+			_, err := cfg.Merge(nil, nil, nil)
+			assert.ErrorContains(t, err, fmt.Sprintf("allow-cidr: project range %q overlaps", cidr))
+		}
+	})
+
+	t.Run("global ranges may overlap loopback", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{AllowCIDR: []string{"169.254.169.254/32"}}}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"169.254.169.254/32"}, merged.AllowCIDR)
+	})
+}
+
+func TestMergeVirtualHosts(t *testing.T) {
+	t.Run("collects .vibepit extra-hosts", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{ExtraHosts: []string{
+			"llm-server:192.168.1.2",
+			"DB.vibepit:172.18.0.5",
+			"cache.vibepit:host-gateway",
+		}}}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"db.vibepit":    "172.18.0.5",
+			"cache.vibepit": "host-gateway",
+		}, merged.VirtualHosts)
+		assert.Len(t, merged.ExtraHosts, 3, "all entries still go to the proxy container")
+	})
+
+	t.Run("none configured", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{ExtraHosts: []string{"llm-server:192.168.1.2"}}}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Nil(t, merged.VirtualHosts)
+	})
+
+	t.Run("host.vibepit is reserved", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{ExtraHosts: []string{"host.vibepit:10.0.0.1"}}}
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, "reserved")
+	})
+
+	t.Run("rejects entries without address", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{ExtraHosts: []string{"db.vibepit"}}}
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, "extra-hosts")
+	})
+}
+
+func TestMergeDNSImpliesHTTP(t *testing.T) {
+	t.Run("off by default", func(t *testing.T) {
+		cfg := &Config{
+			Project: ProjectConfig{AllowDNS: []string{"internal.example.com"}},
+		}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, merged.AllowHTTP)
+		assert.Equal(t, []string{"internal.example.com"}, merged.AllowDNS)
+	})
+
+	t.Run("adds allow-dns entries to allow-http on port 443", func(t *testing.T) {
+		cfg := &Config{
+			Global: GlobalConfig{AllowDNS: []string{"*.corp.example.com"}},
+			Project: ProjectConfig{
+				AllowHTTP:      []string{"internal.example.com:443"},
+				AllowDNS:       []string{"internal.example.com"},
+				DNSImpliesHTTP: true,
+			},
+		}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"internal.example.com:443", "*.corp.example.com:443"}, merged.AllowHTTP)
+		assert.Equal(t, []string{"*.corp.example.com", "internal.example.com"}, merged.AllowDNS)
+	})
+
+	t.Run("loads from project config", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("dns-implies-http: true\n"), 0o644))
+
+		cfg := &ProjectConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.True(t, cfg.DNSImpliesHTTP)
+	})
+}
+
+func TestMergeEntrySources(t *testing.T) {
+	cfg := &Config{
+		Global: GlobalConfig{
+			AllowHTTP: []string{"github.com:443"},
+			AllowDNS:  []string{"corp.example.com"},
+		},
+		Project: ProjectConfig{
+			AllowHTTP:      []string{"github.com:443", "api.example.com:443"},
+			AllowDNS:       []string{"db.example.com"},
+			Presets:        []string{"pkg-go"},
+			DNSImpliesHTTP: true,
+			Profiles: map[string]Profile{
+				"staging": {AllowHTTP: []string{"staging.example.com:443"}},
+			},
+		},
+	}
+
+	merged, err := cfg.Merge([]string{"cli.example.com:443"}, nil, []string{"staging"})
+	require.NoError(t, err)
+	for entry, source := range map[string]string{
+		"github.com:443":          "global",
+		"api.example.com:443":     "project",
+		"cli.example.com:443":     "cli",
+		"staging.example.com:443": "profile:staging",
+		"sum.golang.org:443":      "preset:pkg-go",
+		"corp.example.com":        "global",
+		"db.example.com":          "project",
+		"corp.example.com:443":    "dns-implies-http",
+	} {
+		assert.Equal(t, source, merged.EntrySources[entry], "source of %s", entry)
+	}
+	for _, e := range slices.Concat(merged.AllowHTTP, merged.AllowDNS) {
+		assert.NotEmpty(t, merged.EntrySources[e], "entry %s has no source", e)
+	}
+}
+
+func TestMergeDenyLists(t *testing.T) {
+	cfg := &Config{
+		Global: GlobalConfig{
+			AllowHTTP: []string{"pastebin.com:443"},
+			DenyHTTP:  []string{"pastebin.com:*", "*.paste.example"},
+			DenyDNS:   []string{".pastebin.com"},
+		},
+		Project: ProjectConfig{
+			AllowHTTP:      []string{"a.paste.example:443", "*.paste.example:443", "github.com:443"},
+			AllowDNS:       []string{"pastebin.com", "db.example.com"},
+			DNSImpliesHTTP: true,
+		},
+	}
+
+	t.Run("drops covered allow entries from every layer", func(t *testing.T) {
+		merged, err := cfg.Merge([]string{"pastebin.com:8443"}, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pastebin.com:*", "*.paste.example:*"}, merged.DenyHTTP, "deny-http without a port denies every port")
+		assert.Equal(t, []string{".pastebin.com"}, merged.DenyDNS)
+		assert.Equal(t, []string{"github.com:443", "db.example.com:443"}, merged.AllowHTTP)
+		assert.Equal(t, []string{"db.example.com"}, merged.AllowDNS)
+		assert.ElementsMatch(t, []string{
+			"pastebin.com:443", "a.paste.example:443", "*.paste.example:443", "pastebin.com:8443",
+			"pastebin.com",
+		}, merged.Denied)
+		assert.NotContains(t, merged.EntrySources, "pastebin.com:443")
+	})
+
+	t.Run("project deny subtracts preset entries", func(t *testing.T) {
+		cfg := &Config{
+			Global: GlobalConfig{DenyHTTP: []string{"pastebin.com:*"}},
+			Project: ProjectConfig{
+				Presets:  []string{"pkg-go"},
+				DenyHTTP: []string{"https://sum.golang.org", "pastebin.com:*"},
+				DenyDNS:  []string{"*.corp.example"},
+				AllowDNS: []string{"git.corp.example"},
+			},
+		}
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Contains(t, merged.AllowHTTP, "proxy.golang.org:443")
+		assert.NotContains(t, merged.AllowHTTP, "sum.golang.org:443")
+		assert.Empty(t, merged.AllowDNS)
+		assert.Equal(t, []string{"pastebin.com:*", "sum.golang.org:443"}, merged.DenyHTTP, "global and project deny lists are merged")
+		assert.Equal(t, []string{"*.corp.example"}, merged.DenyDNS)
+	})
+
+	t.Run("rejects invalid deny entries", func(t *testing.T) {
+		bad := &Config{Global: GlobalConfig{DenyDNS: []string{"pastebin.com:443"}}}
+		_, err := bad.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, "deny-dns:")
+	})
+}
+
+func TestCustomPresets(t *testing.T) {
+	t.Run("load and expand", func(t *testing.T) {
+		dir := t.TempDir()
+		projectFile := filepath.Join(dir, "network.yaml")
+		require.NoError(t, os.WriteFile(projectFile, []byte(`presets:
+  - corp
+  - pkg-go
+custom-presets:
+  corp:
+    - git.corp.example
+    - http://artifacts.corp.example
+`), 0o600))
+
+		cfg, err := Load(filepath.Join(dir, "missing.yaml"), projectFile)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Validate())
+
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Contains(t, merged.AllowHTTP, "git.corp.example:443")
+		assert.Contains(t, merged.AllowHTTP, "artifacts.corp.example:80")
+		assert.Contains(t, merged.AllowHTTP, "proxy.golang.org:443")
+		assert.Equal(t, "preset:corp", merged.EntrySources["git.corp.example:443"])
+	})
+
+	t.Run("cli presets can name custom presets", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{CustomPresets: map[string][]string{"corp": {"git.corp.example:443"}}}}
+		merged, err := cfg.Merge(nil, []string{"corp"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"git.corp.example:443"}, merged.AllowHTTP)
+	})
+
+	t.Run("rejects built-in names", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{CustomPresets: map[string][]string{"pkg-go": {"goproxy.corp.example:443"}}}}
+		assert.ErrorContains(t, cfg.Validate(), `custom-presets: "pkg-go" is the name of a built-in preset`)
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects invalid entries", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{CustomPresets: map[string][]string{"corp": {"git.corp.example:44a"}}}}
+		assert.ErrorContains(t, cfg.Validate(), "custom-presets: corp:")
+	})
+
+	t.Run("reconfigure keeps custom presets", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "network.yaml")
+		custom := map[string][]string{
+			"corp":  {"git.corp.example:443", "*.corp.example:443"},
+			"extra": {"extra.example:443"},
+		}
+		require.NoError(t, os.WriteFile(path, []byte(`presets: [pkg-go]
+custom-presets:
+  corp: [git.corp.example:443, "*.corp.example:443"]
+  extra: [extra.example:443]
+`), 0o600))
+		require.NoError(t, setProjectConfigPresets(path, []string{"corp"}))
+
+		var cfg ProjectConfig
+		require.NoError(t, loadFile(path, &cfg))
+		assert.Equal(t, []string{"corp"}, cfg.Presets)
+		assert.Equal(t, custom, cfg.CustomPresets)
+	})
+}
+
+func TestSetProjectConfigPresets(t *testing.T) {
+	t.Run("keeps every other key and comments", func(t *testing.T) {
+		data := `# Team network config.
+presets:
+  - pkg-go # Go modules
+allow-http:
+  - api.example.com:443
+allow-dns:
+  - internal.example.com
+allow-host-ports: [8080]
+dns-implies-http: true
+allow-cidr:
+  - 10.20.0.0/16
+custom-presets:
+  corp:
+    - git.corp.example:443
+dns-cache-size: 500
+deny-http:
+  - tracking.example.com:443
+deny-dns:
+  - ads.example.com
+setup-commands:
+  - make deps
+setup-ignore-errors: true
+resources:
+  memory-mb: 2048
+  cpus: 2
+env:
+  FOO: bar
+profiles:
+  ci:
+    allow-http:
+      - ci.example.com:443
+    allow-dns:
+      - ci-dns.example.com
+# Kept for older vibepit versions.
+allow:
+  - legacy.example.com:443
+`
+		// Every ProjectConfig key must be in the fixture, so new keys are
+		// covered as well.
+		typ := reflect.TypeFor[ProjectConfig]()
+		for i := range typ.NumField() {
+			key := typ.Field(i).Tag.Get("koanf")
+			assert.Contains(t, data, "\n"+key+":", "fixture misses %s", key)
+		}
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "network.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		before, err := Load("/nonexistent/config.yaml", path)
+		require.NoError(t, err)
+
+		require.NoError(t, setProjectConfigPresets(path, []string{"pkg-node", "corp"}))
+
+		after, err := Load("/nonexistent/config.yaml", path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pkg-node", "corp"}, after.Project.Presets)
+		after.Project.Presets = before.Project.Presets
+		assert.Equal(t, before.Project, after.Project)
+		assert.Equal(t, []string{path}, after.LegacyAllowFiles)
+
+		out, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(out), "# Team network config.")
+		assert.Contains(t, string(out), "# Kept for older vibepit versions.")
+	})
+
+	t.Run("replaces the template placeholder", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "network.yaml")
+		require.NoError(t, CreateProjectConfig(path))
+		require.NoError(t, setProjectConfigPresets(path, []string{"pkg-go"}))
+
+		var cfg ProjectConfig
+		require.NoError(t, loadFile(path, &cfg))
+		assert.Equal(t, []string{"pkg-go"}, cfg.Presets)
+		out, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(out), "# allow-http:")
+	})
+
+	t.Run("clears presets", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "network.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("presets:\n  - pkg-go\nallow-http:\n  - a.example.com:443\n"), 0o600))
+		require.NoError(t, setProjectConfigPresets(path, nil))
+
+		var cfg ProjectConfig
+		require.NoError(t, loadFile(path, &cfg))
+		assert.Empty(t, cfg.Presets)
+		assert.Equal(t, []string{"a.example.com:443"}, cfg.AllowHTTP)
+	})
+
+	t.Run("writes the template for a missing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sub", "network.yaml")
+		require.NoError(t, setProjectConfigPresets(path, []string{"pkg-go"}))
+
+		var cfg ProjectConfig
+		require.NoError(t, loadFile(path, &cfg))
+		assert.Equal(t, []string{"pkg-go"}, cfg.Presets)
+	})
+}
+
 func TestUnmarshalUpstreamDNS(t *testing.T) {
 	t.Run("unmarshal upstream-dns string", func(t *testing.T) {
 		dir := t.TempDir()
@@ -397,7 +1040,7 @@ upstream-dns: 8.8.8.8:53
 
 		cfg, err := Load(globalFile, "/nonexistent/project.yaml")
 		require.NoError(t, err)
-		assert.Equal(t, "8.8.8.8:53", cfg.Global.UpstreamDNS)
+		assert.Equal(t, []string{"8.8.8.8:53"}, cfg.Global.UpstreamDNS)
 	})
 
 	t.Run("unmarshal upstream-dns with port only", func(t *testing.T) {
@@ -407,10 +1050,10 @@ upstream-dns: 8.8.8.8:53
 
 		cfg := &GlobalConfig{}
 		require.NoError(t, loadFile(path, cfg))
-		assert.Equal(t, "1.1.1.1:5353", cfg.UpstreamDNS)
+		assert.Equal(t, []string{"1.1.1.1:5353"}, cfg.UpstreamDNS)
 	})
 
-	t.Run("missing upstream-dns is empty string", func(t *testing.T) {
+	t.Run("missing upstream-dns is empty", func(t *testing.T) {
 		dir := t.TempDir()
 		path := filepath.Join(dir, "config.yaml")
 		os.WriteFile(path, []byte(`allow-dns:
@@ -433,9 +1076,55 @@ allow-dns:
 		cfg, err := Load(globalFile, "/nonexistent/project.yaml")
 		require.NoError(t, err)
 
-		merged, err := cfg.Merge(nil, nil)
+		merged, err := cfg.Merge(nil, nil, nil)
 		require.NoError(t, err)
-		assert.Equal(t, "9.9.9.9:53", merged.UpstreamDNS)
+		assert.Equal(t, []string{"9.9.9.9:53"}, merged.UpstreamDNS)
+	})
+
+	t.Run("unmarshal upstream-dns list", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(`upstream-dns:
+  - 9.9.9.9:53
+  - 1.1.1.1:53`), 0o644)
+
+		cfg := &GlobalConfig{}
+		require.NoError(t, loadFile(path, cfg))
+		assert.Equal(t, []string{"9.9.9.9:53", "1.1.1.1:53"}, cfg.UpstreamDNS)
+	})
+
+	t.Run("merge rejects upstream without port", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{UpstreamDNS: []string{"9.9.9.9:53", "1.1.1.1"}}}
+
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, `upstream-dns: "1.1.1.1" must be host:port`)
+	})
+
+	t.Run("merge passes upstream-doh through", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{UpstreamDoH: []string{"https://1.1.1.1/dns-query"}}}
+
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://1.1.1.1/dns-query"}, merged.UpstreamDoH)
+		assert.Empty(t, merged.UpstreamDNS)
+	})
+
+	t.Run("merge rejects upstream-doh without IP host", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{UpstreamDoH: []string{"https://dns.example.com/dns-query"}}}
+
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, "upstream-doh:")
+		assert.ErrorContains(t, err, "must use an IP address as host")
+	})
+
+	t.Run("merge rejects upstream-dns with upstream-doh", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{
+			UpstreamDNS: []string{"9.9.9.9:53"},
+			UpstreamDoH: []string{"https://1.1.1.1/dns-query"},
+		}}
+
+		_, err := cfg.Merge(nil, nil, nil)
+		assert.ErrorContains(t, err, "can't be used together")
 	})
 }
 
@@ -446,22 +1135,34 @@ allow-dns:
 // This test sets every field that is meant to cross the boundary to a sentinel
 // and asserts it survives.
 //
-// Two fields intentionally do NOT cross and are excluded by design:
+// Three fields intentionally do NOT cross and are excluded by design:
 //   - MergedConfig.ExtraHosts: applied via the container config, not proxy JSON.
+//   - MergedConfig.ConfigHash: computed by the proxy, only read back from it.
 //   - ProxyConfig.DNSPort: proxy-only, defaulted internally.
 func TestMergedConfigRoundTripsToProxyConfig(t *testing.T) {
 	merged := MergedConfig{
-		AllowHTTP:      []string{"github.com:443"},
-		AllowDNS:       []string{"example.com"},
-		BlockCIDR:      []string{"10.0.0.0/8"},
-		AllowCIDR:      []string{"192.168.0.0/16"},
-		UpstreamDNS:    "10.0.0.53:53",
-		AllowHostPorts: []int{8080},
-		ProxyIP:        "172.20.0.2",
-		HostGateway:    "host-gateway",
-		ProxyPort:      54321,
-		ControlAPIPort: 54322,
-		SSHForwardAddr: "172.20.0.3:2222",
+		AllowHTTP:        []string{"github.com:443"},
+		AllowDNS:         []string{"example.com"},
+		BlockCIDR:        []string{"10.0.0.0/8"},
+		AllowCIDR:        []string{"192.168.0.0/16"},
+		UpstreamDNS:      []string{"10.0.0.53:53", "10.0.0.54:53"},
+		AllowHostPorts:   []int{8080},
+		ProxyIP:          "172.20.0.2",
+		HostGateway:      "host-gateway",
+		ProxyPort:        54321,
+		ControlAPIPort:   54322,
+		SSHForwardAddr:   "172.20.0.3:2222",
+		ControlAPISocket: "/run/vibepit/control.sock",
+		DenyHTTP:         []string{"pastebin.com:*"},
+		DenyDNS:          []string{"pastebin.com"},
+		UpstreamDoH:      []string{"https://1.1.1.1/dns-query"},
+		VirtualHosts:     map[string]string{"db.vibepit": "172.18.0.5"},
+		MaxRequestBytes:  1 << 20,
+		DNSCacheSize:     4096,
+		EntryComments:    map[string]string{"github.com:443": "code hosting"},
+		EntrySources:     map[string]string{"github.com:443": "project"},
+
+		AllowPrivateNetwork: true,
 	}
 
 	data, err := json.Marshal(merged)
@@ -482,4 +1183,493 @@ func TestMergedConfigRoundTripsToProxyConfig(t *testing.T) {
 	assert.Equal(t, merged.ProxyPort, pc.ProxyPort, "proxy-port")
 	assert.Equal(t, merged.ControlAPIPort, pc.ControlAPIPort, "control-api-port")
 	assert.Equal(t, merged.SSHForwardAddr, pc.SSHForwardAddr, "ssh-forward-addr")
+	assert.Equal(t, merged.ControlAPISocket, pc.ControlAPISocket, "control-api-socket")
+	assert.Equal(t, merged.DenyHTTP, pc.DenyHTTP, "deny-http")
+	assert.Equal(t, merged.DenyDNS, pc.DenyDNS, "deny-dns")
+	assert.Equal(t, merged.UpstreamDoH, pc.UpstreamDoH, "upstream-doh")
+	assert.Equal(t, merged.VirtualHosts, pc.VirtualHosts, "virtual-hosts")
+	assert.Equal(t, merged.MaxRequestBytes, pc.MaxRequestBytes, "max-request-bytes")
+	assert.Equal(t, merged.DNSCacheSize, pc.DNSCacheSize, "dns-cache-size")
+	assert.Equal(t, merged.EntryComments, pc.EntryComments, "entry-comments")
+	assert.Equal(t, merged.EntrySources, pc.EntrySources, "entry-sources")
+	assert.Equal(t, merged.AllowPrivateNetwork, pc.AllowPrivateNetwork, "allow-private-network")
+	assert.Equal(t, pc.PolicyHash(), merged.PolicyHash(), "policy hash")
+}
+
+func TestFindProjectRoot(t *testing.T) {
+	runGit := func(t *testing.T, dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null",
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, out)
+	}
+
+	// newRepoWithWorktree creates a main checkout with one commit and a
+	// linked worktree next to it. Paths are symlink-resolved so they compare
+	// equal to what git prints (macOS temp dirs live behind /var -> /private/var).
+	newRepoWithWorktree := func(t *testing.T) (string, string) {
+		t.Helper()
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git not available")
+		}
+		base, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		main := filepath.Join(base, "main")
+		worktree := filepath.Join(base, "feature")
+		require.NoError(t, os.MkdirAll(filepath.Join(main, "sub"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(main, "sub", "go.mod"), []byte("module example\n"), 0o644))
+		runGit(t, main, "init", "-q")
+		runGit(t, main, "add", ".")
+		runGit(t, main, "commit", "-q", "-m", "init")
+		runGit(t, main, "worktree", "add", "-q", worktree)
+		return main, worktree
+	}
+
+	t.Run("returns the linked worktree root, not the main checkout", func(t *testing.T) {
+		main, worktree := newRepoWithWorktree(t)
+
+		root, err := FindProjectRoot(filepath.Join(worktree, "sub"))
+		require.NoError(t, err)
+		assert.Equal(t, worktree, root)
+
+		root, err = FindProjectRoot(filepath.Join(main, "sub"))
+		require.NoError(t, err)
+		assert.Equal(t, main, root)
+	})
+
+	t.Run("falls back to the .git file when git is unavailable", func(t *testing.T) {
+		_, worktree := newRepoWithWorktree(t)
+		t.Setenv("PATH", "")
+
+		root, err := FindProjectRoot(filepath.Join(worktree, "sub"))
+		require.NoError(t, err)
+		assert.Equal(t, worktree, root)
+	})
+
+	t.Run("ignores a .git file without a gitdir pointer", func(t *testing.T) {
+		dir := t.TempDir()
+		sub := filepath.Join(dir, "sub")
+		require.NoError(t, os.MkdirAll(sub, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".git"), []byte("garbage\n"), 0o644))
+		t.Setenv("PATH", "")
+
+		root, err := FindProjectRoot(sub)
+		require.NoError(t, err)
+		assert.Equal(t, sub, root)
+	})
+}
+
+func TestPortConflictNotes(t *testing.T) {
+	t.Run("same domain on different ports", func(t *testing.T) {
+		notes := portConflictNotes([]presetEntries{
+			{name: "pkg-go", entries: []string{"proxy.golang.org:443", "sum.golang.org:443"}},
+			{name: "custom", entries: []string{"proxy.golang.org:80"}},
+		})
+		assert.Equal(t, []string{
+			"proxy.golang.org is allowed on port 443 (pkg-go) and port 80 (custom)",
+		}, notes)
+	})
+
+	t.Run("same port from several presets is no conflict", func(t *testing.T) {
+		notes := portConflictNotes([]presetEntries{
+			{name: "default", entries: []string{"proxy.golang.org:443"}},
+			{name: "pkg-go", entries: []string{"proxy.golang.org:443"}},
+		})
+		assert.Empty(t, notes)
+	})
+
+	t.Run("lists all presets per port", func(t *testing.T) {
+		notes := portConflictNotes([]presetEntries{
+			{name: "a", entries: []string{"example.com:443"}},
+			{name: "b", entries: []string{"example.com:443", "example.com:80"}},
+			{name: "c", entries: []string{"example.com:*"}},
+		})
+		assert.Equal(t, []string{
+			"example.com is allowed on port 443 (a, b), port 80 (b) and port * (c)",
+		}, notes)
+	})
+}
+
+func TestPresetPortNotes(t *testing.T) {
+	var names []string
+	for _, p := range proxy.NewPresetRegistry().All() {
+		names = append(names, p.Name)
+	}
+	cfg := &Config{Project: ProjectConfig{Presets: names[:1]}}
+	assert.Empty(t, cfg.PresetPortNotes(names[1:]),
+		"built-in presets should not allow a domain on different ports")
+}
+
+func TestLoadLegacyAllowSection(t *testing.T) {
+	dir := t.TempDir()
+	globalFile := filepath.Join(dir, "config.yaml")
+	projectFile := filepath.Join(dir, "network.yaml")
+	require.NoError(t, os.WriteFile(globalFile, []byte("allow-http:\n  - github.com:443\n"), 0o644))
+	require.NoError(t, os.WriteFile(projectFile, []byte(`
+allow:
+  - api.example.com:443
+  - registry.example.com
+allow-http:
+  - api.anthropic.com:443
+  - api.example.com:443
+`), 0o644))
+
+	cfg, err := Load(globalFile, projectFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{projectFile}, cfg.LegacyAllowFiles)
+	assert.Equal(t, []string{"api.anthropic.com:443", "api.example.com:443", "registry.example.com"}, cfg.Project.AllowHTTP)
+
+	merged, err := cfg.Merge(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, merged.AllowHTTP, "registry.example.com:443")
+	assert.Contains(t, merged.AllowHTTP, "github.com:443")
+
+	t.Run("appending does not touch the legacy section", func(t *testing.T) {
+		require.NoError(t, AppendAllowHTTP(projectFile, []string{"new.example.com:443"}))
+		data, err := os.ReadFile(projectFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "allow:\n  - api.example.com:443\n  - registry.example.com\n")
+
+		cfg, err := Load(globalFile, projectFile)
+		require.NoError(t, err)
+		assert.Contains(t, cfg.Project.AllowHTTP, "new.example.com:443")
+		assert.Contains(t, cfg.Project.AllowHTTP, "registry.example.com")
+	})
+}
+
+func TestCertLifetime(t *testing.T) {
+	t.Run("defaults to 30 days", func(t *testing.T) {
+		lifetime, err := (&Config{}).CertLifetime(0)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultCertLifetime, lifetime)
+	})
+
+	t.Run("reads the global config", func(t *testing.T) {
+		globalFile := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(globalFile, []byte("cert-lifetime: 24h\n"), 0o644))
+		cfg, err := Load(globalFile, filepath.Join(t.TempDir(), "missing.yaml"))
+		require.NoError(t, err)
+
+		lifetime, err := cfg.CertLifetime(0)
+		require.NoError(t, err)
+		assert.Equal(t, 24*time.Hour, lifetime)
+	})
+
+	t.Run("override wins", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{CertLifetime: 24 * time.Hour}}
+		lifetime, err := cfg.CertLifetime(2 * time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Hour, lifetime)
+	})
+
+	t.Run("rejects negative", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{CertLifetime: -time.Hour}}
+		_, err := cfg.CertLifetime(0)
+		assert.ErrorContains(t, err, "must be positive")
+		assert.ErrorContains(t, cfg.Validate(), "cert-lifetime")
+	})
+
+	t.Run("rejects more than a year", func(t *testing.T) {
+		_, err := (&Config{}).CertLifetime(MaxCertLifetime + time.Hour)
+		assert.ErrorContains(t, err, "must not exceed")
+	})
+}
+
+func TestCertKeyType(t *testing.T) {
+	t.Run("defaults to ed25519", func(t *testing.T) {
+		kt, err := (&Config{}).CertKeyType("")
+		require.NoError(t, err)
+		assert.Equal(t, proxy.KeyTypeEd25519, kt)
+	})
+
+	t.Run("reads the global config", func(t *testing.T) {
+		globalFile := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(globalFile, []byte("cert-key-type: ecdsa-p256\n"), 0o644))
+		cfg, err := Load(globalFile, filepath.Join(t.TempDir(), "missing.yaml"))
+		require.NoError(t, err)
+
+		kt, err := cfg.CertKeyType("")
+		require.NoError(t, err)
+		assert.Equal(t, proxy.KeyTypeECDSAP256, kt)
+	})
+
+	t.Run("override wins", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{CertKeyType: "ecdsa-p256"}}
+		kt, err := cfg.CertKeyType("ed25519")
+		require.NoError(t, err)
+		assert.Equal(t, proxy.KeyTypeEd25519, kt)
+	})
+
+	t.Run("rejects unknown types", func(t *testing.T) {
+		cfg := &Config{Global: GlobalConfig{CertKeyType: "rsa"}}
+		_, err := cfg.CertKeyType("")
+		assert.ErrorContains(t, err, `unsupported key type "rsa"`)
+		assert.ErrorContains(t, cfg.Validate(), "cert-key-type")
+	})
+}
+
+func TestSandboxResources(t *testing.T) {
+	t.Run("unlimited by default", func(t *testing.T) {
+		r, err := (&Config{}).SandboxResources(0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, Resources{}, r)
+	})
+
+	t.Run("loads the project config", func(t *testing.T) {
+		dir := t.TempDir()
+		projectFile := filepath.Join(dir, "network.yaml")
+		require.NoError(t, os.WriteFile(projectFile, []byte("resources:\n  memory-mb: 4096\n  cpus: 1.5\n"), 0o600))
+		cfg, err := Load(filepath.Join(dir, "missing.yaml"), projectFile)
+		require.NoError(t, err)
+
+		r, err := cfg.SandboxResources(0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, Resources{MemoryMB: 4096, CPUs: 1.5}, r)
+	})
+
+	t.Run("overrides win", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{Resources: Resources{MemoryMB: 4096, CPUs: 2}}}
+		r, err := cfg.SandboxResources(1024, 0)
+		require.NoError(t, err)
+		assert.Equal(t, Resources{MemoryMB: 1024, CPUs: 2}, r)
+	})
+
+	t.Run("rejects negative limits", func(t *testing.T) {
+		_, err := (&Config{}).SandboxResources(-1, 0)
+		assert.ErrorContains(t, err, "memory-mb must not be negative")
+
+		cfg := &Config{Project: ProjectConfig{Resources: Resources{CPUs: -1}}}
+		assert.ErrorContains(t, cfg.Validate(), "cpus must not be negative")
+	})
+}
+
+func TestSetupCommands(t *testing.T) {
+	t.Run("reads the project config", func(t *testing.T) {
+		projectFile := filepath.Join(t.TempDir(), "network.yaml")
+		content := "setup-commands:\n  - npm ci\n  - |\n    go mod download\n    go build ./...\nsetup-ignore-errors: true\n"
+		require.NoError(t, os.WriteFile(projectFile, []byte(content), 0o644))
+		cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), projectFile)
+		require.NoError(t, err)
+
+		commands, err := cfg.SetupCommands()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"npm ci", "go mod download\ngo build ./...\n"}, commands)
+		assert.True(t, cfg.Project.SetupIgnoreErrors)
+	})
+
+	t.Run("rejects empty commands", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{SetupCommands: []string{"npm ci", "  "}}}
+		_, err := cfg.SetupCommands()
+		assert.ErrorContains(t, err, "command 2 is empty")
+		assert.ErrorContains(t, cfg.Validate(), "setup-commands")
+	})
+
+	t.Run("rejects NUL bytes", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{SetupCommands: []string{"npm ci\x00"}}}
+		_, err := cfg.SetupCommands()
+		assert.ErrorContains(t, err, "NUL")
+	})
+}
+
+func TestCACerts(t *testing.T) {
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: time.Hour})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return path
+	}
+
+	t.Run("bundles the certificates of all files", func(t *testing.T) {
+		ca := write("ca.pem", append([]byte("# corporate root\n"), creds.CACertPEM()...))
+		server := write("server.pem", creds.ServerCertPEM())
+		cfg := &Config{Global: GlobalConfig{CACerts: []string{ca, server}}}
+
+		bundle, err := cfg.CACerts()
+		require.NoError(t, err)
+		assert.Equal(t, string(creds.CACertPEM())+string(creds.ServerCertPEM()), string(bundle))
+	})
+
+	t.Run("expands the home directory", func(t *testing.T) {
+		t.Setenv("HOME", dir)
+		write("home.pem", creds.CACertPEM())
+		cfg := &Config{Global: GlobalConfig{CACerts: []string{"~/home.pem"}}}
+
+		bundle, err := cfg.CACerts()
+		require.NoError(t, err)
+		assert.Equal(t, creds.CACertPEM(), bundle)
+	})
+
+	t.Run("no ca-certs is an empty bundle", func(t *testing.T) {
+		bundle, err := (&Config{}).CACerts()
+		require.NoError(t, err)
+		assert.Empty(t, bundle)
+	})
+
+	t.Run("rejects invalid files", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			path string
+			want string
+		}{
+			"relative path": {"certs/ca.pem", "path must be absolute"},
+			"missing file":  {filepath.Join(dir, "missing.pem"), "no such file"},
+			"not PEM":       {write("text.pem", []byte("not a certificate")), "no PEM certificates found"},
+			"private key":   {write("key.pem", creds.ServerKeyPEM()), "only certificates are allowed"},
+			"bad DER":       {write("bad.pem", []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")), "x509"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				cfg := &Config{Global: GlobalConfig{CACerts: []string{tc.path}}}
+				_, err := cfg.CACerts()
+				assert.ErrorContains(t, err, "ca-certs: ")
+				assert.ErrorContains(t, err, tc.want)
+				assert.ErrorContains(t, cfg.Validate(), tc.want)
+			})
+		}
+	})
+}
+
+func TestProxyConfigStale(t *testing.T) {
+	disk := MergedConfig{
+		AllowHTTP: []string{"github.com:443"},
+		AllowDNS:  []string{"internal.example.com"},
+		BlockCIDR: []string{"10.0.0.0/8"},
+	}
+	live := func(m MergedConfig) MergedConfig {
+		m.ConfigHash = m.PolicyHash()
+		return m
+	}
+
+	t.Run("unchanged config", func(t *testing.T) {
+		assert.False(t, ProxyConfigStale(live(disk), disk))
+	})
+
+	t.Run("proxy without hash", func(t *testing.T) {
+		assert.False(t, ProxyConfigStale(MergedConfig{}, disk))
+	})
+
+	t.Run("extra live entries", func(t *testing.T) {
+		started := live(disk)
+		started.AllowHTTP = append(started.AllowHTTP, "runtime.example.com:443")
+		assert.False(t, ProxyConfigStale(started, disk))
+	})
+
+	t.Run("entry added on disk", func(t *testing.T) {
+		started := live(disk)
+		changed := disk
+		changed.AllowHTTP = []string{"github.com:443", "new.example.com:443"}
+		assert.True(t, ProxyConfigStale(started, changed))
+	})
+
+	t.Run("entry added on disk and at runtime", func(t *testing.T) {
+		started := live(disk)
+		started.AllowHTTP = []string{"github.com:443", "new.example.com:443"}
+		changed := disk
+		changed.AllowHTTP = []string{"github.com:443", "new.example.com:443"}
+		assert.False(t, ProxyConfigStale(started, changed))
+	})
+
+	t.Run("private network allowed with the flag", func(t *testing.T) {
+		started := disk
+		started.AllowPrivateNetwork = true
+		assert.False(t, ProxyConfigStale(live(started), disk))
+		assert.True(t, ProxyConfigStale(live(disk), started))
+	})
+
+	t.Run("other setting changed on disk", func(t *testing.T) {
+		started := live(disk)
+		changed := disk
+		changed.BlockCIDR = []string{"10.0.0.0/8", "192.168.0.0/16"}
+		assert.True(t, ProxyConfigStale(started, changed))
+	})
+
+	t.Run("entry removed on disk", func(t *testing.T) {
+		started := disk
+		started.AllowDNS = []string{"internal.example.com", "old.example.com"}
+		started = live(started)
+		started.EntrySources = map[string]string{"github.com:443": "global", "internal.example.com": "global", "old.example.com": "project"}
+		assert.True(t, ProxyConfigStale(started, disk))
+
+		started.EntrySources["old.example.com"] = "runtime"
+		assert.False(t, ProxyConfigStale(started, disk), "runtime entries are not in the files")
+		for _, source := range []string{"cli", "preset:corp", "profile:ci"} {
+			started.EntrySources["old.example.com"] = source
+			assert.False(t, ProxyConfigStale(started, disk), source)
+		}
+	})
+
+	t.Run("deny entry added on disk", func(t *testing.T) {
+		started := live(disk)
+		changed := disk
+		changed.DenyDNS = []string{"pastebin.com"}
+		assert.True(t, ProxyConfigStale(started, changed))
+		assert.False(t, ProxyConfigStale(live(changed), changed))
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	globalFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(globalFile, []byte(`
+profiles:
+  research:
+    allow-http:
+      - docs.example.com
+`), 0o644))
+	projectFile := filepath.Join(dir, "network.yaml")
+	require.NoError(t, os.WriteFile(projectFile, []byte(`
+allow-http:
+  - github.com:443
+profiles:
+  publish:
+    allow-http:
+      - upload.pypi.org:443
+    allow-dns:
+      - registry.internal.example.com
+  research:
+    allow-http:
+      - papers.example.org:443
+`), 0o644))
+
+	cfg, err := Load(globalFile, projectFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"publish", "research"}, cfg.ProfileNames())
+
+	t.Run("profiles are not applied unless selected", func(t *testing.T) {
+		merged, err := cfg.Merge(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com:443"}, merged.AllowHTTP)
+		assert.Empty(t, merged.AllowDNS)
+	})
+
+	t.Run("selected profiles are merged", func(t *testing.T) {
+		merged, err := cfg.Merge(nil, nil, []string{"publish"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com:443", "upload.pypi.org:443"}, merged.AllowHTTP)
+		assert.Equal(t, []string{"registry.internal.example.com"}, merged.AllowDNS)
+	})
+
+	t.Run("global and project profiles with the same name combine", func(t *testing.T) {
+		merged, err := cfg.Merge(nil, nil, []string{"research"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com:443", "docs.example.com:443", "papers.example.org:443"}, merged.AllowHTTP)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := cfg.Merge(nil, nil, []string{"deploy"})
+		assert.ErrorContains(t, err, `unknown profile "deploy"`)
+	})
+
+	t.Run("validate checks every profile", func(t *testing.T) {
+		cfg := &Config{Project: ProjectConfig{Profiles: map[string]Profile{
+			"broken": {AllowDNS: []string{"*"}},
+		}}}
+		assert.ErrorContains(t, cfg.Validate(), "allow-dns")
+	})
 }
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockConfigFile takes an exclusive lock for the config file at path, so
+// concurrent vibepit processes serialize their read-modify-write cycles. It
+// blocks until the lock is free and returns a function that releases it.
+//
+// The lock is a flock on the directory of the config file. It stays valid when
+// an editor replaces the file and leaves no lock file behind in the project.
+// The kernel drops the lock when the holding process exits, so a crashed
+// process never leaves it stuck.
+func lockConfigFile(path string) (func(), error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create config dir: %w", err)
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("lock config: %w", err)
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, fmt.Errorf("lock config: %w", err)
+	}
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil //nolint:errcheck
+}
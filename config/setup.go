@@ -2,11 +2,14 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/bernd/vibepit/proxy"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,7 +24,7 @@ func RunFirstTimeSetup(projectDir, projectConfigPath string) ([]string, error) {
 		preChecked[d] = true
 	}
 
-	selected, err := runPresetSelectorTUI(preChecked, detected)
+	selected, err := runPresetSelectorTUI(proxy.NewPresetRegistry(), preChecked, detected, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -29,13 +32,18 @@ func RunFirstTimeSetup(projectDir, projectConfigPath string) ([]string, error) {
 	return selected, writeProjectConfig(projectConfigPath, selected)
 }
 
-// RunReconfigure re-runs the interactive preset selector, preserving existing
-// allow-http and allow-dns entries from the project config.
+// RunReconfigure re-runs the interactive preset selector and replaces the
+// presets of the project config. Every other key and the comments are kept,
+// see setProjectConfigPresets.
 func RunReconfigure(projectConfigPath, projectDir string) ([]string, error) {
 	var cfg ProjectConfig
 	if err := loadFile(projectConfigPath, &cfg); err != nil {
 		return nil, fmt.Errorf("load project config: %w", err)
 	}
+	reg, err := newPresetRegistry(cfg.CustomPresets)
+	if err != nil {
+		return nil, err
+	}
 
 	detected := DetectPresets(projectDir)
 
@@ -44,22 +52,37 @@ func RunReconfigure(projectConfigPath, projectDir string) ([]string, error) {
 		preChecked[p] = true
 	}
 
-	selected, err := runPresetSelectorTUI(preChecked, detected)
+	comments := make(map[string]string)
+	if err := loadEntryComments(projectConfigPath, comments); err != nil {
+		return nil, fmt.Errorf("load project config: %w", err)
+	}
+
+	selected, err := runPresetSelectorTUI(reg, preChecked, detected, comments)
 	if err != nil {
 		return nil, err
 	}
+	return selected, setProjectConfigPresets(projectConfigPath, selected)
+}
 
-	return selected, writeReconfiguredProjectConfig(projectConfigPath, selected, cfg.AllowHTTP, cfg.AllowDNS)
+// CreateProjectConfig writes the commented project config template without
+// any presets selected.
+func CreateProjectConfig(path string) error {
+	return writeProjectConfig(path, nil)
 }
 
 func writeProjectConfig(path string, presets []string) error {
-	return writeReconfiguredProjectConfig(path, presets, nil, nil)
+	unlock, err := lockConfigFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeProjectConfigTemplate(path, presets)
 }
 
-// writeReconfiguredProjectConfig writes the config file with new presets while
-// preserving existing allow-http and allow-dns entries. When allowHTTP and allowDNS
-// are nil, commented-out placeholder sections are written instead.
-func writeReconfiguredProjectConfig(path string, presets []string, allowHTTP []string, allowDNS []string) error {
+// writeProjectConfigTemplate writes the commented config template with the
+// given presets and commented-out placeholder sections. Callers hold the lock
+// from lockConfigFile.
+func writeProjectConfigTemplate(path string, presets []string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
 		return err
 	}
@@ -69,16 +92,102 @@ func writeReconfiguredProjectConfig(path string, presets []string, allowHTTP []s
 	writePresetsSection(&sb, presets)
 	writeYAMLListSection(&sb,
 		"# Additional domains to allow HTTP access for this project.",
-		"allow-http", allowHTTP,
+		"allow-http", nil,
 		[]string{"api.openai.com:443", "api.anthropic.com:443"})
 	writeYAMLListSection(&sb,
 		"# Domains that only need DNS resolution (no HTTP proxy).",
-		"allow-dns", allowDNS,
+		"allow-dns", nil,
 		[]string{"internal.corp.example.com"})
+	writeCustomPresetsSection(&sb)
 
 	return os.WriteFile(path, []byte(sb.String()), 0o600)
 }
 
+// setProjectConfigPresets replaces the presets list of the project config at
+// path and leaves every other key as it is. A missing file gets the template.
+// The whole read-modify-write runs under the config lock, so allows saved by
+// another process while the selector was open are kept.
+func setProjectConfigPresets(path string, presets []string) error {
+	unlock, err := lockConfigFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return writeProjectConfigTemplate(path, presets)
+	}
+	if err != nil {
+		return fmt.Errorf("read project config: %w", err)
+	}
+	updated, err := setYAMLPresets(data, presets)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, updated, 0o600)
+}
+
+// setYAMLPresets sets the presets list in the given config bytes. A
+// commented-out "# presets:" placeholder, as written by the template, is
+// replaced line by line. Otherwise the presets node is edited in place and
+// the document re-encoded, which keeps the other keys and the comments
+// yaml.v3 attaches to nodes, but may change formatting.
+func setYAMLPresets(data []byte, presets []string) ([]byte, error) {
+	doc, root, err := parseProjectConfigYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*yaml.Node, 0, len(presets))
+	for _, p := range presets {
+		items = append(items, newYAMLStringScalar(p))
+	}
+	keyNode, valNode := findYAMLMappingPair(root, "presets")
+	switch {
+	case keyNode == nil:
+		if len(presets) == 0 {
+			return data, nil
+		}
+		if out, ok := replaceCommentedYAMLListSection(data, "presets", presets); ok && yamlSectionEquals(out, "presets", presets) {
+			return out, nil
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+		root.Content = append(root.Content, newYAMLStringScalar("presets"), seq)
+
+	case valNode.Kind == yaml.SequenceNode:
+		// Editing the node keeps its comments and anchor; an alias of an
+		// anchored presets list means the same list anyway.
+		valNode.Content = items
+		valNode.Style = 0
+		if len(items) == 0 {
+			valNode.Style = yaml.FlowStyle
+		}
+
+	default:
+		// A null or an alias, give the key its own list.
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+		if len(items) == 0 {
+			seq.Style = yaml.FlowStyle
+		}
+		for i := 1; i < len(root.Content); i += 2 {
+			if root.Content[i] == valNode {
+				root.Content[i] = seq
+			}
+		}
+	}
+
+	out, err := encodeYAMLDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !yamlSectionEquals(out, "presets", presets) {
+		return nil, fmt.Errorf("presets: cannot safely update the project config, set presets to %s by hand",
+			strings.Join(presets, ", "))
+	}
+	return out, nil
+}
+
 // writeConfigHeader writes the shared file header comment block.
 func writeConfigHeader(sb *strings.Builder) {
 	sb.WriteString("# Vibepit network config for this project.\n")
@@ -125,6 +234,14 @@ func writeYAMLListSection(sb *strings.Builder, comment, key string, entries []st
 	}
 }
 
+// writeCustomPresetsSection writes a commented-out custom-presets example.
+func writeCustomPresetsSection(sb *strings.Builder) {
+	sb.WriteString("\n# Project presets, listed in presets like the built-in ones.\n")
+	sb.WriteString("# custom-presets:\n")
+	sb.WriteString("#   internal:\n")
+	sb.WriteString("#     - git.corp.example.com:443\n")
+}
+
 // formatYAMLListValue quotes values that would otherwise be parsed as aliases.
 func formatYAMLListValue(v string) string {
 	if strings.HasPrefix(v, "*") {
@@ -145,7 +262,49 @@ func AppendAllowDNS(projectConfigPath string, entries []string) error {
 	return appendAllowEntries(projectConfigPath, "allow-dns", entries)
 }
 
+// AppendGlobalAllowHTTP adds entries to the allow-http list of the global
+// config, creating the file first if it does not exist yet.
+func AppendGlobalAllowHTTP(globalConfigPath string, entries []string) error {
+	if err := ensureConfigFile(globalConfigPath); err != nil {
+		return err
+	}
+	return appendAllowEntries(globalConfigPath, "allow-http", entries)
+}
+
+// AppendGlobalAllowDNS adds entries to the allow-dns list of the global
+// config, creating the file first if it does not exist yet.
+func AppendGlobalAllowDNS(globalConfigPath string, entries []string) error {
+	if err := ensureConfigFile(globalConfigPath); err != nil {
+		return err
+	}
+	return appendAllowEntries(globalConfigPath, "allow-dns", entries)
+}
+
+// ensureConfigFile creates an empty config file and its parent directory if
+// path does not exist. Existing files are left untouched.
+func ensureConfigFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create config: %w", err)
+	}
+	return f.Close()
+}
+
+// appendAllowEntries adds the entries missing from the sectionKey list of the
+// config file. The whole read-modify-write runs under the config lock.
 func appendAllowEntries(projectConfigPath, sectionKey string, entries []string) error {
+	unlock, err := lockConfigFile(projectConfigPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	var cfg ProjectConfig
 	if err := loadFile(projectConfigPath, &cfg); err != nil {
 		return fmt.Errorf("load project config: %w", err)
@@ -182,7 +341,7 @@ func appendAllowEntries(projectConfigPath, sectionKey string, entries []string)
 		return fmt.Errorf("read project config: %w", err)
 	}
 
-	updated, err := appendYAMLListEntries(data, sectionKey, added)
+	updated, err := appendYAMLListEntries(data, sectionKey, current, added)
 	if err != nil {
 		return err
 	}
@@ -193,24 +352,42 @@ func appendAllowEntries(projectConfigPath, sectionKey string, entries []string)
 // given config bytes. It prefers line-based edits to preserve comments and
 // blank lines verbatim, and only falls back to a full YAML re-encode for
 // awkward shapes (flow style, nested items, explicit-null values on their own
-// line) where surgical editing isn't safe.
-func appendYAMLListEntries(data []byte, sectionKey string, added []string) ([]byte, error) {
+// line) where surgical editing isn't safe. current holds the section's entries
+// as loaded, which may differ from the literal YAML when anchors are involved.
+//
+// Every line edit is checked by parsing the result again; if the section does
+// not come out as current followed by added (unusual indentation, a section
+// nested under another key, ...), the edit is discarded for a re-encode.
+func appendYAMLListEntries(data []byte, sectionKey string, current, added []string) ([]byte, error) {
 	doc, root, err := parseProjectConfigYAML(data)
 	if err != nil {
 		return nil, err
 	}
 
+	if usesYAMLAnchors(doc) {
+		return appendAnchoredYAMLListEntries(doc, root, sectionKey, current, added)
+	}
+
+	want := append(slices.Clone(current), added...)
 	keyNode, valNode := findYAMLMappingPair(root, sectionKey)
 
 	switch {
 	case keyNode == nil:
-		if out, ok := replaceCommentedYAMLListSection(data, sectionKey, added); ok {
+		if out, ok := replaceCommentedYAMLListSection(data, sectionKey, added); ok && yamlSectionEquals(out, sectionKey, want) {
+			return out, nil
+		}
+		if out := appendNewYAMLListSection(data, sectionKey, added); yamlSectionEquals(out, sectionKey, want) {
 			return out, nil
 		}
-		return appendNewYAMLListSection(data, sectionKey, added), nil
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, d := range added {
+			seq.Content = append(seq.Content, newYAMLStringScalar(d))
+		}
+		root.Content = append(root.Content, newYAMLStringScalar(sectionKey), seq)
+		return encodeYAMLDocument(doc)
 
 	case valNode.Kind == yaml.SequenceNode:
-		if out, ok := appendToExistingBlockYAMLList(data, valNode, added); ok {
+		if out, ok := appendToExistingBlockYAMLList(data, valNode, added); ok && yamlSectionEquals(out, sectionKey, want) {
 			return out, nil
 		}
 		valNode.Style = 0
@@ -226,7 +403,7 @@ func appendYAMLListEntries(data []byte, sectionKey string, added []string) ([]by
 		// would yield `allow-http: ~\n  - entry`, which YAML reparses as a
 		// single mangled scalar. Those fall through to the re-encode below.
 		if valNode.Value == "" && valNode.Line == keyNode.Line && keyNode.Line > 0 {
-			if out, ok := insertAfterKeyLine(data, keyNode.Line, added); ok {
+			if out, ok := insertAfterKeyLine(data, keyNode.Line, added); ok && yamlSectionEquals(out, sectionKey, want) {
 				return out, nil
 			}
 		}
@@ -244,6 +421,95 @@ func appendYAMLListEntries(data []byte, sectionKey string, added []string) ([]by
 	}
 }
 
+// usesYAMLAnchors reports whether the document contains anchors, aliases, or
+// merge keys anywhere.
+func usesYAMLAnchors(node *yaml.Node) bool {
+	if node.Anchor != "" || node.Kind == yaml.AliasNode || node.Tag == "!!merge" {
+		return true
+	}
+	for _, c := range node.Content {
+		if usesYAMLAnchors(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendAnchoredYAMLListEntries handles configs that use anchors, aliases, or
+// merge keys. A line edit could extend a list that is shared through an alias
+// or shadow one inherited through a merge key, so the document is edited as
+// nodes and re-encoded instead. Comments are kept where yaml.v3 can attach
+// them, but formatting may change. The result is decoded again and rejected
+// unless the section ends up holding exactly current followed by added.
+func appendAnchoredYAMLListEntries(doc, root *yaml.Node, sectionKey string, current, added []string) ([]byte, error) {
+	want := append(slices.Clone(current), added...)
+	newList := func() *yaml.Node {
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, d := range want {
+			seq.Content = append(seq.Content, newYAMLStringScalar(d))
+		}
+		return seq
+	}
+
+	keyNode, valNode := findYAMLMappingPair(root, sectionKey)
+	switch {
+	case keyNode == nil:
+		// The section may be inherited through a merge key. An explicit key
+		// overrides the merged one, so it has to carry the inherited entries.
+		root.Content = append(root.Content, newYAMLStringScalar(sectionKey), newList())
+
+	case valNode.Kind == yaml.SequenceNode:
+		// Appending to an anchored list also extends every alias of it, which
+		// matches what the user wrote: those keys share one list.
+		for _, d := range added {
+			valNode.Content = append(valNode.Content, newYAMLStringScalar(d))
+		}
+
+	case valNode.Kind == yaml.AliasNode,
+		valNode.Kind == yaml.ScalarNode && valNode.Tag == "!!null":
+		// Give the section its own list instead of editing the alias target,
+		// which would change every other key that refers to it.
+		for i := 1; i < len(root.Content); i += 2 {
+			if root.Content[i] == valNode {
+				root.Content[i] = newList()
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: expected YAML list", sectionKey)
+	}
+
+	out, err := encodeYAMLDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !yamlSectionEquals(out, sectionKey, want) {
+		return nil, fmt.Errorf("%s: cannot safely update a project config that uses YAML anchors or merge keys, add %s by hand",
+			sectionKey, strings.Join(added, ", "))
+	}
+	return out, nil
+}
+
+// yamlSectionEquals reports whether data parses as a YAML mapping whose
+// sectionKey is a list of exactly the given strings.
+func yamlSectionEquals(data []byte, sectionKey string, want []string) bool {
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return false
+	}
+	list, ok := m[sectionKey].([]any)
+	if !ok || len(list) != len(want) {
+		return false
+	}
+	for i, item := range list {
+		if s, ok := item.(string); !ok || s != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func encodeYAMLDocument(doc *yaml.Node) ([]byte, error) {
 	var out bytes.Buffer
 	enc := yaml.NewEncoder(&out)
@@ -323,6 +589,58 @@ func parseProjectConfigYAML(data []byte) (*yaml.Node, *yaml.Node, error) {
 	return &doc, root, nil
 }
 
+// loadEntryComments records the trailing comments of allow-http, allow-dns
+// and custom-presets list items in path. Later files override earlier ones
+// for the same entry.
+func loadEntryComments(path string, comments map[string]string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+	_, httpList := findYAMLMappingPair(root, "allow-http")
+	_, dnsList := findYAMLMappingPair(root, "allow-dns")
+	addListComments(httpList, true, comments)
+	addListComments(dnsList, false, comments)
+	if _, custom := findYAMLMappingPair(root, "custom-presets"); custom != nil && custom.Kind == yaml.MappingNode {
+		for i := 1; i < len(custom.Content); i += 2 {
+			addListComments(custom.Content[i], true, comments)
+		}
+	}
+	return nil
+}
+
+// addListComments records the trailing comments of the items of list. HTTP
+// entries are keyed by the canonical form Merge produces.
+func addListComments(list *yaml.Node, isHTTP bool, comments map[string]string) {
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, item := range list.Content {
+		comment := strings.TrimSpace(strings.TrimPrefix(item.LineComment, "#"))
+		if item.Kind != yaml.ScalarNode || comment == "" {
+			continue
+		}
+		entry := item.Value
+		if isHTTP {
+			if n, err := proxy.NormalizeHTTPEntry(entry); err == nil {
+				entry = n
+			}
+		}
+		comments[entry] = comment
+	}
+}
+
 func findYAMLMappingPair(root *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
 	for i := 0; i+1 < len(root.Content); i += 2 {
 		k := root.Content[i]
@@ -397,10 +715,13 @@ func replaceCommentedYAMLListSection(data []byte, sectionKey string, added []str
 		endIdx = j
 	}
 
+	// Lines were split on "\n" only, so a CRLF file keeps its "\r" on each
+	// line and the replacement lines need it too.
+	cr := strings.TrimSuffix(lineEnding(lines[headerIdx]+"\n"), "\n")
 	replacement := make([]string, 0, 1+len(added))
-	replacement = append(replacement, sectionKey+":")
+	replacement = append(replacement, sectionKey+":"+cr)
 	for _, d := range added {
-		replacement = append(replacement, "  - "+formatYAMLListValue(d))
+		replacement = append(replacement, "  - "+formatYAMLListValue(d)+cr)
 	}
 
 	out := make([]string, 0, len(lines)-(endIdx-headerIdx+1)+len(replacement))
@@ -414,26 +735,33 @@ func replaceCommentedYAMLListSection(data []byte, sectionKey string, added []str
 // the file, leaving exactly one blank line between any existing content and
 // the new section.
 func appendNewYAMLListSection(data []byte, sectionKey string, added []string) []byte {
+	nl := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		nl = "\r\n"
+	}
 	var sb bytes.Buffer
 	sb.Write(data)
 	if len(data) > 0 {
 		if !bytes.HasSuffix(data, []byte("\n")) {
-			sb.WriteByte('\n')
+			sb.WriteString(nl)
 		}
-		if !bytes.HasSuffix(data, []byte("\n\n")) {
-			sb.WriteByte('\n')
+		if !bytes.HasSuffix(data, []byte(nl+nl)) {
+			sb.WriteString(nl)
 		}
 	}
 	sb.WriteString(sectionKey)
-	sb.WriteString(":\n")
+	sb.WriteString(":" + nl)
 	for _, d := range added {
-		fmt.Fprintf(&sb, "  - %s\n", formatYAMLListValue(d))
+		fmt.Fprintf(&sb, "  - %s%s", formatYAMLListValue(d), nl)
 	}
 	return sb.Bytes()
 }
 
+// isCommentedYAMLSectionHeader matches a "# <key>:" placeholder at the start
+// of the line. Indented placeholders belong to a nested block and replacing
+// them with a top-level key would break that block.
 func isCommentedYAMLSectionHeader(line, key string) bool {
-	trimmed := strings.TrimSpace(line)
+	trimmed := strings.TrimRight(line, " \t\r")
 	if !strings.HasPrefix(trimmed, "#") {
 		return false
 	}
@@ -54,7 +54,7 @@ func buildPresetItems(reg *proxy.PresetRegistry, preChecked map[string]bool, det
 		preset proxy.Preset
 	}
 
-	var detectedEntries, defaultEntries, pkgEntries, infraEntries []entry
+	var detectedEntries, defaultEntries, pkgEntries, infraEntries, customEntries []entry
 
 	for _, p := range allPresets {
 		if detectedSet[p.Name] {
@@ -65,6 +65,8 @@ func buildPresetItems(reg *proxy.PresetRegistry, preChecked map[string]bool, det
 			pkgEntries = append(pkgEntries, entry{preset: p})
 		} else if p.Group == "Infrastructure" {
 			infraEntries = append(infraEntries, entry{preset: p})
+		} else if p.Group == proxy.CustomPresetGroup {
+			customEntries = append(customEntries, entry{preset: p})
 		}
 	}
 
@@ -88,6 +90,7 @@ func buildPresetItems(reg *proxy.PresetRegistry, preChecked map[string]bool, det
 	addSection("Defaults", defaultEntries)
 	addSection("Package Managers", pkgEntries)
 	addSection("Infrastructure", infraEntries)
+	addSection("Custom", customEntries)
 
 	checked := make(map[string]bool, len(preChecked))
 	maps.Copy(checked, preChecked)
@@ -103,10 +106,13 @@ type presetScreen struct {
 	expanded map[string]bool // key: section name or preset name
 	registry *proxy.PresetRegistry
 	selected []string
+
+	// comments maps entries to their config file comment, shown after the
+	// domain lines of custom presets.
+	comments map[string]string
 }
 
-func newPresetScreen(preChecked map[string]bool, detected []string) *presetScreen {
-	reg := proxy.NewPresetRegistry()
+func newPresetScreen(reg *proxy.PresetRegistry, preChecked map[string]bool, detected []string) *presetScreen {
 	items, checked := buildPresetItems(reg, preChecked, detected)
 
 	expanded := make(map[string]bool)
@@ -399,6 +405,9 @@ func (s *presetScreen) renderDomainLine(l visibleLine, highlighted bool) string
 
 	indent := base.Render("          ")
 	text := base.Faint(true).Render(l.text)
+	if comment := s.comments[l.text]; comment != "" {
+		text += base.Render("  ") + base.Foreground(tui.ColorField).Render("# "+comment)
+	}
 	return marker + indent + text
 }
 
@@ -435,8 +444,11 @@ func (s *presetScreen) FooterStatus(w *tui.Window) string {
 
 // runPresetSelectorTUI runs the full-screen preset selector and returns the
 // selected preset names. Returns nil if the user quit without confirming.
-func runPresetSelectorTUI(preChecked map[string]bool, detected []string) ([]string, error) {
-	s := newPresetScreen(preChecked, detected)
+// comments are the entry comments of the project config, see
+// loadEntryComments.
+func runPresetSelectorTUI(reg *proxy.PresetRegistry, preChecked map[string]bool, detected []string, comments map[string]string) ([]string, error) {
+	s := newPresetScreen(reg, preChecked, detected)
+	s.comments = comments
 	header := &tui.HeaderInfo{ProjectDir: "vibepit", SessionID: "setup"}
 	w := tui.NewWindow(header, s)
 	p := tea.NewProgram(w)
@@ -7,6 +7,7 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"github.com/bernd/vibepit/proxy"
 	"github.com/bernd/vibepit/tui"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -68,11 +69,24 @@ func TestBuildPresetItems_NoDetected(t *testing.T) {
 	assert.Contains(t, headers, "Defaults")
 }
 
+func TestBuildPresetItems_Custom(t *testing.T) {
+	reg, err := newPresetRegistry(map[string][]string{"corp": {"git.corp.example:443"}})
+	require.NoError(t, err)
+
+	items, _ := buildPresetItems(reg, nil, nil)
+
+	last := items[len(items)-1]
+	header := items[len(items)-2]
+	assert.True(t, header.isHeader)
+	assert.Equal(t, "Custom", header.section)
+	assert.Equal(t, "corp", last.presetName)
+}
+
 func makePresetTestSetup() (*presetScreen, *tui.Window) {
 	preChecked := map[string]bool{"default": true, "pkg-go": true}
 	detected := []string{"pkg-go"}
 
-	s := newPresetScreen(preChecked, detected)
+	s := newPresetScreen(proxy.NewPresetRegistry(), preChecked, detected)
 	header := &tui.HeaderInfo{ProjectDir: "vibepit", SessionID: "setup"}
 	w := tui.NewWindow(header, s)
 	w.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
@@ -353,7 +367,7 @@ func TestPresetScreen_CollapseResetsOffset(t *testing.T) {
 	// Use a small viewport so expanding forces scrolling.
 	preChecked := map[string]bool{"default": true, "pkg-go": true}
 	detected := []string{"pkg-go"}
-	s := newPresetScreen(preChecked, detected)
+	s := newPresetScreen(proxy.NewPresetRegistry(), preChecked, detected)
 	header := &tui.HeaderInfo{ProjectDir: "vibepit", SessionID: "setup"}
 	w := tui.NewWindow(header, s)
 	w.Update(tea.WindowSizeMsg{Width: 100, Height: 15}) // small viewport
@@ -475,3 +489,17 @@ func TestPresetScreen_ViewShowsSubGroupsForMetaPreset(t *testing.T) {
 	assert.Contains(t, view, "vcs-github:")
 	assert.Contains(t, view, "api.anthropic.com")
 }
+
+func TestPresetScreen_ViewShowsEntryComments(t *testing.T) {
+	reg, err := newPresetRegistry(map[string][]string{"corp": {"git.corp.example:443", "ci.corp.example"}})
+	require.NoError(t, err)
+	s := newPresetScreen(reg, nil, nil)
+	s.comments = map[string]string{"git.corp.example:443": "source mirror", "ci.corp.example:443": "build runners"}
+	w := tui.NewWindow(&tui.HeaderInfo{ProjectDir: "vibepit", SessionID: "setup"}, s)
+	w.Update(tea.WindowSizeMsg{Width: 100, Height: 80})
+
+	s.expanded["corp"] = true
+	view := ansi.Strip(s.View(w))
+	assert.Contains(t, view, "git.corp.example:443  # source mirror")
+	assert.Contains(t, view, "ci.corp.example:443  # build runners", "comments are keyed by the normalized entry")
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bernd/vibepit/proxy"
+)
+
+// lockfileParsers maps dependency lock files to a parser returning the URLs
+// the locked packages are downloaded from, and the entries to fall back to
+// when the lock file does not record any URL.
+var lockfileParsers = []struct {
+	name     string
+	parse    func(data []byte) ([]string, error)
+	fallback []string
+}{
+	{name: "package-lock.json", parse: npmLockURLs, fallback: []string{"registry.npmjs.org:443"}},
+}
+
+// SuggestAllowHTTP reads the supported dependency lock files in projectDir
+// and returns the sorted allow-http entries needed to download the locked
+// packages. Missing lock files are skipped.
+func SuggestAllowHTTP(projectDir string) ([]string, error) {
+	var entries []string
+	for _, lf := range lockfileParsers {
+		data, err := os.ReadFile(filepath.Join(projectDir, lf.name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		urls, err := lf.parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lf.name, err)
+		}
+		found := urlEntries(urls)
+		if len(found) == 0 {
+			found = lf.fallback
+		}
+		entries = append(entries, found...)
+	}
+	slices.Sort(entries)
+	return slices.Compact(entries), nil
+}
+
+// urlEntries converts download URLs into allow-http entries. URLs that don't
+// use http or https, like file: or git+ssh: references, are skipped.
+func urlEntries(urls []string) []string {
+	var entries []string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		scheme := strings.TrimPrefix(u.Scheme, "git+")
+		entry, err := proxy.NormalizeHTTPEntry(scheme + "://" + u.Host)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// npmLockDependency is a dependency in the lockfileVersion 1 format, which
+// nests transitive dependencies.
+type npmLockDependency struct {
+	Resolved     string                       `json:"resolved"`
+	Dependencies map[string]npmLockDependency `json:"dependencies"`
+}
+
+// npmLockURLs returns the resolved package URLs from a package-lock.json.
+// Both the flat "packages" map (lockfileVersion 2 and 3) and the nested
+// "dependencies" map (lockfileVersion 1) are read.
+func npmLockURLs(data []byte) ([]string, error) {
+	var lock struct {
+		Packages map[string]struct {
+			Resolved string `json:"resolved"`
+		} `json:"packages"`
+		Dependencies map[string]npmLockDependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, p := range lock.Packages {
+		if p.Resolved != "" {
+			urls = append(urls, p.Resolved)
+		}
+	}
+	var walk func(deps map[string]npmLockDependency)
+	walk = func(deps map[string]npmLockDependency) {
+		for _, d := range deps {
+			if d.Resolved != "" {
+				urls = append(urls, d.Resolved)
+			}
+			walk(d.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return urls, nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestAllowHTTP(t *testing.T) {
+	writeLock := func(t *testing.T, content string) string {
+		t.Helper()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package-lock.json"), []byte(content), 0o644))
+		return dir
+	}
+
+	t.Run("no lock file", func(t *testing.T) {
+		entries, err := SuggestAllowHTTP(t.TempDir())
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("lockfile version 3", func(t *testing.T) {
+		dir := writeLock(t, `{
+			"lockfileVersion": 3,
+			"packages": {
+				"": {"name": "app", "dependencies": {"left-pad": "^1.3.0"}},
+				"node_modules/left-pad": {"resolved": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz"},
+				"node_modules/internal": {"resolved": "https://npm.corp.example.com/internal/-/internal-1.0.0.tgz"},
+				"node_modules/legacy": {"resolved": "http://mirror.example.com:8080/legacy-1.0.0.tgz"},
+				"node_modules/forked": {"resolved": "git+https://github.com/example/forked.git#abc123"},
+				"node_modules/private": {"resolved": "git+ssh://git@github.com/example/private.git#abc123"},
+				"node_modules/local": {"resolved": "file:../local"}
+			}
+		}`)
+		entries, err := SuggestAllowHTTP(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"github.com:443",
+			"mirror.example.com:8080",
+			"npm.corp.example.com:443",
+			"registry.npmjs.org:443",
+		}, entries)
+	})
+
+	t.Run("lockfile version 1 with nested dependencies", func(t *testing.T) {
+		dir := writeLock(t, `{
+			"lockfileVersion": 1,
+			"dependencies": {
+				"a": {
+					"resolved": "https://registry.npmjs.org/a/-/a-1.0.0.tgz",
+					"requires": {"b": "^1.0.0"},
+					"dependencies": {
+						"b": {"resolved": "https://registry.yarnpkg.com/b/-/b-1.0.0.tgz"}
+					}
+				}
+			}
+		}`)
+		entries, err := SuggestAllowHTTP(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"registry.npmjs.org:443", "registry.yarnpkg.com:443"}, entries)
+	})
+
+	t.Run("falls back to the default registry", func(t *testing.T) {
+		dir := writeLock(t, `{"lockfileVersion": 3, "packages": {"": {"name": "app"}}}`)
+		entries, err := SuggestAllowHTTP(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"registry.npmjs.org:443"}, entries)
+	})
+
+	t.Run("invalid lock file", func(t *testing.T) {
+		dir := writeLock(t, `{not json`)
+		_, err := SuggestAllowHTTP(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "package-lock.json")
+	})
+}
@@ -1,6 +1,7 @@
 package container
 
 import (
+	"archive/tar"
 	"context"
 	"crypto/rand"
 	"encoding/binary"
@@ -8,16 +9,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bernd/vibepit/config"
 	"github.com/bernd/vibepit/tui"
+	"github.com/docker/docker/api/types/build"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
@@ -52,20 +56,56 @@ const (
 	ProxyImage       = "gcr.io/distroless/base-debian13:latest"
 	LabelControlPort = "vibepit.control-port"
 
+	// LabelControlSocket holds the host path of the control API socket of
+	// proxies started with ProxyContainerConfig.ControlSocketDir.
+	LabelControlSocket = "vibepit.control-socket"
+
+	// LabelAllow, LabelPresets and LabelProfiles hold the comma-separated
+	// --allow, --preset and --profile flags the session started with, so
+	// vibepit config reload can apply them again.
+	LabelAllow        = "vibepit.flags.allow"
+	LabelPresets      = "vibepit.flags.preset"
+	LabelProfiles     = "vibepit.flags.profile"
+	ControlSocketDir  = "/run/vibepit"
+	ControlSocketPath = ControlSocketDir + "/control.sock"
+
 	SSHContainerPort = "2222/tcp"
 	SSHHostKeyPath   = "/etc/vibepit/sshd/host-key"
 	SSHHostPubPath   = "/etc/vibepit/sshd/host-key.pub"
 	SSHPubKeyEnv     = "VIBEPIT_SSH_PUBKEY"
 	SessionStatePath = "/tmp/vibed-sessions.json"
+
+	SetupCommandsPath      = "/etc/vibepit/setup-commands"
+	SetupIgnoreErrorsEnv   = "VIBEPIT_SETUP_IGNORE_ERRORS"
+	setupCommandsSeparator = "\x00"
+
+	// CACertsPath holds the extra CA certificates from the ca-certs config,
+	// CABundlePath the system bundle plus those, written by the entrypoint.
+	CACertsPath  = "/etc/vibepit/ca-certs.pem"
+	CABundlePath = "/tmp/vibepit-ca-bundle.pem"
 )
 
 // Client wraps the Docker/Podman API, trying Docker first then falling back
 // to the Podman-compatible socket.
 type Client struct {
-	docker *dockerclient.Client
-	debug  bool
+	docker  *dockerclient.Client
+	debug   bool
+	runtime string
 }
 
+// Container runtimes accepted by WithRuntime. RuntimeAuto keeps the default
+// detection order; the others connect to that runtime's socket only.
+const (
+	RuntimeAuto           = "auto"
+	RuntimeDocker         = "docker"
+	RuntimePodmanRootless = "podman-rootless"
+	RuntimePodmanRoot     = "podman-root"
+
+	// RuntimeCustomPrefix selects an explicit daemon host, e.g.
+	// "custom:///run/containerd/nerdctl.sock" or "custom://tcp://host:2375".
+	RuntimeCustomPrefix = "custom://"
+)
+
 type ClientOpt func(*Client) error
 
 func WithDebug(debug bool) ClientOpt {
@@ -75,6 +115,28 @@ func WithDebug(debug bool) ClientOpt {
 	}
 }
 
+// WithRuntime selects the container runtime socket instead of relying on
+// auto-detection. An empty value is the same as RuntimeAuto.
+func WithRuntime(runtime string) ClientOpt {
+	return func(c *Client) error {
+		switch {
+		case runtime == "", runtime == RuntimeAuto:
+			c.runtime = ""
+		case runtime == RuntimeDocker, runtime == RuntimePodmanRootless, runtime == RuntimePodmanRoot:
+			c.runtime = runtime
+		case strings.HasPrefix(runtime, RuntimeCustomPrefix):
+			if strings.TrimPrefix(runtime, RuntimeCustomPrefix) == "" {
+				return fmt.Errorf("runtime %q: missing socket path or host", runtime)
+			}
+			c.runtime = runtime
+		default:
+			return fmt.Errorf("unknown container runtime %q (want %s, %s, %s, %s, or %s<host>)", runtime,
+				RuntimeAuto, RuntimeDocker, RuntimePodmanRootless, RuntimePodmanRoot, RuntimeCustomPrefix)
+		}
+		return nil
+	}
+}
+
 func NewClient(opts ...ClientOpt) (*Client, error) {
 	client := &Client{}
 
@@ -84,16 +146,33 @@ func NewClient(opts ...ClientOpt) (*Client, error) {
 		}
 	}
 
+	if client.runtime != "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine current user: %w", err)
+		}
+		cli, err := findSocket(client.debug, nil, runtimeHosts(client.runtime, u, os.Getenv("XDG_RUNTIME_DIR"))...)
+		if err != nil {
+			return nil, fmt.Errorf("container runtime %s: %w", client.runtime, err)
+		}
+		client.docker = cli
+		return client, nil
+	}
+
 	// First try the regular Docker environment chain.
+	var failed []*DaemonError
 	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
 	if err == nil {
-		if _, pingErr := cli.Ping(context.Background()); pingErr == nil {
+		_, pingErr := cli.Ping(context.Background())
+		if pingErr == nil {
 			displayDockerHost(client.debug, cli)
 			client.docker = cli
 			return client, nil
-		} else if client.debug {
+		}
+		if client.debug {
 			tui.Debug("Could not ping Docker: %v", pingErr)
 		}
+		failed = append(failed, classifyDaemonError(cli.DaemonHost(), pingErr))
 		cli.Close()
 	} else if client.debug {
 		tui.Debug("Could not connect to Docker: %s", err)
@@ -107,6 +186,7 @@ func NewClient(opts ...ClientOpt) (*Client, error) {
 
 	detectedCli, err := findSocket(
 		client.debug,
+		failed,
 		// Used on macOS with Docker Desktop
 		fmt.Sprintf("unix://%s/.docker/run/docker.sock", u.HomeDir),
 		// Rootless Podman
@@ -120,6 +200,31 @@ func NewClient(opts ...ClientOpt) (*Client, error) {
 	return client, nil
 }
 
+// runtimeHosts returns the daemon hosts to try for an explicitly selected
+// runtime, in order.
+func runtimeHosts(runtime string, u *user.User, xdgRuntimeDir string) []string {
+	switch runtime {
+	case RuntimeDocker:
+		return []string{
+			"unix:///var/run/docker.sock",
+			// Used on macOS with Docker Desktop
+			fmt.Sprintf("unix://%s/.docker/run/docker.sock", u.HomeDir),
+		}
+	case RuntimePodmanRootless:
+		if xdgRuntimeDir == "" {
+			xdgRuntimeDir = "/run/user/" + u.Uid
+		}
+		return []string{fmt.Sprintf("unix://%s/podman/podman.sock", xdgRuntimeDir)}
+	case RuntimePodmanRoot:
+		return []string{"unix:///run/podman/podman.sock"}
+	}
+	host := strings.TrimPrefix(runtime, RuntimeCustomPrefix)
+	if strings.HasPrefix(host, "/") {
+		host = "unix://" + host
+	}
+	return []string{host}
+}
+
 func displayDockerHost(debug bool, cli *dockerclient.Client) {
 	host := cli.DaemonHost()
 	if path, ok := strings.CutPrefix(host, "unix://"); ok {
@@ -132,7 +237,10 @@ func displayDockerHost(debug bool, cli *dockerclient.Client) {
 	}
 }
 
-func findSocket(debug bool, paths ...string) (*dockerclient.Client, error) {
+// findSocket connects to the first reachable host in paths. When none
+// answers, it returns the *DaemonError that best explains why, taking the
+// already failed hosts into account.
+func findSocket(debug bool, failed []*DaemonError, paths ...string) (*dockerclient.Client, error) {
 	for _, path := range paths {
 		if debug {
 			tui.Debug("Trying socket: %s", path)
@@ -145,6 +253,7 @@ func findSocket(debug bool, paths ...string) (*dockerclient.Client, error) {
 			if debug {
 				tui.Debug("Could not connect to socket: %v", err)
 			}
+			failed = append(failed, classifyDaemonError(path, err))
 			continue
 		}
 		if _, err := cli.Ping(context.Background()); err != nil {
@@ -152,20 +261,30 @@ func findSocket(debug bool, paths ...string) (*dockerclient.Client, error) {
 			if debug {
 				tui.Debug("Could not ping via socket: %v", err)
 			}
+			failed = append(failed, classifyDaemonError(path, err))
 			continue
 		}
 		displayDockerHost(debug, cli)
 		return cli, nil
 	}
 
-	return nil, errors.New("couldn't find a Docker socket")
+	if e := mostSpecificDaemonError(failed); e != nil {
+		return nil, e
+	}
+	return nil, ErrNoSocket
 }
 
 func (c *Client) Close() error { return c.docker.Close() }
 
-// EnsureImage pulls the image if it is not available locally. Returns true
-// if the image was pulled, false if it was already present.
-func (c *Client) EnsureImage(ctx context.Context, ref string, quiet bool) (bool, error) {
+// debugf logs a container API operation when debug mode is enabled.
+func (c *Client) debugf(format string, args ...any) {
+	if c.debug {
+		tui.Debug(format, args...)
+	}
+}
+
+// HasImage reports whether the image is available locally.
+func (c *Client) HasImage(ctx context.Context, ref string) (bool, error) {
 	images, err := c.docker.ImageList(ctx, image.ListOptions{
 		Filters: filters.NewArgs(filters.Arg("reference", ref)),
 	})
@@ -173,10 +292,10 @@ func (c *Client) EnsureImage(ctx context.Context, ref string, quiet bool) (bool,
 		return false, fmt.Errorf("list images: %w", err)
 	}
 	if len(images) > 0 {
-		return false, nil
+		c.debugf("Image %s is present locally", ref)
+		return true, nil
 	}
-
-	return true, c.PullImage(ctx, ref, quiet)
+	return false, nil
 }
 
 // PullImage pulls the latest version of the image.
@@ -184,7 +303,7 @@ func (c *Client) PullImage(ctx context.Context, ref string, quiet bool) error {
 	tui.Status("Pulling", "image %s", ref)
 	reader, err := c.docker.ImagePull(ctx, ref, image.PullOptions{})
 	if err != nil {
-		return fmt.Errorf("pull image %s: %w", ref, err)
+		return c.pullError(ctx, ref, err)
 	}
 	defer reader.Close()
 
@@ -194,11 +313,133 @@ func (c *Client) PullImage(ctx context.Context, ref string, quiet bool) error {
 		err = displayPullProgress(reader)
 	}
 	if err != nil {
-		return fmt.Errorf("pull image %s: %w", ref, err)
+		return c.pullError(ctx, ref, err)
 	}
 	return nil
 }
 
+// ImageNotFoundError reports that the registry has no manifest for an image
+// tag, e.g. because no image is published for the user's UID/GID combination.
+type ImageNotFoundError struct {
+	Ref string
+}
+
+func (e *ImageNotFoundError) Error() string {
+	return fmt.Sprintf("image %s not found in registry", e.Ref)
+}
+
+// pullError wraps a pull failure, translating "no matching manifest" errors
+// into a *PlatformError that names the daemon's platform and missing tags
+// into an *ImageNotFoundError.
+func (c *Client) pullError(ctx context.Context, ref string, err error) error {
+	switch {
+	case isNoMatchingManifest(err):
+		platform, _ := c.DaemonPlatform(ctx)
+		return fmt.Errorf("pull image %s: %w", ref, &PlatformError{Ref: ref, Platform: platform})
+	case isManifestNotFound(err):
+		return fmt.Errorf("pull image %s: %w", ref, &ImageNotFoundError{Ref: ref})
+	}
+	return fmt.Errorf("pull image %s: %w", ref, err)
+}
+
+// isManifestNotFound reports whether a pull error means the tag doesn't exist.
+// Docker says "manifest for <ref> not found: manifest unknown", Podman says
+// "manifest unknown" or "<ref>: not found".
+func isManifestNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "manifest unknown") ||
+		(strings.Contains(msg, "manifest for") && strings.Contains(msg, "not found"))
+}
+
+// BuildImage builds an image from the Dockerfile in contextDir and tags it
+// with tag. The directory is sent to the daemon as the build context. Build
+// output is streamed to stdout unless quiet is set.
+func (c *Client) BuildImage(ctx context.Context, contextDir, tag string, buildArgs map[string]string, quiet bool) error {
+	args := make(map[string]*string, len(buildArgs))
+	for k, v := range buildArgs {
+		args[k] = &v
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeBuildContext(pw, contextDir))
+	}()
+	defer pr.Close()
+
+	tui.Status("Building", "image %s from %s", tag, contextDir)
+	resp, err := c.docker.ImageBuild(ctx, pr, build.ImageBuildOptions{
+		Tags:        []string{tag},
+		BuildArgs:   args,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return fmt.Errorf("build image %s: %w", tag, err)
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	isTerminal := term.IsTerminal(int(os.Stdout.Fd()))
+	if quiet {
+		out = io.Discard
+		isTerminal = false
+	}
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, out, os.Stdout.Fd(), isTerminal, nil); err != nil {
+		return fmt.Errorf("build image %s: %w", tag, err)
+	}
+	return nil
+}
+
+// writeBuildContext writes dir as an uncompressed tar stream to w, with
+// paths relative to dir.
+func writeBuildContext(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("build context: %w", err)
+	}
+	return tw.Close()
+}
+
 // displayPullProgress reads Docker pull JSON messages and shows a single
 // updating status line with aggregated download progress.
 func displayPullProgress(r io.Reader) error {
@@ -254,10 +495,10 @@ func displayPullProgress(r io.Reader) error {
 		if totalBytes > 0 {
 			pct := min(int(float64(currentBytes)/float64(totalBytes)*100), 100)
 			line = fmt.Sprintf("             %s / %s, %d%%",
-				humanBytes(currentBytes), humanBytes(totalBytes), pct)
+				HumanBytes(currentBytes), HumanBytes(totalBytes), pct)
 		} else {
 			line = fmt.Sprintf("             %s",
-				humanBytes(currentBytes))
+				HumanBytes(currentBytes))
 		}
 		fmt.Fprintf(os.Stdout, "\r\033[K%s", line)
 		wroteProgress = true
@@ -268,7 +509,8 @@ func displayPullProgress(r io.Reader) error {
 	return nil
 }
 
-func humanBytes(b int64) string {
+// HumanBytes formats a byte count with a binary unit, e.g. "1.5 GB".
+func HumanBytes(b int64) string {
 	const (
 		kb = 1024
 		mb = 1024 * kb
@@ -315,6 +557,29 @@ func (c *Client) FindRunningSession(ctx context.Context, projectDir string) (*Ru
 	return nil, nil
 }
 
+// FindRunningSessionByID returns the running sandbox container of the given
+// session, or nil if the session is not running for the project directory.
+func (c *Client) FindRunningSessionByID(ctx context.Context, projectDir, sessionID string) (*RunningSession, error) {
+	containers, err := c.docker.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", LabelProjectDir, projectDir)),
+			filters.Arg("label", fmt.Sprintf("%s=%s", LabelSessionID, sessionID)),
+			filters.Arg("label", LabelRole+"="+RoleSandbox),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) > 0 {
+		return &RunningSession{
+			ContainerID: containers[0].ID,
+			SessionID:   sessionID,
+			ProjectDir:  projectDir,
+		}, nil
+	}
+	return nil, nil
+}
+
 // FindAnySessionContainer returns the session ID for any container (sandbox or
 // proxy) matching the given project directory. This is useful for cleanup when
 // the sandbox may have crashed but the proxy is still running.
@@ -450,6 +715,7 @@ func (c *Client) AttachAndStartSession(ctx context.Context, containerID string)
 	// Use next-exit so created containers do not return immediately.
 	waitCh, waitErrCh := c.docker.ContainerWait(waitCtx, containerID, container.WaitConditionNextExit)
 
+	c.debugf("Starting attached container %s", containerID)
 	if err := c.docker.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("start attached container: %w", err)
 	}
@@ -484,6 +750,7 @@ func (c *Client) AttachAndStartSession(ctx context.Context, containerID string)
 func (c *Client) ExecSession(ctx context.Context, containerID string) error {
 	size := terminalSize()
 
+	c.debugf("Creating exec session in container %s", containerID)
 	execResp, err := c.docker.ContainerExecCreate(ctx, containerID, container.ExecOptions{
 		Tty:          true,
 		AttachStdin:  true,
@@ -542,6 +809,7 @@ func (c *Client) CreateNetwork(ctx context.Context, name string) (NetworkInfo, e
 		return NetworkInfo{}, fmt.Errorf("generate subnet: %w", err)
 	}
 
+	c.debugf("Creating network %s (subnet %s)", name, subnet)
 	resp, err := c.docker.NetworkCreate(ctx, name, network.CreateOptions{
 		Internal: true,
 		Labels:   map[string]string{LabelVibepit: "true"},
@@ -594,8 +862,21 @@ func nextIP(ip net.IP) net.IP {
 	return next
 }
 
+// RemoveNetwork removes a network. A network that is already gone is not an
+// error.
 func (c *Client) RemoveNetwork(ctx context.Context, networkID string) error {
-	return c.docker.NetworkRemove(ctx, networkID)
+	c.debugf("Removing network %s", networkID)
+	if err := c.docker.NetworkRemove(ctx, networkID); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// isNotFound reports whether the runtime answered that the object doesn't
+// exist, e.g. because it was removed already.
+func isNotFound(err error) bool {
+	var notFound interface{ NotFound() }
+	return errors.As(err, &notFound)
 }
 
 // ProxyContainerConfig holds the parameters for starting the in-network proxy.
@@ -614,13 +895,40 @@ type ProxyContainerConfig struct {
 	NoRestart      bool // when true, omits the restart policy so the proxy stops with the session
 	SSHPort        int  // when > 0, publish this port for SSH forwarding to sandbox
 	ExtraHosts     []string
+
+	// ControlSocketDir is a host directory mounted at ControlSocketDir. When
+	// set, the control API listens on a unix socket in it and no port is
+	// published for it.
+	ControlSocketDir string
+
+	// Allow, Presets and Profiles are the session's command line flags,
+	// recorded in LabelAllow, LabelPresets and LabelProfiles.
+	Allow    []string
+	Presets  []string
+	Profiles []string
+}
+
+// setListLabel stores values comma-separated in labels[key], unless there
+// are none. Allow entries, preset and profile names never contain commas.
+func setListLabel(labels map[string]string, key string, values []string) {
+	if len(values) > 0 {
+		labels[key] = strings.Join(values, ",")
+	}
+}
+
+// listLabel returns the values setListLabel stored in labels[key].
+func listLabel(labels map[string]string, key string) []string {
+	if labels[key] == "" {
+		return nil
+	}
+	return strings.Split(labels[key], ",")
 }
 
 // StartProxyContainer creates and starts a minimal container that runs the
 // vibepit proxy binary, then connects it to the bridge network so it can
 // reach the internet. The control API port is published to 127.0.0.1 with
-// an OS-assigned host port. Returns the container ID and the assigned host
-// port.
+// an OS-assigned host port, unless the control API uses a socket in
+// cfg.ControlSocketDir. Returns the container ID and the assigned host port.
 func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConfig) (string, string, error) {
 	var env []string
 	if cfg.TLSKeyPEM != "" {
@@ -634,24 +942,32 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 	portStr := strconv.Itoa(cfg.ControlAPIPort)
 
 	labels := map[string]string{
-		LabelVibepit:     "true",
-		LabelRole:        RoleProxy,
-		LabelProjectDir:  cfg.ProjectDir,
-		LabelControlPort: portStr,
+		LabelVibepit:    "true",
+		LabelRole:       RoleProxy,
+		LabelProjectDir: cfg.ProjectDir,
 	}
 	if cfg.SessionID != "" {
 		labels[LabelSessionID] = cfg.SessionID
 	}
-
-	containerPort, _ := nat.NewPort("tcp", portStr)
-
-	exposedPorts := nat.PortSet{
-		containerPort: struct{}{},
+	setListLabel(labels, LabelAllow, cfg.Allow)
+	setListLabel(labels, LabelPresets, cfg.Presets)
+	setListLabel(labels, LabelProfiles, cfg.Profiles)
+	binds := []string{
+		cfg.BinaryPath + ":" + ProxyBinaryPath + ":ro",
+		cfg.ConfigPath + ":" + ProxyConfigPath + ":ro",
 	}
-	portBindings := nat.PortMap{
-		containerPort: []nat.PortBinding{
-			{HostIP: "127.0.0.1", HostPort: portStr},
-		},
+
+	exposedPorts := nat.PortSet{}
+	portBindings := nat.PortMap{}
+	if cfg.ControlSocketDir != "" {
+		portStr = ""
+		labels[LabelControlSocket] = filepath.Join(cfg.ControlSocketDir, filepath.Base(ControlSocketPath))
+		binds = append(binds, cfg.ControlSocketDir+":"+ControlSocketDir)
+	} else {
+		labels[LabelControlPort] = portStr
+		containerPort, _ := nat.NewPort("tcp", portStr)
+		exposedPorts[containerPort] = struct{}{}
+		portBindings[containerPort] = []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: portStr}}
 	}
 	if cfg.SSHPort > 0 {
 		sshPort := nat.Port(SSHContainerPort)
@@ -662,11 +978,8 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 	hostConfig := &container.HostConfig{
 		// Use bridge as the primary network so HostIP/HostPort publishing is
 		// actually activated by the runtime.
-		NetworkMode: "bridge",
-		Binds: []string{
-			cfg.BinaryPath + ":" + ProxyBinaryPath + ":ro",
-			cfg.ConfigPath + ":" + ProxyConfigPath + ":ro",
-		},
+		NetworkMode:  "bridge",
+		Binds:        binds,
 		ExtraHosts:   []string{"host-gateway:host-gateway"},
 		PortBindings: portBindings,
 	}
@@ -677,6 +990,8 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 		hostConfig.RestartPolicy = container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}
 	}
 
+	c.debugf("Creating proxy container %s (image %s, binds %d, ports %d)",
+		cfg.Name, ProxyImage, len(hostConfig.Binds), len(portBindings))
 	resp, err := c.docker.ContainerCreate(ctx,
 		&container.Config{
 			Image:        ProxyImage,
@@ -696,6 +1011,7 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 	}
 	// Attach to the isolated vibepit network with the fixed proxy IP so
 	// sandbox containers can use it as DNS/HTTP proxy endpoint.
+	c.debugf("Connecting proxy container %s to network %s (ip %s)", resp.ID, cfg.NetworkID, cfg.ProxyIP)
 	if err := c.docker.NetworkConnect(ctx, cfg.NetworkID, resp.ID, &network.EndpointSettings{
 		IPAMConfig: &network.EndpointIPAMConfig{
 			IPv4Address: cfg.ProxyIP,
@@ -703,6 +1019,7 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 	}); err != nil {
 		return "", "", fmt.Errorf("connect proxy to session network: %w", err)
 	}
+	c.debugf("Starting proxy container %s", resp.ID)
 	if err := c.docker.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return "", "", fmt.Errorf("start proxy container: %w", err)
 	}
@@ -712,11 +1029,20 @@ func (c *Client) StartProxyContainer(ctx context.Context, cfg ProxyContainerConf
 
 // ProxySession describes a running proxy for session discovery.
 type ProxySession struct {
-	ContainerID string
-	SessionID   string
-	ControlPort string
-	ProjectDir  string
-	StartedAt   time.Time
+	ContainerID string `json:"container-id"`
+	SessionID   string `json:"session-id"`
+	ControlPort string `json:"control-port,omitempty"`
+	// ControlSocket is the host path of the control API socket, empty when
+	// the control API is reached through ControlPort.
+	ControlSocket string    `json:"control-socket,omitempty"`
+	ProjectDir    string    `json:"project-dir"`
+	StartedAt     time.Time `json:"started-at"`
+
+	// Allow, Presets and Profiles are the command line flags the session
+	// started with, see LabelAllow.
+	Allow    []string `json:"allow,omitempty"`
+	Presets  []string `json:"presets,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
 }
 
 // ListProxySessions returns all running vibepit proxy containers with their
@@ -735,16 +1061,23 @@ func (c *Client) ListProxySessions(ctx context.Context) ([]ProxySession, error)
 
 	var sessions []ProxySession
 	for _, ctr := range containers {
+		controlSocket := ctr.Labels[LabelControlSocket]
 		controlPort := ctr.Labels[LabelControlPort]
-		if port, err := c.FindPublishedPort(ctx, ctr.ID, controlPort+"/tcp"); err == nil {
-			controlPort = strconv.Itoa(port)
+		if controlSocket == "" {
+			if port, err := c.FindPublishedPort(ctx, ctr.ID, controlPort+"/tcp"); err == nil {
+				controlPort = strconv.Itoa(port)
+			}
 		}
 		sessions = append(sessions, ProxySession{
-			ContainerID: ctr.ID,
-			SessionID:   ctr.Labels[LabelSessionID],
-			ControlPort: controlPort,
-			ProjectDir:  ctr.Labels[LabelProjectDir],
-			StartedAt:   time.Unix(ctr.Created, 0),
+			ContainerID:   ctr.ID,
+			SessionID:     ctr.Labels[LabelSessionID],
+			ControlPort:   controlPort,
+			ControlSocket: controlSocket,
+			ProjectDir:    ctr.Labels[LabelProjectDir],
+			StartedAt:     time.Unix(ctr.Created, 0),
+			Allow:         listLabel(ctr.Labels, LabelAllow),
+			Presets:       listLabel(ctr.Labels, LabelPresets),
+			Profiles:      listLabel(ctr.Labels, LabelProfiles),
 		})
 	}
 	return sessions, nil
@@ -774,6 +1107,38 @@ type SandboxContainerConfig struct {
 	DaemonHostPubPath   string   // host path to SSH host pub key
 	DaemonAuthorizedKey string   // SSH public key for client auth (set as VIBEPIT_SSH_PUBKEY env)
 	DaemonEntrypoint    []string // entrypoint override for daemon mode
+	SetupCommands       []string // commands run by the entrypoint before the shell starts
+	SetupIgnoreErrors   bool     // when true, a failing setup command doesn't stop the sandbox
+	CACerts             []byte   // extra PEM CA certificates the sandbox trusts
+	Env                 []string // extra KEY=VALUE entries, appended after the proxy settings
+	MemoryLimitMB       int64    // memory limit in MiB, 0 means unlimited
+	CPUs                float64  // number of CPUs the sandbox may use, 0 means unlimited
+}
+
+// reservedEnv lists the variables CreateSandboxContainer sets to route
+// traffic through the proxy. Extra environment entries can't override them.
+var reservedEnv = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "GRPC_PROXY", "NO_PROXY", "ALL_PROXY",
+	"NODE_USE_ENV_PROXY", "JAVA_TOOL_OPTIONS", "MAVEN_ARGS",
+}
+
+// ReservedEnv reports whether name is a proxy setting or a VIBEPIT_
+// variable of the sandbox. The proxy variables are matched regardless of
+// case, since tools read both spellings.
+func ReservedEnv(name string) bool {
+	if strings.HasPrefix(name, "VIBEPIT_") {
+		return true
+	}
+	return slices.Contains(reservedEnv, strings.ToUpper(name))
+}
+
+// sandboxResources translates the resource limits of cfg for the host
+// config. Zero limits are left unset, which Docker treats as unlimited.
+func sandboxResources(cfg SandboxContainerConfig) container.Resources {
+	return container.Resources{
+		Memory:   cfg.MemoryLimitMB * 1024 * 1024,
+		NanoCPUs: int64(cfg.CPUs * 1e9),
+	}
 }
 
 // CreateSandboxContainer creates the sandboxed development container
@@ -827,9 +1192,46 @@ func (c *Client) CreateSandboxContainer(ctx context.Context, cfg SandboxContaine
 		binds = append(binds, mavenSettings+":/etc/vibepit/maven-settings.xml:ro")
 		env = append(env, `MAVEN_ARGS=--global-settings=/etc/vibepit/maven-settings.xml`)
 	}
+	// The entrypoint runs the setup commands after initializing the home
+	// directory. They are NUL-separated so commands can span several lines.
+	if len(cfg.SetupCommands) > 0 {
+		setupPath := filepath.Join(cfg.RuntimeDir, "setup-commands")
+		data := strings.Join(cfg.SetupCommands, setupCommandsSeparator) + setupCommandsSeparator
+		if err := os.WriteFile(setupPath, []byte(data), 0o600); err != nil {
+			return "", fmt.Errorf("write setup commands: %w", err)
+		}
+		binds = append(binds, setupPath+":"+SetupCommandsPath+":ro")
+		if cfg.SetupIgnoreErrors {
+			env = append(env, SetupIgnoreErrorsEnv+"=1")
+		}
+	}
+	// The root filesystem is read-only, so the entrypoint combines the system
+	// CA bundle and the extra certificates in CABundlePath. Node.js takes the
+	// extra certificates on top of its own store.
+	if len(cfg.CACerts) > 0 {
+		certsPath := filepath.Join(cfg.RuntimeDir, "ca-certs.pem")
+		if err := os.WriteFile(certsPath, cfg.CACerts, 0o600); err != nil {
+			return "", fmt.Errorf("write CA certificates: %w", err)
+		}
+		binds = append(binds, certsPath+":"+CACertsPath+":ro")
+		env = append(env,
+			"NODE_EXTRA_CA_CERTS="+CACertsPath,
+			"SSL_CERT_FILE="+CABundlePath,
+			"REQUESTS_CA_BUNDLE="+CABundlePath,
+			"CURL_CA_BUNDLE="+CABundlePath,
+			"GIT_SSL_CAINFO="+CABundlePath,
+		)
+	}
 	if _, err := os.Stat("/etc/localtime"); err == nil {
 		binds = append(binds, "/etc/localtime:/etc/localtime:ro")
 	}
+	for _, e := range cfg.Env {
+		name, _, _ := strings.Cut(e, "=")
+		if ReservedEnv(name) {
+			return "", fmt.Errorf("environment variable %s is reserved for the proxy settings", name)
+		}
+		env = append(env, e)
+	}
 
 	labels := map[string]string{
 		LabelVibepit:         "true",
@@ -860,6 +1262,7 @@ func (c *Client) CreateSandboxContainer(ctx context.Context, cfg SandboxContaine
 		CapDrop:        []string{"ALL"},
 		SecurityOpt:    []string{"no-new-privileges"},
 		Tmpfs:          map[string]string{"/tmp": "exec"},
+		Resources:      sandboxResources(cfg),
 	}
 
 	var networkingConfig *network.NetworkingConfig
@@ -893,6 +1296,8 @@ func (c *Client) CreateSandboxContainer(ctx context.Context, cfg SandboxContaine
 		},
 	}
 
+	c.debugf("Creating sandbox container %s (image %s, network %s, binds %d)",
+		cfg.Name, containerConfig.Image, cfg.NetworkID, len(hostConfig.Binds))
 	resp, err := c.docker.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, cfg.Name)
 	if err != nil {
 		return "", fmt.Errorf("create sandbox container: %w", err)
@@ -903,6 +1308,7 @@ func (c *Client) CreateSandboxContainer(ctx context.Context, cfg SandboxContaine
 
 // StartContainer starts a previously created container without attaching.
 func (c *Client) StartContainer(ctx context.Context, containerID string) error {
+	c.debugf("Starting container %s", containerID)
 	return c.docker.ContainerStart(ctx, containerID, container.StartOptions{})
 }
 
@@ -910,6 +1316,7 @@ func (c *Client) StartContainer(ctx context.Context, containerID string) error {
 // the given container port (e.g. "2222/tcp"). Returns an error if the port
 // is not published.
 func (c *Client) FindPublishedPort(ctx context.Context, containerID string, containerPort string) (int, error) {
+	c.debugf("Inspecting container %s for port %s", containerID, containerPort)
 	info, err := c.docker.ContainerInspect(ctx, containerID)
 	if err != nil {
 		return 0, fmt.Errorf("inspect container: %w", err)
@@ -921,6 +1328,7 @@ func (c *Client) FindPublishedPort(ctx context.Context, containerID string, cont
 // container. It reads the container port from the control port label and
 // looks up the published binding.
 func (c *Client) FindControlPort(ctx context.Context, containerID string) (int, error) {
+	c.debugf("Inspecting container %s for control port", containerID)
 	info, err := c.docker.ContainerInspect(ctx, containerID)
 	if err != nil {
 		return 0, fmt.Errorf("inspect container: %w", err)
@@ -932,6 +1340,17 @@ func (c *Client) FindControlPort(ctx context.Context, containerID string) (int,
 	return publishedPort(info, portStr+"/tcp")
 }
 
+// FindControlSocket returns the host path of the control API socket of a
+// proxy container, or an empty string when its control API uses a port.
+func (c *Client) FindControlSocket(ctx context.Context, containerID string) (string, error) {
+	c.debugf("Inspecting container %s for control socket", containerID)
+	info, err := c.docker.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("inspect container: %w", err)
+	}
+	return info.Config.Labels[LabelControlSocket], nil
+}
+
 // publishedPort extracts the host port for a container port from an inspect result.
 func publishedPort(info container.InspectResponse, containerPort string) (int, error) {
 	bindings, ok := info.NetworkSettings.Ports[nat.Port(containerPort)]
@@ -947,11 +1366,15 @@ func publishedPort(info container.InspectResponse, containerPort string) (int, e
 
 // StopAndRemove stops a container (best-effort) then forcibly removes it.
 // Uses a short stop timeout since callers invoke this after the workload
-// has already exited.
+// has already exited. A container that is already gone is not an error.
 func (c *Client) StopAndRemove(ctx context.Context, containerID string) error {
+	c.debugf("Stopping and removing container %s", containerID)
 	timeout := 2
 	c.docker.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
-	return c.docker.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+	if err := c.docker.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 // EnsureVolume creates a named volume if it does not already exist, labelling
@@ -965,10 +1388,12 @@ func (c *Client) EnsureVolume(ctx context.Context, name string, uid int, user st
 	}
 	for _, v := range list.Volumes {
 		if v.Name == name {
+			c.debugf("Volume %s already exists", name)
 			return nil
 		}
 	}
 
+	c.debugf("Creating volume %s", name)
 	_, err = c.docker.VolumeCreate(ctx, volume.CreateOptions{
 		Name: name,
 		Labels: map[string]string{
@@ -984,6 +1409,7 @@ func (c *Client) EnsureVolume(ctx context.Context, name string, uid int, user st
 }
 
 func (c *Client) RemoveVolume(ctx context.Context, name string) error {
+	c.debugf("Removing volume %s", name)
 	return c.docker.VolumeRemove(ctx, name, false)
 }
 
@@ -1,10 +1,19 @@
 package container
 
 import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"os/user"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNextIP(t *testing.T) {
@@ -21,3 +30,127 @@ func TestNextIP(t *testing.T) {
 		assert.Equal(t, tt.expected, got.String(), "nextIP(%s)", tt.input)
 	}
 }
+
+func TestIsManifestNotFound(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"Error response from daemon: manifest for ghcr.io/bernd/vibepit:r2-uid-1234-gid-1234 not found: manifest unknown: manifest unknown", true},
+		{"initializing source docker://ghcr.io/bernd/vibepit:r2-uid-1234-gid-1234: reading manifest r2-uid-1234-gid-1234 in ghcr.io/bernd/vibepit: manifest unknown", true},
+		{"no matching manifest for linux/amd64 in the manifest list entries", false},
+		{"dial unix /var/run/docker.sock: connect: permission denied", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isManifestNotFound(errors.New(tt.msg)), tt.msg)
+	}
+	assert.False(t, isManifestNotFound(nil))
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "No such container: abc" }
+func (notFoundError) NotFound()     {}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(notFoundError{}))
+	assert.True(t, isNotFound(fmt.Errorf("remove: %w", notFoundError{})))
+	assert.False(t, isNotFound(errors.New("No such container: abc")), "only the error type counts")
+	assert.False(t, isNotFound(nil))
+}
+
+func TestWriteBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("#!/bin/sh\n"), 0o755))
+
+	var buf bytes.Buffer
+	require.NoError(t, writeBuildContext(&buf, dir))
+
+	files := map[string]string{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+
+	assert.Equal(t, map[string]string{
+		"Dockerfile": "FROM scratch\n",
+		"bin":        "",
+		"bin/tool":   "#!/bin/sh\n",
+	}, files)
+}
+
+func TestWithRuntime(t *testing.T) {
+	for _, runtime := range []string{"", RuntimeAuto, RuntimeDocker, RuntimePodmanRootless, RuntimePodmanRoot, "custom:///run/nerdctl.sock"} {
+		t.Run("accepts "+runtime, func(t *testing.T) {
+			assert.NoError(t, WithRuntime(runtime)(&Client{}))
+		})
+	}
+	for _, runtime := range []string{"containerd", "custom://"} {
+		t.Run("rejects "+runtime, func(t *testing.T) {
+			assert.Error(t, WithRuntime(runtime)(&Client{}))
+		})
+	}
+}
+
+func TestRuntimeHosts(t *testing.T) {
+	u := &user.User{Uid: "1000", HomeDir: "/home/alice"}
+
+	tests := []struct {
+		runtime string
+		xdg     string
+		want    []string
+	}{
+		{RuntimeDocker, "", []string{"unix:///var/run/docker.sock", "unix:///home/alice/.docker/run/docker.sock"}},
+		{RuntimePodmanRootless, "", []string{"unix:///run/user/1000/podman/podman.sock"}},
+		{RuntimePodmanRootless, "/tmp/xdg", []string{"unix:///tmp/xdg/podman/podman.sock"}},
+		{RuntimePodmanRoot, "", []string{"unix:///run/podman/podman.sock"}},
+		{"custom:///run/containerd/nerdctl.sock", "", []string{"unix:///run/containerd/nerdctl.sock"}},
+		{"custom://tcp://127.0.0.1:2375", "", []string{"tcp://127.0.0.1:2375"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			assert.Equal(t, tt.want, runtimeHosts(tt.runtime, u, tt.xdg))
+		})
+	}
+}
+
+func TestSandboxResources(t *testing.T) {
+	t.Run("unlimited by default", func(t *testing.T) {
+		r := sandboxResources(SandboxContainerConfig{})
+		assert.Zero(t, r.Memory)
+		assert.Zero(t, r.NanoCPUs)
+	})
+
+	t.Run("translates the limits", func(t *testing.T) {
+		r := sandboxResources(SandboxContainerConfig{MemoryLimitMB: 512, CPUs: 1.5})
+		assert.Equal(t, int64(512*1024*1024), r.Memory)
+		assert.Equal(t, int64(1_500_000_000), r.NanoCPUs)
+	})
+}
+
+func TestReservedEnv(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "https_proxy", "No_Proxy", "JAVA_TOOL_OPTIONS", "VIBEPIT_PROJECT_DIR"} {
+		assert.True(t, ReservedEnv(name), name)
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "EDITOR", "vibepit_x"} {
+		assert.False(t, ReservedEnv(name), name)
+	}
+}
+
+func TestListLabel(t *testing.T) {
+	labels := map[string]string{}
+	setListLabel(labels, LabelAllow, []string{"a.example.com:443", "b.example.com:443"})
+	setListLabel(labels, LabelPresets, nil)
+	assert.Equal(t, map[string]string{LabelAllow: "a.example.com:443,b.example.com:443"}, labels)
+	assert.Equal(t, []string{"a.example.com:443", "b.example.com:443"}, listLabel(labels, LabelAllow))
+	assert.Nil(t, listLabel(labels, LabelPresets))
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Reasons why no container runtime could be reached. A *DaemonError matches
+// one of them with errors.Is.
+var (
+	ErrNoSocket   = errors.New("no container runtime socket found")
+	ErrNoDaemon   = errors.New("container runtime is not running")
+	ErrPermission = errors.New("permission denied on the container runtime socket")
+)
+
+// DaemonError reports why connecting to the daemon at Host failed. Kind is
+// ErrNoSocket, ErrNoDaemon or ErrPermission, Err the underlying error.
+type DaemonError struct {
+	Host string
+	Kind error
+	Err  error
+}
+
+func (e *DaemonError) Error() string {
+	return fmt.Sprintf("%v at %s", e.Kind, e.Host)
+}
+
+func (e *DaemonError) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// classifyDaemonError turns a failed connection to host into a *DaemonError.
+// A unix socket path that doesn't exist means no runtime is installed or
+// configured there, one that exists but refuses connections means the
+// daemon is down.
+func classifyDaemonError(host string, err error) *DaemonError {
+	kind := ErrNoDaemon
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		if _, statErr := os.Stat(path); errors.Is(statErr, fs.ErrNotExist) {
+			kind = ErrNoSocket
+		} else if errors.Is(statErr, fs.ErrPermission) {
+			kind = ErrPermission
+		}
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		kind = ErrPermission
+	}
+	return &DaemonError{Host: host, Kind: kind, Err: err}
+}
+
+// daemonErrorRank orders the kinds by how much they tell the user. A socket
+// that denies access explains more than a missing one.
+func daemonErrorRank(e *DaemonError) int {
+	switch e.Kind {
+	case ErrPermission:
+		return 2
+	case ErrNoDaemon:
+		return 1
+	}
+	return 0
+}
+
+// mostSpecificDaemonError returns the error that best explains why none of
+// the candidate hosts could be reached, preferring earlier hosts on ties.
+func mostSpecificDaemonError(errs []*DaemonError) *DaemonError {
+	var best *DaemonError
+	for _, e := range errs {
+		if best == nil || daemonErrorRank(e) > daemonErrorRank(best) {
+			best = e
+		}
+	}
+	return best
+}
@@ -0,0 +1,81 @@
+package container
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staleSocket returns the path of a unix socket file nobody listens on, like
+// the one a stopped daemon leaves behind.
+func staleSocket(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	l.SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	return path
+}
+
+func TestClassifyDaemonError(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &url.Error{Op: "Get", URL: "http://docker/_ping", Err: &net.OpError{
+			Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", errno),
+		}}
+	}
+
+	t.Run("missing socket", func(t *testing.T) {
+		host := "unix://" + filepath.Join(t.TempDir(), "docker.sock")
+		err := classifyDaemonError(host, dialErr(syscall.ENOENT))
+		assert.ErrorIs(t, err, ErrNoSocket)
+		assert.EqualError(t, err, "no container runtime socket found at "+host)
+	})
+
+	t.Run("socket without daemon", func(t *testing.T) {
+		err := classifyDaemonError("unix://"+staleSocket(t), dialErr(syscall.ECONNREFUSED))
+		assert.ErrorIs(t, err, ErrNoDaemon)
+		assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	})
+
+	t.Run("socket without access", func(t *testing.T) {
+		err := classifyDaemonError("unix://"+staleSocket(t), dialErr(syscall.EACCES))
+		assert.ErrorIs(t, err, ErrPermission)
+	})
+
+	t.Run("unreachable tcp host", func(t *testing.T) {
+		err := classifyDaemonError("tcp://127.0.0.1:2375", dialErr(syscall.ECONNREFUSED))
+		assert.ErrorIs(t, err, ErrNoDaemon)
+	})
+}
+
+func TestFindSocketErrors(t *testing.T) {
+	missing := "unix://" + filepath.Join(t.TempDir(), "docker.sock")
+	stale := "unix://" + staleSocket(t)
+
+	t.Run("reports the most specific failure", func(t *testing.T) {
+		_, err := findSocket(false, nil, missing, stale)
+		var daemonErr *DaemonError
+		require.True(t, errors.As(err, &daemonErr))
+		assert.ErrorIs(t, err, ErrNoDaemon)
+		assert.Equal(t, stale, daemonErr.Host)
+	})
+
+	t.Run("takes earlier failures into account", func(t *testing.T) {
+		denied := &DaemonError{Host: "unix:///var/run/docker.sock", Kind: ErrPermission}
+		_, err := findSocket(false, []*DaemonError{denied}, missing, stale)
+		assert.ErrorIs(t, err, ErrPermission)
+	})
+
+	t.Run("no socket at all", func(t *testing.T) {
+		_, err := findSocket(false, nil, missing)
+		assert.ErrorIs(t, err, ErrNoSocket)
+	})
+}
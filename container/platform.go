@@ -0,0 +1,78 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bernd/vibepit/tui"
+)
+
+// PlatformError reports that an image is not published for the platform the
+// container daemon runs on. Pulling such an image fails with a cryptic
+// "no matching manifest" error, so callers get this instead.
+type PlatformError struct {
+	Ref      string
+	Platform string
+}
+
+func (e *PlatformError) Error() string {
+	if e.Platform == "" {
+		return fmt.Sprintf("image %s isn't published for your daemon's platform", e.Ref)
+	}
+	return fmt.Sprintf("image %s isn't published for %s", e.Ref, e.Platform)
+}
+
+// DaemonPlatform returns the "os/arch" platform of the container daemon
+// (e.g. "linux/amd64"), using Go architecture names.
+func (c *Client) DaemonPlatform(ctx context.Context) (string, error) {
+	info, err := c.docker.Info(ctx)
+	if err != nil {
+		return "", fmt.Errorf("daemon info: %w", err)
+	}
+	return info.OSType + "/" + normalizeArch(info.Architecture), nil
+}
+
+// CheckPlatform returns a *PlatformError if the daemon's platform is not one
+// of the supported platforms. If the daemon can't report its platform, the
+// check is skipped and the pull gets to decide.
+func (c *Client) CheckPlatform(ctx context.Context, ref string, supported []string) error {
+	platform, err := c.DaemonPlatform(ctx)
+	if err != nil {
+		if c.debug {
+			tui.Debug("Skipping platform check: %v", err)
+		}
+		return nil
+	}
+	if c.debug {
+		tui.Debug("Container daemon platform: %s", platform)
+	}
+	if !slices.Contains(supported, platform) {
+		return &PlatformError{Ref: ref, Platform: platform}
+	}
+	return nil
+}
+
+// normalizeArch maps the uname-style architecture reported by the daemon to
+// the Go/OCI name used in image manifests.
+func normalizeArch(arch string) string {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "armv7l", "armhf":
+		return "arm"
+	case "i386", "i686":
+		return "386"
+	default:
+		return arch
+	}
+}
+
+// isNoMatchingManifest reports whether a pull error means the image has no
+// manifest for the requested platform.
+func isNoMatchingManifest(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no matching manifest")
+}
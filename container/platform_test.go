@@ -0,0 +1,39 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeArch(t *testing.T) {
+	tests := map[string]string{
+		"x86_64":  "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"armv7l":  "arm",
+		"s390x":   "s390x",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, normalizeArch(in), "normalizeArch(%q)", in)
+	}
+}
+
+func TestIsNoMatchingManifest(t *testing.T) {
+	err := errors.New("no matching manifest for linux/amd64 in the manifest list entries")
+	assert.True(t, isNoMatchingManifest(err))
+	assert.True(t, isNoMatchingManifest(fmt.Errorf("pull: %w", err)))
+	assert.False(t, isNoMatchingManifest(errors.New("manifest unknown")))
+	assert.False(t, isNoMatchingManifest(nil))
+}
+
+func TestPlatformError(t *testing.T) {
+	err := fmt.Errorf("pull image x: %w", &PlatformError{Ref: "img:tag", Platform: "linux/386"})
+
+	pe, ok := errors.AsType[*PlatformError](err)
+	assert.True(t, ok)
+	assert.Equal(t, "linux/386", pe.Platform)
+	assert.Contains(t, err.Error(), "isn't published for linux/386")
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerStats is a resource usage sample of a running container.
+type ContainerStats struct {
+	// CPUPercent is the CPU usage since the previous sample, where 100%
+	// is one fully used core.
+	CPUPercent float64
+	// MemoryUsage excludes the page cache, like docker stats does.
+	MemoryUsage uint64
+	// MemoryLimit is the container's memory limit, or the host memory
+	// when no limit is set.
+	MemoryLimit uint64
+}
+
+// ContainerStats samples the CPU and memory usage of a running container.
+// The daemon takes two CPU readings for the sample, so the call blocks for
+// about a second.
+func (c *Client) ContainerStats(ctx context.Context, id string) (ContainerStats, error) {
+	c.debugf("container stats %s", id)
+	resp, err := c.docker.ContainerStats(ctx, id, false)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("container stats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var s container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return ContainerStats{}, fmt.Errorf("decode container stats: %w", err)
+	}
+	return statsFromResponse(s), nil
+}
+
+// statsFromResponse computes the usage from a stats response the same way
+// the docker CLI does.
+func statsFromResponse(s container.StatsResponse) ContainerStats {
+	var cpuPercent float64
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpuPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// The page cache can be reclaimed, so it doesn't count as usage. The
+	// key is inactive_file on cgroup v2 and total_inactive_file on v1.
+	usage := s.MemoryStats.Usage
+	cache, ok := s.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		cache = s.MemoryStats.Stats["total_inactive_file"]
+	}
+	if cache < usage {
+		usage -= cache
+	}
+
+	return ContainerStats{
+		CPUPercent:  cpuPercent,
+		MemoryUsage: usage,
+		MemoryLimit: s.MemoryStats.Limit,
+	}
+}
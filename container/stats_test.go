@@ -0,0 +1,46 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsFromResponse(t *testing.T) {
+	t.Run("cgroup v2", func(t *testing.T) {
+		var s container.StatsResponse
+		s.CPUStats.CPUUsage.TotalUsage = 3_000_000
+		s.CPUStats.SystemUsage = 20_000_000
+		s.CPUStats.OnlineCPUs = 4
+		s.PreCPUStats.CPUUsage.TotalUsage = 1_000_000
+		s.PreCPUStats.SystemUsage = 10_000_000
+		s.MemoryStats.Usage = 600
+		s.MemoryStats.Limit = 2000
+		s.MemoryStats.Stats = map[string]uint64{"inactive_file": 100}
+
+		assert.Equal(t, ContainerStats{CPUPercent: 80, MemoryUsage: 500, MemoryLimit: 2000}, statsFromResponse(s))
+	})
+
+	t.Run("cgroup v1 counts CPUs from per-CPU usage", func(t *testing.T) {
+		var s container.StatsResponse
+		s.CPUStats.CPUUsage.TotalUsage = 2_000_000
+		s.CPUStats.CPUUsage.PercpuUsage = []uint64{1_000_000, 1_000_000}
+		s.CPUStats.SystemUsage = 10_000_000
+		s.MemoryStats.Usage = 600
+		s.MemoryStats.Stats = map[string]uint64{"total_inactive_file": 200}
+
+		assert.Equal(t, ContainerStats{CPUPercent: 40, MemoryUsage: 400}, statsFromResponse(s))
+	})
+
+	t.Run("first sample without previous reading", func(t *testing.T) {
+		var s container.StatsResponse
+		s.CPUStats.CPUUsage.TotalUsage = 2_000_000
+		s.CPUStats.SystemUsage = 10_000_000
+		s.CPUStats.OnlineCPUs = 2
+		s.PreCPUStats.CPUUsage.TotalUsage = 2_000_000
+		s.PreCPUStats.SystemUsage = 10_000_000
+
+		assert.Zero(t, statsFromResponse(s).CPUPercent)
+	})
+}
@@ -1,8 +1,11 @@
 package proxy
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 
@@ -10,6 +13,11 @@ import (
 	"github.com/bernd/vibepit/config"
 )
 
+// EnvProxyCacheDir overrides the directory the embedded proxy binary is
+// extracted to. Useful when the default cache location is read-only or
+// lives on a volume that doesn't allow executables.
+const EnvProxyCacheDir = "VIBEPIT_PROXY_CACHE_DIR"
+
 // ProxyBinary returns the embedded Linux proxy binary, if present.
 func ProxyBinary() ([]byte, bool) {
 	data, err := proxyFS.ReadFile("vibepit")
@@ -20,14 +28,28 @@ func ProxyBinary() ([]byte, bool) {
 }
 
 // CachedProxyBinary extracts the embedded binary to a cache directory and
-// returns the path. Subsequent calls reuse the cached file if the content
-// hash matches.
+// returns the path. Subsequent calls reuse the cached file if its content
+// hash matches the embedded binary, and re-extract it otherwise.
 func CachedProxyBinary() (string, error) {
 	data, ok := ProxyBinary()
 	if !ok {
 		return "", fmt.Errorf("no embedded Linux binary found")
 	}
 
+	dir, err := proxyCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return cachedBinary(data, dir)
+}
+
+// proxyCacheDir returns the directory for the extracted proxy binary,
+// honoring EnvProxyCacheDir before falling back to the XDG cache dir.
+func proxyCacheDir() (string, error) {
+	if dir := os.Getenv(EnvProxyCacheDir); dir != "" {
+		return dir, nil
+	}
+
 	cacheDir := xdg.CacheHome
 	if cacheDir == "" {
 		userCacheDir, err := os.UserCacheDir()
@@ -36,29 +58,56 @@ func CachedProxyBinary() (string, error) {
 		}
 		cacheDir = userCacheDir
 	}
-
-	return cachedBinary(data, filepath.Join(cacheDir, config.CacheDirName, "bin"))
+	return filepath.Join(cacheDir, config.CacheDirName, "bin"), nil
 }
 
 // cachedBinary writes data to dir/<name> where name is derived from a content
-// hash. Returns the path to the cached file, reusing an existing one if
-// present.
+// hash. Returns the path to the cached file, reusing an existing one if its
+// checksum matches. A corrupted or truncated file is replaced.
 func cachedBinary(data []byte, dir string) (string, error) {
 	hash := sha256.Sum256(data)
 	name := fmt.Sprintf("vibepit-%x", hash[:6])
 	path := filepath.Join(dir, name)
 
-	if _, err := os.Stat(path); err == nil {
-		return path, nil
+	if existing, err := os.ReadFile(path); err == nil {
+		if sum := sha256.Sum256(existing); bytes.Equal(sum[:], hash[:]) {
+			return path, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("read cached binary: %w", err)
 	}
 
 	if err := os.MkdirAll(dir, 0o750); err != nil {
-		return "", fmt.Errorf("create cache dir: %w", err)
+		return "", cacheDirError(dir, err)
 	}
 
-	if err := os.WriteFile(path, data, 0o555); err != nil {
+	// Write to a temp file and rename so a concurrent or interrupted
+	// extraction never leaves a partially written binary at path.
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return "", cacheDirError(dir, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
 		return "", fmt.Errorf("write cached binary: %w", err)
 	}
+	if err := tmp.Chmod(0o555); err != nil {
+		tmp.Close() //nolint:errcheck
+		return "", fmt.Errorf("chmod cached binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("write cached binary: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("install cached binary: %w", err)
+	}
 
 	return path, nil
 }
+
+func cacheDirError(dir string, err error) error {
+	return fmt.Errorf("proxy binary cache dir %s is not writable (set %s to a writable directory): %w",
+		dir, EnvProxyCacheDir, err)
+}
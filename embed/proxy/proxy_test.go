@@ -65,3 +65,48 @@ func TestCachedBinary(t *testing.T) {
 		assert.NotEqual(t, path1, path2)
 	})
 }
+
+func TestCachedBinary_ReplacesCorruptedFile(t *testing.T) {
+	data := []byte("fake-binary-content")
+	dir := filepath.Join(t.TempDir(), "vibepit")
+
+	path, err := cachedBinary(data, dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chmod(path, 0o644))
+	require.NoError(t, os.WriteFile(path, []byte("truncated"), 0o644))
+
+	path2, err := cachedBinary(data, dir)
+	require.NoError(t, err)
+	assert.Equal(t, path, path2)
+
+	got, err := os.ReadFile(path2)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temp files must not be left behind")
+}
+
+func TestCachedBinary_UnwritableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	parent := t.TempDir()
+	require.NoError(t, os.Chmod(parent, 0o555))
+	t.Cleanup(func() { os.Chmod(parent, 0o755) }) //nolint:errcheck
+
+	_, err := cachedBinary([]byte("data"), filepath.Join(parent, "vibepit"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), EnvProxyCacheDir)
+}
+
+func TestProxyCacheDir_EnvOverride(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvProxyCacheDir, dir)
+
+	got, err := proxyCacheDir()
+	require.NoError(t, err)
+	assert.Equal(t, dir, got)
+}
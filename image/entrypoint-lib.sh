@@ -54,3 +54,52 @@ init_home() {
 		date > "$HOME/.vibepit-initialized"
 	fi
 }
+
+# run_setup_commands runs the NUL-separated commands in file one after another
+# in a login shell, in the current directory. A failing command stops the run
+# and its exit code is returned, unless VIBEPIT_SETUP_IGNORE_ERRORS is set.
+#
+# Usage: run_setup_commands [file]
+#   file: setup commands written by vibepit (default: /etc/vibepit/setup-commands)
+run_setup_commands() {
+	local file="${1:-/etc/vibepit/setup-commands}"
+	local cmd rc
+
+	if [ ! -s "$file" ]; then
+		return 0
+	fi
+
+	while IFS= read -r -d '' cmd; do
+		type vp_status &>/dev/null && vp_status "Running setup: $cmd"
+		rc=0
+		bash --login -c "$cmd" </dev/null || rc=$?
+		if [ "$rc" -ne 0 ]; then
+			type vp_error &>/dev/null && vp_error "Setup command failed with exit code $rc: $cmd"
+			if [ -z "${VIBEPIT_SETUP_IGNORE_ERRORS-}" ]; then
+				return "$rc"
+			fi
+		fi
+	done <"$file"
+}
+
+# install_ca_certs writes the system CA bundle followed by the extra CA
+# certificates from the ca-certs config to bundle. SSL_CERT_FILE and the other
+# CA bundle variables of the sandbox point to it. The root filesystem is
+# read-only, so the system trust store itself can't be updated.
+#
+# Usage: install_ca_certs [extra] [system] [bundle]
+#   extra: extra certificates written by vibepit (default: /etc/vibepit/ca-certs.pem)
+#   system: system CA bundle (default: /etc/ssl/certs/ca-certificates.crt)
+#   bundle: combined bundle to write (default: /tmp/vibepit-ca-bundle.pem)
+install_ca_certs() {
+	local extra="${1:-/etc/vibepit/ca-certs.pem}"
+	local system="${2:-/etc/ssl/certs/ca-certificates.crt}"
+	local bundle="${3:-/tmp/vibepit-ca-bundle.pem}"
+
+	if [ ! -s "$extra" ]; then
+		return 0
+	fi
+
+	cat "$system" "$extra" > "$bundle.tmp"
+	mv "$bundle.tmp" "$bundle"
+}
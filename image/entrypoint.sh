@@ -12,6 +12,12 @@ migrate_linuxbrew_volume
 
 init_home
 
+# Trust the CA certificates from the ca-certs config.
+install_ca_certs
+
+# Run the project's setup-commands before the shell starts.
+run_setup_commands
+
 vp_status "Welcome to the pit!"
 vp_status ""
 
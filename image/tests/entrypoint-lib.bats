@@ -58,3 +58,48 @@ teardown() {
 	[ -d "$TEST_DIR/linuxbrew/.linuxbrew/bin" ]
 	[ "$(cat "$TEST_DIR/linuxbrew/.linuxbrew/bin/brew")" = "brew" ]
 }
+
+@test "setup commands run in order" {
+	printf '%s\0' "echo one >> '$TEST_DIR/out'" "echo two >> '$TEST_DIR/out'" > "$TEST_DIR/setup-commands"
+
+	run_setup_commands "$TEST_DIR/setup-commands"
+
+	[ "$(cat "$TEST_DIR/out")" = "$(printf 'one\ntwo')" ]
+}
+
+@test "setup commands stop at the first failure" {
+	printf '%s\0' "exit 3" "touch '$TEST_DIR/ran'" > "$TEST_DIR/setup-commands"
+
+	run run_setup_commands "$TEST_DIR/setup-commands"
+
+	[ "$status" -eq 3 ]
+	[ ! -e "$TEST_DIR/ran" ]
+}
+
+@test "setup command failures are ignored when configured" {
+	printf '%s\0' "exit 3" "touch '$TEST_DIR/ran'" > "$TEST_DIR/setup-commands"
+
+	VIBEPIT_SETUP_IGNORE_ERRORS=1 run run_setup_commands "$TEST_DIR/setup-commands"
+
+	[ "$status" -eq 0 ]
+	[ -e "$TEST_DIR/ran" ]
+}
+
+@test "setup commands are a no-op without a commands file" {
+	run_setup_commands "$TEST_DIR/missing"
+}
+
+@test "ca certs are appended to the system bundle" {
+	echo "system" > "$TEST_DIR/system.crt"
+	echo "corporate" > "$TEST_DIR/ca-certs.pem"
+
+	install_ca_certs "$TEST_DIR/ca-certs.pem" "$TEST_DIR/system.crt" "$TEST_DIR/bundle.pem"
+
+	[ "$(cat "$TEST_DIR/bundle.pem")" = "$(printf 'system\ncorporate')" ]
+}
+
+@test "ca certs are a no-op without extra certs" {
+	install_ca_certs "$TEST_DIR/missing" "$TEST_DIR/system.crt" "$TEST_DIR/bundle.pem"
+
+	[ ! -e "$TEST_DIR/bundle.pem" ]
+}
@@ -1,7 +1,8 @@
 #!/bin/bash
 # vibed-init.sh — sandbox initialization called by vibed before accepting
-# SSH sessions. Runs the same home-directory and linuxbrew setup as
-# entrypoint.sh so the environment is ready regardless of entry path.
+# SSH sessions. Runs the same home-directory and linuxbrew setup, CA
+# certificate install, and the project's setup-commands as entrypoint.sh so
+# the environment is ready regardless of entry path.
 
 set -e
 
@@ -14,3 +15,8 @@ source /etc/vibepit/entrypoint-lib.sh
 migrate_linuxbrew_volume
 
 init_home
+
+# Trust the CA certificates from the ca-certs config.
+install_ca_certs
+
+run_setup_commands
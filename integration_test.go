@@ -60,7 +60,7 @@ func mustGetFreePort(t *testing.T) int {
 // Run with: go test -tags=integration -v -run TestProxyServerIntegration
 func TestProxyServerIntegration(t *testing.T) {
 	// Generate ephemeral mTLS credentials for the control API.
-	creds, err := proxy.GenerateMTLSCredentials(10 * time.Minute)
+	creds, err := proxy.GenerateMTLSCredentials(proxy.MTLSOptions{Lifetime: 10 * time.Minute})
 	require.NoError(t, err, "GenerateMTLSCredentials")
 
 	// Set the env vars required by LoadServerTLSConfigFromEnv.
@@ -75,7 +75,7 @@ func TestProxyServerIntegration(t *testing.T) {
 	cfg := proxy.ProxyConfig{
 		AllowHTTP:      []string{"httpbin.org:443", "example.com:443"},
 		AllowDNS:       []string{"dns-only.example.com"},
-		UpstreamDNS:    "8.8.8.8:53",
+		UpstreamDNS:    []string{"8.8.8.8:53"},
 		ProxyPort:      proxyPort,
 		ControlAPIPort: controlPort,
 		DNSPort:        dnsPort,
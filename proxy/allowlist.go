@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 )
@@ -10,12 +12,20 @@ import (
 type domainPattern struct {
 	labels        []string // split by ".", lowercased
 	doubleStarIdx int      // index of "**" label, or -1 if none
+	includeApex   bool     // leading "." form, also matches labels[1:]
 }
 
+// parseDomainPattern parses a validated domain pattern. A leading "." as in
+// ".example.com" is parsed like "**.example.com" that also matches the apex
+// "example.com".
 func parseDomainPattern(pattern string) domainPattern {
 	if pattern == "" {
 		return domainPattern{doubleStarIdx: -1}
 	}
+	includeApex := strings.HasPrefix(pattern, ".")
+	if includeApex {
+		pattern = "**" + pattern
+	}
 	labels := strings.Split(strings.ToLower(pattern), ".")
 	idx := -1
 	for i, l := range labels {
@@ -24,7 +34,7 @@ func parseDomainPattern(pattern string) domainPattern {
 			break
 		}
 	}
-	return domainPattern{labels: labels, doubleStarIdx: idx}
+	return domainPattern{labels: labels, doubleStarIdx: idx, includeApex: includeApex}
 }
 
 func (p domainPattern) matches(host string) bool {
@@ -33,6 +43,9 @@ func (p domainPattern) matches(host string) bool {
 	}
 	hostLabels := strings.Split(strings.ToLower(host), ".")
 
+	if p.includeApex && slices.Equal(p.labels[1:], hostLabels) {
+		return true
+	}
 	if p.doubleStarIdx >= 0 {
 		prefix := p.labels[:p.doubleStarIdx]
 		suffix := p.labels[p.doubleStarIdx+1:]
@@ -83,6 +96,18 @@ func portMatches(pattern, port string) bool {
 type HTTPRule struct {
 	Domain domainPattern
 	Port   string
+	// PortMin and PortMax hold the inclusive bounds of a "min-max" port
+	// range. Both are 0 for an exact port or '*'.
+	PortMin, PortMax int
+	entry            string // original allow-http entry
+}
+
+func (r HTTPRule) portMatches(port string) bool {
+	if r.PortMax > 0 {
+		n, err := strconv.Atoi(port)
+		return err == nil && n >= r.PortMin && n <= r.PortMax
+	}
+	return portMatches(r.Port, port)
 }
 
 // HTTPAllowlist holds parsed HTTP allow rules. Safe for concurrent use.
@@ -126,33 +151,99 @@ func (al *HTTPAllowlist) Add(entries []string) error {
 	}
 }
 
+// Replace parses entries and swaps them in for all current rules at once.
+// On a validation error the allowlist is left unchanged.
+func (al *HTTPAllowlist) Replace(entries []string) error {
+	if err := ValidateHTTPEntries(entries); err != nil {
+		return err
+	}
+	rules := make([]HTTPRule, 0, len(entries))
+	for _, entry := range entries {
+		rules = append(rules, parseHTTPRule(entry))
+	}
+	al.rules.Store(&rules)
+	return nil
+}
+
+// Remove atomically drops the rules for the given entries and returns the
+// entries that were removed. Entries not in the allowlist are ignored.
+func (al *HTTPAllowlist) Remove(entries []string) []string {
+	for {
+		current := al.rules.Load()
+		kept := make([]HTTPRule, 0, len(*current))
+		var removed []string
+		for _, r := range *current {
+			if slices.Contains(entries, r.entry) {
+				if !slices.Contains(removed, r.entry) {
+					removed = append(removed, r.entry)
+				}
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		if al.rules.CompareAndSwap(current, &kept) {
+			return removed
+		}
+	}
+}
+
 func parseHTTPRule(entry string) HTTPRule {
-	var r HTTPRule
+	r := HTTPRule{entry: entry}
 	if idx := strings.LastIndex(entry, ":"); idx > 0 {
 		r.Port = entry[idx+1:]
 		entry = entry[:idx]
 	}
+	r.PortMin, r.PortMax, _ = parsePortRange(r.Port)
 	r.Domain = parseDomainPattern(entry)
 	return r
 }
 
+// Entries returns the allow-http entries currently in effect, including
+// entries added at runtime.
+func (al *HTTPAllowlist) Entries() []string {
+	rules := *al.rules.Load()
+	entries := make([]string, 0, len(rules))
+	for _, r := range rules {
+		entries = append(entries, r.entry)
+	}
+	return entries
+}
+
 // Allows checks whether a host:port pair is permitted.
 func (al *HTTPAllowlist) Allows(host, port string) bool {
+	_, ok := al.Match(host, port)
+	return ok
+}
+
+// Match returns the first allow-http entry that permits the host:port pair.
+func (al *HTTPAllowlist) Match(host, port string) (string, bool) {
 	if host == "" {
-		return false
+		return "", false
 	}
 	rules := *al.rules.Load()
 	for _, r := range rules {
-		if portMatches(r.Port, port) && r.Domain.matches(host) {
-			return true
+		if r.portMatches(port) && r.Domain.matches(host) {
+			return r.entry, true
 		}
 	}
-	return false
+	return "", false
+}
+
+// MatchEntry returns the first rule that matches the domain and port of an
+// allow-http entry as written, e.g. the deny-http rule that blocks it. A
+// wildcard entry only matches rules with a wildcard in the same place.
+func (al *HTTPAllowlist) MatchEntry(entry string) (string, bool) {
+	r := parseHTTPRule(entry)
+	return al.Match(strings.TrimSuffix(entry, ":"+r.Port), r.Port)
 }
 
 // DNSRule represents a parsed allow-dns entry with a domain pattern.
 type DNSRule struct {
 	Domain domainPattern
+	entry  string // original allow-dns entry
 }
 
 // DNSAllowlist holds parsed DNS allow rules. Safe for concurrent use.
@@ -195,29 +286,96 @@ func (al *DNSAllowlist) Add(entries []string) error {
 	}
 }
 
+// Replace parses entries and swaps them in for all current rules at once.
+// On a validation error the allowlist is left unchanged.
+func (al *DNSAllowlist) Replace(entries []string) error {
+	if err := ValidateDNSEntries(entries); err != nil {
+		return err
+	}
+	rules := make([]DNSRule, 0, len(entries))
+	for _, entry := range entries {
+		rules = append(rules, parseDNSRule(entry))
+	}
+	al.rules.Store(&rules)
+	return nil
+}
+
+// Remove atomically drops the rules for the given entries and returns the
+// entries that were removed. Entries not in the allowlist are ignored.
+func (al *DNSAllowlist) Remove(entries []string) []string {
+	for {
+		current := al.rules.Load()
+		kept := make([]DNSRule, 0, len(*current))
+		var removed []string
+		for _, r := range *current {
+			if slices.Contains(entries, r.entry) {
+				if !slices.Contains(removed, r.entry) {
+					removed = append(removed, r.entry)
+				}
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		if al.rules.CompareAndSwap(current, &kept) {
+			return removed
+		}
+	}
+}
+
 func parseDNSRule(entry string) DNSRule {
-	return DNSRule{Domain: parseDomainPattern(entry)}
+	return DNSRule{Domain: parseDomainPattern(entry), entry: entry}
+}
+
+// Entries returns the allow-dns entries currently in effect, including
+// entries added at runtime.
+func (al *DNSAllowlist) Entries() []string {
+	rules := *al.rules.Load()
+	entries := make([]string, 0, len(rules))
+	for _, r := range rules {
+		entries = append(entries, r.entry)
+	}
+	return entries
 }
 
 // Allows checks whether a domain is permitted for DNS resolution.
 func (al *DNSAllowlist) Allows(host string) bool {
+	_, ok := al.Match(host)
+	return ok
+}
+
+// Match returns the first allow-dns entry that permits the domain.
+func (al *DNSAllowlist) Match(host string) (string, bool) {
 	if host == "" {
-		return false
+		return "", false
 	}
 	rules := *al.rules.Load()
 	for _, r := range rules {
 		if r.Domain.matches(host) {
-			return true
+			return r.entry, true
 		}
 	}
-	return false
+	return "", false
 }
 
-// validateDomainPattern validates a domain pattern string.
+// validateDomainPattern validates a domain pattern string. A leading "."
+// matches the domain and all its subdomains and cannot be combined with
+// wildcards.
 func validateDomainPattern(domain string) error {
 	if domain == "" {
 		return fmt.Errorf("domain must not be empty")
 	}
+	if rest, ok := strings.CutPrefix(domain, "."); ok {
+		if rest == "" {
+			return fmt.Errorf("bare \".\" domain is too broad")
+		}
+		if strings.Contains(rest, "*") {
+			return fmt.Errorf("leading '.' must not be combined with '*'")
+		}
+		domain = rest
+	}
 	labels := strings.Split(domain, ".")
 	doubleStarCount := 0
 	for _, label := range labels {
@@ -244,6 +402,73 @@ func validateDomainPattern(domain string) error {
 	return nil
 }
 
+// NormalizeHTTPEntries normalizes all entries with NormalizeHTTPEntry and
+// returns the first error.
+func NormalizeHTTPEntries(entries []string) ([]string, error) {
+	if entries == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		n, err := NormalizeHTTPEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// NormalizeDenyHTTPEntries normalizes deny-http entries like
+// NormalizeHTTPEntries, except that a bare domain denies every port, so
+// "pastebin.com" becomes "pastebin.com:*". A scheme still implies its port.
+func NormalizeDenyHTTPEntries(entries []string) ([]string, error) {
+	if entries == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != "" && !strings.Contains(entry, ":") {
+			entry += ":*"
+		}
+		n, err := NormalizeHTTPEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// NormalizeHTTPEntry expands allow-http shorthands into the canonical
+// "domain:port" form and validates the result. A bare domain or
+// "https://domain" implies port 443 and "http://domain" implies port 80. An
+// explicit port always wins over the scheme default.
+func NormalizeHTTPEntry(entry string) (string, error) {
+	hostPort, defaultPort := entry, "443"
+	if scheme, rest, ok := strings.Cut(entry, "://"); ok {
+		switch strings.ToLower(scheme) {
+		case "https":
+			defaultPort = "443"
+		case "http":
+			defaultPort = "80"
+		default:
+			return "", fmt.Errorf("invalid allow entry %q: unsupported scheme %q, use http or https", entry, scheme)
+		}
+		hostPort = strings.TrimSuffix(rest, "/")
+		if strings.Contains(hostPort, "/") {
+			return "", fmt.Errorf("invalid allow entry %q: paths are not supported", entry)
+		}
+	}
+	if hostPort != "" && !strings.Contains(hostPort, ":") {
+		hostPort += ":" + defaultPort
+	}
+	if err := ValidateHTTPEntry(hostPort); err != nil {
+		return "", err
+	}
+	return hostPort, nil
+}
+
 // ValidateHTTPEntries validates all entries and returns the first error.
 func ValidateHTTPEntries(entries []string) error {
 	for _, entry := range entries {
@@ -255,7 +480,8 @@ func ValidateHTTPEntries(entries []string) error {
 }
 
 // ValidateHTTPEntry validates a single allow-http entry.
-// Entry format is "domain:port" where port is an exact number or '*'.
+// Entry format is "domain:port" where port is an exact number, an inclusive
+// range like "8000-8100", or '*'.
 func ValidateHTTPEntry(entry string) error {
 	if entry == "" {
 		return fmt.Errorf("invalid allow entry: empty string")
@@ -275,16 +501,51 @@ func ValidateHTTPEntry(entry string) error {
 	if err := validateDomainPattern(domain); err != nil {
 		return fmt.Errorf("invalid allow entry %q: %w", entry, err)
 	}
-	if port != "*" {
-		for _, ch := range port {
-			if ch < '0' || ch > '9' {
-				return fmt.Errorf("invalid allow entry %q: port must be a number or '*'", entry)
-			}
+	if strings.Contains(port, "-") {
+		if _, _, err := parsePortRange(port); err != nil {
+			return fmt.Errorf("invalid allow entry %q: %w", entry, err)
 		}
+		return nil
+	}
+	if port != "*" && !isDigits(port) {
+		return fmt.Errorf("invalid allow entry %q: port must be a number, a range like 8000-8100, or '*'", entry)
 	}
 	return nil
 }
 
+// parsePortRange parses a "min-max" port range. It returns zeros without
+// an error for anything that isn't a range.
+func parsePortRange(port string) (int, int, error) {
+	lo, hi, ok := strings.Cut(port, "-")
+	if !ok {
+		return 0, 0, nil
+	}
+	if !isDigits(lo) || !isDigits(hi) {
+		return 0, 0, fmt.Errorf("port range %q must be two numbers like 8000-8100", port)
+	}
+	first, errLo := strconv.Atoi(lo)
+	last, errHi := strconv.Atoi(hi)
+	if errLo != nil || errHi != nil || first < 1 || last > 65535 {
+		return 0, 0, fmt.Errorf("port range %q must be within 1-65535", port)
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("port range %q starts after it ends", port)
+	}
+	return first, last, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // ValidateDNSEntries validates all allow-dns entries and returns the first error.
 func ValidateDNSEntries(entries []string) error {
 	for _, entry := range entries {
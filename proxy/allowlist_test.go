@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -89,6 +91,16 @@ func TestHTTPAllowlist(t *testing.T) {
 		assert.False(t, isolated.Allows("bedrock.a.b.amazonaws.com", "443"), "too many labels")
 		assert.False(t, isolated.Allows("bedrock.amazonaws.com", "443"), "too few labels")
 	})
+
+	t.Run("leading dot matches apex and subdomains", func(t *testing.T) {
+		al, err := NewHTTPAllowlist([]string{".example.com:443"})
+		require.NoError(t, err)
+		assert.True(t, al.Allows("example.com", "443"))
+		assert.True(t, al.Allows("api.example.com", "443"))
+		assert.True(t, al.Allows("a.b.example.com", "443"))
+		assert.False(t, al.Allows("example.com", "80"))
+		assert.False(t, al.Allows("notexample.com", "443"))
+	})
 }
 
 func TestHTTPAllowlistAdd(t *testing.T) {
@@ -107,6 +119,148 @@ func TestHTTPAllowlistAdd(t *testing.T) {
 	assert.True(t, al.Allows("github.com", "443"), "original entries should still work")
 }
 
+func TestAllowlistReplace(t *testing.T) {
+	t.Run("http", func(t *testing.T) {
+		al, err := NewHTTPAllowlist([]string{"github.com:443"})
+		require.NoError(t, err)
+
+		require.NoError(t, al.Replace([]string{"bun.sh:443"}))
+		assert.Equal(t, []string{"bun.sh:443"}, al.Entries())
+		assert.False(t, al.Allows("github.com", "443"))
+
+		assert.Error(t, al.Replace([]string{"esm.sh:443", "github.com"}))
+		assert.Equal(t, []string{"bun.sh:443"}, al.Entries(), "invalid entries must not change the allowlist")
+	})
+
+	t.Run("dns", func(t *testing.T) {
+		al, err := NewDNSAllowlist([]string{"github.com"})
+		require.NoError(t, err)
+
+		require.NoError(t, al.Replace([]string{"*.svc.local"}))
+		assert.Equal(t, []string{"*.svc.local"}, al.Entries())
+		assert.False(t, al.Allows("github.com"))
+
+		assert.Error(t, al.Replace([]string{"github.com:443"}))
+		assert.Equal(t, []string{"*.svc.local"}, al.Entries())
+	})
+}
+
+func TestHTTPAllowlistPortRange(t *testing.T) {
+	al, err := NewHTTPAllowlist([]string{"localhost:8000-8100", "github.com:443"})
+	require.NoError(t, err)
+
+	assert.True(t, al.Allows("localhost", "8000"), "range start is inclusive")
+	assert.True(t, al.Allows("localhost", "8042"))
+	assert.True(t, al.Allows("localhost", "8100"), "range end is inclusive")
+	assert.False(t, al.Allows("localhost", "7999"))
+	assert.False(t, al.Allows("localhost", "8101"))
+	assert.False(t, al.Allows("localhost", ""))
+	assert.False(t, al.Allows("localhost", "8000-8100"), "the range itself is not a port")
+	assert.False(t, al.Allows("example.com", "8042"))
+	assert.True(t, al.Allows("github.com", "443"))
+
+	entry, ok := al.Match("localhost", "8080")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:8000-8100", entry)
+}
+
+func TestPortRangeErrors(t *testing.T) {
+	tests := []struct {
+		entry string
+		err   string
+	}{
+		{"github.com:8100-8000", `port range "8100-8000" starts after it ends`},
+		{"github.com:-", `port range "-" must be two numbers like 8000-8100`},
+		{"github.com:0-80", `port range "0-80" must be within 1-65535`},
+		{"github.com:44a", "port must be a number, a range like 8000-8100, or '*'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			assert.ErrorContains(t, ValidateHTTPEntry(tt.entry), tt.err)
+		})
+	}
+}
+
+func TestHTTPAllowlistRemove(t *testing.T) {
+	al, err := NewHTTPAllowlist([]string{"github.com:443", "bun.sh:443", "*.npmjs.org:*"})
+	require.NoError(t, err)
+
+	removed := al.Remove([]string{"bun.sh:443", "*.npmjs.org:*", "unknown.com:443"})
+	assert.Equal(t, []string{"bun.sh:443", "*.npmjs.org:*"}, removed)
+	assert.Equal(t, []string{"github.com:443"}, al.Entries())
+	assert.False(t, al.Allows("bun.sh", "443"))
+	assert.False(t, al.Allows("registry.npmjs.org", "443"))
+	assert.True(t, al.Allows("github.com", "443"))
+
+	assert.Nil(t, al.Remove([]string{"bun.sh:443"}), "removing a missing entry is a no-op")
+	assert.Equal(t, []string{"github.com:443"}, al.Entries())
+}
+
+func TestHTTPAllowlistRemoveConcurrent(t *testing.T) {
+	al, err := NewHTTPAllowlist([]string{"github.com:443"})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		entry := fmt.Sprintf("host%d.example.com:443", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, al.Add([]string{entry}))
+			al.Remove([]string{entry})
+		}()
+		go func() {
+			defer wg.Done()
+			assert.True(t, al.Allows("github.com", "443"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"github.com:443"}, al.Entries())
+}
+
+func TestHTTPAllowlistMatch(t *testing.T) {
+	al, err := NewHTTPAllowlist([]string{"github.com:443", "*.npmjs.org:*", ".example.com:443"})
+	require.NoError(t, err)
+
+	entry, ok := al.Match("registry.npmjs.org", "443")
+	assert.True(t, ok)
+	assert.Equal(t, "*.npmjs.org:*", entry)
+
+	entry, ok = al.Match("example.com", "443")
+	assert.True(t, ok)
+	assert.Equal(t, ".example.com:443", entry)
+
+	entry, ok = al.Match("github.com", "80")
+	assert.False(t, ok)
+	assert.Empty(t, entry)
+}
+
+func TestHTTPAllowlistMatchEntry(t *testing.T) {
+	deny, err := NewHTTPAllowlist([]string{"pastebin.com:*", "*.evil.example:443"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		entry string
+		rule  string
+	}{
+		{"pastebin.com:443", "pastebin.com:*"},
+		{"pastebin.com:*", "pastebin.com:*"},
+		{"*.evil.example:443", "*.evil.example:443"},
+		{"a.evil.example:443", "*.evil.example:443"},
+		// Broader entries stay, the proxy blocks the denied hosts in them.
+		{"*.pastebin.com:443", ""},
+		{"a.evil.example:*", ""},
+		{"github.com:443", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			rule, ok := deny.MatchEntry(tt.entry)
+			assert.Equal(t, tt.rule != "", ok)
+			assert.Equal(t, tt.rule, rule)
+		})
+	}
+}
+
 func TestDNSAllowlist(t *testing.T) {
 	al, err := NewDNSAllowlist([]string{
 		"github.com",
@@ -147,6 +301,25 @@ func TestDNSAllowlist(t *testing.T) {
 		assert.True(t, combined.Allows("api.example.com"))
 		assert.True(t, combined.Allows("a.b.example.com"))
 	})
+
+	t.Run("leading dot matches apex and subdomains", func(t *testing.T) {
+		al, err := NewDNSAllowlist([]string{".example.com"})
+		require.NoError(t, err)
+		assert.True(t, al.Allows("example.com"))
+		assert.True(t, al.Allows("api.example.com"))
+		assert.True(t, al.Allows("a.b.example.com"))
+		assert.False(t, al.Allows("notexample.com"))
+	})
+}
+
+func TestDNSAllowlistRemove(t *testing.T) {
+	al, err := NewDNSAllowlist([]string{"github.com", "*.npmjs.org"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"*.npmjs.org"}, al.Remove([]string{"*.npmjs.org", "unknown.com"}))
+	assert.False(t, al.Allows("registry.npmjs.org"))
+	assert.True(t, al.Allows("github.com"))
+	assert.Nil(t, al.Remove([]string{"unknown.com"}))
 }
 
 func TestDomainMatches(t *testing.T) {
@@ -180,6 +353,15 @@ func TestDomainMatches(t *testing.T) {
 		{"**.example.com", "a.b.c.example.com", true},
 		{"**.example.com", "example.com", false},
 
+		// Leading dot matches the apex and all subdomains
+		{".example.com", "example.com", true},
+		{".example.com", "Example.COM", true},
+		{".example.com", "foo.example.com", true},
+		{".example.com", "a.b.example.com", true},
+		{".example.com", "notexample.com", false},
+		{".example.com", "example.com.evil.com", false},
+		{".example.com", "com", false},
+
 		// Multi-label wildcard mid-domain
 		{"bedrock.**.amazonaws.com", "bedrock.us-east-1.amazonaws.com", true},
 		{"bedrock.**.amazonaws.com", "bedrock.a.b.amazonaws.com", true},
@@ -239,6 +421,72 @@ func TestPortMatch(t *testing.T) {
 	}
 }
 
+func TestNormalizeHTTPEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"canonical entry unchanged", "github.com:443", "github.com:443"},
+		{"bare domain implies 443", "github.com", "github.com:443"},
+		{"bare wildcard implies 443", "*.example.com", "*.example.com:443"},
+		{"https implies 443", "https://github.com", "github.com:443"},
+		{"http implies 80", "http://example.com", "example.com:80"},
+		{"scheme is case-insensitive", "HTTP://example.com", "example.com:80"},
+		{"trailing slash is dropped", "https://github.com/", "github.com:443"},
+		{"explicit port wins over https", "https://example.com:8443", "example.com:8443"},
+		{"explicit port wins over http", "http://example.com:8080", "example.com:8080"},
+		{"wildcard port kept", "http://example.com:*", "example.com:*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeHTTPEntry(tt.entry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []struct {
+		name  string
+		entry string
+		err   string
+	}{
+		{"unsupported scheme", "ftp://example.com", "unsupported scheme"},
+		{"path", "https://example.com/api", "paths are not supported"},
+		{"empty", "", "empty string"},
+		{"scheme only", "https://", "empty string"},
+		{"invalid port", "https://example.com:44a", "port must be a number"},
+		{"invalid domain", "example..com", "empty label"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NormalizeHTTPEntry(tt.entry)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestNormalizeDenyHTTPEntries(t *testing.T) {
+	got, err := NormalizeDenyHTTPEntries([]string{
+		"pastebin.com",
+		"*.paste.example",
+		"upload.example.com:443",
+		"https://files.example.com",
+		"http://plain.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"pastebin.com:*",
+		"*.paste.example:*",
+		"upload.example.com:443",
+		"files.example.com:443",
+		"plain.example.com:80",
+	}, got)
+
+	_, err = NormalizeDenyHTTPEntries([]string{""})
+	assert.ErrorContains(t, err, "empty string")
+}
+
 func TestValidateHTTPEntry(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -255,6 +503,10 @@ func TestValidateHTTPEntry(t *testing.T) {
 		{"single wildcard with wildcard port", "*.example.com:*", true},
 		{"multi wildcard with wildcard port", "**.example.com:*", true},
 		{"combined * and **", "*.**.example.com:443", true},
+		{"apex and subdomains", ".example.com:443", true},
+		{"port range", "localhost:8000-8100", true},
+		{"single port range", "localhost:8080-8080", true},
+		{"wildcard domain with port range", "*.example.com:8000-8100", true},
 
 		// Invalid: port patterns
 		{"partial port glob trailing", "github.com:80*", false},
@@ -263,13 +515,22 @@ func TestValidateHTTPEntry(t *testing.T) {
 		{"non-digit port", "github.com:44a", false},
 		{"empty port", "github.com:", false},
 		{"missing port", "github.com", false},
+		{"reversed port range", "github.com:8100-8000", false},
+		{"bare dash port", "github.com:-", false},
+		{"half-open port range", "github.com:8000-", false},
+		{"port range with wildcard", "github.com:8000-*", false},
+		{"port range starting at zero", "github.com:0-80", false},
+		{"port range beyond 65535", "github.com:8000-70000", false},
+		{"three-part port range", "github.com:1-2-3", false},
 
 		// Invalid: domain label grammar
 		{"mixed wildcard label", "a*.example.com:443", false},
 		{"mixed wildcard label suffix", "*foo.example.com:443", false},
 		{"triple star label", "***.example.com:443", false},
 		{"mixed double star label", "foo**.example.com:443", false},
-		{"empty label leading dot", ".example.com:443", false},
+		{"double leading dot", "..example.com:443", false},
+		{"leading dot with wildcard", ".*.example.com:443", false},
+		{"bare leading dot", ".:443", false},
 		{"empty label double dot", "foo..example.com:443", false},
 		{"empty label trailing dot", "example.com.:443", false},
 
@@ -307,6 +568,7 @@ func TestValidateDNSEntry(t *testing.T) {
 		{"multi-label wildcard", "**.example.com", true},
 		{"mid-domain wildcard", "bedrock.*.amazonaws.com", true},
 		{"combined * and **", "*.**.example.com", true},
+		{"apex and subdomains", ".example.com", true},
 
 		// Invalid patterns
 		{"empty string", "", false},
@@ -316,7 +578,8 @@ func TestValidateDNSEntry(t *testing.T) {
 		{"bare double wildcard", "**", false},
 		{"two double wildcards", "**.**.example.com", false},
 		{"mixed label", "a*.example.com", false},
-		{"empty label", ".example.com", false},
+		{"empty label", "..example.com", false},
+		{"leading dot with wildcard", ".**.example.com", false},
 		{"empty label double dot", "foo..example.com", false},
 	}
 
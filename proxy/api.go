@@ -2,35 +2,70 @@ package proxy
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"runtime/debug"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // ControlAPI serves proxy status and configuration over HTTP.
 type ControlAPI struct {
 	mux           *http.ServeMux
 	log           *LogBuffer
-	config        any
+	config        ProxyConfig
 	httpAllowlist *HTTPAllowlist
 	dnsAllowlist  *DNSAllowlist
+
+	// configHash is the PolicyHash of the config the proxy was started
+	// with, or last reloaded. GET /config returns it so clients can detect
+	// config drift.
+	configHash string
+
+	// denyHTTP and denyDNS hold the deny rules. Entries they match are
+	// refused by the allow handlers.
+	denyHTTP *HTTPAllowlist
+	denyDNS  *DNSAllowlist
+
+	// removed holds the entries removed at runtime, so GET /config can
+	// leave them out of the startup config. Re-adding an entry clears it.
+	// mu also guards config and configHash, which POST /reload replaces.
+	mu      sync.Mutex
+	removed map[string]bool
+
+	// changeMu serializes the handlers that change the allowlists, so a
+	// reload doesn't drop entries allowed or removed at the same time.
+	changeMu sync.Mutex
 }
 
+// NewControlAPI creates the control API. config is a ProxyConfig or any value
+// with the same JSON form, such as the CLI's merged config.
 func NewControlAPI(log *LogBuffer, config any, httpAllowlist *HTTPAllowlist, dnsAllowlist *DNSAllowlist) *ControlAPI {
+	// A value that doesn't fit only loses the startup config of GET /config;
+	// the allowlists are passed separately.
+	cfg, _ := toProxyConfig(config)
 	api := &ControlAPI{
 		mux:           http.NewServeMux(),
 		log:           log,
-		config:        config,
+		config:        cfg,
 		httpAllowlist: httpAllowlist,
 		dnsAllowlist:  dnsAllowlist,
+		removed:       make(map[string]bool),
 	}
 	api.mux.HandleFunc("GET /logs", api.handleLogs)
+	api.mux.HandleFunc("GET /logs/stream", api.handleLogStream)
 	api.mux.HandleFunc("GET /stats", api.handleStats)
 	api.mux.HandleFunc("GET /config", api.handleConfig)
 	api.mux.HandleFunc("POST /allow-http", api.handleAllowHTTP)
 	api.mux.HandleFunc("POST /allow-dns", api.handleAllowDNS)
+	api.mux.HandleFunc("DELETE /allow-http", api.handleRemoveHTTP)
+	api.mux.HandleFunc("DELETE /allow-dns", api.handleRemoveDNS)
+	api.mux.HandleFunc("POST /reload", api.handleReload)
 	return api
 }
 
@@ -66,6 +101,12 @@ func (rw *responseState) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+// and change deadlines.
+func (rw *responseState) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (a *ControlAPI) handleLogs(w http.ResponseWriter, r *http.Request) {
 	var afterID uint64
 	if r.URL != nil {
@@ -76,12 +117,149 @@ func (a *ControlAPI) handleLogs(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, a.log.EntriesAfter(afterID))
 }
 
+// logStreamBuffer is the number of entries a /logs/stream client may fall
+// behind before it is disconnected.
+const logStreamBuffer = 256
+
+// handleLogStream writes log entries as JSON lines while they are added,
+// until the client disconnects or falls too far behind. With an "after"
+// query parameter, the buffered entries after that ID are sent first.
+func (a *ControlAPI) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	entries, cancel := a.log.Subscribe(logStreamBuffer)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	var lastID uint64
+	if s := r.URL.Query().Get("after"); s != "" {
+		afterID, _ := strconv.ParseUint(s, 10, 64)
+		for _, e := range a.log.EntriesAfter(afterID) {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			lastID = e.ID
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-entries:
+			if !ok {
+				return
+			}
+			// Entries added between Subscribe and EntriesAfter were sent
+			// already.
+			if e.ID <= lastID {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (a *ControlAPI) handleStats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, a.log.Stats())
 }
 
+// configResponse is the body of GET /config.
+type configResponse struct {
+	ProxyConfig
+	ConfigHash string `json:"config-hash,omitempty"`
+}
+
+// handleConfig serves the startup config with the live allowlists merged
+// into allow-http and allow-dns, so entries added at runtime show up and
+// entries removed at runtime don't. The
+// entry sources are left out unless the request asks for them with
+// ?sources=true; entries added at runtime then have the source "runtime".
 func (a *ControlAPI) handleConfig(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, a.config)
+	a.mu.Lock()
+	resp := configResponse{ProxyConfig: a.config, ConfigHash: a.configHash}
+	a.mu.Unlock()
+
+	if r.URL.Query().Get("sources") == "true" {
+		resp.EntrySources = a.entrySources(resp.ProxyConfig)
+	} else {
+		resp.EntrySources = nil
+	}
+	if a.httpAllowlist != nil {
+		resp.AllowHTTP = a.withoutRemoved(mergeEntries(resp.AllowHTTP, a.httpAllowlist.Entries()))
+	}
+	if a.dnsAllowlist != nil {
+		resp.AllowDNS = a.withoutRemoved(mergeEntries(resp.AllowDNS, a.dnsAllowlist.Entries()))
+	}
+	writeJSON(w, resp)
+}
+
+// entrySources returns the entry sources of cfg plus EntrySourceRuntime for
+// the live allowlist entries cfg doesn't list.
+func (a *ControlAPI) entrySources(cfg ProxyConfig) map[string]string {
+	sources := maps.Clone(cfg.EntrySources)
+	if sources == nil {
+		sources = make(map[string]string)
+	}
+	var live []string
+	if a.httpAllowlist != nil {
+		live = append(live, a.httpAllowlist.Entries()...)
+	}
+	if a.dnsAllowlist != nil {
+		live = append(live, a.dnsAllowlist.Entries()...)
+	}
+	for _, e := range live {
+		if _, ok := sources[e]; !ok && !slices.Contains(cfg.AllowHTTP, e) && !slices.Contains(cfg.AllowDNS, e) {
+			sources[e] = EntrySourceRuntime
+		}
+	}
+	return sources
+}
+
+// mergeEntries returns the configured entries followed by the live ones,
+// skipping duplicates. configured is not modified.
+func mergeEntries(configured, live []string) []string {
+	result := make([]string, 0, len(configured)+len(live))
+	for _, s := range slices.Concat(configured, live) {
+		if !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// withoutRemoved drops the entries removed at runtime.
+func (a *ControlAPI) withoutRemoved(entries []string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.DeleteFunc(entries, func(e string) bool { return a.removed[e] })
+}
+
+// setRemoved marks entries as removed at runtime, or clears the mark.
+func (a *ControlAPI) setRemoved(entries []string, removed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range entries {
+		if removed {
+			a.removed[e] = true
+		} else {
+			delete(a.removed, e)
+		}
+	}
 }
 
 func (a *ControlAPI) decodeAllowRequest(r *http.Request) ([]string, error) {
@@ -103,10 +281,22 @@ func (a *ControlAPI) handleAllowHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+	if a.denyHTTP != nil {
+		for _, e := range entries {
+			if rule, ok := a.denyHTTP.MatchEntry(e); ok {
+				msg := fmt.Sprintf("%s is denied by deny-http entry %s", e, rule)
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, msg), http.StatusForbidden)
+				return
+			}
+		}
+	}
 	if err := a.httpAllowlist.Add(entries); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
 		return
 	}
+	a.setRemoved(entries, false)
 	writeJSON(w, map[string]any{"added": entries})
 }
 
@@ -116,13 +306,176 @@ func (a *ControlAPI) handleAllowDNS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+	if a.denyDNS != nil {
+		for _, e := range entries {
+			if rule, ok := a.denyDNS.Match(e); ok {
+				msg := fmt.Sprintf("%s is denied by deny-dns entry %s", e, rule)
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, msg), http.StatusForbidden)
+				return
+			}
+		}
+	}
 	if err := a.dnsAllowlist.Add(entries); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
 		return
 	}
+	a.setRemoved(entries, false)
 	writeJSON(w, map[string]any{"added": entries})
 }
 
+func (a *ControlAPI) handleRemoveHTTP(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.decodeAllowRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+	removed := a.httpAllowlist.Remove(entries)
+	a.setRemoved(removed, true)
+	writeJSON(w, map[string]any{"removed": nonNil(removed)})
+}
+
+func (a *ControlAPI) handleRemoveDNS(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.decodeAllowRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+	removed := a.dnsAllowlist.Remove(entries)
+	a.setRemoved(removed, true)
+	writeJSON(w, map[string]any{"removed": nonNil(removed)})
+}
+
+// reloadRequest holds the settings POST /reload replaces. The other proxy
+// settings only change with a restart.
+type reloadRequest struct {
+	AllowHTTP     []string          `json:"allow-http"`
+	AllowDNS      []string          `json:"allow-dns"`
+	DenyHTTP      []string          `json:"deny-http"`
+	DenyDNS       []string          `json:"deny-dns"`
+	EntryComments map[string]string `json:"entry-comments"`
+	EntrySources  map[string]string `json:"entry-sources"`
+}
+
+// handleReload replaces the configured allow and deny lists with the ones in
+// the request, which the client merges from the config files. Entries
+// allowed at runtime are kept unless the new deny rules cover them, and
+// entries removed at runtime come back if the new config lists them. All
+// lists are validated before any is swapped, and each swap is atomic, so
+// requests never see a partly parsed list. Open connections are not
+// affected; the allowlists are only checked when a request starts.
+func (a *ControlAPI) handleReload(w http.ResponseWriter, r *http.Request) {
+	var req reloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	denyHTTP, err := NewHTTPAllowlist(req.DenyHTTP)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "deny-http: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+	denyDNS, err := NewDNSAllowlist(req.DenyDNS)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "deny-dns: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateHTTPEntries(req.AllowHTTP); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "allow-http: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateDNSEntries(req.AllowDNS); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "allow-dns: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+
+	a.mu.Lock()
+	cfg := a.config
+	a.mu.Unlock()
+
+	httpEntries := reloadEntries(cfg.AllowHTTP, a.httpAllowlist.Entries(), req.AllowHTTP, func(e string) bool {
+		_, ok := denyHTTP.MatchEntry(e)
+		return ok
+	})
+	dnsEntries := reloadEntries(cfg.AllowDNS, a.dnsAllowlist.Entries(), req.AllowDNS, func(e string) bool {
+		_, ok := denyDNS.Match(e)
+		return ok
+	})
+
+	// The deny rules go first, so a request in between is rather refused
+	// than allowed by an entry the new config drops.
+	if a.denyHTTP != nil {
+		a.denyHTTP.Replace(req.DenyHTTP)
+	}
+	if a.denyDNS != nil {
+		a.denyDNS.Replace(req.DenyDNS)
+	}
+	a.httpAllowlist.Replace(httpEntries)
+	a.dnsAllowlist.Replace(dnsEntries)
+
+	cfg.AllowHTTP, cfg.AllowDNS = req.AllowHTTP, req.AllowDNS
+	cfg.DenyHTTP, cfg.DenyDNS = req.DenyHTTP, req.DenyDNS
+	cfg.EntryComments, cfg.EntrySources = req.EntryComments, req.EntrySources
+	hash := cfg.PolicyHash()
+
+	a.mu.Lock()
+	a.config = cfg
+	a.configHash = hash
+	clear(a.removed)
+	a.mu.Unlock()
+
+	writeJSON(w, map[string]any{"config-hash": hash})
+}
+
+// toProxyConfig converts the config the control API is created with to a
+// ProxyConfig through its JSON form.
+func toProxyConfig(config any) (ProxyConfig, error) {
+	var cfg ProxyConfig
+	data, err := json.Marshal(config)
+	if err != nil {
+		return cfg, err
+	}
+	if string(data) == "null" {
+		return cfg, nil
+	}
+	return cfg, json.Unmarshal(data, &cfg)
+}
+
+// reloadEntries returns the configured entries followed by the live entries
+// that weren't configured before, i.e. the ones allowed at runtime, leaving
+// out those denied by the new rules.
+func reloadEntries(oldConfigured, live, configured []string, denied func(string) bool) []string {
+	result := make([]string, 0, len(configured))
+	for _, e := range configured {
+		if !slices.Contains(result, e) {
+			result = append(result, e)
+		}
+	}
+	for _, e := range live {
+		if slices.Contains(oldConfigured, e) || slices.Contains(result, e) || denied(e) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// nonNil returns an empty slice for nil, so it encodes as [] instead of null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(v)
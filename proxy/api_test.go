@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -57,6 +59,69 @@ func TestControlAPI(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 
+	t.Run("GET /config includes runtime additions", func(t *testing.T) {
+		api := NewControlAPI(log, ProxyConfig{
+			AllowHTTP: []string{"a.com:443"},
+			AllowDNS:  []string{"c.com"},
+			BlockCIDR: []string{"10.0.0.0/8"},
+		}, allowlist, dnsAllowlist)
+		require.NoError(t, allowlist.Add([]string{"live.com:443"}))
+		require.NoError(t, dnsAllowlist.Add([]string{"live.internal"}))
+
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var cfg ProxyConfig
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cfg))
+		assert.Equal(t, []string{"a.com:443", "b.com:443", "live.com:443"}, cfg.AllowHTTP)
+		assert.Equal(t, []string{"c.com", "live.internal"}, cfg.AllowDNS)
+		assert.Equal(t, []string{"10.0.0.0/8"}, cfg.BlockCIDR)
+	})
+
+	t.Run("GET /config returns entry sources on request", func(t *testing.T) {
+		httpAL, err := NewHTTPAllowlist([]string{"a.com:443", "b.com:443"})
+		require.NoError(t, err)
+		dnsAL, err := NewDNSAllowlist(nil)
+		require.NoError(t, err)
+		api := NewControlAPI(log, ProxyConfig{
+			AllowHTTP:    []string{"a.com:443", "b.com:443"},
+			EntrySources: map[string]string{"a.com:443": "preset:pkg-go"},
+		}, httpAL, dnsAL)
+		require.NoError(t, httpAL.Add([]string{"live.com:443"}))
+
+		get := func(path string) map[string]any {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			var cfg map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cfg))
+			return cfg
+		}
+
+		assert.NotContains(t, get("/config"), "entry-sources")
+		assert.Equal(t, map[string]any{
+			"a.com:443":    "preset:pkg-go",
+			"live.com:443": EntrySourceRuntime,
+		}, get("/config?sources=true")["entry-sources"])
+	})
+
+	t.Run("GET /config includes the config hash", func(t *testing.T) {
+		api := NewControlAPI(log, ProxyConfig{}, allowlist, dnsAllowlist)
+		api.configHash = "abc123"
+
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var cfg map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cfg))
+		assert.Equal(t, "abc123", cfg["config-hash"])
+	})
+
 	t.Run("GET /unknown returns 404", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/unknown", nil)
 		w := httptest.NewRecorder()
@@ -135,6 +200,113 @@ func TestControlAPI(t *testing.T) {
 		assert.False(t, dnsAllowlist.Allows("github.com"))
 	})
 
+	t.Run("POST /allow-http refuses denied entries", func(t *testing.T) {
+		api.denyHTTP, err = NewHTTPAllowlist([]string{"pastebin.com:*"})
+		require.NoError(t, err)
+		t.Cleanup(func() { api.denyHTTP = nil })
+
+		body := `{"entries": ["gist.github.com:443", "pastebin.com:443"]}`
+		req := httptest.NewRequest(http.MethodPost, "/allow-http", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "pastebin.com:443 is denied by deny-http entry pastebin.com:*")
+		assert.False(t, allowlist.Allows("gist.github.com", "443"), "no entry of the batch is added")
+	})
+
+	t.Run("POST /allow-dns refuses denied entries", func(t *testing.T) {
+		api.denyDNS, err = NewDNSAllowlist([]string{".pastebin.com"})
+		require.NoError(t, err)
+		t.Cleanup(func() { api.denyDNS = nil })
+
+		body := `{"entries": ["www.pastebin.com"]}`
+		req := httptest.NewRequest(http.MethodPost, "/allow-dns", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.False(t, dnsAllowlist.Allows("www.pastebin.com"))
+	})
+
+	t.Run("DELETE /allow-http removes entries from allowlist", func(t *testing.T) {
+		require.NoError(t, allowlist.Add([]string{"revoke.com:443"}))
+
+		body := `{"entries": ["revoke.com:443", "unknown.com:443"]}`
+		req := httptest.NewRequest(http.MethodDelete, "/allow-http", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string][]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []string{"revoke.com:443"}, resp["removed"], "unknown entries are ignored")
+		assert.False(t, allowlist.Allows("revoke.com", "443"))
+		assert.True(t, allowlist.Allows("a.com", "443"))
+	})
+
+	t.Run("DELETE /allow-http without matches returns empty list", func(t *testing.T) {
+		body := `{"entries": ["unknown.com:443"]}`
+		req := httptest.NewRequest(http.MethodDelete, "/allow-http", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"removed":[]}`, w.Body.String())
+	})
+
+	t.Run("DELETE /allow-http with empty entries returns 400", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/allow-http", strings.NewReader(`{"entries": []}`))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("DELETE /allow-dns removes entries from DNS allowlist", func(t *testing.T) {
+		require.NoError(t, dnsAllowlist.Add([]string{"revoke.internal"}))
+
+		body := `{"entries": ["revoke.internal"]}`
+		req := httptest.NewRequest(http.MethodDelete, "/allow-dns", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string][]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []string{"revoke.internal"}, resp["removed"])
+		assert.False(t, dnsAllowlist.Allows("revoke.internal"))
+	})
+
+	t.Run("GET /config leaves out removed entries", func(t *testing.T) {
+		httpAllow, err := NewHTTPAllowlist([]string{"a.com:443", "b.com:443"})
+		require.NoError(t, err)
+		dnsAllow, err := NewDNSAllowlist([]string{"c.com"})
+		require.NoError(t, err)
+		api := NewControlAPI(log, ProxyConfig{
+			AllowHTTP: []string{"a.com:443", "b.com:443"},
+			AllowDNS:  []string{"c.com"},
+		}, httpAllow, dnsAllow)
+		for path, body := range map[string]string{
+			"/allow-http": `{"entries": ["a.com:443"]}`,
+			"/allow-dns":  `{"entries": ["c.com"]}`,
+		} {
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, strings.NewReader(body)))
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var cfg ProxyConfig
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cfg))
+		assert.Equal(t, []string{"b.com:443"}, cfg.AllowHTTP)
+		assert.Empty(t, cfg.AllowDNS)
+	})
+
 	t.Run("GET /logs with nil URL returns all entries", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/logs", nil)
 		req.URL = nil
@@ -148,6 +320,140 @@ func TestControlAPI(t *testing.T) {
 	})
 }
 
+func TestControlAPIReload(t *testing.T) {
+	newAPI := func(t *testing.T) *ControlAPI {
+		t.Helper()
+		cfg := ProxyConfig{
+			AllowHTTP: []string{"a.com:443", "b.com:443"},
+			AllowDNS:  []string{"c.com"},
+			BlockCIDR: []string{"203.0.113.0/24"},
+		}
+		httpAllow, err := NewHTTPAllowlist(cfg.AllowHTTP)
+		require.NoError(t, err)
+		dnsAllow, err := NewDNSAllowlist(cfg.AllowDNS)
+		require.NoError(t, err)
+		api := NewControlAPI(NewLogBuffer(100), cfg, httpAllow, dnsAllow)
+		api.configHash = cfg.PolicyHash()
+		api.denyHTTP, _ = NewHTTPAllowlist(nil)
+		api.denyDNS, _ = NewDNSAllowlist(nil)
+		return api
+	}
+	do := func(t *testing.T, api *ControlAPI, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("replaces configured entries and keeps runtime entries", func(t *testing.T) {
+		api := newAPI(t)
+		require.Equal(t, http.StatusOK, do(t, api, http.MethodPost, "/allow-http", `{"entries": ["runtime.com:443"]}`).Code)
+		require.Equal(t, http.StatusOK, do(t, api, http.MethodDelete, "/allow-http", `{"entries": ["a.com:443"]}`).Code)
+
+		w := do(t, api, http.MethodPost, "/reload", `{"allow-http": ["a.com:443", "new.com:443"], "allow-dns": ["d.com"]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, []string{"a.com:443", "new.com:443", "runtime.com:443"}, api.httpAllowlist.Entries())
+		assert.Equal(t, []string{"d.com"}, api.dnsAllowlist.Entries())
+
+		var cfg ProxyConfig
+		require.NoError(t, json.Unmarshal(do(t, api, http.MethodGet, "/config", "").Body.Bytes(), &cfg))
+		assert.Equal(t, []string{"a.com:443", "new.com:443", "runtime.com:443"}, cfg.AllowHTTP)
+		assert.Equal(t, []string{"203.0.113.0/24"}, cfg.BlockCIDR, "settings outside the lists keep their startup value")
+	})
+
+	t.Run("returns the hash of the reloaded config", func(t *testing.T) {
+		api := newAPI(t)
+		w := do(t, api, http.MethodPost, "/reload", `{"allow-http": ["new.com:443"], "deny-dns": ["evil.com"]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		want := ProxyConfig{
+			AllowHTTP: []string{"new.com:443"},
+			BlockCIDR: []string{"203.0.113.0/24"},
+			DenyDNS:   []string{"evil.com"},
+		}.PolicyHash()
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, want, resp["config-hash"])
+
+		var cfg map[string]any
+		require.NoError(t, json.Unmarshal(do(t, api, http.MethodGet, "/config", "").Body.Bytes(), &cfg))
+		assert.Equal(t, want, cfg["config-hash"])
+	})
+
+	t.Run("applies new deny rules to runtime entries", func(t *testing.T) {
+		api := newAPI(t)
+		require.Equal(t, http.StatusOK, do(t, api, http.MethodPost, "/allow-http", `{"entries": ["pastebin.com:443"]}`).Code)
+
+		w := do(t, api, http.MethodPost, "/reload", `{"allow-http": ["a.com:443"], "deny-http": ["pastebin.com:*"]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, []string{"a.com:443"}, api.httpAllowlist.Entries())
+		assert.True(t, api.denyHTTP.Allows("pastebin.com", "443"))
+		assert.Equal(t, http.StatusForbidden, do(t, api, http.MethodPost, "/allow-http", `{"entries": ["pastebin.com:443"]}`).Code)
+	})
+
+	t.Run("rejects invalid lists without changing anything", func(t *testing.T) {
+		api := newAPI(t)
+		for _, body := range []string{
+			`{"allow-http": ["new.com:443"], "allow-dns": ["d.com:53"]}`,
+			`{"allow-http": ["new.com:443"], "deny-http": ["evil.com"]}`,
+			`{"allow-http": "new.com:443"}`,
+		} {
+			w := do(t, api, http.MethodPost, "/reload", body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+		assert.Equal(t, []string{"a.com:443", "b.com:443"}, api.httpAllowlist.Entries())
+		assert.Equal(t, []string{"c.com"}, api.dnsAllowlist.Entries())
+		assert.Empty(t, api.denyHTTP.Entries())
+	})
+}
+
+func TestControlAPILogStream(t *testing.T) {
+	log := NewLogBuffer(100)
+	log.Add(LogEntry{Domain: "old.com", Action: ActionAllow, Source: SourceProxy})
+	log.Add(LogEntry{Domain: "recent.com", Action: ActionAllow, Source: SourceProxy})
+	srv := httptest.NewServer(NewControlAPI(log, nil, nil, nil))
+	defer srv.Close()
+
+	stream := func(t *testing.T, query string) *bufio.Scanner {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/logs/stream"+query, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/jsonl", resp.Header.Get("Content-Type"))
+		return bufio.NewScanner(resp.Body)
+	}
+	next := func(t *testing.T, lines *bufio.Scanner) LogEntry {
+		t.Helper()
+		require.True(t, lines.Scan())
+		var e LogEntry
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &e))
+		return e
+	}
+
+	t.Run("streams new entries", func(t *testing.T) {
+		lines := stream(t, "")
+		log.Add(LogEntry{Domain: "new.com", Action: ActionBlock, Source: SourceDNS})
+		e := next(t, lines)
+		assert.Equal(t, "new.com", e.Domain)
+		assert.Equal(t, ActionBlock, e.Action)
+	})
+
+	t.Run("sends buffered entries after the given ID first", func(t *testing.T) {
+		lines := stream(t, "?after=1")
+		assert.Equal(t, "recent.com", next(t, lines).Domain)
+		assert.Equal(t, "new.com", next(t, lines).Domain)
+		log.Add(LogEntry{Domain: "newer.com"})
+		assert.Equal(t, "newer.com", next(t, lines).Domain)
+	})
+}
+
 func TestControlAPIPanicRecovery(t *testing.T) {
 	log := NewLogBuffer(100)
 	allowlist, err := NewHTTPAllowlist(nil)
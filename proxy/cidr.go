@@ -1,27 +1,48 @@
 package proxy
 
-import "net"
+import (
+	"net"
+	"slices"
+)
 
-var defaultBlockedCIDRs = []string{
+// privateNetworkCIDRs are the private network ranges, blocked by default
+// unless allow-private-network is set.
+var privateNetworkCIDRs = []string{
 	"10.0.0.0/8",
 	"172.16.0.0/12",
 	"192.168.0.0/16",
+	"fc00::/7",
+}
+
+// localCIDRs are the loopback and link-local ranges, which include cloud
+// metadata endpoints. They are always blocked by default.
+var localCIDRs = []string{
 	"127.0.0.0/8",
 	"169.254.0.0/16",
 	"::1/128",
-	"fc00::/7",
 	"fe80::/10",
 }
 
+var defaultBlockedCIDRs = slices.Concat(privateNetworkCIDRs, localCIDRs)
+
 type CIDRBlocker struct {
 	blockNets []*net.IPNet
 	allowNets []*net.IPNet
 }
 
 func NewCIDRBlocker(block, allow []string) *CIDRBlocker {
-	blocked := make([]string, 0, len(defaultBlockedCIDRs)+len(block))
-	blocked = append(blocked, defaultBlockedCIDRs...)
-	blocked = append(blocked, block...)
+	return newCIDRBlocker(defaultBlockedCIDRs, block, allow)
+}
+
+// NewPrivateNetworkCIDRBlocker is like NewCIDRBlocker but does not block the
+// private network ranges by default. Ranges in block are still blocked, and
+// so are the loopback and link-local ranges.
+func NewPrivateNetworkCIDRBlocker(block, allow []string) *CIDRBlocker {
+	return newCIDRBlocker(localCIDRs, block, allow)
+}
+
+func newCIDRBlocker(defaults, block, allow []string) *CIDRBlocker {
+	blocked := slices.Concat(defaults, block)
 
 	blockNets := parseCIDRs(blocked)
 	allowNets := parseCIDRs(allow)
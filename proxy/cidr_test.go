@@ -62,6 +62,33 @@ func TestCIDRBlockerCustomRanges(t *testing.T) {
 	}
 }
 
+func TestPrivateNetworkCIDRBlocker(t *testing.T) {
+	blocker := NewPrivateNetworkCIDRBlocker([]string{"192.168.50.0/24"}, nil)
+
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"private 10/8 allowed", "10.0.0.1", false},
+		{"private 172.16/12 allowed", "172.16.5.4", false},
+		{"private 192.168/16 allowed", "192.168.1.20", false},
+		{"private fc00::/7 allowed", "fd00::1", false},
+		{"explicit block-cidr still blocked", "192.168.50.10", true},
+		{"loopback still blocked", "127.0.0.1", true},
+		{"link-local metadata still blocked", "169.254.169.254", true},
+		{"ipv6 loopback still blocked", "::1", true},
+		{"public allowed", "8.8.8.8", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			assert.Equal(t, tt.want, blocker.IsBlocked(ip), "IsBlocked(%s)", tt.ip)
+		})
+	}
+}
+
 func TestCIDRBlockerAllowCIDR(t *testing.T) {
 	blocker := NewCIDRBlocker(nil, []string{"10.0.0.0/24"})
 
@@ -115,6 +142,29 @@ func TestCIDRBlockerAllowOverridesBlock(t *testing.T) {
 	}
 }
 
+func TestCIDRBlockerAllowInsideDefaultRange(t *testing.T) {
+	// 10.1.0.0/16 lies inside the default-blocked 10.0.0.0/8 and inside a
+	// custom block range. Allow wins over both, only for the allowed range.
+	blocker := NewCIDRBlocker([]string{"10.1.0.0/16"}, []string{"10.1.0.0/16"})
+
+	tests := []struct {
+		name        string
+		ip          string
+		wantBlocked bool
+	}{
+		{"inside allowed subnet", "10.1.2.3", false},
+		{"allowed subnet last address", "10.1.255.255", false},
+		{"rest of 10.0.0.0/8 still blocked", "10.2.0.1", true},
+		{"loopback still blocked", "127.0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantBlocked, blocker.IsBlocked(net.ParseIP(tt.ip)), "IsBlocked(%s)", tt.ip)
+		})
+	}
+}
+
 func TestCIDRBlockerAllowEmpty(t *testing.T) {
 	blocker := NewCIDRBlocker(nil, nil)
 
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
@@ -15,21 +16,47 @@ type DNSServer struct {
 	allowlist *DNSAllowlist
 	cidr      *CIDRBlocker
 	log       *LogBuffer
-	upstream  string
+	upstreams *UpstreamPool
 	proxyIP   net.IP
+
+	virtualHosts map[string]bool
+
+	// denylist blocks matching queries before anything else is checked,
+	// see SetDenylist.
+	denylist *DNSAllowlist
 }
 
-// SetProxyIP sets the IP address that host.vibepit will resolve to.
+// SetProxyIP sets the IP address that host.vibepit and the other virtual
+// hosts will resolve to.
 func (s *DNSServer) SetProxyIP(ip net.IP) {
 	s.proxyIP = ip
 }
 
-func NewDNSServer(allowlist *DNSAllowlist, cidr *CIDRBlocker, log *LogBuffer, upstream string) *DNSServer {
+// SetDenylist installs deny-dns rules that block matching queries even when
+// the allowlist or a virtual host would answer them. Pass nil to remove it.
+func (s *DNSServer) SetDenylist(deny *DNSAllowlist) {
+	s.denylist = deny
+}
+
+// SetVirtualHosts registers additional virtual hostnames that resolve to the
+// proxy IP, like host.vibepit.
+func (s *DNSServer) SetVirtualHosts(names []string) {
+	s.virtualHosts = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.virtualHosts[strings.ToLower(name)] = true
+	}
+}
+
+func (s *DNSServer) isVirtualHost(domain string) bool {
+	return domain == HostVibepit || s.virtualHosts[domain]
+}
+
+func NewDNSServer(allowlist *DNSAllowlist, cidr *CIDRBlocker, log *LogBuffer, upstreams *UpstreamPool) *DNSServer {
 	return &DNSServer{
 		allowlist: allowlist,
 		cidr:      cidr,
 		log:       log,
-		upstream:  upstream,
+		upstreams: upstreams,
 	}
 }
 
@@ -45,13 +72,31 @@ func (s *DNSServer) handler() mdns.Handler {
 		}
 
 		domain := strings.TrimSuffix(strings.ToLower(r.Question[0].Name), ".")
+		qtype := mdns.Type(r.Question[0].Qtype).String()
 
-		// Synthetic response for host.vibepit — resolves to the proxy IP
-		// without upstream forwarding or CIDR validation.
-		if domain == "host.vibepit" && s.proxyIP != nil && r.Question[0].Qtype == mdns.TypeA {
+		if s.denylist != nil && s.denylist.Allows(domain) {
 			s.log.Add(LogEntry{
 				Time:   time.Now(),
 				Domain: domain,
+				QType:  qtype,
+				Action: ActionBlock,
+				Source: SourceDNS,
+				Reason: "explicitly denied",
+			})
+			m := new(mdns.Msg)
+			m.SetRcode(r, mdns.RcodeNameError)
+			w.WriteMsg(m)
+			return
+		}
+
+		// Synthetic response for host.vibepit and other virtual hosts —
+		// resolves to the proxy IP without upstream forwarding or CIDR
+		// validation.
+		if s.isVirtualHost(domain) && s.proxyIP != nil && r.Question[0].Qtype == mdns.TypeA {
+			s.log.Add(LogEntry{
+				Time:   time.Now(),
+				Domain: domain,
+				QType:  qtype,
 				Action: ActionAllow,
 				Source: SourceDNS,
 			})
@@ -74,6 +119,7 @@ func (s *DNSServer) handler() mdns.Handler {
 			s.log.Add(LogEntry{
 				Time:   time.Now(),
 				Domain: domain,
+				QType:  qtype,
 				Action: ActionBlock,
 				Source: SourceDNS,
 				Reason: "domain not in allowlist",
@@ -84,9 +130,9 @@ func (s *DNSServer) handler() mdns.Handler {
 			return
 		}
 
-		// Forward to upstream resolver.
-		c := new(mdns.Client)
-		resp, _, err := c.Exchange(r, s.upstream)
+		// Forward to the upstream resolvers. The CIDR check below applies
+		// to the answer of whichever upstream served it.
+		resp, upstream, err := s.upstreams.exchange(context.Background(), r)
 		if err != nil {
 			s.handleFailed(w, r)
 			return
@@ -95,11 +141,13 @@ func (s *DNSServer) handler() mdns.Handler {
 		// Reject responses that resolve to blocked IP ranges (e.g. private networks).
 		if s.hasBlockedIP(resp) {
 			s.log.Add(LogEntry{
-				Time:   time.Now(),
-				Domain: domain,
-				Action: ActionBlock,
-				Source: SourceDNS,
-				Reason: "resolved IP in blocked CIDR range",
+				Time:     time.Now(),
+				Domain:   domain,
+				QType:    qtype,
+				Action:   ActionBlock,
+				Source:   SourceDNS,
+				Reason:   "resolved IP in blocked CIDR range",
+				Upstream: upstream,
 			})
 			m := new(mdns.Msg)
 			m.SetRcode(r, mdns.RcodeNameError)
@@ -108,10 +156,12 @@ func (s *DNSServer) handler() mdns.Handler {
 		}
 
 		s.log.Add(LogEntry{
-			Time:   time.Now(),
-			Domain: domain,
-			Action: ActionAllow,
-			Source: SourceDNS,
+			Time:     time.Now(),
+			Domain:   domain,
+			QType:    qtype,
+			Action:   ActionAllow,
+			Source:   SourceDNS,
+			Upstream: upstream,
 		})
 		w.WriteMsg(resp)
 	})
@@ -133,16 +183,46 @@ func (s *DNSServer) hasBlockedIP(msg *mdns.Msg) bool {
 	return false
 }
 
-// ListenAndServe starts the DNS server on the given address (e.g. ":53").
-func (s *DNSServer) ListenAndServe(addr string) error {
-	udpServer := &mdns.Server{Addr: addr, Net: "udp", Handler: s.handler()}
-	tcpServer := &mdns.Server{Addr: addr, Net: "tcp", Handler: s.handler()}
+// ListenAndServe starts the DNS server on the given address (e.g. ":53") over
+// UDP and TCP. When ctx is canceled it waits up to shutdownTimeout for
+// in-flight queries, closes both listeners, and returns nil.
+func (s *DNSServer) ListenAndServe(ctx context.Context, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close() //nolint:errcheck
+		return err
+	}
+	udpServer := &mdns.Server{PacketConn: pc, Handler: s.handler()}
+	tcpServer := &mdns.Server{Listener: ln, Handler: s.handler()}
 
 	errCh := make(chan error, 2)
-	go func() { errCh <- udpServer.ListenAndServe() }()
-	go func() { errCh <- tcpServer.ListenAndServe() }()
+	go func() { errCh <- udpServer.ActivateAndServe() }()
+	go func() { errCh <- tcpServer.ActivateAndServe() }()
+
+	var serveErr error
+	pending := 2
+	select {
+	case serveErr = <-errCh:
+		pending--
+	case <-ctx.Done():
+	}
 
-	return <-errCh
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	udpServer.ShutdownContext(shutdownCtx) //nolint:errcheck
+	tcpServer.ShutdownContext(shutdownCtx) //nolint:errcheck
+	// Closing the sockets also stops a server that had not finished starting
+	// when the shutdown began.
+	pc.Close() //nolint:errcheck
+	ln.Close() //nolint:errcheck
+	for range pending {
+		<-errCh
+	}
+	return serveErr
 }
 
 // ListenAndServeTest starts a UDP DNS server on a random port for testing.
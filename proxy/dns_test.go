@@ -16,7 +16,7 @@ func TestDNSServer(t *testing.T) {
 	blocker := NewCIDRBlocker(nil, nil)
 	log := NewLogBuffer(100)
 
-	srv := NewDNSServer(al, blocker, log, "8.8.8.8:53")
+	srv := NewDNSServer(al, blocker, log, NewUpstreamPool([]string{"8.8.8.8:53"}))
 	addr, cleanup := srv.ListenAndServeTest()
 	defer cleanup()
 
@@ -67,6 +67,23 @@ func TestDNSServer(t *testing.T) {
 		}
 		assert.True(t, found, "blocked DNS query not found in log")
 	})
+
+	t.Run("logs query type", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("evil6.com.", dns.TypeAAAA)
+
+		_, _, err := c.Exchange(m, addr)
+		require.NoError(t, err)
+
+		qtypes := map[string]string{}
+		for _, e := range log.Entries() {
+			if e.Action == ActionBlock {
+				qtypes[e.Domain] = e.QType
+			}
+		}
+		assert.Equal(t, "A", qtypes["evil.com"])
+		assert.Equal(t, "AAAA", qtypes["evil6.com"])
+	})
 }
 
 func TestDNSHostVibepit(t *testing.T) {
@@ -77,7 +94,7 @@ func TestDNSHostVibepit(t *testing.T) {
 
 	proxyIP := net.ParseIP("10.42.0.2")
 
-	srv := NewDNSServer(al, blocker, log, "8.8.8.8:53")
+	srv := NewDNSServer(al, blocker, log, NewUpstreamPool([]string{"8.8.8.8:53"}))
 	srv.SetProxyIP(proxyIP)
 	addr, cleanup := srv.ListenAndServeTest()
 	defer cleanup()
@@ -125,3 +142,60 @@ func TestDNSHostVibepit(t *testing.T) {
 		assert.True(t, found, "host.vibepit DNS query not found in log")
 	})
 }
+
+func TestDNSVirtualHosts(t *testing.T) {
+	al, err := NewDNSAllowlist(nil)
+	require.NoError(t, err)
+	proxyIP := net.ParseIP("10.42.0.2")
+
+	srv := NewDNSServer(al, NewCIDRBlocker(nil, nil), NewLogBuffer(100), NewUpstreamPool([]string{"8.8.8.8:53"}))
+	srv.SetProxyIP(proxyIP)
+	srv.SetVirtualHosts([]string{"db.vibepit"})
+	addr, cleanup := srv.ListenAndServeTest()
+	defer cleanup()
+
+	time.Sleep(50 * time.Millisecond)
+
+	c := new(dns.Client)
+	for _, name := range []string{"host.vibepit.", "db.vibepit."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+
+		r, _, err := c.Exchange(m, addr)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeSuccess, r.Rcode, name)
+		require.NotEmpty(t, r.Answer, name)
+		a, ok := r.Answer[0].(*dns.A)
+		require.True(t, ok, "expected A record, got %T", r.Answer[0])
+		assert.True(t, a.A.Equal(proxyIP), name)
+	}
+}
+
+func TestDNSDenylist(t *testing.T) {
+	al, err := NewDNSAllowlist([]string{".example.com"})
+	require.NoError(t, err)
+	deny, err := NewDNSAllowlist([]string{"paste.example.com"})
+	require.NoError(t, err)
+	log := NewLogBuffer(100)
+
+	srv := NewDNSServer(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool([]string{fakeUpstream(t, "93.184.216.34")}))
+	srv.SetDenylist(deny)
+	addr, cleanup := srv.ListenAndServeTest()
+	defer cleanup()
+
+	c := new(dns.Client)
+	query := func(name string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		r, _, err := c.Exchange(m, addr)
+		require.NoError(t, err)
+		return r
+	}
+
+	assert.Equal(t, dns.RcodeNameError, query("paste.example.com.").Rcode)
+	entries := log.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "explicitly denied", entries[0].Reason)
+
+	assert.Equal(t, dns.RcodeSuccess, query("www.example.com.").Rcode)
+}
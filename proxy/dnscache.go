@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	mdns "github.com/miekg/dns"
+)
+
+// dnsCacheSize is the default bound on the number of cached answers.
+const dnsCacheSize = 1024
+
+type dnsCacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+type dnsCacheEntry struct {
+	msg      *mdns.Msg
+	upstream string
+	stored   time.Time
+	expires  time.Time
+}
+
+// dnsCache keeps successful upstream answers until the lowest TTL in the
+// answer runs out. Answers are never served past their TTL, so a name that
+// changes its records is re-resolved and CIDR-checked again.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[dnsCacheKey]dnsCacheEntry
+	size    int
+	now     func() time.Time
+}
+
+func newDNSCache(size int) *dnsCache {
+	return &dnsCache{
+		entries: make(map[dnsCacheKey]dnsCacheEntry),
+		size:    size,
+		now:     time.Now,
+	}
+}
+
+func cacheKey(q mdns.Question) dnsCacheKey {
+	return dnsCacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}
+}
+
+// get returns a copy of the cached answer for r with its TTLs reduced by the
+// time it spent in the cache, and the upstream that originally served it.
+func (c *dnsCache) get(r *mdns.Msg) (*mdns.Msg, string, bool) {
+	if len(r.Question) != 1 {
+		return nil, "", false
+	}
+	key := cacheKey(r.Question[0])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+	now := c.now()
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, "", false
+	}
+
+	resp := entry.msg.Copy()
+	resp.Id = r.Id
+	resp.Question = r.Question
+	age := uint32(now.Sub(entry.stored) / time.Second)
+	for _, rr := range resp.Answer {
+		rr.Header().Ttl -= min(age, rr.Header().Ttl)
+	}
+	return resp, entry.upstream, true
+}
+
+// put stores a successful answer to r. Errors, empty and truncated answers
+// and answers with a zero TTL are not cached.
+func (c *dnsCache) put(r, resp *mdns.Msg, upstream string) {
+	if len(r.Question) != 1 || resp.Rcode != mdns.RcodeSuccess || resp.Truncated || len(resp.Answer) == 0 {
+		return
+	}
+	ttl := resp.Answer[0].Header().Ttl
+	for _, rr := range resp.Answer[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	if ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	key := cacheKey(r.Question[0])
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = dnsCacheEntry{
+		msg:      resp.Copy(),
+		upstream: upstream,
+		stored:   now,
+		expires:  now.Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+// evict drops all expired entries, or the entry closest to expiring when
+// none has expired yet. The caller holds c.mu.
+func (c *dnsCache) evict(now time.Time) {
+	var oldest dnsCacheKey
+	var oldestExpires time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = key, entry.expires
+		}
+	}
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAnswer(r *dns.Msg, ip string, ttl uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+		A:   net.ParseIP(ip),
+	})
+	return m
+}
+
+func testQuery(name string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	return m
+}
+
+func TestDNSCache(t *testing.T) {
+	now := time.Now()
+	newCache := func(size int) *dnsCache {
+		c := newDNSCache(size)
+		c.now = func() time.Time { return now }
+		return c
+	}
+
+	t.Run("serves an answer until its TTL runs out", func(t *testing.T) {
+		c := newCache(10)
+		q := testQuery("example.com.")
+		c.put(q, testAnswer(q, "93.184.216.34", 60), "9.9.9.9:53")
+
+		next := testQuery("EXAMPLE.com.")
+		now = now.Add(20 * time.Second)
+		resp, upstream, ok := c.get(next)
+		require.True(t, ok)
+		assert.Equal(t, "9.9.9.9:53", upstream)
+		assert.Equal(t, next.Id, resp.Id)
+		assert.Equal(t, next.Question, resp.Question)
+		assert.Equal(t, uint32(40), resp.Answer[0].Header().Ttl)
+
+		now = now.Add(40 * time.Second)
+		_, _, ok = c.get(next)
+		assert.False(t, ok)
+	})
+
+	t.Run("uses the lowest TTL in the answer", func(t *testing.T) {
+		c := newCache(10)
+		q := testQuery("example.com.")
+		resp := testAnswer(q, "93.184.216.34", 300)
+		resp.Answer = append(resp.Answer, testAnswer(q, "93.184.216.35", 5).Answer...)
+		c.put(q, resp, "9.9.9.9:53")
+
+		now = now.Add(5 * time.Second)
+		_, _, ok := c.get(q)
+		assert.False(t, ok)
+	})
+
+	t.Run("does not cache failures or zero TTLs", func(t *testing.T) {
+		c := newCache(10)
+		q := testQuery("example.com.")
+		c.put(q, new(dns.Msg).SetRcode(q, dns.RcodeNameError), "9.9.9.9:53")
+		c.put(q, testAnswer(q, "93.184.216.34", 0), "9.9.9.9:53")
+		assert.Empty(t, c.entries)
+	})
+
+	t.Run("cached answers are copies", func(t *testing.T) {
+		c := newCache(10)
+		q := testQuery("example.com.")
+		c.put(q, testAnswer(q, "93.184.216.34", 60), "9.9.9.9:53")
+
+		resp, _, _ := c.get(q)
+		resp.Answer[0].(*dns.A).A = net.ParseIP("10.0.0.1")
+		resp, _, _ = c.get(q)
+		assert.Equal(t, "93.184.216.34", resp.Answer[0].(*dns.A).A.String())
+	})
+
+	t.Run("evicts the entry closest to expiring when full", func(t *testing.T) {
+		c := newCache(3)
+		for i, ttl := range []uint32{60, 10, 30} {
+			q := testQuery(fmt.Sprintf("host%d.example.com.", i))
+			c.put(q, testAnswer(q, "93.184.216.34", ttl), "9.9.9.9:53")
+		}
+		q := testQuery("host3.example.com.")
+		c.put(q, testAnswer(q, "93.184.216.34", 60), "9.9.9.9:53")
+
+		assert.Len(t, c.entries, 3)
+		_, _, ok := c.get(testQuery("host1.example.com."))
+		assert.False(t, ok)
+		_, _, ok = c.get(testQuery("host0.example.com."))
+		assert.True(t, ok)
+	})
+}
+
+func TestUpstreamPoolCache(t *testing.T) {
+	var queries atomic.Int32
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		if r.Question[0].Qtype != dns.TypeA {
+			w.WriteMsg(new(dns.Msg).SetReply(r))
+			return
+		}
+		w.WriteMsg(testAnswer(r, "93.184.216.34", 60))
+	})}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+
+	p := NewUpstreamPool([]string{pc.LocalAddr().String()})
+	for range 3 {
+		ips, err := p.lookupIP(context.Background(), "example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "93.184.216.34", ips[0].String())
+	}
+	// The empty AAAA answer is not cached, the A answer is.
+	assert.Equal(t, int32(4), queries.Load())
+}
+
+func TestUpstreamPoolSetCacheSize(t *testing.T) {
+	p := NewUpstreamPool(nil)
+	assert.Equal(t, dnsCacheSize, p.cache.size)
+
+	p.SetCacheSize(16)
+	assert.Equal(t, 16, p.cache.size)
+
+	p.SetCacheSize(0)
+	assert.Equal(t, dnsCacheSize, p.cache.size)
+}
+
+func TestDNSServerDoesNotCacheBlockedQueries(t *testing.T) {
+	al, err := NewDNSAllowlist([]string{"example.com"})
+	require.NoError(t, err)
+	pool := NewUpstreamPool([]string{fakeUpstream(t, "93.184.216.34")})
+	srv := NewDNSServer(al, NewCIDRBlocker(nil, nil), NewLogBuffer(100), pool)
+	addr, cleanup := srv.ListenAndServeTest()
+	t.Cleanup(cleanup)
+
+	r, _, err := new(dns.Client).Exchange(testQuery("blocked.example.org."), addr)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, r.Rcode)
+	assert.Empty(t, pool.cache.entries)
+
+	r, _, err = new(dns.Client).Exchange(testQuery("example.com."), addr)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+	assert.Len(t, pool.cache.entries, 1)
+}
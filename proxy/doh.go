@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	mdns "github.com/miekg/dns"
+)
+
+// dohContentType is the media type of DNS wire format messages in RFC 8484.
+const dohContentType = "application/dns-message"
+
+// isDoH reports whether an upstream is a DNS-over-HTTPS URL rather than a
+// "host:port" server.
+func isDoH(server string) bool {
+	return strings.HasPrefix(server, "https://")
+}
+
+// ValidateDoHURL checks that s is an https URL whose host is an IP address,
+// e.g. "https://1.1.1.1/dns-query". The proxy resolves everything through
+// its upstreams, so it can't look up the name of the resolver itself.
+func ValidateDoHURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid DoH URL %q: %w", s, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("DoH URL %q must use https", s)
+	}
+	if net.ParseIP(u.Hostname()) == nil {
+		return fmt.Errorf("DoH URL %q must use an IP address as host", s)
+	}
+	return nil
+}
+
+// newDoHClient returns the HTTP client for DoH queries. It ignores the
+// proxy environment variables, since the queries go straight out.
+func newDoHClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{ForceAttemptHTTP2: true},
+	}
+}
+
+// dohExchange sends m to the DoH endpoint at serverURL as an RFC 8484 POST
+// request. The query goes out with ID 0 so responses stay cacheable, and the
+// response gets the ID of m back. The request is bounded by upstreamTimeout.
+func dohExchange(ctx context.Context, client *http.Client, serverURL string, m *mdns.Msg) (*mdns.Msg, error) {
+	q := m.Copy()
+	q.Id = 0
+	body, err := q.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack query: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, mdns.MaxMsgSize))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	r := new(mdns.Msg)
+	if err := r.Unpack(data); err != nil {
+		return nil, fmt.Errorf("unpack response: %w", err)
+	}
+	r.Id = m.Id
+	return r, nil
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDoH starts an RFC 8484 server that answers every A query with ip.
+func fakeDoH(t *testing.T, ip string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		q := new(dns.Msg)
+		if err := q.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(q)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP(ip),
+		})
+		data, _ := m.Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidateDoHURL(t *testing.T) {
+	assert.NoError(t, ValidateDoHURL("https://1.1.1.1/dns-query"))
+	assert.NoError(t, ValidateDoHURL("https://[2606:4700:4700::1111]/dns-query"))
+	assert.ErrorContains(t, ValidateDoHURL("http://1.1.1.1/dns-query"), "must use https")
+	assert.ErrorContains(t, ValidateDoHURL("https://cloudflare-dns.com/dns-query"), "must use an IP address")
+}
+
+func TestDoHExchange(t *testing.T) {
+	t.Run("answers through the DoH server", func(t *testing.T) {
+		srv := fakeDoH(t, "93.184.216.34")
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		resp, err := dohExchange(context.Background(), srv.Client(), srv.URL+"/dns-query", m)
+		require.NoError(t, err)
+		assert.Equal(t, m.Id, resp.Id)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, "93.184.216.34", resp.Answer[0].(*dns.A).A.String())
+	})
+
+	t.Run("fails on an error status", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		_, err := dohExchange(context.Background(), srv.Client(), srv.URL, m)
+		assert.ErrorContains(t, err, "503")
+	})
+
+	t.Run("gives up on a server that doesn't answer", func(t *testing.T) {
+		done := make(chan struct{})
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		}))
+		t.Cleanup(srv.Close)
+		t.Cleanup(func() { close(done) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		_, err := dohExchange(ctx, srv.Client(), srv.URL, m)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestDNSServerDoHUpstream(t *testing.T) {
+	al, err := NewDNSAllowlist([]string{"example.com"})
+	require.NoError(t, err)
+
+	query := func(t *testing.T, srv *httptest.Server) (*dns.Msg, *LogBuffer) {
+		t.Helper()
+		log := NewLogBuffer(100)
+		pool := NewUpstreamPool([]string{srv.URL + "/dns-query"})
+		pool.doh = srv.Client()
+		dnsSrv := NewDNSServer(al, NewCIDRBlocker(nil, nil), log, pool)
+		addr, cleanup := dnsSrv.ListenAndServeTest()
+		t.Cleanup(cleanup)
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		r, _, err := new(dns.Client).Exchange(m, addr)
+		require.NoError(t, err)
+		return r, log
+	}
+
+	t.Run("forwards allowed queries", func(t *testing.T) {
+		srv := fakeDoH(t, "93.184.216.34")
+		r, log := query(t, srv)
+
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		require.Len(t, r.Answer, 1)
+		entries := log.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, srv.URL+"/dns-query", entries[0].Upstream)
+	})
+
+	t.Run("applies the CIDR check to DoH answers", func(t *testing.T) {
+		r, _ := query(t, fakeDoH(t, "10.0.0.1"))
+		assert.Equal(t, dns.RcodeNameError, r.Rcode)
+	})
+
+	t.Run("fails when the DoH server errors", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		r, _ := query(t, srv)
+		assert.Equal(t, dns.RcodeServerFailure, r.Rcode)
+	})
+}
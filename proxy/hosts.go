@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+)
+
+// hostsFile is consulted by the upstream pool before the upstream servers.
+// The container runtime writes the extra-hosts entries there, so names like
+// llm-server resolve without a DNS server that knows them.
+const hostsFile = "/etc/hosts"
+
+// parseHosts parses hosts file data into a map from lowercased hostname to
+// its addresses in file order. Comments and malformed lines are skipped.
+func parseHosts(data []byte) map[string][]net.IP {
+	hosts := make(map[string][]net.IP)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			hosts[name] = append(hosts[name], ip)
+		}
+	}
+	return hosts
+}
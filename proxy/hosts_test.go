@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHosts(t *testing.T) {
+	hosts := parseHosts([]byte(`# comment
+127.0.0.1	localhost
+::1	localhost ip6-localhost
+192.168.1.2 llm-server LLM.lan. # trailing comment
+not-an-ip bad
+10.0.0.1
+`))
+	assert.Equal(t, []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, hosts["localhost"])
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.1.2")}, hosts["llm-server"])
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.1.2")}, hosts["llm.lan"])
+	assert.NotContains(t, hosts, "bad")
+	assert.Len(t, hosts, 4)
+}
@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
@@ -19,98 +21,167 @@ type HTTPProxy struct {
 	cidr           *CIDRBlocker
 	log            *LogBuffer
 	proxy          *goproxy.ProxyHttpServer
-	resolver       *net.Resolver
-	hostGateway    string
+	upstreams      *UpstreamPool
 	allowHostPorts map[int]bool
+
+	// virtualHosts maps virtual hostnames such as host.vibepit to the
+	// address requests for them are rewritten to.
+	virtualHosts map[string]string
+
+	// maxRequestBytes caps plain HTTP request bodies. Zero disables the
+	// limit. CONNECT tunnels are opaque, so HTTPS bodies are not covered.
+	maxRequestBytes int64
+
+	decisionHook DecisionHook
+
+	// denylist blocks matching requests before anything else is checked,
+	// see SetDenylist.
+	denylist *HTTPAllowlist
 }
 
+// DecisionHook lets an embedding program decide about a request before the
+// allowlist is consulted. It returns handled=false to fall back to the
+// allowlist. When handled is true, allow replaces the allowlist result and
+// reason is recorded in the log. Allowed requests still go through the CIDR
+// check, and virtual hosts such as host.vibepit never reach the hook. The
+// hook runs for every request on the proxy's goroutines, so it must be fast
+// and safe for concurrent use.
+type DecisionHook func(host, port string) (allow bool, reason string, handled bool)
+
 // filterResult captures the outcome of a proxy filter check.
 type filterResult struct {
 	action  Action
 	reason  string
-	rewrite string // non-empty when host.vibepit should be rewritten to gateway
+	rewrite string   // non-empty when a virtual host should be rewritten to its target
+	byHook  bool     // true when the decision hook blocked the request
+	byDeny  bool     // true when a deny-http entry blocked the request
+	ips     []net.IP // addresses approved by the CIDR check, see withApprovedIPs
+}
+
+// requestInfo describes the client request in the log entries of
+// checkRequest.
+type requestInfo struct {
+	agent  string // see requestAgent
+	method string // plain HTTP requests only, CONNECT tunnels hide it
+	path   string // plain HTTP requests only, see requestPath
 }
 
 // checkRequest decides whether to allow or block a request. Both the CONNECT
 // and plain HTTP handlers call this so the filtering logic stays in one place.
-func (p *HTTPProxy) checkRequest(hostname, port string) filterResult {
-	if hostname == "host.vibepit" && p.hostGateway != "" {
-		if !p.isHostPortAllowed(port) && !p.allowlist.Allows(hostname, port) {
-			p.logEntry(hostname, port, ActionBlock, "domain not in allowlist")
+func (p *HTTPProxy) checkRequest(hostname, port string, info requestInfo) filterResult {
+	if p.denylist != nil && p.denylist.Allows(hostname, port) {
+		p.logEntry(hostname, port, info, ActionBlock, "explicitly denied")
+		return filterResult{action: ActionBlock, reason: "explicitly denied", byDeny: true}
+	}
+
+	// Virtual hosts skip the CIDR check because their targets are configured
+	// explicitly. Only host.vibepit auto-allows the allow-host-ports list.
+	if target, ok := p.virtualHosts[hostname]; ok {
+		autoAllowed := hostname == HostVibepit && p.isHostPortAllowed(port)
+		if !autoAllowed && !p.allowlist.Allows(hostname, port) {
+			p.logEntry(hostname, port, info, ActionBlock, "domain not in allowlist")
 			return filterResult{action: ActionBlock, reason: "domain not in allowlist"}
 		}
-		rewritten := net.JoinHostPort(p.hostGateway, port)
-		p.logEntry(hostname, port, ActionAllow, "host.vibepit")
+		rewritten := net.JoinHostPort(target, port)
+		p.logEntry(hostname, port, info, ActionAllow, hostname)
 		return filterResult{action: ActionAllow, rewrite: rewritten}
 	}
 
-	if !p.allowlist.Allows(hostname, port) {
-		p.logEntry(hostname, port, ActionBlock, "domain not in allowlist")
-		return filterResult{action: ActionBlock, reason: "domain not in allowlist"}
+	allowed, reason, byHook := p.decide(hostname, port)
+	if !allowed {
+		p.logEntry(hostname, port, info, ActionBlock, reason)
+		return filterResult{action: ActionBlock, reason: reason, byHook: byHook}
 	}
 
-	if blocked, ip := p.resolveAndCheckCIDR(hostname); blocked {
+	ips, blocked, ip := p.resolveAndCheckCIDR(hostname)
+	if blocked {
 		reason := fmt.Sprintf("resolved IP %s is in blocked CIDR range", ip)
 		if ip == nil {
 			reason = "DNS resolution failed during CIDR check"
 		}
-		p.logEntry(hostname, port, ActionBlock, reason)
+		p.logEntry(hostname, port, info, ActionBlock, reason)
 		return filterResult{action: ActionBlock, reason: reason}
 	}
 
-	p.logEntry(hostname, port, ActionAllow, "")
-	return filterResult{action: ActionAllow}
+	p.logEntry(hostname, port, info, ActionAllow, reason)
+	return filterResult{action: ActionAllow, ips: ips}
 }
 
-func NewHTTPProxy(allowlist *HTTPAllowlist, cidr *CIDRBlocker, log *LogBuffer, upstream string) *HTTPProxy {
-	// Build a resolver that talks directly to the upstream DNS server
-	// instead of using /etc/resolv.conf, which may point at the internal
-	// network gateway that cannot resolve external names.
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{}
-			return d.DialContext(ctx, "udp", upstream)
-		},
+// decide asks the decision hook about a request and falls back to the
+// allowlist when there is no hook or it declines. byHook reports whether the
+// hook made the decision.
+func (p *HTTPProxy) decide(hostname, port string) (allowed bool, reason string, byHook bool) {
+	if p.decisionHook != nil {
+		if allow, reason, handled := p.decisionHook(hostname, port); handled {
+			if !allow && reason == "" {
+				reason = "blocked by decision hook"
+			}
+			return allow, reason, true
+		}
 	}
-	dialer := &net.Dialer{Resolver: resolver}
+	if !p.allowlist.Allows(hostname, port) {
+		return false, "domain not in allowlist", false
+	}
+	return true, "", false
+}
+
+func NewHTTPProxy(allowlist *HTTPAllowlist, cidr *CIDRBlocker, log *LogBuffer, upstreams *UpstreamPool) *HTTPProxy {
+	// Resolve through the upstream pool instead of /etc/resolv.conf, which
+	// may point at the internal network gateway that cannot resolve
+	// external names. The pool also covers DNS-over-HTTPS upstreams and
+	// shares the DNS server's cache.
+	dialContext := upstreams.dialContext
 
 	proxy := goproxy.NewProxyHttpServer()
 	proxy.Tr = &http.Transport{
-		DialContext: dialer.DialContext,
-	}
-	proxy.ConnectDial = func(network, addr string) (net.Conn, error) {
-		return dialer.Dial(network, addr)
+		DialContext: dialContext,
 	}
-
 	p := &HTTPProxy{
 		allowlist: allowlist,
 		cidr:      cidr,
 		log:       log,
 		proxy:     proxy,
-		resolver:  resolver,
+		upstreams: upstreams,
+	}
+
+	// The CONNECT request still names the requested host when addr is a
+	// rewritten virtual host target.
+	proxy.ConnectDialWithReq = func(req *http.Request, network, addr string) (net.Conn, error) {
+		conn, err := dialContext(req.Context(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		hostname, _ := splitHostPort(req.Host, "443")
+		return &countingConn{Conn: conn, traffic: log.trafficFor(hostname)}, nil
 	}
 
 	p.proxy.OnRequest().HandleConnect(goproxy.FuncHttpsHandler(
 		func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
 			hostname, port := splitHostPort(host, "443")
-			result := p.checkRequest(hostname, port)
+			result := p.checkRequest(hostname, port, requestInfo{agent: requestAgent(ctx.Req)})
 			if result.action == ActionBlock {
 				return goproxy.RejectConnect, host
 			}
 			if result.rewrite != "" {
 				return goproxy.OkConnect, result.rewrite
 			}
+			// goproxy dials with ctx.Req, see ConnectDialWithReq.
+			ctx.Req = ctx.Req.WithContext(withApprovedIPs(ctx.Req.Context(), hostname, result.ips))
 			return goproxy.OkConnect, host
 		}))
 
 	p.proxy.OnRequest().DoFunc(
 		func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
 			hostname, port := splitHostPort(req.Host, "80")
-			result := p.checkRequest(hostname, port)
+			info := requestInfo{agent: requestAgent(req), method: req.Method, path: requestPath(req)}
+			result := p.checkRequest(hostname, port, info)
 			if result.action == ActionBlock {
 				msg := fmt.Sprintf("domain %q is not in the allowlist\nadd it to .vibepit/network.yaml or run: vibepit monitor\n", hostname)
-				if strings.Contains(result.reason, "blocked CIDR") {
+				if result.byDeny {
+					msg = fmt.Sprintf("domain %q is blocked by a deny-http entry\n", hostname)
+				} else if result.byHook {
+					msg = fmt.Sprintf("domain %q is blocked by policy: %s\n", hostname, result.reason)
+				} else if strings.Contains(result.reason, "blocked CIDR") {
 					msg = fmt.Sprintf("domain %q resolves to a blocked IP\n", hostname)
 				} else if strings.Contains(result.reason, "resolution failed") {
 					msg = fmt.Sprintf("domain %q could not be resolved safely\n", hostname)
@@ -121,75 +192,280 @@ func NewHTTPProxy(allowlist *HTTPAllowlist, cidr *CIDRBlocker, log *LogBuffer, u
 					msg,
 				)
 			}
+			// Only allowed requests get their body checked, so a blocked
+			// request keeps its real reason and its body isn't buffered.
+			if p.requestBodyTooLarge(req) {
+				p.logEntry(hostname, port, info, ActionBlock, "request body exceeds max-request-bytes")
+				return req, goproxy.NewResponse(req,
+					goproxy.ContentTypeText,
+					http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("request body exceeds the limit of %d bytes\n", p.maxRequestBytes),
+				)
+			}
 			if result.rewrite != "" {
 				req.URL.Host = result.rewrite
 				req.Host = result.rewrite
+			} else {
+				req = req.WithContext(withApprovedIPs(req.Context(), hostname, result.ips))
+			}
+			if req.Body != nil && req.Body != http.NoBody {
+				req.Body = &countingBody{ReadCloser: req.Body, traffic: log.trafficFor(hostname), sent: true}
 			}
+			// The response handler counts for the requested host, not the
+			// rewritten one.
+			ctx.UserData = hostname
 			return req, nil
 		})
 
+	p.proxy.OnResponse().DoFunc(
+		func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+			hostname, ok := ctx.UserData.(string)
+			if !ok || resp == nil || resp.Body == nil {
+				return resp
+			}
+			resp.Body = &countingBody{ReadCloser: resp.Body, traffic: log.trafficFor(hostname)}
+			return resp
+		})
+
 	return p
 }
 
+// countingConn adds the bytes of a CONNECT tunnel to the domain stats as
+// they pass. It keeps the half-close methods of the underlying TCP
+// connection, which goproxy uses to shut down each direction separately.
+type countingConn struct {
+	net.Conn
+	traffic *trafficCounter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.traffic.add(0, int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.traffic.add(int64(n), 0)
+	}
+	return n, err
+}
+
+func (c *countingConn) CloseWrite() error {
+	if hc, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return hc.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+func (c *countingConn) CloseRead() error {
+	if hc, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return hc.CloseRead()
+	}
+	return c.Conn.Close()
+}
+
+// countingBody adds the bytes read from a plain HTTP request or response
+// body to the domain stats, as sent for request bodies and as received for
+// response bodies.
+type countingBody struct {
+	io.ReadCloser
+	traffic *trafficCounter
+	sent    bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.sent {
+			b.traffic.add(int64(n), 0)
+		} else {
+			b.traffic.add(0, int64(n))
+		}
+	}
+	return n, err
+}
+
 func (p *HTTPProxy) Handler() http.Handler {
 	return p.proxy
 }
 
-func (p *HTTPProxy) logEntry(hostname, port string, action Action, reason string) {
+func (p *HTTPProxy) logEntry(hostname, port string, info requestInfo, action Action, reason string) {
 	p.log.Add(LogEntry{
 		Time:   time.Now(),
 		Domain: hostname,
 		Port:   port,
+		Agent:  info.agent,
+		Method: info.method,
+		Path:   info.path,
 		Action: action,
 		Source: SourceProxy,
 		Reason: reason,
 	})
 }
 
+// maxAgentLen caps the agent name taken from a request.
+const maxAgentLen = 32
+
+// requestAgent returns the product name from the User-Agent header of req,
+// e.g. "claude-cli" for "claude-cli/1.0.0 (external, cli)", to tell apart
+// the tools sharing a sandbox. Most clients also send it on CONNECT requests.
+// It returns "" when the header is missing or the name has unexpected
+// characters, since the value is client controlled and shown in the monitor.
+func requestAgent(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	product, _, _ := strings.Cut(strings.TrimSpace(req.UserAgent()), " ")
+	name, _, _ := strings.Cut(product, "/")
+	if name == "" || len(name) > maxAgentLen {
+		return ""
+	}
+	for _, c := range name {
+		if !isAgentChar(c) {
+			return ""
+		}
+	}
+	return name
+}
+
+// maxPathLen caps the request path kept in a log entry, so long URLs don't
+// bloat the log buffer.
+const maxPathLen = 256
+
+// requestPath returns the URL path of req for the log, without the query,
+// which often carries tokens. Long paths are cut to maxPathLen bytes. The
+// path is client controlled, so it must be sanitized before it is shown.
+func requestPath(req *http.Request) string {
+	if req.URL == nil {
+		return ""
+	}
+	path := req.URL.Path
+	if len(path) > maxPathLen {
+		path = strings.ToValidUTF8(path[:maxPathLen], "")
+	}
+	return path
+}
+
+func isAgentChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
 // resolveAndCheckCIDR resolves the hostname to IPs and checks whether any
 // fall within a blocked CIDR range. This prevents DNS rebinding attacks
-// where an allowed domain resolves to a private IP.
-func (p *HTTPProxy) resolveAndCheckCIDR(hostname string) (bool, net.IP) {
+// where an allowed domain resolves to a private IP. Lookups go through the
+// upstream pool, so they share the DNS server's cache. It returns the
+// approved addresses, which the dial must use, or blocked with the offending
+// IP, nil when resolution failed.
+func (p *HTTPProxy) resolveAndCheckCIDR(hostname string) (ips []net.IP, blocked bool, blockedIP net.IP) {
 	// If the hostname is already an IP, check it directly.
 	if ip := net.ParseIP(hostname); ip != nil {
 		if p.cidr.IsBlocked(ip) {
-			return true, ip
+			return nil, true, ip
 		}
-		return false, nil
+		return []net.IP{ip}, false, nil
 	}
 
-	addrs, err := p.resolver.LookupIPAddr(context.Background(), hostname)
-	// Fail closed only when lookup returned no usable answers.
-	if err != nil && len(addrs) == 0 {
+	ips, err := p.upstreams.lookupIP(context.Background(), hostname)
+	if err != nil {
 		// Security: do not allow traffic when CIDR validation cannot be completed.
 		// Failing open here would let requests bypass private-IP blocking during
 		// DNS outages or resolver errors.
-		return true, nil
+		return nil, true, nil
 	}
-	for _, addr := range addrs {
-		if p.cidr.IsBlocked(addr.IP) {
-			return true, addr.IP
+	for _, ip := range ips {
+		if p.cidr.IsBlocked(ip) {
+			return nil, true, ip
 		}
 	}
-	return false, nil
+	return ips, false, nil
 }
 
 // SetHostVibepit configures the proxy to rewrite host.vibepit requests to the
 // given gateway address. If allowedPorts is non-nil, only those ports are
 // auto-allowed without requiring an explicit allowlist entry.
 func (p *HTTPProxy) SetHostVibepit(gateway string, allowedPorts []int) {
-	// Strip port from gateway if present; the request port is used instead.
-	if host, _, err := net.SplitHostPort(gateway); err == nil {
-		p.hostGateway = host
-	} else {
-		p.hostGateway = gateway
-	}
+	p.setVirtualHost(HostVibepit, gateway)
 	p.allowHostPorts = make(map[int]bool)
 	for _, port := range allowedPorts {
 		p.allowHostPorts[port] = true
 	}
 }
 
+// SetVirtualHosts configures additional virtual hostnames, mapping each to
+// the address its requests are rewritten to. Unlike host.vibepit, every
+// virtual host port needs an explicit allowlist entry.
+func (p *HTTPProxy) SetVirtualHosts(hosts map[string]string) {
+	for name, target := range hosts {
+		p.setVirtualHost(name, target)
+	}
+}
+
+func (p *HTTPProxy) setVirtualHost(name, target string) {
+	if p.virtualHosts == nil {
+		p.virtualHosts = make(map[string]string)
+	}
+	// Strip port from target if present; the request port is used instead.
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		target = host
+	}
+	p.virtualHosts[strings.ToLower(name)] = target
+}
+
+// SetDecisionHook installs a hook that is asked about every request before the
+// allowlist. Pass nil to remove it. Set it before the proxy serves requests.
+func (p *HTTPProxy) SetDecisionHook(hook DecisionHook) {
+	p.decisionHook = hook
+}
+
+// SetDenylist installs deny-http rules that block matching requests even
+// when the allowlist, a virtual host or the decision hook would allow them.
+// Pass nil to remove it. Set it before the proxy serves requests.
+func (p *HTTPProxy) SetDenylist(deny *HTTPAllowlist) {
+	p.denylist = deny
+}
+
+// SetMaxRequestBytes limits the body size of plain HTTP requests. A value of
+// zero or less disables the limit.
+func (p *HTTPProxy) SetMaxRequestBytes(n int64) {
+	p.maxRequestBytes = max(n, 0)
+}
+
+// requestBodyTooLarge reports whether the request body exceeds the configured
+// limit. A declared Content-Length is checked directly. Bodies of unknown
+// length are buffered up to the limit so an oversized stream is rejected
+// before anything is forwarded upstream.
+func (p *HTTPProxy) requestBodyTooLarge(req *http.Request) bool {
+	if p.maxRequestBytes == 0 || req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	if req.ContentLength > p.maxRequestBytes {
+		return true
+	}
+	if req.ContentLength >= 0 {
+		return false
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, p.maxRequestBytes+1))
+	if int64(len(buf)) > p.maxRequestBytes {
+		return true
+	}
+	body := io.Reader(bytes.NewReader(buf))
+	if err != nil {
+		body = io.MultiReader(body, errReader{err})
+	}
+	req.Body = io.NopCloser(body)
+	return false
+}
+
+// errReader returns err from every Read, so a buffered body still surfaces
+// the read error the client connection produced.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
 func (p *HTTPProxy) isHostPortAllowed(port string) bool {
 	portNum, err := strconv.Atoi(port)
 	if err != nil {
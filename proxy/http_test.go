@@ -1,15 +1,18 @@
 package proxy
 
 import (
-	"context"
-	"errors"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,7 +24,7 @@ func TestHTTPProxy(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 
 		srv := httptest.NewServer(p.Handler())
 		defer srv.Close()
@@ -64,7 +67,7 @@ func TestHTTPProxy(t *testing.T) {
 		// Empty blocker so localhost backend isn't blocked by default private CIDRs.
 		blocker := &CIDRBlocker{}
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 
 		srv := httptest.NewServer(p.Handler())
 		defer srv.Close()
@@ -84,7 +87,7 @@ func TestHTTPProxy(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 
 		srv := httptest.NewServer(p.Handler())
 		defer srv.Close()
@@ -106,7 +109,7 @@ func TestHTTPProxy(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 
 		srv := httptest.NewServer(p.Handler())
 		defer srv.Close()
@@ -134,18 +137,310 @@ func TestHTTPProxy(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
-		p.resolver = &net.Resolver{
-			PreferGo: true,
-			Dial: func(context.Context, string, string) (net.Conn, error) {
-				return nil, errors.New("resolver down")
-			},
-		}
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool([]string{deadUpstream(t)}))
 
-		result := p.checkRequest("example.com", "443")
+		result := p.checkRequest("example.com", "443", requestInfo{})
 		assert.Equal(t, ActionBlock, result.action)
 		assert.Equal(t, "DNS resolution failed during CIDR check", result.reason)
 	})
+
+	t.Run("resolves extra-hosts names from the hosts file", func(t *testing.T) {
+		hostsPath := filepath.Join(t.TempDir(), "hosts")
+		require.NoError(t, os.WriteFile(hostsPath, []byte("192.168.1.2\tllm-server\n"), 0o644))
+		al, err := NewHTTPAllowlist([]string{"llm-server:8000"})
+		require.NoError(t, err)
+		pool := NewUpstreamPool([]string{deadUpstream(t)})
+		pool.hostsPath = hostsPath
+
+		p := NewHTTPProxy(al, NewCIDRBlocker(nil, []string{"192.168.1.0/24"}), NewLogBuffer(100), pool)
+		result := p.checkRequest("llm-server", "8000", requestInfo{})
+		assert.Equal(t, ActionAllow, result.action)
+		assert.Equal(t, []net.IP{net.ParseIP("192.168.1.2")}, result.ips, "the dial uses the checked address")
+
+		p = NewHTTPProxy(al, NewCIDRBlocker(nil, nil), NewLogBuffer(100), pool)
+		result = p.checkRequest("llm-server", "8000", requestInfo{})
+		assert.Equal(t, ActionBlock, result.action)
+		assert.Equal(t, "resolved IP 192.168.1.2 is in blocked CIDR range", result.reason)
+	})
+}
+
+func TestRequestAgent(t *testing.T) {
+	for ua, want := range map[string]string{
+		"claude-cli/1.0.30 (external, cli)": "claude-cli",
+		"curl/8.5.0":                        "curl",
+		"Go-http-client/1.1":                "Go-http-client",
+		"python-requests":                   "python-requests",
+		"":                                  "",
+		"bad\x1b[31m/1.0":                   "",
+		strings.Repeat("a", 33) + "/1.0":    "",
+	} {
+		req := httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil)
+		req.Header.Set("User-Agent", ua)
+		assert.Equal(t, want, requestAgent(req), "User-Agent %q", ua)
+	}
+}
+
+func TestHTTPProxyLogsAgent(t *testing.T) {
+	al, err := NewHTTPAllowlist(nil)
+	require.NoError(t, err)
+	log := NewLogBuffer(100)
+	p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(nil))
+
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://blocked.example.com/", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "claude-cli/1.0.30 (external, cli)")
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	entries := log.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "claude-cli", entries[0].Agent)
+}
+
+func TestHTTPProxyLogsMethodAndPath(t *testing.T) {
+	al, err := NewHTTPAllowlist(nil)
+	require.NoError(t, err)
+	log := NewLogBuffer(100)
+	p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(nil))
+
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		resp, err := client.Post("http://blocked.example.com/api/v1/items?token=secret", "application/json", strings.NewReader("{}"))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		entries := log.Entries()
+		require.NotEmpty(t, entries)
+		e := entries[len(entries)-1]
+		assert.Equal(t, http.MethodPost, e.Method)
+		assert.Equal(t, "/api/v1/items", e.Path, "the query must not be logged")
+	})
+
+	t.Run("CONNECT", func(t *testing.T) {
+		_, err := client.Get("https://blocked.example.com/api/v1/items")
+		require.Error(t, err)
+
+		entries := log.Entries()
+		require.NotEmpty(t, entries)
+		e := entries[len(entries)-1]
+		assert.Empty(t, e.Method)
+		assert.Empty(t, e.Path)
+
+		data, err := json.Marshal(e)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), `"method"`)
+		assert.NotContains(t, string(data), `"path"`)
+	})
+}
+
+func TestRequestPath(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/a/b?q=1", nil)
+	assert.Equal(t, "/a/b", requestPath(req))
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/"+strings.Repeat("ä", maxPathLen), nil)
+	path := requestPath(req)
+	assert.LessOrEqual(t, len(path), maxPathLen)
+	assert.True(t, utf8.ValidString(path), "a cut rune must not be kept")
+}
+
+func TestHTTPProxyDecisionHook(t *testing.T) {
+	newProxy := func(t *testing.T, allow []string, hook DecisionHook) (*HTTPProxy, *LogBuffer) {
+		t.Helper()
+		al, err := NewHTTPAllowlist(allow)
+		require.NoError(t, err)
+		log := NewLogBuffer(100)
+		p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(nil))
+		p.SetDecisionHook(hook)
+		return p, log
+	}
+
+	t.Run("hook allows a host missing from the allowlist", func(t *testing.T) {
+		p, log := newProxy(t, nil, func(host, port string) (bool, string, bool) {
+			return host == "203.0.113.7", "approved by policy service", true
+		})
+		result := p.checkRequest("203.0.113.7", "443", requestInfo{})
+		assert.Equal(t, ActionAllow, result.action)
+		assert.Equal(t, "approved by policy service", log.Entries()[0].Reason)
+	})
+
+	t.Run("hook blocks an allowlisted host", func(t *testing.T) {
+		p, log := newProxy(t, []string{"203.0.113.7:443"}, func(host, port string) (bool, string, bool) {
+			return false, "", true
+		})
+		result := p.checkRequest("203.0.113.7", "443", requestInfo{})
+		assert.Equal(t, ActionBlock, result.action)
+		assert.True(t, result.byHook)
+		assert.Equal(t, "blocked by decision hook", log.Entries()[0].Reason)
+	})
+
+	t.Run("declined hook falls back to the allowlist", func(t *testing.T) {
+		p, _ := newProxy(t, []string{"203.0.113.7:443"}, func(host, port string) (bool, string, bool) {
+			return false, "", false
+		})
+		assert.Equal(t, ActionAllow, p.checkRequest("203.0.113.7", "443", requestInfo{}).action)
+		assert.Equal(t, ActionBlock, p.checkRequest("203.0.113.8", "443", requestInfo{}).action)
+	})
+
+	t.Run("hook cannot bypass the CIDR blocklist", func(t *testing.T) {
+		p, _ := newProxy(t, nil, func(host, port string) (bool, string, bool) {
+			return true, "", true
+		})
+		result := p.checkRequest("10.0.0.1", "443", requestInfo{})
+		assert.Equal(t, ActionBlock, result.action)
+		assert.Contains(t, result.reason, "blocked CIDR")
+	})
+
+	t.Run("plain HTTP block names the policy reason", func(t *testing.T) {
+		p, _ := newProxy(t, nil, func(host, port string) (bool, string, bool) {
+			return false, "pending approval", true
+		})
+		srv := httptest.NewServer(p.Handler())
+		defer srv.Close()
+
+		proxyURL, _ := url.Parse(srv.URL)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+		resp, err := client.Get("http://203.0.113.7/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), "blocked by policy: pending approval")
+	})
+}
+
+func TestHTTPProxyDenylist(t *testing.T) {
+	al, err := NewHTTPAllowlist([]string{"*.example.com:*"})
+	require.NoError(t, err)
+	deny, err := NewHTTPAllowlist([]string{"paste.example.com:*"})
+	require.NoError(t, err)
+	log := NewLogBuffer(100)
+	p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(nil))
+	p.SetDenylist(deny)
+
+	t.Run("wins over a wildcard allow entry", func(t *testing.T) {
+		result := p.checkRequest("paste.example.com", "443", requestInfo{})
+		assert.Equal(t, ActionBlock, result.action)
+		assert.Equal(t, "explicitly denied", result.reason)
+		entries := log.Entries()
+		assert.Equal(t, "explicitly denied", entries[len(entries)-1].Reason)
+	})
+
+	t.Run("wins over the decision hook", func(t *testing.T) {
+		p.SetDecisionHook(func(host, port string) (bool, string, bool) { return true, "", true })
+		t.Cleanup(func() { p.SetDecisionHook(nil) })
+		assert.Equal(t, ActionBlock, p.checkRequest("paste.example.com", "443", requestInfo{}).action)
+	})
+
+	t.Run("plain HTTP block names the deny entry", func(t *testing.T) {
+		srv := httptest.NewServer(p.Handler())
+		defer srv.Close()
+
+		proxyURL, _ := url.Parse(srv.URL)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+		resp, err := client.Get("http://paste.example.com/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), "blocked by a deny-http entry")
+		assert.NotContains(t, string(body), "not in the allowlist")
+	})
+}
+
+func TestHTTPProxyMaxRequestBytes(t *testing.T) {
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	host := backendURL.Host
+
+	newClient := func(t *testing.T) (*http.Client, *LogBuffer) {
+		t.Helper()
+		al, err := NewHTTPAllowlist([]string{host})
+		require.NoError(t, err)
+		log := NewLogBuffer(100)
+		p := NewHTTPProxy(al, &CIDRBlocker{}, log, NewUpstreamPool(nil))
+		p.SetMaxRequestBytes(16)
+
+		srv := httptest.NewServer(p.Handler())
+		t.Cleanup(srv.Close)
+
+		proxyURL, _ := url.Parse(srv.URL)
+		return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}, log
+	}
+
+	assertBlocked := func(t *testing.T, resp *http.Response, log *LogBuffer) {
+		t.Helper()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		var found bool
+		for _, e := range log.Entries() {
+			if e.Action == ActionBlock && e.Reason == "request body exceeds max-request-bytes" {
+				found = true
+				break
+			}
+		}
+		assert.True(t, found, "expected log entry for oversized body")
+	}
+
+	t.Run("rejects oversized Content-Length", func(t *testing.T) {
+		client, log := newClient(t)
+		resp, err := client.Post("http://"+host+"/", "text/plain", strings.NewReader(strings.Repeat("x", 17)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assertBlocked(t, resp, log)
+	})
+
+	t.Run("rejects oversized streamed body", func(t *testing.T) {
+		client, log := newClient(t)
+		// io.MultiReader hides the length, so the body is sent chunked.
+		body := io.MultiReader(strings.NewReader(strings.Repeat("x", 17)))
+		resp, err := client.Post("http://"+host+"/", "text/plain", body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assertBlocked(t, resp, log)
+	})
+
+	t.Run("blocks a domain that is not allowed before checking the body", func(t *testing.T) {
+		client, log := newClient(t)
+		body := io.MultiReader(strings.NewReader(strings.Repeat("x", 17)))
+		resp, err := client.Post("http://not-allowed.example.com/", "text/plain", body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		entries := log.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, ActionBlock, entries[0].Action)
+		assert.Equal(t, "domain not in allowlist", entries[0].Reason)
+	})
+
+	t.Run("forwards body within the limit", func(t *testing.T) {
+		client, _ := newClient(t)
+		body := io.MultiReader(strings.NewReader("small body"))
+		resp, err := client.Post("http://"+host+"/", "text/plain", body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "small body", <-received)
+	})
 }
 
 func TestHTTPProxyHostVibepit(t *testing.T) {
@@ -169,7 +464,7 @@ func TestHTTPProxyHostVibepit(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 		p.SetHostVibepit(backendURL.Host, []int{backendPortInt})
 
 		srv := httptest.NewServer(p.Handler())
@@ -192,7 +487,7 @@ func TestHTTPProxyHostVibepit(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 		p.SetHostVibepit(backendURL.Host, []int{9999})
 
 		srv := httptest.NewServer(p.Handler())
@@ -213,7 +508,7 @@ func TestHTTPProxyHostVibepit(t *testing.T) {
 		require.NoError(t, err)
 		blocker := NewCIDRBlocker(nil, nil)
 		log := NewLogBuffer(100)
-		p := NewHTTPProxy(al, blocker, log, DefaultUpstreamDNS)
+		p := NewHTTPProxy(al, blocker, log, NewUpstreamPool(nil))
 		p.SetHostVibepit(backendURL.Host, nil)
 
 		srv := httptest.NewServer(p.Handler())
@@ -230,4 +525,98 @@ func TestHTTPProxyHostVibepit(t *testing.T) {
 		body, _ := io.ReadAll(resp.Body)
 		assert.Equal(t, "host-service", string(body))
 	})
+
+	t.Run("virtual host requires allowlist entry and is rewritten", func(t *testing.T) {
+		newClient := func(t *testing.T, allow []string) *http.Client {
+			t.Helper()
+			al, err := NewHTTPAllowlist(allow)
+			require.NoError(t, err)
+			p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), NewLogBuffer(100), NewUpstreamPool(nil))
+			p.SetHostVibepit("192.0.2.1", []int{backendPortInt})
+			p.SetVirtualHosts(map[string]string{"db.vibepit": backendURL.Host})
+
+			srv := httptest.NewServer(p.Handler())
+			t.Cleanup(srv.Close)
+
+			proxyURL, _ := url.Parse(srv.URL)
+			return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		}
+
+		// allow-host-ports only applies to host.vibepit.
+		resp, err := newClient(t, nil).Get("http://db.vibepit:" + backendPortStr + "/")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		resp, err = newClient(t, []string{"db.vibepit:" + backendPortStr}).Get("http://db.vibepit:" + backendPortStr + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "host-service", string(body))
+	})
+}
+
+func TestHTTPProxyByteStats(t *testing.T) {
+	newProxy := func(t *testing.T, backend string) (*LogBuffer, *url.URL) {
+		t.Helper()
+		al, err := NewHTTPAllowlist([]string{"svc.vibepit:*"})
+		require.NoError(t, err)
+		log := NewLogBuffer(100)
+		p := NewHTTPProxy(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(nil))
+		p.SetVirtualHosts(map[string]string{"svc.vibepit": backend})
+
+		srv := httptest.NewServer(p.Handler())
+		t.Cleanup(srv.Close)
+		proxyURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		return log, proxyURL
+	}
+
+	t.Run("plain HTTP counts request and response bodies", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			w.Write([]byte(strings.Repeat("r", 300)))
+		}))
+		defer backend.Close()
+		backendURL, _ := url.Parse(backend.URL)
+		_, port, _ := net.SplitHostPort(backendURL.Host)
+
+		log, proxyURL := newProxy(t, backendURL.Host)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Post("http://svc.vibepit:"+port+"/", "text/plain", strings.NewReader(strings.Repeat("s", 100)))
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		stats := log.Stats()["svc.vibepit"]
+		assert.Equal(t, int64(100), stats.BytesSent)
+		assert.Equal(t, int64(300), stats.BytesReceived)
+	})
+
+	t.Run("CONNECT counts tunnel traffic", func(t *testing.T) {
+		backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat("r", 300)))
+		}))
+		defer backend.Close()
+		backendURL, _ := url.Parse(backend.URL)
+		_, port, _ := net.SplitHostPort(backendURL.Host)
+
+		log, proxyURL := newProxy(t, backendURL.Host)
+		transport := backend.Client().Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		transport.TLSClientConfig.ServerName = "example.com"
+		client := &http.Client{Transport: transport}
+
+		resp, err := client.Get("https://svc.vibepit:" + port + "/")
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Len(t, body, 300)
+		transport.CloseIdleConnections()
+
+		stats := log.Stats()["svc.vibepit"]
+		assert.Positive(t, stats.BytesSent, "the TLS handshake and request went through the tunnel")
+		assert.Greater(t, stats.BytesReceived, int64(300), "the response and TLS overhead came back")
+	})
 }
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,18 +21,29 @@ const (
 )
 
 type LogEntry struct {
-	ID     uint64    `json:"id"`
-	Time   time.Time `json:"time"`
-	Domain string    `json:"domain"`
-	Port   string    `json:"port,omitempty"`
-	Action Action    `json:"action"`
-	Source Source    `json:"source"`
-	Reason string    `json:"reason,omitempty"`
+	ID       uint64    `json:"id"`
+	Time     time.Time `json:"time"`
+	Domain   string    `json:"domain"`
+	Port     string    `json:"port,omitempty"`
+	QType    string    `json:"qtype,omitempty"`  // DNS query type (A, AAAA, ...), DNS entries only
+	Agent    string    `json:"agent,omitempty"`  // client product name from the User-Agent, proxy entries only
+	Method   string    `json:"method,omitempty"` // HTTP method, plain HTTP proxy entries only
+	Path     string    `json:"path,omitempty"`   // URL path without the query, plain HTTP proxy entries only
+	Action   Action    `json:"action"`
+	Source   Source    `json:"source"`
+	Reason   string    `json:"reason,omitempty"`
+	Upstream string    `json:"upstream,omitempty"` // DNS server that answered, DNS entries only
 }
 
 type DomainStats struct {
 	Allowed int `json:"allowed"`
 	Blocked int `json:"blocked"`
+
+	// BytesSent and BytesReceived count the traffic of allowed requests:
+	// the request and response bodies of plain HTTP, and everything a
+	// CONNECT tunnel carries in either direction, including TLS overhead.
+	BytesSent     int64 `json:"bytes-sent"`
+	BytesReceived int64 `json:"bytes-received"`
 }
 
 type LogBuffer struct {
@@ -42,6 +54,25 @@ type LogBuffer struct {
 	full    bool
 	nextID  uint64
 	stats   map[string]*DomainStats
+	traffic map[string]*trafficCounter
+	subs    map[chan LogEntry]struct{}
+}
+
+// trafficCounter counts the bytes of one domain. The counters are atomic so
+// connections can add to them on every read and write without taking the
+// buffer lock.
+type trafficCounter struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (c *trafficCounter) add(sent, received int64) {
+	if sent != 0 {
+		c.sent.Add(sent)
+	}
+	if received != 0 {
+		c.received.Add(received)
+	}
 }
 
 func NewLogBuffer(capacity int) *LogBuffer {
@@ -50,6 +81,8 @@ func NewLogBuffer(capacity int) *LogBuffer {
 		cap:     capacity,
 		nextID:  1,
 		stats:   make(map[string]*DomainStats),
+		traffic: make(map[string]*trafficCounter),
+		subs:    make(map[chan LogEntry]struct{}),
 	}
 }
 
@@ -76,6 +109,36 @@ func (b *LogBuffer) Add(entry LogEntry) {
 	case ActionBlock:
 		s.Blocked++
 	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- entry:
+		default:
+			// Never block the proxy on a slow subscriber.
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives every entry added after the call,
+// buffering up to size entries, and a function that ends the subscription.
+// Add never waits for a subscriber: when its buffer is full, the subscriber
+// is dropped and its channel closed.
+func (b *LogBuffer) Subscribe(size int) (<-chan LogEntry, func()) {
+	ch := make(chan LogEntry, size)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
 }
 
 func (b *LogBuffer) Entries() []LogEntry {
@@ -130,6 +193,25 @@ func (b *LogBuffer) entriesLocked() []LogEntry {
 	return result
 }
 
+// AddBytes adds transferred bytes to the stats of domain.
+func (b *LogBuffer) AddBytes(domain string, sent, received int64) {
+	b.trafficFor(domain).add(sent, received)
+}
+
+// trafficFor returns the byte counters of domain, creating them on first
+// use. Connections look them up once and add to them as data passes.
+func (b *LogBuffer) trafficFor(domain string) *trafficCounter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.traffic[domain]
+	if !ok {
+		c = &trafficCounter{}
+		b.traffic[domain] = c
+	}
+	return c
+}
+
 func (b *LogBuffer) Stats() map[string]DomainStats {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -138,5 +220,14 @@ func (b *LogBuffer) Stats() map[string]DomainStats {
 	for k, v := range b.stats {
 		result[k] = *v
 	}
+	for k, c := range b.traffic {
+		sent, received := c.sent.Load(), c.received.Load()
+		if sent == 0 && received == 0 {
+			continue
+		}
+		s := result[k]
+		s.BytesSent, s.BytesReceived = sent, received
+		result[k] = s
+	}
 	return result
 }
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -58,6 +59,78 @@ func TestLogBuffer(t *testing.T) {
 		assert.Equal(t, 1, stats["a.com"].Blocked)
 		assert.Equal(t, 1, stats["b.com"].Blocked)
 	})
+
+	t.Run("stats add up bytes per domain", func(t *testing.T) {
+		buf := NewLogBuffer(100)
+		buf.Add(LogEntry{Domain: "a.com", Action: ActionAllow})
+
+		var wg sync.WaitGroup
+		for range 100 {
+			wg.Go(func() { buf.AddBytes("a.com", 10, 20) })
+		}
+		wg.Wait()
+		buf.AddBytes("b.com", 0, 5)
+
+		stats := buf.Stats()
+		assert.Equal(t, DomainStats{Allowed: 1, BytesSent: 1000, BytesReceived: 2000}, stats["a.com"])
+		assert.Equal(t, DomainStats{BytesReceived: 5}, stats["b.com"])
+	})
+
+	t.Run("connections share the counters of a domain", func(t *testing.T) {
+		buf := NewLogBuffer(100)
+		first, second := buf.trafficFor("a.com"), buf.trafficFor("a.com")
+		assert.Same(t, first, second)
+
+		first.add(10, 0)
+		second.add(0, 20)
+		buf.trafficFor("idle.com")
+
+		stats := buf.Stats()
+		assert.Equal(t, DomainStats{BytesSent: 10, BytesReceived: 20}, stats["a.com"])
+		assert.NotContains(t, stats, "idle.com", "a connection without traffic adds no stats")
+	})
+}
+
+func TestLogBufferSubscribe(t *testing.T) {
+	t.Run("receives entries added after subscribing", func(t *testing.T) {
+		buf := NewLogBuffer(10)
+		buf.Add(LogEntry{Domain: "before.com"})
+		entries, cancel := buf.Subscribe(10)
+		defer cancel()
+
+		buf.Add(LogEntry{Domain: "a.com"})
+		e := <-entries
+		assert.Equal(t, "a.com", e.Domain)
+		assert.Equal(t, uint64(2), e.ID)
+	})
+
+	t.Run("drops slow subscribers without blocking", func(t *testing.T) {
+		buf := NewLogBuffer(10)
+		entries, cancel := buf.Subscribe(1)
+		defer cancel()
+
+		buf.Add(LogEntry{Domain: "a.com"})
+		buf.Add(LogEntry{Domain: "b.com"})
+		buf.Add(LogEntry{Domain: "c.com"})
+
+		e, ok := <-entries
+		require.True(t, ok)
+		assert.Equal(t, "a.com", e.Domain)
+		_, ok = <-entries
+		assert.False(t, ok, "channel is closed after the subscriber was dropped")
+		assert.Len(t, buf.Entries(), 3)
+	})
+
+	t.Run("cancel ends the subscription", func(t *testing.T) {
+		buf := NewLogBuffer(10)
+		entries, cancel := buf.Subscribe(1)
+		cancel()
+		cancel()
+
+		buf.Add(LogEntry{Domain: "a.com"})
+		_, ok := <-entries
+		assert.False(t, ok)
+	})
 }
 
 func TestEntriesAfter(t *testing.T) {
@@ -2,7 +2,10 @@
 package proxy
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -24,22 +27,64 @@ type MTLSCredentials struct {
 
 	ServerCert    *x509.Certificate
 	serverCertDER []byte
-	serverKey     ed25519.PrivateKey
+	serverKey     crypto.Signer
 
 	ClientCert    *x509.Certificate
 	clientCertDER []byte
-	clientKey     ed25519.PrivateKey
+	clientKey     crypto.Signer
+}
+
+// KeyType is the key algorithm of the mTLS certificates.
+type KeyType string
+
+const (
+	KeyTypeEd25519   KeyType = "ed25519"
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+)
+
+// ParseKeyType returns the KeyType named s. An empty s means
+// KeyTypeEd25519.
+func ParseKeyType(s string) (KeyType, error) {
+	switch KeyType(s) {
+	case "", KeyTypeEd25519:
+		return KeyTypeEd25519, nil
+	case KeyTypeECDSAP256:
+		return KeyTypeECDSAP256, nil
+	}
+	return "", fmt.Errorf("unsupported key type %q, use %s or %s", s, KeyTypeEd25519, KeyTypeECDSAP256)
+}
+
+// MTLSOptions configures GenerateMTLSCredentials.
+type MTLSOptions struct {
+	// Lifetime is the validity of all three certificates.
+	Lifetime time.Duration
+	// KeyType is the key algorithm of all three certificates. Empty means
+	// KeyTypeEd25519. ECDSA P-256 is for TLS inspection middleboxes that
+	// reject ed25519.
+	KeyType KeyType
+}
+
+// generateKey returns a new private key of the given type.
+func generateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case "", KeyTypeEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", keyType)
 }
 
 // GenerateMTLSCredentials creates an ephemeral CA and signs a server cert
 // (SAN: 127.0.0.1, EKU: serverAuth) and a client cert (EKU: clientAuth).
 // The CA private key is discarded after signing.
-func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
+func GenerateMTLSCredentials(opts MTLSOptions) (*MTLSCredentials, error) {
 	now := time.Now()
-	notAfter := now.Add(lifetime)
+	notAfter := now.Add(opts.Lifetime)
 
 	// Generate ephemeral CA.
-	caPub, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	caPriv, err := generateKey(opts.KeyType)
 	if err != nil {
 		return nil, fmt.Errorf("generate CA key: %w", err)
 	}
@@ -57,7 +102,7 @@ func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
 		BasicConstraintsValid: true,
 		KeyUsage:              x509.KeyUsageCertSign,
 	}
-	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPub, caPriv)
+	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPriv.Public(), caPriv)
 	if err != nil {
 		return nil, fmt.Errorf("create CA cert: %w", err)
 	}
@@ -67,7 +112,7 @@ func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
 	}
 
 	// Generate server cert.
-	serverPub, serverPriv, err := ed25519.GenerateKey(rand.Reader)
+	serverPriv, err := generateKey(opts.KeyType)
 	if err != nil {
 		return nil, fmt.Errorf("generate server key: %w", err)
 	}
@@ -84,7 +129,7 @@ func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
 	}
-	serverCertDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, serverPub, caPriv)
+	serverCertDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, serverPriv.Public(), caPriv)
 	if err != nil {
 		return nil, fmt.Errorf("create server cert: %w", err)
 	}
@@ -94,7 +139,7 @@ func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
 	}
 
 	// Generate client cert.
-	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	clientPriv, err := generateKey(opts.KeyType)
 	if err != nil {
 		return nil, fmt.Errorf("generate client key: %w", err)
 	}
@@ -110,7 +155,7 @@ func GenerateMTLSCredentials(lifetime time.Duration) (*MTLSCredentials, error) {
 		KeyUsage:     x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	}
-	clientCertDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, clientPub, caPriv)
+	clientCertDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, clientPriv.Public(), caPriv)
 	if err != nil {
 		return nil, fmt.Errorf("create client cert: %w", err)
 	}
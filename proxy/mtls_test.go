@@ -14,7 +14,7 @@ import (
 )
 
 func TestGenerateMTLSCredentials(t *testing.T) {
-	creds, err := GenerateMTLSCredentials(30 * 24 * time.Hour)
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 30 * 24 * time.Hour})
 	require.NoError(t, err)
 
 	t.Run("CA cert is self-signed and valid", func(t *testing.T) {
@@ -60,7 +60,7 @@ func TestGenerateMTLSCredentials(t *testing.T) {
 }
 
 func TestMTLSCredentialsPEM(t *testing.T) {
-	creds, err := GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	t.Run("PEM round-trips for CA cert", func(t *testing.T) {
@@ -82,7 +82,7 @@ func TestMTLSCredentialsPEM(t *testing.T) {
 }
 
 func TestMTLSHandshake(t *testing.T) {
-	creds, err := GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	serverTLS, err := creds.ServerTLSConfig()
@@ -127,7 +127,7 @@ func TestMTLSHandshake(t *testing.T) {
 	})
 
 	t.Run("client with wrong CA is rejected", func(t *testing.T) {
-		otherCreds, err := GenerateMTLSCredentials(24 * time.Hour)
+		otherCreds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 24 * time.Hour})
 		require.NoError(t, err)
 
 		otherTLS, err := otherCreds.ClientTLSConfig()
@@ -144,8 +144,79 @@ func TestMTLSHandshake(t *testing.T) {
 	})
 }
 
+func TestMTLSKeyTypes(t *testing.T) {
+	for keyType, want := range map[KeyType]struct {
+		key x509.PublicKeyAlgorithm
+		sig x509.SignatureAlgorithm
+	}{
+		"":               {x509.Ed25519, x509.PureEd25519},
+		KeyTypeEd25519:   {x509.Ed25519, x509.PureEd25519},
+		KeyTypeECDSAP256: {x509.ECDSA, x509.ECDSAWithSHA256},
+	} {
+		t.Run(string(keyType), func(t *testing.T) {
+			creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: time.Hour, KeyType: keyType})
+			require.NoError(t, err)
+
+			for _, cert := range []*x509.Certificate{creds.CACert, creds.ServerCert, creds.ClientCert} {
+				assert.Equal(t, want.key, cert.PublicKeyAlgorithm, cert.Subject.CommonName)
+				assert.Equal(t, want.sig, cert.SignatureAlgorithm, cert.Subject.CommonName)
+			}
+			pool := x509.NewCertPool()
+			pool.AddCert(creds.CACert)
+			_, err = creds.ServerCert.Verify(x509.VerifyOptions{Roots: pool})
+			require.NoError(t, err)
+			_, err = creds.ClientCert.Verify(x509.VerifyOptions{
+				Roots:     pool,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			require.NoError(t, err)
+
+			// The proxy loads its credentials from the PEM environment.
+			t.Setenv(EnvProxyTLSKey, string(creds.ServerKeyPEM()))
+			t.Setenv(EnvProxyTLSCert, string(creds.ServerCertPEM()))
+			t.Setenv(EnvProxyCACert, string(creds.CACertPEM()))
+			serverTLS, err := LoadServerTLSConfigFromEnv()
+			require.NoError(t, err)
+			ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+			require.NoError(t, err)
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})}
+			go srv.Serve(ln)
+			defer srv.Close()
+
+			clientTLS, err := creds.ClientTLSConfig()
+			require.NoError(t, err)
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get("https://" + ln.Addr().String())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+
+	t.Run("rejects unknown key types", func(t *testing.T) {
+		_, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: time.Hour, KeyType: "rsa-2048"})
+		assert.ErrorContains(t, err, `unsupported key type "rsa-2048"`)
+	})
+}
+
+func TestParseKeyType(t *testing.T) {
+	for s, want := range map[string]KeyType{
+		"":           KeyTypeEd25519,
+		"ed25519":    KeyTypeEd25519,
+		"ecdsa-p256": KeyTypeECDSAP256,
+	} {
+		got, err := ParseKeyType(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseKeyType("rsa")
+	assert.ErrorContains(t, err, "use ed25519 or ecdsa-p256")
+}
+
 func TestServerTLSConfigFromEnv(t *testing.T) {
-	creds, err := GenerateMTLSCredentials(24 * time.Hour)
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 24 * time.Hour})
 	require.NoError(t, err)
 
 	t.Setenv("VIBEPIT_PROXY_TLS_KEY", string(creds.ServerKeyPEM()))
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	_ "embed"
+	"fmt"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,7 +21,11 @@ type Preset struct {
 	Includes    []string `yaml:"includes"` // other preset names (meta-presets)
 }
 
-// PresetRegistry holds all built-in presets in definition order.
+// CustomPresetGroup is the group of presets defined in a project config.
+const CustomPresetGroup = "Custom"
+
+// PresetRegistry holds all built-in presets in definition order, followed by
+// the presets added with Register.
 type PresetRegistry struct {
 	presets []Preset
 	index   map[string]int
@@ -41,6 +46,17 @@ func NewPresetRegistry() *PresetRegistry {
 	return &PresetRegistry{presets: presets, index: index}
 }
 
+// Register adds a preset after the existing ones. It fails when a preset
+// with the same name is already registered.
+func (r *PresetRegistry) Register(p Preset) error {
+	if _, ok := r.index[p.Name]; ok {
+		return fmt.Errorf("preset %q already exists", p.Name)
+	}
+	r.index[p.Name] = len(r.presets)
+	r.presets = append(r.presets, p)
+	return nil
+}
+
 // Get returns a preset by name.
 func (r *PresetRegistry) Get(name string) (Preset, bool) {
 	i, ok := r.index[name]
@@ -58,8 +74,28 @@ func (r *PresetRegistry) All() []Preset {
 // Expand resolves a list of preset names into a deduplicated flat list of
 // domains, recursively expanding Includes with cycle detection.
 func (r *PresetRegistry) Expand(names []string) []string {
-	seen := make(map[string]bool)
 	var domains []string
+	r.walk(names, func(_, domain string) {
+		domains = append(domains, domain)
+	})
+	return domains
+}
+
+// Sources maps every domain Expand returns for names to the preset that
+// lists it. For meta-presets that is the included preset, not the meta-preset
+// itself.
+func (r *PresetRegistry) Sources(names []string) map[string]string {
+	sources := make(map[string]string)
+	r.walk(names, func(preset, domain string) {
+		sources[domain] = preset
+	})
+	return sources
+}
+
+// walk calls fn for each domain of the named presets and their includes in
+// Expand order, once per domain, together with the preset that lists it.
+func (r *PresetRegistry) walk(names []string, fn func(preset, domain string)) {
+	seen := make(map[string]bool)
 	visited := make(map[string]bool)
 
 	var expand func(name string)
@@ -78,7 +114,7 @@ func (r *PresetRegistry) Expand(names []string) []string {
 		for _, d := range p.Domains {
 			if !seen[d] {
 				seen[d] = true
-				domains = append(domains, d)
+				fn(p.Name, d)
 			}
 		}
 	}
@@ -86,5 +122,4 @@ func (r *PresetRegistry) Expand(names []string) []string {
 	for _, name := range names {
 		expand(name)
 	}
-	return domains
 }
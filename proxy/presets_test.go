@@ -127,4 +127,26 @@ func TestPresetRegistry(t *testing.T) {
 			assert.Empty(t, p.Matchers, "preset %q should have no matchers", name)
 		}
 	})
+	t.Run("sources name the preset that lists each domain", func(t *testing.T) {
+		sources := reg.Sources([]string{"default", "pkg-go"})
+		assert.Equal(t, "pkg-go", sources["sum.golang.org:443"])
+		assert.Equal(t, "anthropic", sources["api.anthropic.com:443"])
+		assert.Len(t, sources, len(reg.Expand([]string{"default", "pkg-go"})))
+	})
+
+	t.Run("register adds a preset", func(t *testing.T) {
+		reg := NewPresetRegistry()
+		require.NoError(t, reg.Register(Preset{Name: "internal", Group: CustomPresetGroup, Domains: []string{"git.corp.example:443"}}))
+
+		p, ok := reg.Get("internal")
+		require.True(t, ok)
+		assert.Equal(t, CustomPresetGroup, p.Group)
+		assert.Equal(t, "internal", reg.All()[len(reg.All())-1].Name)
+		assert.Equal(t, []string{"git.corp.example:443"}, reg.Expand([]string{"internal"}))
+	})
+
+	t.Run("register rejects existing names", func(t *testing.T) {
+		reg := NewPresetRegistry()
+		assert.ErrorContains(t, reg.Register(Preset{Name: "pkg-go"}), `preset "pkg-go" already exists`)
+	})
 }
@@ -2,14 +2,19 @@ package proxy
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"os"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -18,10 +23,24 @@ const (
 	DefaultDNSPort     = 53
 	LogBufferCapacity  = 10000
 
+	// EntrySourceRuntime is the entry source GET /config reports for allow
+	// entries added while the proxy runs.
+	EntrySourceRuntime = "runtime"
+
+	// HostVibepit is the virtual hostname that reaches the host machine.
+	HostVibepit = "host.vibepit"
+	// VirtualHostSuffix marks extra-hosts entries that the proxy serves as
+	// virtual hosts, like host.vibepit.
+	VirtualHostSuffix = ".vibepit"
+
 	httpProxyReadHeaderTimeout = 10 * time.Second
 	httpProxyIdleTimeout       = 2 * time.Minute
 	controlAPIReadTimeout      = 15 * time.Second
 	controlAPIWriteTimeout     = 30 * time.Second
+
+	// shutdownTimeout bounds how long Run waits for in-flight requests to
+	// drain after its context is canceled.
+	shutdownTimeout = 5 * time.Second
 )
 
 // ProxyConfig is the JSON config file passed to the proxy container.
@@ -30,7 +49,7 @@ type ProxyConfig struct {
 	AllowDNS       []string `json:"allow-dns"`
 	BlockCIDR      []string `json:"block-cidr"`
 	AllowCIDR      []string `json:"allow-cidr"`
-	UpstreamDNS    string   `json:"upstream-dns"`
+	UpstreamDNS    []string `json:"upstream-dns"`
 	AllowHostPorts []int    `json:"allow-host-ports"`
 	ProxyIP        string   `json:"proxy-ip"`
 	HostGateway    string   `json:"host-gateway"`
@@ -38,13 +57,107 @@ type ProxyConfig struct {
 	ControlAPIPort int      `json:"control-api-port"`
 	DNSPort        int      `json:"dns-port"`
 	SSHForwardAddr string   `json:"ssh-forward-addr,omitempty"`
+
+	// DenyHTTP and DenyDNS block matching requests and queries before any
+	// allow rule is consulted. The control API refuses to allow them.
+	DenyHTTP []string `json:"deny-http,omitempty"`
+	DenyDNS  []string `json:"deny-dns,omitempty"`
+
+	// UpstreamDoH lists DNS-over-HTTPS resolver URLs like
+	// "https://1.1.1.1/dns-query". When set, they replace UpstreamDNS.
+	UpstreamDoH []string `json:"upstream-doh,omitempty"`
+
+	// ControlAPISocket makes the control API listen on this unix socket
+	// instead of ControlAPIPort.
+	ControlAPISocket string `json:"control-api-socket,omitempty"`
+
+	// VirtualHosts maps additional *.vibepit hostnames to their target
+	// address. They resolve to the proxy and are gated by allow-http.
+	VirtualHosts map[string]string `json:"virtual-hosts,omitempty"`
+
+	// MaxRequestBytes caps plain HTTP request bodies. Zero means unlimited.
+	MaxRequestBytes int64 `json:"max-request-bytes,omitempty"`
+
+	// DNSCacheSize bounds the number of cached upstream answers. Zero means
+	// the default of 1024.
+	DNSCacheSize int `json:"dns-cache-size,omitempty"`
+
+	// AllowPrivateNetwork turns off the default blocking of the private
+	// network ranges. BlockCIDR still applies.
+	AllowPrivateNetwork bool `json:"allow-private-network,omitempty"`
+
+	// EntryComments maps allow entries to their config comment. It is not
+	// used for matching; the control API returns it for display.
+	EntryComments map[string]string `json:"entry-comments,omitempty"`
+
+	// EntrySources maps allow entries to the config layer or preset they
+	// came from. GET /config only returns it with ?sources=true.
+	EntrySources map[string]string `json:"entry-sources,omitempty"`
+}
+
+// PolicyHash returns a hex SHA-256 hash of the settings that decide what the
+// proxy allows. Runtime settings like ports and addresses, the order of list
+// entries, and comments don't change the hash, so the config files hash the
+// same as the proxy config they were turned into.
+func (c ProxyConfig) PolicyHash() string {
+	upstreamDNS := c.UpstreamDNS
+	if len(upstreamDNS) == 0 && len(c.UpstreamDoH) == 0 {
+		upstreamDNS = []string{DefaultUpstreamDNS}
+	}
+	virtualHosts := c.VirtualHosts
+	if len(virtualHosts) == 0 {
+		virtualHosts = nil
+	}
+	policy := struct {
+		AllowHTTP           []string          `json:"allow-http"`
+		AllowDNS            []string          `json:"allow-dns"`
+		BlockCIDR           []string          `json:"block-cidr"`
+		AllowCIDR           []string          `json:"allow-cidr"`
+		UpstreamDNS         []string          `json:"upstream-dns"`
+		AllowHostPorts      []int             `json:"allow-host-ports"`
+		VirtualHosts        map[string]string `json:"virtual-hosts"`
+		MaxRequestBytes     int64             `json:"max-request-bytes"`
+		AllowPrivateNetwork bool              `json:"allow-private-network"`
+		DenyHTTP            []string          `json:"deny-http,omitempty"`
+		DenyDNS             []string          `json:"deny-dns,omitempty"`
+		UpstreamDoH         []string          `json:"upstream-doh,omitempty"`
+	}{
+		AllowHTTP:           slices.Sorted(slices.Values(c.AllowHTTP)),
+		AllowDNS:            slices.Sorted(slices.Values(c.AllowDNS)),
+		BlockCIDR:           slices.Sorted(slices.Values(c.BlockCIDR)),
+		AllowCIDR:           slices.Sorted(slices.Values(c.AllowCIDR)),
+		UpstreamDNS:         slices.Sorted(slices.Values(upstreamDNS)),
+		AllowHostPorts:      slices.Sorted(slices.Values(c.AllowHostPorts)),
+		VirtualHosts:        virtualHosts,
+		MaxRequestBytes:     c.MaxRequestBytes,
+		AllowPrivateNetwork: c.AllowPrivateNetwork,
+		DenyHTTP:            slices.Sorted(slices.Values(c.DenyHTTP)),
+		DenyDNS:             slices.Sorted(slices.Values(c.DenyDNS)),
+		UpstreamDoH:         slices.Sorted(slices.Values(c.UpstreamDoH)),
+	}
+	// Marshaling a struct of strings, ints and a string map cannot fail.
+	data, _ := json.Marshal(policy)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // Server runs the HTTP proxy, DNS server, and control API.
+//
+// Programs that embed the proxy create a Server with NewServerFromConfig and
+// call Run. The control API always uses mTLS and reads its credentials from
+// the environment (see LoadServerTLSConfigFromEnv).
 type Server struct {
-	config ProxyConfig
+	config       ProxyConfig
+	allowlist    *HTTPAllowlist
+	dnsAllowlist *DNSAllowlist
+	log          *LogBuffer
+	httpProxy    *HTTPProxy
+	dnsServer    *DNSServer
+	controlAPI   *ControlAPI
 }
 
+// NewServer reads a JSON ProxyConfig from configPath and creates a Server
+// with NewServerFromConfig.
 func NewServer(configPath string) (*Server, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -56,53 +169,140 @@ func NewServer(configPath string) (*Server, error) {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
-	if cfg.UpstreamDNS == "" {
-		cfg.UpstreamDNS = DefaultUpstreamDNS
-	}
-
-	return &Server{config: cfg}, nil
+	return NewServerFromConfig(cfg)
 }
 
-func (s *Server) Run(ctx context.Context) error {
-	allowlist, err := NewHTTPAllowlist(s.config.AllowHTTP)
+// NewServerFromConfig validates the config and sets up the allowlists, log
+// buffer, and services. Nothing listens until Run is called. An empty
+// UpstreamDNS defaults to DefaultUpstreamDNS, and UpstreamDoH replaces it
+// when set. The HTTP proxy and the DNS server share one UpstreamPool, so both
+// skip an upstream that failed.
+func NewServerFromConfig(cfg ProxyConfig) (*Server, error) {
+	if len(cfg.UpstreamDNS) == 0 && len(cfg.UpstreamDoH) == 0 {
+		cfg.UpstreamDNS = []string{DefaultUpstreamDNS}
+	}
+	for _, u := range cfg.UpstreamDoH {
+		if err := ValidateDoHURL(u); err != nil {
+			return nil, fmt.Errorf("upstream-doh: %w", err)
+		}
+	}
+
+	allowlist, err := NewHTTPAllowlist(cfg.AllowHTTP)
+	if err != nil {
+		return nil, fmt.Errorf("allow-http: %w", err)
+	}
+	dnsAllowlist, err := NewDNSAllowlist(cfg.AllowDNS)
 	if err != nil {
-		return fmt.Errorf("allow-http: %w", err)
+		return nil, fmt.Errorf("allow-dns: %w", err)
 	}
-	dnsAllowlist, err := NewDNSAllowlist(s.config.AllowDNS)
+	denyHTTP, err := NewHTTPAllowlist(cfg.DenyHTTP)
 	if err != nil {
-		return fmt.Errorf("allow-dns: %w", err)
+		return nil, fmt.Errorf("deny-http: %w", err)
+	}
+	denyDNS, err := NewDNSAllowlist(cfg.DenyDNS)
+	if err != nil {
+		return nil, fmt.Errorf("deny-dns: %w", err)
+	}
+	cidr := NewCIDRBlocker(cfg.BlockCIDR, cfg.AllowCIDR)
+	if cfg.AllowPrivateNetwork {
+		cidr = NewPrivateNetworkCIDRBlocker(cfg.BlockCIDR, cfg.AllowCIDR)
 	}
-	cidr := NewCIDRBlocker(s.config.BlockCIDR, s.config.AllowCIDR)
 	log := NewLogBuffer(LogBufferCapacity)
 
-	httpProxy := NewHTTPProxy(allowlist, cidr, log, s.config.UpstreamDNS)
-	dnsServer := NewDNSServer(dnsAllowlist, cidr, log, s.config.UpstreamDNS)
-	controlAPI := NewControlAPI(log, s.config, allowlist, dnsAllowlist)
+	upstreamServers := cfg.UpstreamDNS
+	if len(cfg.UpstreamDoH) > 0 {
+		upstreamServers = cfg.UpstreamDoH
+	}
+	upstreams := NewUpstreamPool(upstreamServers)
+	upstreams.SetCacheSize(cfg.DNSCacheSize)
+	httpProxy := NewHTTPProxy(allowlist, cidr, log, upstreams)
+	dnsServer := NewDNSServer(dnsAllowlist, cidr, log, upstreams)
+	controlAPI := NewControlAPI(log, cfg, allowlist, dnsAllowlist)
+	controlAPI.configHash = cfg.PolicyHash()
+	controlAPI.denyHTTP, controlAPI.denyDNS = denyHTTP, denyDNS
+	httpProxy.SetDenylist(denyHTTP)
+	dnsServer.SetDenylist(denyDNS)
 
 	// Configure host.vibepit support.
-	if proxyIP := net.ParseIP(s.config.ProxyIP); proxyIP != nil {
+	if proxyIP := net.ParseIP(cfg.ProxyIP); proxyIP != nil {
 		dnsServer.SetProxyIP(proxyIP)
 	}
-	if s.config.HostGateway != "" {
-		httpProxy.SetHostVibepit(s.config.HostGateway, s.config.AllowHostPorts)
+	if cfg.HostGateway != "" {
+		httpProxy.SetHostVibepit(cfg.HostGateway, cfg.AllowHostPorts)
+	}
+	if len(cfg.VirtualHosts) > 0 {
+		httpProxy.SetVirtualHosts(cfg.VirtualHosts)
+		dnsServer.SetVirtualHosts(slices.Collect(maps.Keys(cfg.VirtualHosts)))
 	}
+	httpProxy.SetMaxRequestBytes(cfg.MaxRequestBytes)
+
+	return &Server{
+		config:       cfg,
+		allowlist:    allowlist,
+		dnsAllowlist: dnsAllowlist,
+		log:          log,
+		httpProxy:    httpProxy,
+		dnsServer:    dnsServer,
+		controlAPI:   controlAPI,
+	}, nil
+}
+
+// Config returns the config the server was created with, including defaults.
+func (s *Server) Config() ProxyConfig {
+	return s.config
+}
 
+// LogBuffer returns the buffer that records every allow and block decision.
+func (s *Server) LogBuffer() *LogBuffer {
+	return s.log
+}
+
+// Allowlist returns the HTTP allowlist. Entries added to it take effect for
+// new requests immediately.
+func (s *Server) Allowlist() *HTTPAllowlist {
+	return s.allowlist
+}
+
+// DNSAllowlist returns the DNS allowlist. Entries added to it take effect for
+// new queries immediately.
+func (s *Server) DNSAllowlist() *DNSAllowlist {
+	return s.dnsAllowlist
+}
+
+// HTTPProxy returns the filtering HTTP proxy, for example to install a
+// DecisionHook before calling Run.
+func (s *Server) HTTPProxy() *HTTPProxy {
+	return s.httpProxy
+}
+
+// Run starts all services and blocks until ctx is canceled or one of them
+// fails.
+func (s *Server) Run(ctx context.Context) error {
 	proxyAddr := fmt.Sprintf(":%d", s.config.ProxyPort)
 	controlAddr := fmt.Sprintf(":%d", s.config.ControlAPIPort)
 	dnsAddr := fmt.Sprintf(":%d", s.dnsPort())
+
+	// Services stop on their own when runCtx is canceled; the HTTP servers
+	// are shut down explicitly below.
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
 	proxyServer := &http.Server{
 		Addr:              proxyAddr,
-		Handler:           httpProxy.Handler(),
+		Handler:           s.httpProxy.Handler(),
 		ReadHeaderTimeout: httpProxyReadHeaderTimeout,
 		IdleTimeout:       httpProxyIdleTimeout,
 	}
 	controlServer := &http.Server{
 		Addr:              controlAddr,
-		Handler:           controlAPI,
+		Handler:           s.controlAPI,
 		ReadHeaderTimeout: httpProxyReadHeaderTimeout,
 		ReadTimeout:       controlAPIReadTimeout,
 		WriteTimeout:      controlAPIWriteTimeout,
 		IdleTimeout:       httpProxyIdleTimeout,
+		// Canceling runCtx ends long-running requests like /logs/stream,
+		// which a graceful shutdown would otherwise wait for.
+		BaseContext: func(net.Listener) context.Context { return runCtx },
 	}
 
 	services := 3
@@ -110,81 +310,150 @@ func (s *Server) Run(ctx context.Context) error {
 		services++
 	}
 	errCh := make(chan error, services)
+	var wg sync.WaitGroup
 
-	go func() {
+	wg.Go(func() {
 		fmt.Printf("proxy: HTTP proxy listening on %s\n", proxyAddr)
 		if err := proxyServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
-	}()
+	})
 
-	go func() {
+	wg.Go(func() {
 		fmt.Printf("proxy: DNS server listening on %s\n", dnsAddr)
-		errCh <- dnsServer.ListenAndServe(dnsAddr)
-	}()
+		if err := s.dnsServer.ListenAndServe(runCtx, dnsAddr); err != nil {
+			errCh <- err
+		}
+	})
 
-	go func() {
+	wg.Go(func() {
 		tlsCfg, err := LoadServerTLSConfigFromEnv()
 		if err != nil {
 			errCh <- fmt.Errorf("control API TLS: %w", err)
 			return
 		}
-		fmt.Printf("proxy: control API listening on %s (mTLS)\n", controlAddr)
-		ln, err := tls.Listen("tcp", controlAddr, tlsCfg)
+		ln, addr, err := s.controlListener(controlAddr, tlsCfg)
 		if err != nil {
 			errCh <- err
 			return
 		}
+		fmt.Printf("proxy: control API listening on %s (mTLS)\n", addr)
 		if err := controlServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
-	}()
+	})
 
 	if s.config.SSHForwardAddr != "" {
-		go func() {
-			errCh <- s.runSSHForwarder(s.config.SSHForwardAddr)
-		}()
+		wg.Go(func() {
+			if err := s.runSSHForwarder(runCtx, s.config.SSHForwardAddr); err != nil {
+				errCh <- err
+			}
+		})
+	}
+
+	if s.config.AllowPrivateNetwork {
+		fmt.Println("proxy: WARNING: private network ranges are not blocked (allow-private-network)")
 	}
 
+	var err error
 	select {
-	case err := <-errCh:
-		return err
+	case err = <-errCh:
 	case <-ctx.Done():
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		proxyServer.Shutdown(shutdownCtx)   //nolint:errcheck
-		controlServer.Shutdown(shutdownCtx) //nolint:errcheck
-		return ctx.Err()
+		err = ctx.Err()
+	}
+
+	// Stop everything, also when a single service failed, so all ports are
+	// free once Run returns.
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownHTTP(shutdownCtx, proxyServer)
+	shutdownHTTP(shutdownCtx, controlServer)
+	wg.Wait()
+	return err
+}
+
+// controlListener listens for control API connections on the configured
+// unix socket, or on addr when there is none, and returns the address for
+// logging.
+func (s *Server) controlListener(addr string, tlsCfg *tls.Config) (net.Listener, string, error) {
+	path := s.config.ControlAPISocket
+	if path == "" {
+		ln, err := tls.Listen("tcp", addr, tlsCfg)
+		return ln, addr, err
+	}
+	// A restarted proxy finds the socket of its previous run.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("remove stale control socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	// The host user connecting to the socket is not the proxy user with a
+	// rootful runtime. The mounted session directory restricts access.
+	if err := os.Chmod(path, 0o666); err != nil {
+		ln.Close() //nolint:errcheck
+		return nil, "", fmt.Errorf("control socket permissions: %w", err)
+	}
+	return tls.NewListener(ln, tlsCfg), "unix:" + path, nil
+}
+
+// shutdownHTTP gracefully shuts down srv and force-closes the connections
+// that did not finish in time. Hijacked connections, such as CONNECT
+// tunnels, are not tracked by the server and are left to their clients.
+func shutdownHTTP(ctx context.Context, srv *http.Server) {
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close() //nolint:errcheck
 	}
 }
 
 // SSHForwardPort is the port the SSH forwarder listens on inside the proxy container.
 const SSHForwardPort = 2222
 
-// runSSHForwarder accepts TCP connections and forwards them to the sandbox SSH server.
-func (s *Server) runSSHForwarder(targetAddr string) error {
+// runSSHForwarder accepts TCP connections and forwards them to the sandbox SSH
+// server until ctx is canceled. Open connections are closed on cancel.
+func (s *Server) runSSHForwarder(ctx context.Context, targetAddr string) error {
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", SSHForwardPort))
 	if err != nil {
 		return fmt.Errorf("ssh forwarder listen: %w", err)
 	}
 	fmt.Printf("proxy: SSH forwarder listening on :%d -> %s\n", SSHForwardPort, targetAddr)
+
+	defer ln.Close() //nolint:errcheck
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	stop := context.AfterFunc(ctx, func() { ln.Close() }) //nolint:errcheck
+	defer stop()
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			return fmt.Errorf("ssh forwarder accept: %w", err)
 		}
-		go forwardTCP(conn, targetAddr)
+		wg.Go(func() { forwardTCP(ctx, conn, targetAddr) })
 	}
 }
 
-func forwardTCP(client net.Conn, targetAddr string) {
+func forwardTCP(ctx context.Context, client net.Conn, targetAddr string) {
 	defer client.Close() //nolint:errcheck
-	target, err := net.Dial("tcp", targetAddr)
+	var d net.Dialer
+	target, err := d.DialContext(ctx, "tcp", targetAddr)
 	if err != nil {
 		return
 	}
 	defer target.Close() //nolint:errcheck
 
+	// Closing both ends unblocks the copies below when the server stops.
+	stop := context.AfterFunc(ctx, func() {
+		client.Close() //nolint:errcheck
+		target.Close() //nolint:errcheck
+	})
+	defer stop()
+
 	done := make(chan struct{}, 2)
 	go func() {
 		io.Copy(target, client) //nolint:errcheck
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServerFromConfig(t *testing.T) {
+	t.Run("sets up allowlists and log buffer", func(t *testing.T) {
+		srv, err := NewServerFromConfig(ProxyConfig{
+			AllowHTTP: []string{"github.com:443"},
+			AllowDNS:  []string{"example.com"},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{DefaultUpstreamDNS}, srv.Config().UpstreamDNS)
+		assert.True(t, srv.Allowlist().Allows("github.com", "443"))
+		assert.True(t, srv.DNSAllowlist().Allows("example.com"))
+		require.NotNil(t, srv.LogBuffer())
+		assert.Empty(t, srv.LogBuffer().Entries())
+	})
+
+	t.Run("proxy decisions go to the shared log buffer", func(t *testing.T) {
+		srv, err := NewServerFromConfig(ProxyConfig{})
+		require.NoError(t, err)
+
+		assert.Equal(t, ActionBlock, srv.httpProxy.checkRequest("github.com", "443", requestInfo{}).action)
+		entries := srv.LogBuffer().Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, "github.com", entries[0].Domain)
+	})
+
+	t.Run("applies dns-cache-size", func(t *testing.T) {
+		srv, err := NewServerFromConfig(ProxyConfig{DNSCacheSize: 64})
+		require.NoError(t, err)
+		assert.Equal(t, 64, srv.httpProxy.upstreams.cache.size)
+	})
+
+	t.Run("rejects invalid entries", func(t *testing.T) {
+		_, err := NewServerFromConfig(ProxyConfig{AllowHTTP: []string{"github.com"}})
+		assert.ErrorContains(t, err, "allow-http")
+
+		_, err = NewServerFromConfig(ProxyConfig{AllowDNS: []string{"*"}})
+		assert.ErrorContains(t, err, "allow-dns")
+
+		_, err = NewServerFromConfig(ProxyConfig{UpstreamDoH: []string{"https://dns.example.com/dns-query"}})
+		assert.ErrorContains(t, err, "upstream-doh")
+	})
+
+	t.Run("allow-private-network stops blocking private ranges", func(t *testing.T) {
+		srv, err := NewServerFromConfig(ProxyConfig{AllowPrivateNetwork: true, BlockCIDR: []string{"10.9.0.0/16"}})
+		require.NoError(t, err)
+		assert.False(t, srv.httpProxy.cidr.IsBlocked(net.ParseIP("192.168.1.20")))
+		assert.True(t, srv.httpProxy.cidr.IsBlocked(net.ParseIP("10.9.0.1")))
+		assert.True(t, srv.httpProxy.cidr.IsBlocked(net.ParseIP("169.254.169.254")))
+	})
+
+	t.Run("records the config hash", func(t *testing.T) {
+		cfg := ProxyConfig{AllowHTTP: []string{"github.com:443"}}
+		srv, err := NewServerFromConfig(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, cfg.PolicyHash(), srv.controlAPI.configHash)
+	})
+}
+
+func TestProxyConfigPolicyHash(t *testing.T) {
+	base := ProxyConfig{
+		AllowHTTP: []string{"github.com:443", "example.com:443"},
+		AllowDNS:  []string{"internal.example.com"},
+		BlockCIDR: []string{"10.0.0.0/8"},
+	}
+
+	t.Run("ignores order, runtime settings and comments", func(t *testing.T) {
+		other := ProxyConfig{
+			AllowHTTP:      []string{"example.com:443", "github.com:443"},
+			AllowDNS:       []string{"internal.example.com"},
+			BlockCIDR:      []string{"10.0.0.0/8"},
+			UpstreamDNS:    []string{DefaultUpstreamDNS},
+			ProxyIP:        "172.20.0.2",
+			ProxyPort:      54321,
+			ControlAPIPort: 54322,
+			VirtualHosts:   map[string]string{},
+			EntryComments:  map[string]string{"github.com:443": "code hosting"},
+		}
+		assert.Equal(t, base.PolicyHash(), other.PolicyHash())
+	})
+
+	t.Run("changes with the policy", func(t *testing.T) {
+		other := base
+		other.AllowHTTP = []string{"github.com:443"}
+		assert.NotEqual(t, base.PolicyHash(), other.PolicyHash())
+
+		other = base
+		other.MaxRequestBytes = 1 << 20
+		assert.NotEqual(t, base.PolicyHash(), other.PolicyHash())
+
+		other = base
+		other.UpstreamDNS = []string{DefaultUpstreamDNS, "1.1.1.1:53"}
+		assert.NotEqual(t, base.PolicyHash(), other.PolicyHash())
+
+		other = base
+		other.DenyHTTP = []string{"pastebin.com:*"}
+		assert.NotEqual(t, base.PolicyHash(), other.PolicyHash())
+
+		other = base
+		other.UpstreamDoH = []string{"https://1.1.1.1/dns-query"}
+		assert.NotEqual(t, base.PolicyHash(), other.PolicyHash())
+	})
+}
+
+func TestNewServer(t *testing.T) {
+	t.Run("reads the config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"allow-http":["github.com:443"],"upstream-dns":["10.0.0.53:53"]}`), 0o600))
+
+		srv, err := NewServer(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.53:53"}, srv.Config().UpstreamDNS)
+		assert.True(t, srv.Allowlist().Allows("github.com", "443"))
+	})
+
+	t.Run("reports a missing file", func(t *testing.T) {
+		_, err := NewServer(filepath.Join(t.TempDir(), "missing.json"))
+		assert.ErrorContains(t, err, "read config")
+	})
+}
+
+func TestServerRunShutdown(t *testing.T) {
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 10 * time.Minute})
+	require.NoError(t, err)
+	t.Setenv(EnvProxyTLSKey, string(creds.ServerKeyPEM()))
+	t.Setenv(EnvProxyTLSCert, string(creds.ServerCertPEM()))
+	t.Setenv(EnvProxyCACert, string(creds.CACertPEM()))
+
+	freePort := func(t *testing.T) int {
+		t.Helper()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		return ln.Addr().(*net.TCPAddr).Port
+	}
+	cfg := ProxyConfig{
+		ProxyPort:      freePort(t),
+		ControlAPIPort: freePort(t),
+		DNSPort:        freePort(t),
+	}
+	srv, err := NewServerFromConfig(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	for _, port := range []int{cfg.ProxyPort, cfg.ControlAPIPort, cfg.DNSPort} {
+		require.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		}, 5*time.Second, 10*time.Millisecond, "port %d not listening", port)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(shutdownTimeout + 2*time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// All ports must be free again once Run has returned.
+	for _, port := range []int{cfg.ProxyPort, cfg.ControlAPIPort, cfg.DNSPort} {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		require.NoError(t, err, "tcp port %d still in use", port)
+		ln.Close()
+	}
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", cfg.DNSPort))
+	require.NoError(t, err, "udp port %d still in use", cfg.DNSPort)
+	pc.Close()
+}
+
+func TestControlListenerUnixSocket(t *testing.T) {
+	creds, err := GenerateMTLSCredentials(MTLSOptions{Lifetime: 10 * time.Minute})
+	require.NoError(t, err)
+	tlsCfg, err := creds.ServerTLSConfig()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	// A socket file left behind by a previous run must not block the listener.
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	srv := &Server{config: ProxyConfig{ControlAPISocket: path}}
+	ln, addr, err := srv.controlListener(":0", tlsCfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	assert.Equal(t, "unix:"+path, addr)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0o666), info.Mode().Perm())
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	// upstreamTimeout bounds a single query to one upstream DNS server.
+	upstreamTimeout = 2 * time.Second
+	// upstreamRetryAfter is how long a failed upstream is skipped before it
+	// gets another chance.
+	upstreamRetryAfter = 30 * time.Second
+)
+
+// UpstreamPool hands out upstream DNS servers round-robin and tracks their
+// health passively: a server that fails a query is demoted and only tried
+// after the healthy ones until upstreamRetryAfter has passed. Answers are
+// cached for their TTL, shared by the DNS server and the HTTP proxy's CIDR
+// check. Names in the hosts file are answered from there first.
+type UpstreamPool struct {
+	mu        sync.Mutex
+	servers   []string
+	next      int
+	downUntil map[string]time.Time
+	now       func() time.Time
+	cache     *dnsCache
+	doh       *http.Client
+
+	hostsPath string
+	hostsOnce sync.Once
+	hosts     map[string][]net.IP
+}
+
+// NewUpstreamPool creates a pool for the given servers. A server is either
+// "host:port" for plain DNS or an https:// URL for DNS-over-HTTPS. An empty
+// list falls back to DefaultUpstreamDNS.
+func NewUpstreamPool(servers []string) *UpstreamPool {
+	if len(servers) == 0 {
+		servers = []string{DefaultUpstreamDNS}
+	}
+	return &UpstreamPool{
+		servers:   servers,
+		downUntil: make(map[string]time.Time),
+		now:       time.Now,
+		cache:     newDNSCache(dnsCacheSize),
+		doh:       newDoHClient(),
+		hostsPath: hostsFile,
+	}
+}
+
+// order returns the servers to try for one query: healthy servers first,
+// starting at the round-robin position, then the demoted ones as a last
+// resort.
+func (p *UpstreamPool) order() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	start := p.next
+	p.next = (p.next + 1) % len(p.servers)
+
+	now := p.now()
+	healthy := make([]string, 0, len(p.servers))
+	var demoted []string
+	for i := range p.servers {
+		server := p.servers[(start+i)%len(p.servers)]
+		if now.Before(p.downUntil[server]) {
+			demoted = append(demoted, server)
+		} else {
+			healthy = append(healthy, server)
+		}
+	}
+	return append(healthy, demoted...)
+}
+
+func (p *UpstreamPool) markFailed(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.now().Before(p.downUntil[server]) {
+		return
+	}
+	p.downUntil[server] = p.now().Add(upstreamRetryAfter)
+	fmt.Printf("proxy: upstream DNS %s failed, retrying it in %s\n", server, upstreamRetryAfter)
+}
+
+func (p *UpstreamPool) markOK(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.downUntil, server)
+}
+
+// exchange answers m from the cache or sends it to the upstream servers in
+// turn until one answers. It returns the response together with the server
+// that served it.
+func (p *UpstreamPool) exchange(ctx context.Context, m *mdns.Msg) (*mdns.Msg, string, error) {
+	if resp, server, ok := p.cache.get(m); ok {
+		return resp, server, nil
+	}
+	c := &mdns.Client{Timeout: upstreamTimeout}
+	var errs []error
+	for _, server := range p.order() {
+		var resp *mdns.Msg
+		var err error
+		if isDoH(server) {
+			resp, err = dohExchange(ctx, p.doh, server, m)
+		} else {
+			resp, _, err = c.ExchangeContext(ctx, m, server)
+		}
+		if err == nil {
+			p.markOK(server)
+			p.cache.put(m, resp, server)
+			return resp, server, nil
+		}
+		p.markFailed(server)
+		errs = append(errs, fmt.Errorf("%s: %w", server, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// lookupHosts returns the addresses of host in the hosts file. The file is
+// read once; the container runtime writes it before the proxy starts. A
+// missing or unreadable file counts as empty.
+func (p *UpstreamPool) lookupHosts(host string) []net.IP {
+	p.hostsOnce.Do(func() {
+		if data, err := os.ReadFile(p.hostsPath); err == nil {
+			p.hosts = parseHosts(data)
+		}
+	})
+	return p.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+// lookupIP resolves host from the hosts file, or else the A and AAAA records
+// of host through exchange. It returns an error when neither query yields an
+// address.
+func (p *UpstreamPool) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ips := p.lookupHosts(host); len(ips) > 0 {
+		return ips, nil
+	}
+	var ips []net.IP
+	var errs []error
+	for _, qtype := range []uint16{mdns.TypeA, mdns.TypeAAAA} {
+		m := new(mdns.Msg)
+		m.SetQuestion(mdns.Fqdn(host), qtype)
+		resp, _, err := p.exchange(ctx, m)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch v := rr.(type) {
+			case *mdns.A:
+				ips = append(ips, v.A)
+			case *mdns.AAAA:
+				ips = append(ips, v.AAAA)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return ips, nil
+}
+
+// SetCacheSize replaces the answer cache with an empty one that holds up to
+// size answers. A size of zero or less keeps dnsCacheSize. Call it before the
+// pool serves queries.
+func (p *UpstreamPool) SetCacheSize(size int) {
+	if size <= 0 {
+		size = dnsCacheSize
+	}
+	p.cache = newDNSCache(size)
+}
+
+// approvedIPsKey is the context key of withApprovedIPs.
+type approvedIPsKey struct{}
+
+type approvedIPs struct {
+	host string
+	ips  []net.IP
+}
+
+// withApprovedIPs returns a context that makes dialContext connect host to
+// ips instead of resolving it again. A second lookup may return a different
+// answer than the one the CIDR check approved, which reopens DNS rebinding.
+func withApprovedIPs(ctx context.Context, host string, ips []net.IP) context.Context {
+	return context.WithValue(ctx, approvedIPsKey{}, approvedIPs{host: host, ips: ips})
+}
+
+// dialContext connects to addr. The host is dialed at the addresses from
+// withApprovedIPs, or else resolved through lookupIP. The addresses are tried
+// in turn until one accepts the connection.
+func (p *UpstreamPool) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	var ips []net.IP
+	if approved, ok := ctx.Value(approvedIPsKey{}).(approvedIPs); ok && strings.EqualFold(approved.host, host) {
+		ips = approved.ips
+	} else if ips, err = p.lookupIP(ctx, host); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
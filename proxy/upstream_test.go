@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpstream starts a UDP DNS server that answers every A query with ip.
+func fakeUpstream(t *testing.T, ip string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP(ip),
+		})
+		w.WriteMsg(m)
+	})}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// deadUpstream returns the address of a closed UDP port, so queries to it
+// fail right away.
+func deadUpstream(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	return addr
+}
+
+func TestUpstreamPool(t *testing.T) {
+	t.Run("defaults to the default upstream", func(t *testing.T) {
+		assert.Equal(t, []string{DefaultUpstreamDNS}, NewUpstreamPool(nil).order())
+	})
+
+	t.Run("rotates through the servers", func(t *testing.T) {
+		p := NewUpstreamPool([]string{"a:53", "b:53", "c:53"})
+		assert.Equal(t, []string{"a:53", "b:53", "c:53"}, p.order())
+		assert.Equal(t, []string{"b:53", "c:53", "a:53"}, p.order())
+		assert.Equal(t, []string{"c:53", "a:53", "b:53"}, p.order())
+		assert.Equal(t, []string{"a:53", "b:53", "c:53"}, p.order())
+	})
+
+	t.Run("tries a failed server last until its retry time", func(t *testing.T) {
+		now := time.Now()
+		p := NewUpstreamPool([]string{"a:53", "b:53"})
+		p.now = func() time.Time { return now }
+
+		p.markFailed("a:53")
+		assert.Equal(t, []string{"b:53", "a:53"}, p.order())
+		assert.Equal(t, []string{"b:53", "a:53"}, p.order())
+
+		now = now.Add(upstreamRetryAfter)
+		assert.Equal(t, []string{"a:53", "b:53"}, p.order())
+	})
+
+	t.Run("a successful query restores a server", func(t *testing.T) {
+		p := NewUpstreamPool([]string{"a:53", "b:53"})
+		p.markFailed("a:53")
+		p.markOK("a:53")
+		assert.Equal(t, []string{"a:53", "b:53"}, p.order())
+	})
+
+	t.Run("exchange fails over to the next server", func(t *testing.T) {
+		dead := deadUpstream(t)
+		alive := fakeUpstream(t, "93.184.216.34")
+		p := NewUpstreamPool([]string{dead, alive})
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		resp, server, err := p.exchange(context.Background(), m)
+		require.NoError(t, err)
+		assert.Equal(t, alive, server)
+		require.Len(t, resp.Answer, 1)
+
+		// The dead server is demoted, so the next query skips it.
+		assert.Equal(t, []string{alive, dead}, p.order())
+	})
+
+	t.Run("exchange reports every failed server", func(t *testing.T) {
+		dead1, dead2 := deadUpstream(t), deadUpstream(t)
+		p := NewUpstreamPool([]string{dead1, dead2})
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		_, _, err := p.exchange(context.Background(), m)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), dead1)
+		assert.Contains(t, err.Error(), dead2)
+	})
+}
+
+func TestDNSServerUpstreams(t *testing.T) {
+	al, err := NewDNSAllowlist([]string{"example.com"})
+	require.NoError(t, err)
+
+	query := func(t *testing.T, upstreams []string) (*dns.Msg, *LogBuffer) {
+		t.Helper()
+		log := NewLogBuffer(100)
+		srv := NewDNSServer(al, NewCIDRBlocker(nil, nil), log, NewUpstreamPool(upstreams))
+		addr, cleanup := srv.ListenAndServeTest()
+		t.Cleanup(cleanup)
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		r, _, err := new(dns.Client).Exchange(m, addr)
+		require.NoError(t, err)
+		return r, log
+	}
+
+	t.Run("logs the upstream that answered", func(t *testing.T) {
+		alive := fakeUpstream(t, "93.184.216.34")
+		r, log := query(t, []string{deadUpstream(t), alive})
+
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		entries := log.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, ActionAllow, entries[0].Action)
+		assert.Equal(t, alive, entries[0].Upstream)
+	})
+
+	t.Run("blocks private answers from any upstream", func(t *testing.T) {
+		r, log := query(t, []string{deadUpstream(t), fakeUpstream(t, "10.0.0.1")})
+
+		assert.Equal(t, dns.RcodeNameError, r.Rcode)
+		entries := log.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, ActionBlock, entries[0].Action)
+	})
+
+	t.Run("fails when no upstream answers", func(t *testing.T) {
+		r, _ := query(t, []string{deadUpstream(t)})
+		assert.Equal(t, dns.RcodeServerFailure, r.Rcode)
+	})
+}
+
+func TestUpstreamPoolDialsApprovedIPs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	addr := net.JoinHostPort("backend.example.com", port)
+
+	// The dead upstream makes any second lookup fail.
+	p := NewUpstreamPool([]string{deadUpstream(t)})
+
+	ctx := withApprovedIPs(context.Background(), "Backend.example.com", []net.IP{net.ParseIP("127.0.0.1")})
+	conn, err := p.dialContext(ctx, "tcp", addr)
+	require.NoError(t, err)
+	conn.Close()
+
+	ctx = withApprovedIPs(context.Background(), "other.example.com", []net.IP{net.ParseIP("127.0.0.1")})
+	_, err = p.dialContext(ctx, "tcp", addr)
+	assert.Error(t, err, "approval for another host must not be used")
+}
@@ -160,7 +160,11 @@ func renderCompactHeader(info *HeaderInfo, width int) string {
 
 // PrintHeader prints a branding header (wordmark + tagline) to stdout.
 // It detects terminal size and uses the compact layout on short terminals.
+// Nothing is printed when the status format is not StatusLines.
 func PrintHeader() {
+	if Quiet() {
+		return
+	}
 	width, height, err := term.GetSize(int(os.Stdout.Fd()))
 	width, height = normalizeBannerSize(width, height, err)
 	writeBanner(os.Stdout, width, height)
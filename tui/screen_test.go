@@ -1,9 +1,11 @@
 package tui
 
 import (
+	"strings"
 	"testing"
 
 	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,6 +22,16 @@ func (s *stubScreen) View(w *Window) string            { return "stub" }
 func (s *stubScreen) FooterKeys(w *Window) []FooterKey { return nil }
 func (s *stubScreen) FooterStatus(w *Window) string    { return "" }
 
+// keysScreen returns a fixed set of footer keys.
+type keysScreen struct {
+	keys []FooterKey
+}
+
+func (s *keysScreen) Update(msg tea.Msg, w *Window) (Screen, tea.Cmd) { return s, nil }
+func (s *keysScreen) View(w *Window) string                           { return "" }
+func (s *keysScreen) FooterKeys(w *Window) []FooterKey                { return s.keys }
+func (s *keysScreen) FooterStatus(w *Window) string                   { return "" }
+
 // switchScreen returns a different Screen from Update.
 type switchScreen struct {
 	target Screen
@@ -78,3 +90,19 @@ func TestWindow_ScreenSwitch(t *testing.T) {
 	win := updated.(*Window)
 	assert.IsType(t, &stubScreen{}, win.screen)
 }
+
+func TestWindow_FooterDropsKeysThatDontFit(t *testing.T) {
+	s := &keysScreen{keys: []FooterKey{
+		{Key: "a", Desc: "allow"},
+		{Key: "b", Desc: strings.Repeat("x", 40)},
+		{Key: "c", Desc: "config"},
+	}}
+	w := NewWindow(&HeaderInfo{ProjectDir: "/test", SessionID: "abc123"}, s)
+	w.Update(tea.WindowSizeMsg{Width: 40, Height: 24})
+
+	footer := ansi.Strip(w.renderFooter())
+	assert.Contains(t, footer, "a allow")
+	assert.NotContains(t, footer, "b x")
+	assert.NotContains(t, footer, "c config")
+	assert.True(t, strings.HasSuffix(footer, "q quit"), footer)
+}
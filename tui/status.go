@@ -1,37 +1,203 @@
 package tui
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"charm.land/lipgloss/v2"
+	"golang.org/x/term"
 )
 
+// SpinnerFrames are the glyphs cycled by spinners in the TUI and status output.
+var SpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 100 * time.Millisecond
+
 var (
 	statusStyle = lipgloss.NewStyle().Bold(true).Foreground(ColorCyan)
 	errorStyle  = lipgloss.NewStyle().Bold(true).Foreground(ColorOrange)
 	debugStyle  = lipgloss.NewStyle().Bold(true).Foreground(ColorPurple)
 )
 
-func writeStatus(w io.Writer, verb string, style lipgloss.Style, format string, args ...any) {
+// StatusFormat selects how Status, Warn, Error, StartSpinner and PrintHeader
+// report progress.
+type StatusFormat string
+
+const (
+	// StatusLines prints the human readable status lines. It is the default.
+	StatusLines StatusFormat = "lines"
+	// StatusNone prints nothing but warnings and errors.
+	StatusNone StatusFormat = "none"
+	// StatusJSON writes one JSON object per status line to stderr, for
+	// wrappers that parse the progress.
+	StatusJSON StatusFormat = "json"
+)
+
+var statusFormat = StatusLines
+
+// SetStatusFormat switches the status output format. Call it before any
+// output is written.
+func SetStatusFormat(f StatusFormat) error {
+	switch f {
+	case StatusLines, StatusNone, StatusJSON:
+		statusFormat = f
+		return nil
+	}
+	return fmt.Errorf("unknown status format %q, use %s, %s or %s", f, StatusLines, StatusNone, StatusJSON)
+}
+
+// Quiet reports whether the status format suppresses human readable output
+// like banners and progress bars.
+func Quiet() bool {
+	return statusFormat != StatusLines
+}
+
+// statusEvent is the JSON form of a status line.
+type statusEvent struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+}
+
+// writeEvent writes a status line as a JSON object. The event is the verb in
+// lower case with dashes, e.g. "starting" or "would-allow".
+func writeEvent(w io.Writer, level, verb string, format string, args ...any) {
+	data, err := json.Marshal(statusEvent{
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Event:   strings.ReplaceAll(strings.ToLower(strings.TrimSpace(verb)), " ", "-"),
+		Message: fmt.Sprintf(format, args...),
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
+
+// report writes a status line in the current format. Info lines are dropped
+// by StatusNone; warnings and errors are always written.
+func report(w io.Writer, level, verb string, style lipgloss.Style, format string, args ...any) {
+	switch statusFormat {
+	case StatusJSON:
+		writeEvent(os.Stderr, level, verb, format, args...)
+	case StatusNone:
+		if level != "info" {
+			writeStatus(w, verb, style, format, args...)
+		}
+	default:
+		writeStatus(w, verb, style, format, args...)
+	}
+}
+
+func formatStatus(verb string, style lipgloss.Style, format string, args ...any) string {
 	padded := fmt.Sprintf("%12s", verb)
 	styled := style.Render(padded)
 	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(w, "%s %s\n", styled, msg)
+	return styled + " " + msg
+}
+
+func writeStatus(w io.Writer, verb string, style lipgloss.Style, format string, args ...any) {
+	fmt.Fprintln(w, formatStatus(verb, style, format, args...))
 }
 
 // Status prints a right-aligned bold cyan verb followed by a message to stdout.
 func Status(verb string, format string, args ...any) {
-	writeStatus(os.Stdout, verb, statusStyle, format, args...)
+	report(os.Stdout, "info", verb, statusStyle, format, args...)
 }
 
 // Error prints a right-aligned bold orange "error" followed by a message to stderr.
 func Error(format string, args ...any) {
-	writeStatus(os.Stderr, "error", errorStyle, format, args...)
+	report(os.Stderr, "error", "error", errorStyle, format, args...)
+}
+
+// Warn prints a right-aligned bold orange "warning" followed by a message to stderr.
+func Warn(format string, args ...any) {
+	report(os.Stderr, "warning", "warning", errorStyle, format, args...)
+}
+
+// debugOutput is set by SetDebug.
+var debugOutput bool
+
+// SetDebug tells the package that Debug lines may be printed. Spinners then
+// don't animate, the debug lines would land inside the spinner line.
+func SetDebug(on bool) {
+	debugOutput = on
 }
 
 // Debug prints a right-aligned bold purple "debug" followed by a message to stdout.
 func Debug(format string, args ...any) {
 	writeStatus(os.Stdout, "debug", debugStyle, format, args...)
 }
+
+// Spinner animates a glyph after a status line while a blocking step runs.
+type Spinner struct {
+	w    io.Writer
+	line string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartSpinner prints a status line like Status and animates a spinner after
+// it until Stop is called. When stdout is not a terminal, debug output is on,
+// or the status format is not StatusLines, it reports the line like Status
+// and does not animate.
+func StartSpinner(verb string, format string, args ...any) *Spinner {
+	if Quiet() {
+		Status(verb, format, args...)
+		return &Spinner{}
+	}
+	return startSpinner(os.Stdout, animateSpinner(term.IsTerminal(int(os.Stdout.Fd()))), verb, statusStyle, format, args...)
+}
+
+// animateSpinner reports whether a spinner on a terminal (or not) animates.
+func animateSpinner(terminal bool) bool {
+	return terminal && !debugOutput
+}
+
+func startSpinner(w io.Writer, animate bool, verb string, style lipgloss.Style, format string, args ...any) *Spinner {
+	s := &Spinner{w: w, line: formatStatus(verb, style, format, args...)}
+	if !animate {
+		fmt.Fprintln(w, s.line)
+		return s
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+	return s
+}
+
+func (s *Spinner) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	glyph := lipgloss.NewStyle().Foreground(ColorCyan)
+	for frame := 0; ; frame++ {
+		fmt.Fprintf(s.w, "\r%s %s", s.line, glyph.Render(SpinnerFrames[frame%len(SpinnerFrames)]))
+		select {
+		case <-s.stop:
+			// Redraw without the glyph and clear the rest of the line.
+			fmt.Fprintf(s.w, "\r%s\x1b[K\n", s.line)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop ends the animation and leaves the plain status line behind. It is safe
+// to call more than once.
+func (s *Spinner) Stop() {
+	if s.stop == nil {
+		return
+	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
@@ -2,10 +2,14 @@ package tui
 
 import (
 	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 
 	"charm.land/lipgloss/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWriteStatus(t *testing.T) {
@@ -87,3 +91,93 @@ func TestWriteStatus_UnstyledHasNoANSI(t *testing.T) {
 
 	assert.Equal(t, "    Creating network vibepit-abc\n", buf.String())
 }
+
+func TestSpinner(t *testing.T) {
+	plain := lipgloss.NewStyle()
+
+	t.Run("prints a plain status line when not animating", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := startSpinner(&buf, false, "Creating", plain, "network %s", "vibepit-1")
+		s.Stop()
+		s.Stop()
+		assert.Equal(t, "    Creating network vibepit-1\n", buf.String())
+	})
+
+	t.Run("animates and leaves the status line behind", func(t *testing.T) {
+		var buf syncBuffer
+		s := startSpinner(&buf, true, "Creating", plain, "network %s", "vibepit-1")
+		s.Stop()
+		s.Stop()
+
+		out := buf.String()
+		assert.Contains(t, out, "\r    Creating network vibepit-1 ")
+		assert.Contains(t, out, SpinnerFrames[0])
+		assert.True(t, strings.HasSuffix(out, "\r    Creating network vibepit-1\x1b[K\n"), "got %q", out)
+	})
+
+	t.Run("does not animate with debug output", func(t *testing.T) {
+		t.Cleanup(func() { SetDebug(false) })
+		assert.True(t, animateSpinner(true))
+		assert.False(t, animateSpinner(false))
+		SetDebug(true)
+		assert.False(t, animateSpinner(true))
+	})
+}
+
+func TestStatusFormat(t *testing.T) {
+	plain := lipgloss.NewStyle()
+	t.Cleanup(func() { statusFormat = StatusLines })
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		assert.ErrorContains(t, SetStatusFormat("yaml"), "unknown status format")
+		assert.Equal(t, StatusLines, statusFormat)
+	})
+
+	t.Run("none drops info lines but keeps warnings", func(t *testing.T) {
+		require.NoError(t, SetStatusFormat(StatusNone))
+		assert.True(t, Quiet())
+
+		var buf bytes.Buffer
+		report(&buf, "info", "Starting", plain, "proxy container")
+		report(&buf, "warning", "warning", plain, "private network ranges are NOT blocked")
+		assert.Equal(t, "     warning private network ranges are NOT blocked\n", buf.String())
+	})
+
+	t.Run("json events", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeEvent(&buf, "info", "Would allow", "%s", "api.example.com:443")
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+		assert.Equal(t, "info", event["level"])
+		assert.Equal(t, "would-allow", event["event"])
+		assert.Equal(t, "api.example.com:443", event["message"])
+		assert.NotEmpty(t, event["time"])
+		assert.True(t, strings.HasSuffix(buf.String(), "}\n"), "one object per line")
+	})
+
+	t.Run("spinners do not animate", func(t *testing.T) {
+		require.NoError(t, SetStatusFormat(StatusNone))
+		s := StartSpinner("Creating", "network")
+		assert.Nil(t, s.stop)
+		s.Stop()
+	})
+}
+
+// syncBuffer is a bytes.Buffer safe for use from the spinner goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
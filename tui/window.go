@@ -157,18 +157,25 @@ func (w *Window) renderFooter() string {
 		left = screenStatus + windowStatus
 	}
 
-	// Right: screen keys + base keys
+	// Right: screen keys + base keys. Screen keys that don't fit are
+	// dropped from the end so the quit key always stays visible.
+	leftWidth := ansi.StringWidth(left)
+	quit := keyStyle.Render("q") + " " + descStyle.Render("quit")
+	avail := w.width - leftWidth - 2 - ansi.StringWidth(quit)
+
 	var keys []string
 	for _, fk := range w.screen.FooterKeys(w) {
-		keys = append(keys, keyStyle.Render(fk.Key)+" "+descStyle.Render(fk.Desc))
+		key := keyStyle.Render(fk.Key) + " " + descStyle.Render(fk.Desc)
+		width := ansi.StringWidth(key) + 2
+		if width > avail {
+			break
+		}
+		avail -= width
+		keys = append(keys, key)
 	}
-	keys = append(keys,
-		keyStyle.Render("q")+" "+descStyle.Render("quit"),
-	)
+	keys = append(keys, quit)
 
 	right := strings.Join(keys, "  ")
-
-	leftWidth := ansi.StringWidth(left)
 	rightWidth := ansi.StringWidth(right)
 	gap := max(w.width-leftWidth-rightWidth, 2)
 